@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jossecurity/joss/pkg/core"
+)
+
+// backupArgs are the flags of db:backup and db:restore
+type backupArgs struct {
+	opts       core.BackupOptions
+	connection string
+	retention  core.BackupRetention
+	files      []string
+}
+
+func parseBackupArgs(args []string) backupArgs {
+	parsed := backupArgs{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !strings.HasPrefix(arg, "--") {
+			parsed.files = append(parsed.files, arg)
+			continue
+		}
+		// "--flag value" as well as "--flag=value"
+		if !hasValue && name != "gzip" && i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "gzip":
+			parsed.opts.Gzip = true
+		case "format":
+			parsed.opts.Format = value
+		case "tables":
+			parsed.opts.Tables = strings.Split(value, ",")
+		case "path":
+			parsed.opts.Path = value
+		case "connection":
+			parsed.connection = value
+		case "keep":
+			parsed.retention.Keep, _ = strconv.Atoi(value)
+		case "keep-days":
+			parsed.retention.KeepDays, _ = strconv.Atoi(value)
+		default:
+			fmt.Printf("Opción desconocida: %s\n", arg)
+			os.Exit(1)
+		}
+	}
+	return parsed
+}
+
+// runDBBackup writes a backup of the database (joss db:backup)
+func runDBBackup(args []string) {
+	parsed := parseBackupArgs(args)
+	db, driver, env, err := openSchemaDB(parsed.connection)
+	if err != nil {
+		fmt.Printf("Error conectando a la base de datos: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	result, err := core.WriteBackup(db, driver, envPrefix(env), parsed.opts)
+	if err != nil {
+		fmt.Printf("Error creando el respaldo: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Respaldo creado: %s (%s, %d tablas, %d filas)\n", result.Path, result.Format, result.Tables, result.Rows)
+
+	if parsed.opts.Path == "" {
+		for _, name := range core.PruneBackups(core.DefaultBackupDir, parsed.retention) {
+			fmt.Printf("Eliminado por retención: %s\n", name)
+		}
+	}
+}
+
+// runDBRestore loads a backup into the database (joss db:restore)
+func runDBRestore(args []string) {
+	parsed := parseBackupArgs(args)
+	if len(parsed.files) != 1 {
+		fmt.Println("Uso: joss db:restore [archivo] [--connection=nombre]")
+		if backups := core.ListBackups(core.DefaultBackupDir); len(backups) > 0 {
+			fmt.Printf("Respaldos en %s:\n", core.DefaultBackupDir)
+			for _, name := range backups {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+		return
+	}
+
+	path := parsed.files[0]
+	if _, err := os.Stat(path); err != nil {
+		// Bare names refer to storage/backups
+		if _, err := os.Stat(core.DefaultBackupDir + "/" + path); err == nil {
+			path = core.DefaultBackupDir + "/" + path
+		}
+	}
+
+	db, driver, env, err := openSchemaDB(parsed.connection)
+	if err != nil {
+		fmt.Printf("Error conectando a la base de datos: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	fmt.Printf("Restaurando %s...\n", path)
+	result, err := core.RestoreBackup(db, driver, envPrefix(env), path)
+	if err != nil {
+		fmt.Printf("Error restaurando el respaldo: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Restauración completada (%s, %d tablas, %d filas)\n", result.Format, result.Tables, result.Rows)
+}
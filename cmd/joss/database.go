@@ -13,26 +13,26 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-func changeDatabaseEngine(target string) {
+// changeDatabaseEngine copies the data to target and points env.joss at it;
+// it returns false (and leaves env.joss untouched) when the copy fails
+func changeDatabaseEngine(target string) bool {
 	fmt.Printf("Cambiando motor de base de datos a: %s\n", target)
 
 	// 1. Read current env
 	envMap := readEnvFile(GetEnvFile())
-	currentDB := envMap["DB"]
-	if currentDB == "" {
-		currentDB = "mysql" // Default
-	}
+	currentDB := core.NormalizeDriver(envMap["DB"]) // Default mysql
+	target = core.NormalizeDriver(target)
 
 	if currentDB == target {
 		fmt.Println("El motor de base de datos ya es " + target)
-		return
+		return true
 	}
 
 	// 2. Connect to Source
 	srcDB, err := connectToDB(currentDB, envMap)
 	if err != nil {
 		fmt.Printf("Error conectando a origen (%s): %v\n", currentDB, err)
-		return
+		return false
 	}
 	defer srcDB.Close()
 
@@ -40,7 +40,7 @@ func changeDatabaseEngine(target string) {
 	destDB, err := connectToDB(target, envMap)
 	if err != nil {
 		fmt.Printf("Error conectando a destino (%s): %v\n", target, err)
-		return
+		return false
 	}
 	defer destDB.Close()
 
@@ -63,7 +63,7 @@ func changeDatabaseEngine(target string) {
 	destRt.EnsureCronTable()
 
 	// Run User Migrations
-	performMigrations(destRt)
+	performMigrations(destRt, false)
 
 	fmt.Println("Iniciando migración de datos...")
 
@@ -71,7 +71,7 @@ func changeDatabaseEngine(target string) {
 	tables, err := getTables(srcDB, currentDB)
 	if err != nil {
 		fmt.Printf("Error obteniendo tablas: %v\n", err)
-		return
+		return false
 	}
 
 	// 5. Migrate Data
@@ -111,49 +111,81 @@ func changeDatabaseEngine(target string) {
 		}
 
 		// Prepare insert in dest
-		count := 0
 		placeholders := make([]string, len(cols))
 		for i := range placeholders {
 			placeholders[i] = "?"
 		}
 		insertCmd := "INSERT INTO"
+		insertSuffix := ""
 		if target == "mysql" {
 			insertCmd = "INSERT IGNORE INTO"
 		} else if target == "sqlite" {
 			insertCmd = "INSERT OR IGNORE INTO"
+		} else if target == "postgres" {
+			insertSuffix = " ON CONFLICT DO NOTHING"
 		}
-		query := fmt.Sprintf("%s %s (%s) VALUES (%s)", insertCmd, table, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+		query := fmt.Sprintf("%s %s (%s) VALUES (%s)%s", insertCmd, table, strings.Join(cols, ", "), strings.Join(placeholders, ", "), insertSuffix)
 
-		tx, _ := destDB.Begin()
-		stmt, err := tx.Prepare(query)
+		count, err := copyTableRows(destDB, query, rows, vals, valPtrs)
+		rows.Close()
 		if err != nil {
-			fmt.Printf("Error preparando insert (¿Existe la tabla?): %v\n", err)
-			tx.Rollback()
-			continue
+			// One failed row aborts the whole table (Postgres would fail every
+			// later row anyway), so stop before env.joss points at partial data
+			fmt.Printf("Error: %v\n", err)
+			fmt.Printf("La tabla %s se revirtió y %s no se modificó.\n", table, GetEnvFile())
+			return false
 		}
 
-		for rows.Next() {
-			rows.Scan(valPtrs...)
-			_, err = stmt.Exec(vals...)
-			if err != nil {
-				fmt.Printf("Error insertando fila: %v\n", err)
-			} else {
-				count++
-			}
+		// Rows were copied with their ids, so move the SERIAL sequence past them
+		if target == "postgres" && hasColumn(cols, "id") {
+			destDB.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE((SELECT MAX(id) FROM %s), 1))", table, table))
 		}
-		stmt.Close()
-		tx.Commit()
-		rows.Close()
 		fmt.Printf("OK (%d filas)\n", count)
 	}
 
 	// 6. Update env.joss
 	updateEnvFile(GetEnvFile(), "DB", target)
 	fmt.Printf("Migración completada. Archivo %s actualizado.\n", GetEnvFile())
+	return true
+}
+
+// copyTableRows inserts rows into destDB in one transaction, rolled back on
+// the first error
+func copyTableRows(destDB *sql.DB, query string, rows *sql.Rows, vals, valPtrs []interface{}) (int, error) {
+	tx, err := destDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("no se pudo preparar el insert (¿existe la tabla?): %v", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("no se pudo leer la fila %d: %v", count+1, err)
+		}
+		if _, err := stmt.Exec(vals...); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("no se pudo insertar la fila %d: %v", count+1, err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return count, tx.Commit()
 }
 
 func connectToDB(driver string, env map[string]string) (*sql.DB, error) {
-	if driver == "sqlite" {
+	if driver == "postgres" {
+		return core.OpenPostgres(core.PostgresDSN(env))
+	} else if driver == "sqlite" {
 		path := "database.sqlite"
 		if p, ok := env["DB_PATH"]; ok {
 			path = strings.Trim(p, "\"")
@@ -161,7 +193,10 @@ func connectToDB(driver string, env map[string]string) (*sql.DB, error) {
 		}
 		return sql.Open("sqlite", path)
 	} else {
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", env["DB_USER"], env["DB_PASS"], env["DB_HOST"], env["DB_NAME"])
+		dsn, err := core.MySQLDSN(env)
+		if err != nil {
+			return nil, err
+		}
 		return sql.Open("mysql", dsn)
 	}
 }
@@ -171,6 +206,8 @@ func getTables(db *sql.DB, driver string) ([]string, error) {
 	var query string
 	if driver == "sqlite" {
 		query = "SELECT name FROM sqlite_master WHERE type='table'"
+	} else if driver == "postgres" {
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'"
 	} else {
 		query = "SHOW TABLES"
 	}
@@ -207,10 +244,7 @@ func changeDatabasePrefix(newPrefix string) {
 	}
 
 	// 2. Connect to DB
-	dbDriver := envMap["DB"]
-	if dbDriver == "" {
-		dbDriver = "mysql" // Default
-	}
+	dbDriver := core.NormalizeDriver(envMap["DB"]) // Default mysql
 
 	db, err := connectToDB(dbDriver, envMap)
 	if err != nil {
@@ -234,7 +268,7 @@ func changeDatabasePrefix(newPrefix string) {
 			fmt.Printf("Renombrando %s a %s... ", table, newTableName)
 
 			var query string
-			if dbDriver == "sqlite" {
+			if dbDriver == "sqlite" || dbDriver == "postgres" {
 				query = fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, newTableName)
 			} else {
 				query = fmt.Sprintf("RENAME TABLE %s TO %s", table, newTableName)
@@ -303,6 +337,12 @@ func ensureTableSchema(destDB *sql.DB, driver string, table string, rows *sql.Ro
 		if err == nil {
 			tableExists = true
 		}
+	} else if driver == "postgres" {
+		var name string
+		err = destDB.QueryRow("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?", table).Scan(&name)
+		if err == nil {
+			tableExists = true
+		}
 	} else {
 		// MySQL
 		if _, err := destDB.Query("SELECT 1 FROM " + table + " LIMIT 1"); err == nil {
@@ -330,6 +370,8 @@ func ensureTableSchema(destDB *sql.DB, driver string, table string, rows *sql.Ro
 			if strings.ToLower(ct.Name()) == "id" {
 				if driver == "sqlite" {
 					colDef += " INTEGER PRIMARY KEY AUTOINCREMENT"
+				} else if driver == "postgres" {
+					colDef = "id BIGSERIAL PRIMARY KEY"
 				} else {
 					colDef = "id BIGINT AUTO_INCREMENT PRIMARY KEY"
 				}
@@ -393,6 +435,8 @@ func mapTypeToSQL(srcType string, driver string) string {
 	if strings.Contains(srcType, "FLOAT") || strings.Contains(srcType, "DOUBLE") || strings.Contains(srcType, "REAL") {
 		if driver == "sqlite" {
 			return "REAL"
+		} else if driver == "postgres" {
+			return "DOUBLE PRECISION"
 		}
 		return "DOUBLE"
 	}
@@ -412,3 +456,12 @@ func getColumnNames(db *sql.DB, driver string, table string) ([]string, error) {
 	defer rows.Close()
 	return rows.Columns()
 }
+
+func hasColumn(cols []string, name string) bool {
+	for _, c := range cols {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -9,9 +9,31 @@ import (
 
 // Shared Structs
 
+// ColumnSchema is a column as read by getColumns. Blueprint is only filled
+// by schema:dump.
 type ColumnSchema struct {
-	Name string
-	Type string
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Blueprint     string  `json:"blueprint"`
+	Nullable      bool    `json:"nullable"`
+	Default       *string `json:"default,omitempty"`
+	Primary       bool    `json:"primary,omitempty"`
+	AutoIncrement bool    `json:"auto_increment,omitempty"`
+}
+
+type IndexSchema struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+type ForeignKeySchema struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	On         string   `json:"on"`
+	References []string `json:"references"`
+	OnDelete   string   `json:"on_delete,omitempty"`
+	OnUpdate   string   `json:"on_update,omitempty"`
 }
 
 type Relation struct {
@@ -152,9 +152,9 @@ func createCRUDController(modelName, tableName string, cols []ColumnSchema, rela
 			baseRelTable := strings.TrimPrefix(rel.Table, currentPrefix)
 			indexLogic += fmt.Sprintf(".leftJoin(\"%s\", \"%s.%s\", \"=\", \"%s.id\")", baseRelTable, baseTableName, rel.ForeignKey, baseRelTable)
 		}
-		indexLogic += ".get()"
+		indexLogic += ".paginate(15)"
 	} else {
-		indexLogic += fmt.Sprintf("\n        $data = $%s.get()", strings.ToLower(modelName))
+		indexLogic += fmt.Sprintf("\n        $data = $%s.paginate(15)", strings.ToLower(modelName))
 	}
 
 	// Build Create Logic (Fetch relations)
@@ -180,7 +180,7 @@ func createCRUDController(modelName, tableName string, cols []ColumnSchema, rela
     
     function index() {
         %s
-        return View.render("%s/index", {"items": $data})
+        return View.render("%s/index", {"items": $data["data"], "pagination": $data})
     }
 
     function create() {
@@ -261,6 +261,9 @@ func createCRUDViews(modelName string, cols []ColumnSchema, relations []Relation
             </table>
         </div>
     </div>
+    <div class="card-footer">
+        @pagination($pagination)
+    </div>
 </div>
 @endsection
 `, modelName, strings.ToLower(modelName), generateIndexHeaders(cols, relations), generateIndexRows(cols, relations), strings.ToLower(modelName), strings.ToLower(modelName))
@@ -3,43 +3,362 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 )
 
+// getColumns reads the columns of a table: type, nullability, default,
+// primary key and auto-increment
 func getColumns(db *sql.DB, dbType, tableName string) ([]ColumnSchema, error) {
+	switch dbType {
+	case "sqlite":
+		return sqliteColumns(db, tableName)
+	case "postgres":
+		return postgresColumns(db, tableName)
+	}
+	return mysqlColumns(db, tableName)
+}
+
+func sqliteColumns(db *sql.DB, tableName string) ([]ColumnSchema, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%q)", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []ColumnSchema
+	var pkCount int
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		col := ColumnSchema{Name: name, Type: ctype, Nullable: notnull == 0 && pk == 0, Primary: pk > 0}
+		if dflt.Valid {
+			col.Default = sqlDefault(dflt.String)
+		}
+		if pk > 0 {
+			pkCount++
+		}
+		cols = append(cols, col)
+	}
+	// INTEGER PRIMARY KEY is an alias of the rowid: auto-incremented
+	for i := range cols {
+		if cols[i].Primary && pkCount == 1 && strings.EqualFold(cols[i].Type, "INTEGER") {
+			cols[i].AutoIncrement = true
+		}
+	}
+	return cols, rows.Err()
+}
+
+func mysqlColumns(db *sql.DB, tableName string) ([]ColumnSchema, error) {
+	rows, err := db.Query(fmt.Sprintf("DESCRIBE %s", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []ColumnSchema
+	for rows.Next() {
+		var field, ctype, null, key, extra string
+		var def sql.NullString
+		if err := rows.Scan(&field, &ctype, &null, &key, &def, &extra); err != nil {
+			return nil, err
+		}
+		col := ColumnSchema{Name: field, Type: ctype, Nullable: null == "YES", Primary: key == "PRI",
+			AutoIncrement: strings.Contains(strings.ToLower(extra), "auto_increment")}
+		if def.Valid {
+			// MySQL reports literals unquoted and expressions as-is
+			val := def.String
+			if isDefaultExpression(val) {
+				col.Default = &val
+			} else {
+				col.Default = sqlDefault("'" + strings.ReplaceAll(val, "'", "''") + "'")
+			}
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+func postgresColumns(db *sql.DB, tableName string) ([]ColumnSchema, error) {
+	primary := map[string]bool{}
+	pk, err := db.Query(`SELECT a.attname FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(i.indkey)
+		WHERE c.relname = ? AND n.nspname = current_schema() AND i.indisprimary`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for pk.Next() {
+		var name string
+		pk.Scan(&name)
+		primary[name] = true
+	}
+	pk.Close()
+
+	rows, err := db.Query(`SELECT column_name, data_type, character_maximum_length, numeric_precision, numeric_scale, is_nullable, column_default
+		FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? ORDER BY ordinal_position`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var cols []ColumnSchema
+	for rows.Next() {
+		var name, dataType, nullable string
+		var length, precision, scale sql.NullInt64
+		var dflt sql.NullString
+		if err := rows.Scan(&name, &dataType, &length, &precision, &scale, &nullable, &dflt); err != nil {
+			return nil, err
+		}
+		ctype := dataType
+		switch {
+		case length.Valid:
+			ctype = fmt.Sprintf("%s(%d)", dataType, length.Int64)
+		case dataType == "numeric" && precision.Valid:
+			ctype = fmt.Sprintf("numeric(%d,%d)", precision.Int64, scale.Int64)
+		}
+		col := ColumnSchema{Name: name, Type: ctype, Nullable: nullable == "YES", Primary: primary[name]}
+		if dflt.Valid {
+			if strings.HasPrefix(dflt.String, "nextval(") {
+				col.AutoIncrement = true
+			} else {
+				col.Default = sqlDefault(dflt.String)
+			}
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+// getForeignKeys reads the foreign keys of a table
+func getForeignKeys(db *sql.DB, dbType, tableName string) ([]ForeignKeySchema, error) {
+	switch dbType {
+	case "sqlite":
+		return sqliteForeignKeys(db, tableName)
+	case "postgres":
+		rows, err := db.Query(`SELECT tc.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name, rc.update_rule, rc.delete_rule
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name AND kcu.constraint_schema = tc.constraint_schema
+			JOIN information_schema.referential_constraints rc ON rc.constraint_name = tc.constraint_name AND rc.constraint_schema = tc.constraint_schema
+			JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_name = tc.constraint_name AND ccu.constraint_schema = tc.constraint_schema
+			WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema() AND tc.table_name = ?
+			ORDER BY tc.constraint_name, kcu.ordinal_position`, tableName)
+		if err != nil {
+			return nil, err
+		}
+		return scanForeignKeys(rows)
+	}
+	rows, err := db.Query(`SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.UPDATE_RULE, r.DELETE_RULE
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+		WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return scanForeignKeys(rows)
+}
+
+func sqliteForeignKeys(db *sql.DB, tableName string) ([]ForeignKeySchema, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA foreign_key_list(%q)", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := map[int]*ForeignKeySchema{}
+	var order []int
+	for rows.Next() {
+		var id, seq int
+		var refTable, from, onUpdate, onDelete, match string
+		var to sql.NullString
+		if err := rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return nil, err
+		}
+		fk, ok := byID[id]
+		if !ok {
+			fk = &ForeignKeySchema{On: refTable, OnDelete: fkAction(onDelete), OnUpdate: fkAction(onUpdate)}
+			byID[id] = fk
+			order = append(order, id)
+		}
+		fk.Columns = append(fk.Columns, from)
+		ref := to.String
+		if ref == "" {
+			ref = "id"
+		}
+		fk.References = append(fk.References, ref)
+	}
+	sort.Ints(order)
+	var fks []ForeignKeySchema
+	for _, id := range order {
+		fks = append(fks, *byID[id])
+	}
+	return fks, rows.Err()
+}
 
-	if dbType == "sqlite" {
-		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+// getIndexes reads the secondary indexes of a table. On MySQL the indexes
+// backing the given foreign keys are left out: foreign() creates them again.
+func getIndexes(db *sql.DB, dbType, tableName string, fks []ForeignKeySchema) ([]IndexSchema, error) {
+	switch dbType {
+	case "sqlite":
+		return sqliteIndexes(db, tableName)
+	case "postgres":
+		rows, err := db.Query(`SELECT ic.relname, CASE WHEN i.indisunique THEN 0 ELSE 1 END, a.attname FROM pg_index i
+			JOIN pg_class ic ON ic.oid = i.indexrelid
+			JOIN pg_class c ON c.oid = i.indrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+			JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(i.indkey)
+			WHERE c.relname = ? AND n.nspname = current_schema() AND NOT i.indisprimary
+			ORDER BY ic.relname, array_position(i.indkey::int2[], a.attnum)`, tableName)
 		if err != nil {
 			return nil, err
 		}
-		defer rows.Close()
+		return scanIndexes(rows, nil)
+	}
+	fkNames := map[string]bool{}
+	for _, fk := range fks {
+		fkNames[fk.Name] = true
+	}
+	rows, err := db.Query(`SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME <> 'PRIMARY'
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return scanIndexes(rows, fkNames)
+}
 
-		for rows.Next() {
-			var cid int
-			var name, ctype string
-			var notnull, pk int
-			var dflt interface{}
-			rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
-			cols = append(cols, ColumnSchema{Name: name, Type: ctype})
+func sqliteIndexes(db *sql.DB, tableName string) ([]IndexSchema, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_list(%q)", tableName))
+	if err != nil {
+		return nil, err
+	}
+	type indexInfo struct {
+		name   string
+		unique bool
+	}
+	var list []indexInfo
+	for rows.Next() {
+		cols, _ := rows.Columns()
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		rows.Scan(ptrs...)
+		// seq, name, unique, origin ("c" = CREATE INDEX, "u" = UNIQUE, "pk"), partial
+		info := map[string]interface{}{}
+		for i, c := range cols {
+			info[c] = vals[i]
+		}
+		if fmt.Sprint(info["origin"]) == "pk" {
+			continue
 		}
-	} else {
-		rows, err := db.Query(fmt.Sprintf("DESCRIBE %s", tableName))
+		list = append(list, indexInfo{name: fmt.Sprint(info["name"]), unique: fmt.Sprint(info["unique"]) == "1"})
+	}
+	rows.Close()
+
+	var indexes []IndexSchema
+	for _, idx := range list {
+		cols, err := db.Query(fmt.Sprintf("PRAGMA index_info(%q)", idx.name))
 		if err != nil {
 			return nil, err
 		}
-		defer rows.Close()
+		index := IndexSchema{Name: idx.name, Unique: idx.unique}
+		for cols.Next() {
+			var seqno, cid int
+			var name sql.NullString
+			cols.Scan(&seqno, &cid, &name)
+			index.Columns = append(index.Columns, name.String)
+		}
+		cols.Close()
+		if strings.HasPrefix(index.Name, "sqlite_autoindex_") {
+			// Inline UNIQUE constraint, no name of its own
+			index.Name = ""
+		}
+		indexes = append(indexes, index)
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, nil
+}
+
+// scanIndexes groups (name, non_unique, column) rows into indexes
+func scanIndexes(rows *sql.Rows, skip map[string]bool) ([]IndexSchema, error) {
+	defer rows.Close()
+	var indexes []IndexSchema
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+		if skip[name] {
+			continue
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, IndexSchema{Name: name, Columns: []string{column}, Unique: nonUnique == 0})
+	}
+	return indexes, rows.Err()
+}
 
-		for rows.Next() {
-			var field, ctype, null, key string
-			var extra interface{}
-			var def interface{}
-			rows.Scan(&field, &ctype, &null, &key, &def, &extra)
-			cols = append(cols, ColumnSchema{Name: field, Type: ctype})
+// scanForeignKeys groups (name, column, table, ref column, on update, on delete) rows
+func scanForeignKeys(rows *sql.Rows) ([]ForeignKeySchema, error) {
+	defer rows.Close()
+	var fks []ForeignKeySchema
+	for rows.Next() {
+		var name, column, refTable, refColumn, onUpdate, onDelete string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn, &onUpdate, &onDelete); err != nil {
+			return nil, err
+		}
+		if n := len(fks); n > 0 && fks[n-1].Name == name {
+			fk := &fks[n-1]
+			if !containsName(fk.Columns, column) {
+				fk.Columns = append(fk.Columns, column)
+			}
+			if !containsName(fk.References, refColumn) {
+				fk.References = append(fk.References, refColumn)
+			}
+			continue
 		}
+		fks = append(fks, ForeignKeySchema{Name: name, Columns: []string{column}, On: refTable,
+			References: []string{refColumn}, OnDelete: fkAction(onDelete), OnUpdate: fkAction(onUpdate)})
+	}
+	return fks, rows.Err()
+}
+
+// fkAction lower-cases a referential action; the defaults are omitted
+func fkAction(action string) string {
+	action = strings.ToLower(strings.TrimSpace(action))
+	if action == "no action" || action == "restrict" || action == "" {
+		return ""
+	}
+	return action
+}
+
+var pgCast = regexp.MustCompile(`::[a-z ]+(\[\])?$`)
+
+// sqlDefault normalizes a default as written in SQL: quoted literals are
+// unquoted, NULL means no default and expressions are kept verbatim
+func sqlDefault(raw string) *string {
+	val := pgCast.ReplaceAllString(strings.TrimSpace(raw), "")
+	if val == "" || strings.EqualFold(val, "NULL") {
+		return nil
 	}
-	return cols, nil
+	if len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'' {
+		val = strings.ReplaceAll(val[1:len(val)-1], "''", "'")
+	}
+	return &val
+}
+
+func isDefaultExpression(val string) bool {
+	upper := strings.ToUpper(val)
+	return strings.HasPrefix(upper, "CURRENT_") || strings.HasSuffix(upper, "()") || strings.HasPrefix(upper, "NOW(")
 }
 
 func getDisplayColumn(db *sql.DB, dbType, tableName string) string {
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "modernc.org/sqlite"
@@ -48,7 +49,25 @@ func main() {
 			return
 		}
 		filename := os.Args[2]
+
+		// joss run app.joss --profile[=ruta/base]
+		for _, arg := range os.Args[3:] {
+			if arg == "--profile" || strings.HasPrefix(arg, "--profile=") {
+				output := strings.TrimPrefix(strings.TrimPrefix(arg, "--profile"), "=")
+				if output == "" {
+					output = core.DefaultProfileOutput()
+				}
+				core.StartProfiler(output, core.ProfileRate(nil))
+				break
+			}
+		}
+		if core.ActiveProfiler() == nil {
+			if output := core.ProfileOutput(nil); output != "" {
+				core.StartProfiler(output, core.ProfileRate(nil))
+			}
+		}
 		executeScript(filename)
+		core.FlushProfiler()
 
 	case "build":
 		target := "web"
@@ -72,6 +91,12 @@ func main() {
 			return
 		}
 		createMiddleware(os.Args[2])
+	case "make:policy":
+		if len(os.Args) < 3 {
+			fmt.Println("Uso: joss make:policy [Modelo]")
+			return
+		}
+		createPolicy(os.Args[2])
 	case "make:model":
 		if len(os.Args) < 3 {
 			fmt.Println("Uso: joss make:model [Nombre]")
@@ -105,13 +130,56 @@ func main() {
 	case "make:migration":
 		if len(os.Args) < 3 {
 			fmt.Println("Uso: joss make:migration [Nombre]")
+			fmt.Println("     joss make:migration --from-db [tabla...] [--connection=nombre] [--record]")
+			return
+		}
+		if os.Args[2] == "--from-db" {
+			runMigrationFromDB(os.Args[3:])
 			return
 		}
 		createMigration(os.Args[2])
+	case "schema:dump":
+		runSchemaDump(os.Args[2:])
+	case "make:seeder":
+		if len(os.Args) < 3 {
+			fmt.Println("Uso: joss make:seeder [Nombre]")
+			return
+		}
+		createSeeder(os.Args[2])
+	case "make:factory":
+		if len(os.Args) < 3 {
+			fmt.Println("Uso: joss make:factory [Modelo]")
+			return
+		}
+		createFactory(os.Args[2])
+	case "test":
+		runTests(os.Args[2:])
 	case "migrate":
-		runMigrations()
+		runMigrations(os.Args[2:])
+	case "migrate:rollback":
+		runMigrateRollback(os.Args[2:])
+	case "migrate:reset":
+		runMigrateReset(os.Args[2:])
+	case "migrate:refresh":
+		runMigrateRefresh(os.Args[2:])
+	case "migrate:status":
+		runMigrateStatus()
 	case "migrate:fresh":
 		runMigrateFresh()
+	case "db:seed":
+		runSeed(os.Args[2:])
+	case "db:backup":
+		runDBBackup(os.Args[2:])
+	case "db:restore":
+		runDBRestore(os.Args[2:])
+	case "permission:grant":
+		runPermissionGrant(os.Args[2:], false)
+	case "permission:revoke":
+		runPermissionGrant(os.Args[2:], true)
+	case "permission:list":
+		runPermissionList(os.Args[2:])
+	case "oauth:mock":
+		runOAuthMock(os.Args[2:])
 	case "new":
 		if len(os.Args) < 3 {
 			fmt.Println("Uso: joss new [web|console] [ruta]")
@@ -165,7 +233,9 @@ func main() {
 			changeDatabasePrefix(newPrefix)
 		} else {
 			targetEngine := os.Args[3]
-			changeDatabaseEngine(targetEngine)
+			if !changeDatabaseEngine(targetEngine) {
+				os.Exit(1)
+			}
 		}
 	case "help":
 		printHelp()
@@ -196,13 +266,19 @@ func executeScript(filename string) {
 	}
 
 	rt := core.NewRuntime()
+	core.RegisterSource(program, filename)
 
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Printf("\n[Error de Ejecución JOSS] %v\n", r)
+			core.FlushProfiler()
 			os.Exit(1)
 		}
 	}()
 
+	done := rt.ProfileScript(filename)
+	leave := rt.QueryFrame("main", filename)
 	rt.Execute(program)
+	leave()
+	done()
 }
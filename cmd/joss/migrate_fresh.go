@@ -36,7 +36,7 @@ func runMigrateFresh() {
 	rt.EnsureAuthTables()
 
 	// 4. Run migrations
-	performMigrations(rt)
+	performMigrations(rt, false)
 
 	fmt.Println("¡Migraciones ejecutadas exitosamente!")
 }
@@ -4,57 +4,207 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/jossecurity/joss/pkg/core"
 	"github.com/jossecurity/joss/pkg/parser"
 )
 
-func runMigrations() {
-	fmt.Println("Ejecutando migraciones...")
+const migrationsDir = "app/database/migrations"
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("\n[Error de Ejecución JOSS en Migraciones] %v\n", r)
-			os.Exit(1)
+// migrationOptions are the flags accepted by the migrate commands
+type migrationOptions struct {
+	step    int  // --step=N: rollback only the last N migrations
+	pretend bool // --pretend: print the SQL instead of running it
+}
+
+func parseMigrationArgs(args []string) migrationOptions {
+	opts := migrationOptions{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--pretend":
+			opts.pretend = true
+		case arg == "--step" && i+1 < len(args):
+			opts.step, _ = strconv.Atoi(args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--step="):
+			opts.step, _ = strconv.Atoi(strings.TrimPrefix(arg, "--step="))
 		}
-	}()
+	}
+	return opts
+}
 
-	// 1. Initialize Runtime
+// connectMigrations opens the database and makes sure the migration table
+// exists. With pretend the tables are not created: nothing may be written.
+func connectMigrations(pretend bool) *core.Runtime {
 	rt := core.NewRuntime()
 	rt.LoadEnv(nil)
 
-	if rt.GetDB() == nil {
+	rt.SetMigrationMode(pretend, pretend)
+	db := rt.GetDB()
+	rt.SetMigrationMode(false, false)
+	if db == nil {
 		fmt.Println("Error: No se pudo conectar a la base de datos.")
-		return
+		return nil
 	}
 	fmt.Println("Conexión a DB exitosa.")
 
-	// Ensure migration table exists
-	rt.EnsureMigrationTable()
-	rt.EnsureAuthTables()
+	if !pretend {
+		rt.EnsureMigrationTable()
+		rt.EnsureAuthTables()
+	}
+	return rt
+}
+
+// recoverMigrationPanic reports a runtime error of a migrate command and exits
+func recoverMigrationPanic() {
+	if r := recover(); r != nil {
+		fmt.Printf("\n[Error de Ejecución JOSS en Migraciones] %v\n", r)
+		os.Exit(1)
+	}
+}
+
+func runMigrations(args []string) {
+	fmt.Println("Ejecutando migraciones...")
+	defer recoverMigrationPanic()
+
+	pretend := parseMigrationArgs(args).pretend
+	rt := connectMigrations(pretend)
+	if rt == nil {
+		return
+	}
+	performMigrations(rt, pretend)
+}
+
+func runMigrateRollback(args []string) {
+	fmt.Println("Revirtiendo migraciones...")
+	defer recoverMigrationPanic()
+
+	opts := parseMigrationArgs(args)
+	rt := connectMigrations(opts.pretend)
+	if rt == nil {
+		return
+	}
+	records := rt.GetMigrationRecords()
+	if len(records) == 0 {
+		fmt.Println("No hay migraciones para revertir.")
+		return
+	}
 
-	performMigrations(rt)
+	if opts.step > 0 {
+		if opts.step < len(records) {
+			records = records[len(records)-opts.step:]
+		}
+	} else {
+		// Default: the whole last batch
+		last := records[len(records)-1].Batch
+		start := len(records)
+		for start > 0 && records[start-1].Batch == last {
+			start--
+		}
+		records = records[start:]
+	}
+	rollbackMigrations(rt, records, opts.pretend)
 }
 
-func performMigrations(rt *core.Runtime) {
-	// 2. Find migration files
-	files, err := filepath.Glob("app/database/migrations/*.joss")
+func runMigrateReset(args []string) {
+	fmt.Println("Revirtiendo todas las migraciones...")
+	defer recoverMigrationPanic()
+
+	pretend := parseMigrationArgs(args).pretend
+	rt := connectMigrations(pretend)
+	if rt == nil {
+		return
+	}
+	records := rt.GetMigrationRecords()
+	if len(records) == 0 {
+		fmt.Println("No hay migraciones para revertir.")
+		return
+	}
+	rollbackMigrations(rt, records, pretend)
+}
+
+func runMigrateRefresh(args []string) {
+	fmt.Println("Revirtiendo y re-ejecutando todas las migraciones...")
+	defer recoverMigrationPanic()
+
+	pretend := parseMigrationArgs(args).pretend
+	rt := connectMigrations(pretend)
+	if rt == nil {
+		return
+	}
+	if !rollbackMigrations(rt, rt.GetMigrationRecords(), pretend) {
+		return
+	}
+	if pretend {
+		// Nothing was rolled back, so show every migration as pending
+		migrateFiles(rt, map[string]bool{}, pretend)
+		return
+	}
+	performMigrations(rt, pretend)
+}
+
+func runMigrateStatus() {
+	defer recoverMigrationPanic()
+
+	rt := connectMigrations(false)
+	if rt == nil {
+		return
+	}
+
+	files, _ := filepath.Glob(migrationsDir + "/*.joss")
+	batches := make(map[string]int)
+	for _, rec := range rt.GetMigrationRecords() {
+		batches[rec.Migration] = rec.Batch
+	}
+
+	fmt.Printf("\n%-10s %-6s %s\n", "Estado", "Batch", "Migración")
+	fmt.Println(strings.Repeat("-", 60))
+	seen := make(map[string]bool)
+	for _, file := range files {
+		name := filepath.Base(file)
+		seen[name] = true
+		if batch, ok := batches[name]; ok {
+			fmt.Printf("%-10s %-6d %s\n", "Ejecutada", batch, name)
+		} else {
+			fmt.Printf("%-10s %-6s %s\n", "Pendiente", "", name)
+		}
+	}
+	// Executed migrations whose file no longer exists
+	for _, rec := range rt.GetMigrationRecords() {
+		if !seen[rec.Migration] {
+			fmt.Printf("%-10s %-6d %s (archivo no encontrado)\n", "Ejecutada", rec.Batch, rec.Migration)
+		}
+	}
+	if len(files) == 0 && len(batches) == 0 {
+		fmt.Printf("No se encontraron migraciones en %s/\n", migrationsDir)
+	}
+}
+
+func performMigrations(rt *core.Runtime, pretend bool) {
+	migrateFiles(rt, rt.GetExecutedMigrations(), pretend)
+}
+
+// migrateFiles runs up() of every migration file not in executed, as a new batch
+func migrateFiles(rt *core.Runtime, executed map[string]bool, pretend bool) {
+	// Find migration files
+	files, err := filepath.Glob(migrationsDir + "/*.joss")
 	if err != nil {
 		fmt.Printf("Error buscando migraciones: %v\n", err)
 		return
 	}
 
 	if len(files) == 0 {
-		fmt.Println("No se encontraron migraciones en app/database/migrations/")
+		fmt.Printf("No se encontraron migraciones en %s/\n", migrationsDir)
 		return
 	}
 
-	// 3. Get executed migrations
-	executed := rt.GetExecutedMigrations()
 	batch := rt.GetNextBatch()
 	count := 0
 
-	// 4. Execute pending migrations
+	// Execute pending migrations
 	for _, file := range files {
 		filename := filepath.Base(file)
 		if executed[filename] {
@@ -62,66 +212,206 @@ func performMigrations(rt *core.Runtime) {
 		}
 
 		fmt.Printf("Migrando: %s (Batch %d)...\n", filename, batch)
-
-		data, err := os.ReadFile(file)
+		err := runMigration(rt, file, "up", pretend, func() {
+			rt.LogMigration(filename, batch)
+		})
 		if err != nil {
-			fmt.Printf("Error leyendo %s: %v\n", file, err)
-			continue
+			fmt.Printf("Error en %s: %v\n", filename, err)
+			if pretend {
+				fmt.Println("Simulación detenida. No se ejecutó nada.")
+			} else {
+				fmt.Println("Migración revertida. Las migraciones siguientes no se ejecutaron.")
+			}
+			return
 		}
+		count++
+	}
 
-		l := parser.NewLexer(string(data))
-		p := parser.NewParser(l)
-		program := p.ParseProgram()
+	if count == 0 {
+		fmt.Println("No hay migraciones pendientes.")
+	} else {
+		fmt.Printf("Migraciones completadas: %d\n", count)
+	}
+}
 
-		if len(p.Errors()) != 0 {
-			fmt.Printf("Error de parseo en %s:\n", file)
-			for _, msg := range p.Errors() {
-				fmt.Printf("\t%s\n", msg)
-			}
+// rollbackMigrations runs down() of the given records, newest first, and
+// removes them from the migration table. Returns false if one failed.
+func rollbackMigrations(rt *core.Runtime, records []core.MigrationRecord, pretend bool) bool {
+	count := 0
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := records[i]
+		file := filepath.Join(migrationsDir, rec.Migration)
+		if _, err := os.Stat(file); err != nil {
+			fmt.Printf("Advertencia: No se encontró %s, se omite.\n", file)
 			continue
 		}
 
-		rt.Execute(program)
+		fmt.Printf("Revirtiendo: %s (Batch %d)...\n", rec.Migration, rec.Batch)
+		err := runMigration(rt, file, "down", pretend, func() {
+			rt.DeleteMigration(rec.Migration)
+		})
+		if err != nil {
+			fmt.Printf("Error en %s: %v\n", rec.Migration, err)
+			return false
+		}
+		count++
+	}
+	fmt.Printf("Migraciones revertidas: %d\n", count)
+	return true
+}
 
-		// Find the migration class and execute 'up'
-		var migrationClass *parser.ClassStatement
-		for _, stmt := range program.Statements {
-			if classStmt, ok := stmt.(*parser.ClassStatement); ok {
-				migrationClass = classStmt
-				break
-			}
+// runMigration loads a migration file and calls its up() or down() method.
+// The method and record (LogMigration/DeleteMigration) share one transaction
+// when the engine supports transactional DDL, so a failing migration leaves
+// no trace. With pretend, the Schema SQL is printed and nothing is executed.
+func runMigration(rt *core.Runtime, file, method string, pretend bool, record func()) (err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	l := parser.NewLexer(string(data))
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("error de parseo:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	// Find the migration class
+	var migrationClass *parser.ClassStatement
+	for _, stmt := range program.Statements {
+		if classStmt, ok := stmt.(*parser.ClassStatement); ok {
+			migrationClass = classStmt
+			break
+		}
+	}
+	if migrationClass == nil && method == "down" {
+		// Legacy migrations (top-level statements) can only run forwards
+		fmt.Printf("Advertencia: %s no define una clase con down(), solo se elimina su registro.\n", filepath.Base(file))
+		if !pretend {
+			record()
 		}
+		return nil
+	}
 
-		if migrationClass != nil {
-			// Instantiate
-			instance := core.NewInstance(migrationClass)
+	if pretend {
+		if err := checkPretendable(program, migrationClass); err != nil {
+			return err
+		}
+	}
 
-			// Find 'up' method
-			var upMethod *parser.MethodStatement
-			for _, stmt := range migrationClass.Body.Statements {
-				if method, ok := stmt.(*parser.MethodStatement); ok {
-					if method.Name.Value == "up" {
-						upMethod = method
-						break
-					}
-				}
-			}
+	// Migration mode is on before the constructor runs, so with pretend it
+	// can't touch the database either
+	rt.SetMigrationMode(true, pretend)
 
-			if upMethod != nil {
-				fmt.Printf("Ejecutando up() de %s...\n", migrationClass.Name.Value)
-				rt.CallMethodEvaluated(upMethod, instance, []interface{}{})
-			} else {
-				fmt.Printf("Advertencia: No se encontró el método 'up' en %s\n", migrationClass.Name.Value)
+	// A class migration may target a named connection by setting
+	// $this->connection in its constructor; up()/down() and its transaction
+	// then run on a runtime bound to that connection (mrt), while the record
+	// stays in the default one
+	var instance *core.Instance
+	mrt := rt
+	if migrationClass != nil {
+		rt.Execute(program)
+		instance = rt.NewInstance(migrationClass.Name.Value)
+		if instance == nil {
+			rt.SetMigrationMode(false, false)
+			return fmt.Errorf("no se pudo crear la migración %s", migrationClass.Name.Value)
+		}
+		if connection, _ := instance.Fields["connection"].(string); connection != "" {
+			mrt, err = migrationRuntime(rt, connection)
+			if err != nil {
+				rt.SetMigrationMode(false, false)
+				return err
 			}
+			mrt.SetMigrationMode(true, pretend)
 		}
+	}
 
-		rt.LogMigration(filename, batch)
-		count++
+	useTx := !pretend && mrt.TransactionalDDL()
+	if useTx {
+		if err := mrt.BeginTransaction(); err != nil {
+			rt.SetMigrationMode(false, false)
+			mrt.SetMigrationMode(false, false)
+			return err
+		}
 	}
+	defer func() {
+		if r := recover(); r != nil {
+			if useTx {
+				mrt.RollbackTransaction()
+			}
+			err = fmt.Errorf("%v", r)
+		}
+		if pretend {
+			for _, query := range mrt.PretendedQueries() {
+				fmt.Printf("  %s;\n", query)
+			}
+		}
+		rt.SetMigrationMode(false, false)
+		mrt.SetMigrationMode(false, false)
+	}()
 
-	if count == 0 {
-		fmt.Println("No hay migraciones pendientes.")
+	if migrationClass == nil {
+		rt.Execute(program)
 	} else {
-		fmt.Printf("Migraciones completadas: %d\n", count)
+		var fn *parser.MethodStatement
+		for _, stmt := range migrationClass.Body.Statements {
+			if m, ok := stmt.(*parser.MethodStatement); ok && m.Name.Value == method {
+				fn = m
+				break
+			}
+		}
+		if fn != nil {
+			fmt.Printf("Ejecutando %s() de %s...\n", method, migrationClass.Name.Value)
+			mrt.CallMethodEvaluated(fn, instance, []interface{}{})
+		} else {
+			fmt.Printf("Advertencia: No se encontró el método '%s' en %s\n", method, migrationClass.Name.Value)
+		}
 	}
+
+	if pretend {
+		return nil
+	}
+	if mrt == rt {
+		record()
+		if useTx {
+			return rt.CommitTransaction()
+		}
+		return nil
+	}
+	// Named connection: commit there, then record in the default database
+	if useTx {
+		useTx = false
+		if err := mrt.CommitTransaction(); err != nil {
+			return err
+		}
+	}
+	record()
+	return nil
+}
+
+// checkPretendable refuses to simulate migrations whose code runs outside
+// up()/down(): legacy migrations (top-level statements) and files with
+// statements besides the class would execute for real
+func checkPretendable(program *parser.Program, migrationClass *parser.ClassStatement) error {
+	if migrationClass == nil {
+		return fmt.Errorf("--pretend no puede simular una migración sin clase: su código se ejecuta directamente. Conviértela a una clase con up()/down() o ejecútala sin --pretend")
+	}
+	for _, stmt := range program.Statements {
+		if _, ok := stmt.(*parser.ClassStatement); !ok {
+			return fmt.Errorf("--pretend no puede simular %s: el archivo tiene código fuera de la clase. Ejecútala sin --pretend", migrationClass.Name.Value)
+		}
+	}
+	return nil
+}
+
+// migrationRuntime returns rt bound to a named connection, turning an
+// unknown name into an error
+func migrationRuntime(rt *core.Runtime, connection string) (mrt *core.Runtime, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return rt.ConnectionRuntime(connection), nil
 }
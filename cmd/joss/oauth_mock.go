@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oauthMock is a local OpenID Connect provider for development and tests
+// (joss oauth:mock). It approves every authorization request as the
+// configured user, or as login_hint when the request carries one, and
+// implements discovery, PKCE, id_tokens signed with RS256, userinfo and JWKS.
+type oauthMock struct {
+	issuer string
+	email  string
+	name   string
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu     sync.Mutex
+	codes  map[string]oauthMockGrant
+	tokens map[string]map[string]interface{}
+}
+
+type oauthMockGrant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	expires     time.Time
+}
+
+// runOAuthMock starts the mock provider (joss oauth:mock [--port=9400] [--email=E] [--name=N])
+func runOAuthMock(args []string) {
+	port, email, name := "9400", "dev@example.com", "Dev User"
+	for _, arg := range args {
+		key, value, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		switch key {
+		case "port":
+			port = value
+		case "email":
+			email = value
+		case "name":
+			name = value
+		default:
+			fmt.Printf("Opción desconocida: %s\n", arg)
+			os.Exit(1)
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		fmt.Printf("Error generando la clave: %v\n", err)
+		os.Exit(1)
+	}
+	m := &oauthMock{
+		issuer: "http://localhost:" + port,
+		email:  email,
+		name:   name,
+		key:    key,
+		kid:    "mock-" + mockRandom(4),
+		codes:  map[string]oauthMockGrant{},
+		tokens: map[string]map[string]interface{}{},
+	}
+
+	fmt.Printf("Proveedor OIDC de prueba en %s (usuario: %s)\n", m.issuer, email)
+	fmt.Println("Configura en env.joss:")
+	fmt.Printf("  OAUTH_MOCK_ISSUER=\"%s\"\n", m.issuer)
+	fmt.Println("  OAUTH_MOCK_CLIENT_ID=\"joss\"")
+	fmt.Println("  OAUTH_MOCK_CLIENT_SECRET=\"secret\"")
+	if err := http.ListenAndServe(":"+port, m.routes()); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func (m *oauthMock) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, 200, map[string]interface{}{
+			"issuer":                                m.issuer,
+			"authorization_endpoint":                m.issuer + "/authorize",
+			"token_endpoint":                        m.issuer + "/token",
+			"userinfo_endpoint":                     m.issuer + "/userinfo",
+			"jwks_uri":                              m.issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/userinfo", m.userinfo)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, 200, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": m.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	return mux
+}
+
+func (m *oauthMock) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" || q.Get("client_id") == "" {
+		http.Error(w, "client_id y redirect_uri son obligatorios", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "se requiere response_type=code y PKCE S256", http.StatusBadRequest)
+		return
+	}
+
+	email := m.email
+	if hint := q.Get("login_hint"); hint != "" {
+		email = hint
+	}
+	code := mockRandom(16)
+	m.mu.Lock()
+	m.codes[code] = oauthMockGrant{
+		clientID:    q.Get("client_id"),
+		redirectURI: redirectURI,
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		email:       email,
+		expires:     time.Now().Add(time.Minute),
+	}
+	m.mu.Unlock()
+	fmt.Printf("[OAuth mock] Código emitido para %s\n", email)
+
+	back := target.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	target.RawQuery = back.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (m *oauthMock) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeMockJSON(w, 400, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	grant, ok := m.codes[code]
+	delete(m.codes, code)
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(grant.expires):
+		writeMockJSON(w, 400, map[string]string{"error": "invalid_grant", "error_description": "código inválido o expirado"})
+		return
+	case grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri"):
+		writeMockJSON(w, 400, map[string]string{"error": "invalid_grant", "error_description": "client_id o redirect_uri distintos"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge:
+		writeMockJSON(w, 400, map[string]string{"error": "invalid_grant", "error_description": "code_verifier no coincide"})
+		return
+	}
+
+	local, _, _ := strings.Cut(grant.email, "@")
+	hash := sha256.Sum256([]byte(grant.email))
+	claims := map[string]interface{}{
+		"sub":                hex.EncodeToString(hash[:8]),
+		"email":              grant.email,
+		"email_verified":     true,
+		"name":               m.name,
+		"preferred_username": local,
+	}
+	if given, family, found := strings.Cut(m.name, " "); found {
+		claims["given_name"], claims["family_name"] = given, family
+	}
+
+	idClaims := jwt.MapClaims{"iss": m.issuer, "aud": grant.clientID, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	if grant.nonce != "" {
+		idClaims["nonce"] = grant.nonce
+	}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	idToken.Header["kid"] = m.kid
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		writeMockJSON(w, 500, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken := mockRandom(24)
+	m.mu.Lock()
+	m.tokens[accessToken] = claims
+	m.mu.Unlock()
+	writeMockJSON(w, 200, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (m *oauthMock) userinfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	m.mu.Lock()
+	claims, ok := m.tokens[token]
+	m.mu.Unlock()
+	if !ok {
+		writeMockJSON(w, 401, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeMockJSON(w, 200, claims)
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func mockRandom(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jossecurity/joss/pkg/core"
+)
+
+// oauthFlow drives OAuth::url / OAuth::callback of a runtime against the mock
+type oauthFlow struct {
+	t    *testing.T
+	rt   *core.Runtime
+	mock *oauthMock
+}
+
+func newOAuthFlow(t *testing.T) *oauthFlow {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &oauthMock{
+		email:  "dev@example.com",
+		name:   "Dev User",
+		key:    key,
+		kid:    "mock-test",
+		codes:  map[string]oauthMockGrant{},
+		tokens: map[string]map[string]interface{}{},
+	}
+	srv := httptest.NewServer(m.routes())
+	t.Cleanup(srv.Close)
+	m.issuer = srv.URL
+
+	// Log to the temp dir, not to cmd/joss/log.txt
+	if err := core.SetLogFile(filepath.Join(t.TempDir(), "log.txt")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(core.CloseLogger)
+
+	rt := core.NewRuntime()
+	rt.Env = map[string]string{
+		"DB":                       "sqlite",
+		"DB_PATH":                  filepath.Join(t.TempDir(), "oauth.sqlite"),
+		"PREFIX":                   "js_",
+		"JWT_SECRET":               "test-secret",
+		"APP_URL":                  "http://app.test",
+		"OAUTH_MOCK_ISSUER":        srv.URL,
+		"OAUTH_MOCK_CLIENT_ID":     "joss",
+		"OAUTH_MOCK_CLIENT_SECRET": "secret",
+	}
+	rt.DB = nil
+	rt.Variables["$__session"] = &core.Instance{Fields: map[string]interface{}{}}
+	t.Cleanup(func() {
+		if rt.DB != nil {
+			rt.DB.Close()
+		}
+	})
+	return &oauthFlow{t: t, rt: rt, mock: m}
+}
+
+func (f *oauthFlow) call(class, method string, args ...interface{}) interface{} {
+	return f.rt.NativeHandlers[class](f.rt, nil, method, args)
+}
+
+func (f *oauthFlow) session() map[string]interface{} {
+	return f.rt.Variables["$__session"].(*core.Instance).Fields
+}
+
+// authorize starts the flow and returns the query the provider sends back
+func (f *oauthFlow) authorize(extra map[string]interface{}) url.Values {
+	f.t.Helper()
+	authURL, _ := f.call("OAuth", "url", "mock", extra).(string)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(back.String(), "http://app.test/auth/mock/callback") {
+		f.t.Fatalf("unexpected redirect %q (status %d)", resp.Header.Get("Location"), resp.StatusCode)
+	}
+	return back.Query()
+}
+
+// callback runs OAuth::callback with the given query as the request
+func (f *oauthFlow) callback(query url.Values) interface{} {
+	fields := map[string]interface{}{}
+	for k := range query {
+		fields[k] = query.Get(k)
+	}
+	f.rt.Variables["$__request"] = &core.Instance{Fields: fields}
+	return f.call("OAuth", "callback", "mock")
+}
+
+func (f *oauthFlow) expectError(result interface{}, contains string) {
+	f.t.Helper()
+	if result != false {
+		f.t.Fatalf("callback should fail, got %v", result)
+	}
+	if msg, _ := f.call("OAuth", "error").(string); !strings.Contains(msg, contains) {
+		f.t.Fatalf("error %q does not mention %q", msg, contains)
+	}
+	if f.session()["user_id"] != nil {
+		f.t.Fatal("failed callback logged the user in")
+	}
+}
+
+func (f *oauthFlow) logout() {
+	delete(f.session(), "user_id")
+}
+
+func TestOAuthMockFlow(t *testing.T) {
+	f := newOAuthFlow(t)
+
+	t.Run("login registers the user", func(t *testing.T) {
+		profile, ok := f.callback(f.authorize(nil)).(map[string]interface{})
+		if !ok {
+			t.Fatalf("callback failed: %v", f.call("OAuth", "error"))
+		}
+		if profile["email"] != "dev@example.com" || profile["created"] != true {
+			t.Fatalf("unexpected profile %v", profile)
+		}
+		if f.session()["user_id"] != profile["user_id"] {
+			t.Fatalf("session user %v, want %v", f.session()["user_id"], profile["user_id"])
+		}
+		f.logout()
+	})
+
+	t.Run("profile values are stored as text", func(t *testing.T) {
+		f.mock.name = "NULL CURRENT_DATE"
+		defer func() { f.mock.name = "Dev User" }()
+		if _, ok := f.callback(f.authorize(map[string]interface{}{"login_hint": "NOW()@example.com"})).(map[string]interface{}); !ok {
+			t.Fatalf("callback failed: %v", f.call("OAuth", "error"))
+		}
+		f.logout()
+		var username, first, last string
+		row := f.rt.Conn().QueryRow("SELECT username, first_name, last_name FROM js_users WHERE email = ?", "NOW()@example.com")
+		if err := row.Scan(&username, &first, &last); err != nil {
+			t.Fatal(err)
+		}
+		if username != "NOW()" || first != "NULL" || last != "CURRENT_DATE" {
+			t.Fatalf("got %q %q %q", username, first, last)
+		}
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		query := f.authorize(nil)
+		query.Set("state", "forged")
+		f.expectError(f.callback(query), "state")
+	})
+
+	t.Run("state is single use", func(t *testing.T) {
+		query := f.authorize(nil)
+		if _, ok := f.callback(query).(map[string]interface{}); !ok {
+			t.Fatalf("callback failed: %v", f.call("OAuth", "error"))
+		}
+		f.logout()
+		f.expectError(f.callback(query), "state")
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		query := f.authorize(nil)
+		f.session()["oauth_verifier"] = "not-the-verifier"
+		f.expectError(f.callback(query), "code_verifier")
+	})
+
+	t.Run("unverified account is refused", func(t *testing.T) {
+		f.call("Auth", "create", map[string]interface{}{"email": "pending@example.com", "password": "secreto123", "username": "pending"})
+		f.expectError(f.callback(f.authorize(map[string]interface{}{"login_hint": "pending@example.com"})), "verificada")
+	})
+
+	t.Run("locked account is refused", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			f.call("Auth", "attempt", "dev@example.com", "wrong-password")
+		}
+		defer f.call("Auth", "unlock", "dev@example.com")
+		f.expectError(f.callback(f.authorize(nil)), "bloqueada")
+	})
+
+	t.Run("bad id_token signature", func(t *testing.T) {
+		// Same kid, different key: the cached JWKS does not match
+		good := f.mock.key
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		f.mock.key = other
+		defer func() { f.mock.key = good }()
+		f.expectError(f.callback(f.authorize(nil)), "id_token")
+	})
+
+	t.Run("unknown kid refetches the JWKS at most once a minute", func(t *testing.T) {
+		now := time.Now()
+		core.SetTestNow(&now)
+		defer core.SetTestNow(nil)
+
+		// Key rotation right after the last download is not picked up yet
+		rotated, _ := rsa.GenerateKey(rand.Reader, 2048)
+		f.mock.key, f.mock.kid = rotated, "mock-rotated"
+		f.expectError(f.callback(f.authorize(nil)), "mock-rotated")
+
+		later := now.Add(2 * time.Minute)
+		core.SetTestNow(&later)
+		if _, ok := f.callback(f.authorize(nil)).(map[string]interface{}); !ok {
+			t.Fatalf("callback after the refetch interval failed: %v", f.call("OAuth", "error"))
+		}
+		f.logout()
+	})
+}
+
+func TestOAuthRequiresAppURL(t *testing.T) {
+	f := newOAuthFlow(t)
+	delete(f.rt.Env, "APP_URL")
+	f.rt.Variables["$__request"] = &core.Instance{Fields: map[string]interface{}{"_host": "evil.example", "_scheme": "https"}}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("OAuth::url without APP_URL should fail")
+		}
+	}()
+	f.call("OAuth", "url", "mock")
+}
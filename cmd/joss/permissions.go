@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jossecurity/joss/pkg/core"
+)
+
+// permissionArgs are the flags of permission:grant, permission:revoke and permission:list
+type permissionArgs struct {
+	kind        string // role or user
+	subject     string
+	connection  string
+	permissions []string
+}
+
+func parsePermissionArgs(args []string) permissionArgs {
+	parsed := permissionArgs{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			parsed.permissions = append(parsed.permissions, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "role", "user":
+			parsed.kind, parsed.subject = name, value
+		case "connection":
+			parsed.connection = value
+		default:
+			fmt.Printf("Opción desconocida: %s\n", arg)
+			os.Exit(1)
+		}
+	}
+	return parsed
+}
+
+// runPermissionGrant grants or revokes permissions (joss permission:grant / permission:revoke)
+func runPermissionGrant(args []string, revoke bool) {
+	command := "permission:grant"
+	if revoke {
+		command = "permission:revoke"
+	}
+	parsed := parsePermissionArgs(args)
+	if len(parsed.permissions) == 0 || parsed.kind == "" {
+		fmt.Printf("Uso: joss %s [permiso...] --role=nombre | --user=email\n", command)
+		return
+	}
+
+	db, driver, env, err := openSchemaDB(parsed.connection)
+	if err != nil {
+		fmt.Printf("Error conectando a la base de datos: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	prefix := envPrefix(env)
+	core.EnsurePermissionTables(db, driver, prefix)
+
+	who := fmt.Sprintf("al rol '%s'", parsed.subject)
+	if parsed.kind == "user" {
+		who = fmt.Sprintf("al usuario '%s'", parsed.subject)
+	}
+	for _, perm := range parsed.permissions {
+		if revoke {
+			revoked, err := core.RevokePermission(db, prefix, parsed.kind, parsed.subject, perm)
+			switch {
+			case err != nil:
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			case revoked:
+				fmt.Printf("Permiso '%s' revocado %s\n", perm, who)
+			default:
+				fmt.Printf("El permiso '%s' no estaba otorgado %s\n", perm, who)
+			}
+			continue
+		}
+		if err := core.GrantPermission(db, prefix, parsed.kind, parsed.subject, perm); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Permiso '%s' otorgado %s\n", perm, who)
+	}
+}
+
+// runPermissionList prints the permissions, of a role or user when given (joss permission:list)
+func runPermissionList(args []string) {
+	parsed := parsePermissionArgs(args)
+	db, driver, env, err := openSchemaDB(parsed.connection)
+	if err != nil {
+		fmt.Printf("Error conectando a la base de datos: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	prefix := envPrefix(env)
+	core.EnsurePermissionTables(db, driver, prefix)
+
+	var perms []string
+	switch parsed.kind {
+	case "role":
+		perms = core.RolePermissions(db, prefix, parsed.subject)
+		fmt.Printf("Permisos del rol '%s':\n", parsed.subject)
+	case "user":
+		var id int
+		column := "email"
+		if _, err := strconv.Atoi(parsed.subject); err == nil {
+			column = "id"
+		}
+		if db.QueryRow(fmt.Sprintf("SELECT id FROM %susers WHERE %s = ?", prefix, column), parsed.subject).Scan(&id) != nil {
+			fmt.Printf("Error: el usuario '%s' no existe\n", parsed.subject)
+			os.Exit(1)
+		}
+		var role string
+		role, perms = core.UserPermissions(db, prefix, id)
+		fmt.Printf("Permisos del usuario '%s' (rol: %s):\n", parsed.subject, role)
+	default:
+		perms = core.ListPermissions(db, prefix)
+		fmt.Println("Permisos definidos:")
+	}
+	if len(perms) == 0 {
+		fmt.Println("  (ninguno)")
+	}
+	for _, perm := range perms {
+		fmt.Printf("  %s\n", perm)
+	}
+}
+
+func createPolicy(name string) {
+	model := strings.TrimSuffix(name, "Policy")
+	path := filepath.Join("app", "policies", model+"Policy.joss")
+	os.MkdirAll(filepath.Dir(path), 0755)
+
+	content := fmt.Sprintf(`// Política de %[1]s: Auth::can("%[2]s.update", $%[2]s) llama a update($user, $%[2]s)
+class %[1]sPolicy {
+    // Retorna true/false para decidir antes que los demás métodos, o null para continuar
+    function before($user, $ability) {
+        return null
+    }
+
+    function view($user, $%[2]s) {
+        return true
+    }
+
+    function update($user, $%[2]s) {
+        return $user->id == $%[2]s->user_id
+    }
+
+    function delete($user, $%[2]s) {
+        return $user->id == $%[2]s->user_id
+    }
+}
+`, model, strings.ToLower(model))
+
+	writeGenFile(path, content)
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jossecurity/joss/pkg/core"
+)
+
+const schemaDumpPath = "app/database/schema.json"
+
+// frameworkTables are created by the runtime itself (Auth, Cron, Storage,
+// migrations), so they never get a generated migration
+var frameworkTables = []string{"migration", "cron", "users", "roles", "password_resets", "storage"}
+
+// schemaSnapshot is the portable description written by schema:dump. Column
+// types are given both as reported by the engine and as Blueprint types, so
+// the snapshot can be read back on any driver.
+type schemaSnapshot struct {
+	Driver      string        `json:"driver"`
+	Connection  string        `json:"connection,omitempty"`
+	GeneratedAt string        `json:"generated_at"`
+	Prefix      string        `json:"prefix"`
+	Migrations  []string      `json:"migrations"`
+	Tables      []schemaTable `json:"tables"`
+}
+
+type schemaTable struct {
+	Name        string             `json:"name"`
+	Columns     []ColumnSchema     `json:"columns"`
+	Indexes     []IndexSchema      `json:"indexes,omitempty"`
+	ForeignKeys []ForeignKeySchema `json:"foreign_keys,omitempty"`
+}
+
+// schemaOptions are the flags of schema:dump and make:migration --from-db
+type schemaOptions struct {
+	path       string
+	connection string
+	tables     []string
+	record     bool
+}
+
+func parseSchemaArgs(args []string) schemaOptions {
+	opts := schemaOptions{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--from-db":
+		case arg == "--record":
+			opts.record = true
+		case arg == "--path" && i+1 < len(args):
+			opts.path = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--path="):
+			opts.path = strings.TrimPrefix(arg, "--path=")
+		case arg == "--connection" && i+1 < len(args):
+			opts.connection = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--connection="):
+			opts.connection = strings.TrimPrefix(arg, "--connection=")
+		case !strings.HasPrefix(arg, "--"):
+			opts.tables = append(opts.tables, arg)
+		}
+	}
+	return opts
+}
+
+// openSchemaDB connects to the default or a named connection without
+// creating the Auth/Cron tables, so legacy databases are only read
+func openSchemaDB(connection string) (*sql.DB, string, map[string]string, error) {
+	env := readEnvFile(GetEnvFile())
+	if connection != "" {
+		names := core.ConnectionNames(env)
+		switch i := indexOf(names, connection); {
+		case i < 0:
+			return nil, "", nil, fmt.Errorf("la conexión '%s' no está definida en DB_CONNECTIONS", connection)
+		case i > 0:
+			env = core.ConnectionEnv(env, connection)
+		}
+	}
+	driver := core.NormalizeDriver(env["DB"])
+	db, err := connectToDB(driver, env)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, "", nil, err
+	}
+	return db, driver, env, nil
+}
+
+func envPrefix(env map[string]string) string {
+	if val, ok := env["PREFIX"]; ok {
+		return val
+	}
+	return "js_"
+}
+
+// runSchemaDump writes the schema snapshot (joss schema:dump)
+func runSchemaDump(args []string) {
+	opts := parseSchemaArgs(args)
+	db, driver, env, err := openSchemaDB(opts.connection)
+	if err != nil {
+		fmt.Printf("Error conectando a la base de datos: %v\n", err)
+		return
+	}
+	defer db.Close()
+
+	snapshot, err := inspectSchema(db, driver, env, opts.tables)
+	if err != nil {
+		fmt.Printf("Error leyendo el esquema: %v\n", err)
+		return
+	}
+	snapshot.Connection = opts.connection
+
+	path := opts.path
+	if path == "" {
+		path = schemaDumpPath
+	}
+	data, _ := json.MarshalIndent(snapshot, "", "  ")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		fmt.Printf("Error escribiendo %s: %v\n", path, err)
+		return
+	}
+	fmt.Printf("Esquema de %d tablas guardado en %s\n", len(snapshot.Tables), path)
+}
+
+// inspectSchema reads the tables (all, or the given ones) of db. Framework
+// tables are skipped unless asked for by name.
+func inspectSchema(db *sql.DB, driver string, env map[string]string, only []string) (*schemaSnapshot, error) {
+	prefix := envPrefix(env)
+	snapshot := &schemaSnapshot{
+		Driver:      driver,
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Prefix:      prefix,
+		Migrations:  executedMigrations(db, prefix),
+	}
+
+	all, err := getTables(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if len(only) > 0 {
+		for _, name := range only {
+			table := resolveTableName(all, name, prefix)
+			if table == "" {
+				return nil, fmt.Errorf("no existe la tabla '%s'", name)
+			}
+			names = append(names, table)
+		}
+	} else {
+		for _, table := range all {
+			if strings.HasPrefix(table, "sqlite_") || isFrameworkTable(table, prefix) {
+				continue
+			}
+			names = append(names, table)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		table, err := inspectTable(db, driver, name)
+		if err != nil {
+			return nil, fmt.Errorf("tabla %s: %v", name, err)
+		}
+		snapshot.Tables = append(snapshot.Tables, table)
+	}
+	return snapshot, nil
+}
+
+// resolveTableName finds name in tables, with or without the prefix
+func resolveTableName(tables []string, name, prefix string) string {
+	for _, candidate := range []string{name, prefix + name} {
+		for _, t := range tables {
+			if t == candidate {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+func isFrameworkTable(table, prefix string) bool {
+	for _, name := range frameworkTables {
+		if table == prefix+name {
+			return true
+		}
+	}
+	return false
+}
+
+// executedMigrations lists the migration records, if the table exists
+func executedMigrations(db *sql.DB, prefix string) []string {
+	migrations := []string{}
+	rows, err := db.Query(fmt.Sprintf("SELECT migration FROM %smigration ORDER BY id", prefix))
+	if err != nil {
+		return migrations
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			migrations = append(migrations, name)
+		}
+	}
+	return migrations
+}
+
+// inspectTable reads a table with the introspection of gen_db.go
+func inspectTable(db *sql.DB, driver, table string) (schemaTable, error) {
+	t := schemaTable{Name: table}
+	var err error
+	if t.Columns, err = getColumns(db, driver, table); err != nil {
+		return t, err
+	}
+	if t.ForeignKeys, err = getForeignKeys(db, driver, table); err != nil {
+		return t, err
+	}
+	if t.Indexes, err = getIndexes(db, driver, table, t.ForeignKeys); err != nil {
+		return t, err
+	}
+	for i := range t.Columns {
+		t.Columns[i].Blueprint, _ = blueprintType(t.Columns[i])
+	}
+	return t, nil
+}
+
+func containsName(list []string, name string) bool {
+	return indexOf(list, name) >= 0
+}
+
+func indexOf(list []string, name string) int {
+	for i, s := range list {
+		if s == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// blueprintType maps an engine type to the Blueprint type used by Schema
+// ("string(255)", "decimal(10,2)", "bigInteger|unsigned"...). ok is false
+// for types without a Blueprint equivalent, which map to text.
+func blueprintType(col ColumnSchema) (string, bool) {
+	t := strings.ToLower(strings.TrimSpace(col.Type))
+	unsigned := strings.Contains(t, "unsigned")
+	t = strings.TrimSpace(strings.NewReplacer("unsigned", "", "zerofill", "").Replace(t))
+	base, args := t, ""
+	if i := strings.Index(t, "("); i >= 0 {
+		base = strings.TrimSpace(t[:i])
+		if j := strings.LastIndex(t, ")"); j > i {
+			args = t[i+1 : j]
+		}
+	}
+
+	// The width of an auto-increment key follows its integer type. SQLite
+	// reports INTEGER for both, which Schema creates the same way
+	if col.AutoIncrement {
+		switch base {
+		case "bigint", "int8", "bigserial":
+			return "bigIncrements", true
+		case "mediumint":
+			return "mediumIncrements", true
+		case "smallint", "int2", "smallserial", "tinyint":
+			return "smallIncrements", true
+		}
+		return "increments", true
+	}
+
+	var bp string
+	switch base {
+	case "tinyint":
+		bp = "tinyInteger"
+		if args == "1" {
+			return "boolean", true
+		}
+	case "smallint", "int2":
+		bp = "smallInteger"
+	case "mediumint":
+		bp = "mediumInteger"
+	case "int", "integer", "int4":
+		bp = "integer"
+	case "bigint", "int8":
+		bp = "bigInteger"
+	case "smallserial":
+		return "smallIncrements", true
+	case "serial":
+		return "increments", true
+	case "bigserial":
+		return "bigIncrements", true
+	case "bool", "boolean":
+		return "boolean", true
+	case "decimal", "numeric":
+		if args == "" {
+			args = "8,2"
+		}
+		return "decimal(" + strings.ReplaceAll(args, " ", "") + ")", true
+	case "float", "real", "float4":
+		return "float", true
+	case "double", "double precision", "float8":
+		return "double", true
+	case "char", "character", "bpchar":
+		if args == "" {
+			args = "255"
+		}
+		return "char(" + args + ")", true
+	case "varchar", "character varying", "nvarchar", "varchar2":
+		if args == "" {
+			args = "255"
+		}
+		return "string(" + args + ")", true
+	case "uuid":
+		return "char(36)", true
+	case "text", "tinytext", "clob":
+		return "text", true
+	case "mediumtext":
+		return "mediumText", true
+	case "longtext":
+		return "longText", true
+	case "date":
+		return "date", true
+	case "datetime":
+		return "dateTime", true
+	case "timestamp", "timestamp without time zone", "timestamp with time zone", "timestamptz":
+		return "timestamp", true
+	case "time", "time without time zone":
+		return "time", true
+	case "json", "jsonb":
+		return "json", true
+	case "enum":
+		return "enum(" + args + ")", true
+	default:
+		return "text", false
+	}
+	if unsigned {
+		bp += "|unsigned"
+	}
+	return bp, true
+}
+
+// runMigrationFromDB generates Schema::create migrations for the tables of
+// an existing database (joss make:migration --from-db [tabla...]). With
+// --record they are also marked as executed, since the tables already exist.
+func runMigrationFromDB(args []string) {
+	opts := parseSchemaArgs(args)
+	db, driver, env, err := openSchemaDB(opts.connection)
+	if err != nil {
+		fmt.Printf("Error conectando a la base de datos: %v\n", err)
+		return
+	}
+	defer db.Close()
+
+	snapshot, err := inspectSchema(db, driver, env, opts.tables)
+	if err != nil {
+		fmt.Printf("Error leyendo el esquema: %v\n", err)
+		return
+	}
+	if len(snapshot.Tables) == 0 {
+		fmt.Println("No hay tablas para generar migraciones.")
+		return
+	}
+
+	prefix := snapshot.Prefix
+	start := time.Now()
+	var generated []string
+	for i, table := range orderByForeignKeys(snapshot.Tables) {
+		name := strings.TrimPrefix(table.Name, prefix)
+		if prefix != "" && !strings.HasPrefix(table.Name, prefix) {
+			fmt.Printf("Advertencia: la tabla %s no tiene el prefijo %s; Schema::create se lo agregará\n", table.Name, prefix)
+		}
+		filename := fmt.Sprintf("%s_create_%s_table.joss", start.Add(time.Duration(i)*time.Second).Format("20060102150405"), name)
+		path := filepath.Join(migrationsDir, filename)
+		os.MkdirAll(migrationsDir, 0755)
+		if err := os.WriteFile(path, []byte(migrationFromTable(table, name, prefix, opts.connection)), 0644); err != nil {
+			fmt.Printf("Error escribiendo %s: %v\n", path, err)
+			return
+		}
+		fmt.Printf("Creado: %s\n", path)
+		generated = append(generated, filename)
+	}
+
+	if opts.record {
+		recordGeneratedMigrations(generated)
+		return
+	}
+	fmt.Println("Las migraciones no se registraron como ejecutadas (usa --record si las tablas ya existen en la base de datos donde corre joss migrate).")
+}
+
+// recordGeneratedMigrations marks the new files as run in the default
+// database (the tables already exist there) as one batch
+func recordGeneratedMigrations(files []string) {
+	env := readEnvFile(GetEnvFile())
+	db, err := connectToDB(core.NormalizeDriver(env["DB"]), env)
+	if err != nil {
+		fmt.Printf("Advertencia: no se pudieron registrar las migraciones: %v\n", err)
+		return
+	}
+	defer db.Close()
+
+	rt := core.NewRuntime()
+	rt.DB = db
+	rt.Env = env
+	rt.EnsureMigrationTable()
+	batch := rt.GetNextBatch()
+	for _, file := range files {
+		rt.LogMigration(file, batch)
+	}
+	fmt.Printf("%d migraciones registradas como ejecutadas (Batch %d): las tablas ya existen en esta base de datos.\n", len(files), batch)
+}
+
+// orderByForeignKeys sorts tables so referenced tables are created first
+func orderByForeignKeys(tables []schemaTable) []schemaTable {
+	byName := map[string]schemaTable{}
+	for _, t := range tables {
+		byName[t.Name] = t
+	}
+	var ordered []schemaTable
+	state := map[string]int{} // 1 = visiting, 2 = done
+	var visit func(t schemaTable)
+	visit = func(t schemaTable) {
+		if state[t.Name] != 0 {
+			return // done, or a cycle: keep the current order
+		}
+		state[t.Name] = 1
+		for _, fk := range t.ForeignKeys {
+			if dep, ok := byName[fk.On]; ok && fk.On != t.Name {
+				visit(dep)
+			}
+		}
+		state[t.Name] = 2
+		ordered = append(ordered, t)
+	}
+	for _, t := range tables {
+		visit(t)
+	}
+	return ordered
+}
+
+// migrationFromTable writes the migration class that recreates table
+func migrationFromTable(table schemaTable, name, prefix, connection string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Migration: create_%s_table\n// Generada desde la base de datos (%s) el %s\n\n",
+		name, table.Name, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, "class Create%sTable extends Migration {\n", snakeToCamel(name))
+	if connection != "" {
+		fmt.Fprintf(&sb, "    Init constructor() {\n        $this->connection = %s\n    }\n\n", jossString(connection))
+	}
+	fmt.Fprintf(&sb, "    func up() {\n        Schema::create(%s, func($table) {\n", jossString(name))
+	for _, line := range blueprintLines(table, prefix) {
+		fmt.Fprintf(&sb, "            %s\n", line)
+	}
+	fmt.Fprintf(&sb, "        })\n    }\n\n    func down() {\n        Schema::drop(%s)\n    }\n}\n", jossString(name))
+	return sb.String()
+}
+
+// blueprintLines returns the $table->... statements of a table
+func blueprintLines(table schemaTable, prefix string) []string {
+	var lines []string
+	var primary []string
+	for _, col := range table.Columns {
+		if col.Primary {
+			primary = append(primary, col.Name)
+		}
+	}
+
+	// Single-column unique indexes without a custom name (SQLite autoindex,
+	// MySQL names them after the column) become ->unique() on the column
+	uniqueCols := map[string]bool{}
+	var indexes []IndexSchema
+	for _, idx := range table.Indexes {
+		if idx.Unique && len(idx.Columns) == 1 && (idx.Name == "" || idx.Name == idx.Columns[0] ||
+			idx.Name == conventionalIndex(table.Name, idx.Columns, "unique")) {
+			uniqueCols[idx.Columns[0]] = true
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+
+	cols := table.Columns
+	for i := 0; i < len(cols); i++ {
+		col := cols[i]
+		// created_at + updated_at -> timestamps(), deleted_at -> softDeletes()
+		if col.Name == "created_at" && i+1 < len(cols) && cols[i+1].Name == "updated_at" &&
+			isNullableTimestamp(col) && isNullableTimestamp(cols[i+1]) {
+			lines = append(lines, "$table->timestamps()")
+			i++
+			continue
+		}
+		if col.Name == "deleted_at" && isNullableTimestamp(col) {
+			lines = append(lines, "$table->softDeletes()")
+			continue
+		}
+		lines = append(lines, columnLine(col, uniqueCols[col.Name]))
+	}
+
+	if len(primary) > 1 || (len(primary) == 1 && !isAutoIncrement(table, primary[0])) {
+		lines = append(lines, fmt.Sprintf("// Llave primaria (%s): Blueprint solo crea llaves autoincrementales, agrégala con GranDB::query()", strings.Join(primary, ", ")))
+	}
+
+	for _, idx := range indexes {
+		method := "index"
+		suffix := "index"
+		if idx.Unique {
+			method, suffix = "unique", "unique"
+		}
+		line := fmt.Sprintf("$table->%s(%s", method, jossColumns(idx.Columns))
+		if idx.Name != "" && idx.Name != conventionalIndex(table.Name, idx.Columns, suffix) {
+			line += ", " + jossString(idx.Name)
+		}
+		lines = append(lines, line+")")
+	}
+
+	for _, fk := range table.ForeignKeys {
+		line := fmt.Sprintf("$table->foreign(%s", jossColumns(fk.Columns))
+		if fk.Name != "" && fk.Name != conventionalIndex(table.Name, fk.Columns, "foreign") {
+			line += ", " + jossString(fk.Name)
+		}
+		line += ")"
+		if len(fk.References) != 1 || fk.References[0] != "id" {
+			line += fmt.Sprintf("->references(%s)", jossString(strings.Join(fk.References, ",")))
+		}
+		line += fmt.Sprintf("->on(%s)", jossString(strings.TrimPrefix(fk.On, prefix)))
+		if fk.OnDelete != "" {
+			line += fmt.Sprintf("->onDelete(%s)", jossString(fk.OnDelete))
+		}
+		if fk.OnUpdate != "" {
+			line += fmt.Sprintf("->onUpdate(%s)", jossString(fk.OnUpdate))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func isAutoIncrement(table schemaTable, column string) bool {
+	for _, col := range table.Columns {
+		if col.Name == column {
+			return col.AutoIncrement
+		}
+	}
+	return false
+}
+
+// conventionalIndex is the name Schema gives an index when none is passed
+func conventionalIndex(table string, columns []string, suffix string) string {
+	return strings.ToLower(table + "_" + strings.Join(columns, "_") + "_" + suffix)
+}
+
+func isNullableTimestamp(col ColumnSchema) bool {
+	bp, _ := blueprintType(col)
+	return col.Nullable && (bp == "timestamp" || bp == "dateTime") && col.Default == nil
+}
+
+// columnLine writes one column definition with its modifiers
+func columnLine(col ColumnSchema, unique bool) string {
+	bp, ok := blueprintType(col)
+	typeName, typeArgs := bp, ""
+	if i := strings.Index(bp, "("); i >= 0 {
+		typeName, typeArgs = bp[:i], strings.TrimSuffix(bp[i+1:], ")")
+	}
+	unsigned := strings.HasSuffix(typeName, "|unsigned")
+	typeName = strings.TrimSuffix(typeName, "|unsigned")
+
+	var line string
+	switch typeName {
+	case "bigIncrements":
+		if col.Name == "id" {
+			line = "$table->id()"
+		} else {
+			line = fmt.Sprintf("$table->bigIncrements(%s)", jossString(col.Name))
+		}
+	case "string", "char":
+		line = fmt.Sprintf("$table->%s(%s", typeName, jossString(col.Name))
+		if typeArgs != "255" {
+			line += ", " + typeArgs
+		}
+		line += ")"
+	case "decimal":
+		line = fmt.Sprintf("$table->decimal(%s, %s)", jossString(col.Name), strings.ReplaceAll(typeArgs, ",", ", "))
+	case "enum":
+		line = fmt.Sprintf("$table->enum(%s, [%s])", jossString(col.Name), enumValues(typeArgs))
+	default:
+		line = fmt.Sprintf("$table->%s(%s)", typeName, jossString(col.Name))
+	}
+
+	if unsigned {
+		line += "->unsigned()"
+	}
+	if col.Nullable && !col.AutoIncrement {
+		line += "->nullable()"
+	}
+	if unique {
+		line += "->unique()"
+	}
+	if col.Default != nil && !col.AutoIncrement {
+		line += defaultModifier(*col.Default, typeName)
+	}
+	if !ok {
+		line += " // tipo original: " + col.Type
+	}
+	return line
+}
+
+// defaultModifier writes ->default(...); SQL expressions such as
+// CURRENT_TIMESTAMP have no Blueprint equivalent and are left as a comment
+func defaultModifier(val, typeName string) string {
+	if isDefaultExpression(val) {
+		return " // default: " + val
+	}
+	switch typeName {
+	case "boolean":
+		switch strings.ToLower(val) {
+		case "true", "1":
+			return "->default(1)"
+		case "false", "0":
+			return "->default(0)"
+		}
+	case "integer", "tinyInteger", "smallInteger", "mediumInteger", "bigInteger", "float", "double", "decimal":
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return "->default(" + val + ")"
+		}
+	}
+	return "->default(" + jossString(val) + ")"
+}
+
+// enumValues turns "'a','b'" into "\"a\", \"b\""
+func enumValues(args string) string {
+	var vals []string
+	for _, v := range strings.Split(args, ",") {
+		v = strings.Trim(strings.TrimSpace(v), "'")
+		vals = append(vals, jossString(v))
+	}
+	return strings.Join(vals, ", ")
+}
+
+func jossString(s string) string {
+	return strconv.Quote(s)
+}
+
+func jossColumns(columns []string) string {
+	if len(columns) == 1 {
+		return jossString(columns[0])
+	}
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = jossString(c)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	seedersDir   = "app/database/seeders"
+	factoriesDir = "app/database/factories"
+)
+
+// runSeed runs DatabaseSeeder, the seeder given with --class, or every
+// seeder of app/database/seeders when there is no DatabaseSeeder
+func runSeed(args []string) {
+	fmt.Println("Sembrando la base de datos...")
+	defer recoverMigrationPanic()
+
+	class := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--class" && i+1 < len(args):
+			class = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--class="):
+			class = strings.TrimPrefix(args[i], "--class=")
+		}
+	}
+
+	rt := connectMigrations(false)
+	if rt == nil {
+		return
+	}
+	rt.LoadClassDirs("app/models", factoriesDir, seedersDir)
+
+	seeders := []string{class}
+	if class == "" {
+		seeders = seederClasses()
+		for _, name := range seeders {
+			if name == "DatabaseSeeder" {
+				seeders = []string{name}
+				break
+			}
+		}
+	}
+	if len(seeders) == 0 {
+		fmt.Printf("No se encontraron seeders en %s/\n", seedersDir)
+		return
+	}
+	for _, name := range seeders {
+		rt.RunSeeder(name)
+	}
+	fmt.Println("Base de datos sembrada.")
+}
+
+// seederClasses lists the seeder names (file names) of app/database/seeders
+func seederClasses() []string {
+	files, _ := filepath.Glob(seedersDir + "/*.joss")
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), ".joss"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func createSeeder(name string) {
+	if !strings.HasSuffix(name, "Seeder") {
+		name += "Seeder"
+	}
+	path := filepath.Join(seedersDir, name+".joss")
+	os.MkdirAll(seedersDir, 0755)
+	content := fmt.Sprintf(`class %s extends Seeder {
+    func run() {
+        // Usuarios de Auth (contraseña "password")
+        Factory::users(10)->create()
+
+        // Otros seeders:
+        // $this->call(["RoleSeeder"])
+    }
+}
+`, name)
+	writeGenFile(path, content)
+}
+
+func createFactory(name string) {
+	model := strings.TrimSuffix(name, "Factory")
+	path := filepath.Join(factoriesDir, model+"Factory.joss")
+	os.MkdirAll(factoriesDir, 0755)
+	content := fmt.Sprintf(`class %sFactory extends Factory {
+    func definition() {
+        return {
+            "name": Faker::name(),
+            "created_at": Faker::dateTimeBetween("-1 year")
+        }
+    }
+}
+`, model)
+	writeGenFile(path, content)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jossecurity/joss/pkg/core"
+	"github.com/jossecurity/joss/pkg/parser"
+)
+
+// runTests executes the Joss test suite.
+//
+//	joss test [ruta] [--coverage[=dir]]
+//
+// Every *.joss file under tests/ (or the given file/dir) is loaded in a fresh
+// runtime. Classes whose name ends in "Test" have each method starting with
+// "test" run on a new instance (setUp() first, if defined); a panic or failed
+// assertion fails that test. Files without test classes count as one test.
+func runTests(args []string) {
+	target := "tests"
+	coverageDir := ""
+	for _, arg := range args {
+		switch {
+		case arg == "--coverage":
+			coverageDir = "coverage"
+		case strings.HasPrefix(arg, "--coverage="):
+			coverageDir = strings.TrimPrefix(arg, "--coverage=")
+		default:
+			target = arg
+		}
+	}
+
+	files, err := findTestFiles(target)
+	if err != nil || len(files) == 0 {
+		fmt.Printf("No se encontraron tests en %s\n", target)
+		os.Exit(1)
+	}
+
+	if coverageDir != "" {
+		cov := core.StartCoverage()
+		// Only the tests themselves: target may be "." or any project folder
+		cov.Exclude = append([]string{"tests"}, files...)
+	}
+
+	start := time.Now()
+	passed, failed := 0, 0
+	var failures []string
+
+	for _, file := range files {
+		fmt.Printf("\n%s\n", file)
+		results := runTestFile(file)
+		for _, res := range results {
+			if res.err == "" {
+				passed++
+				fmt.Printf("  ✓ %s\n", res.name)
+			} else {
+				failed++
+				fmt.Printf("  ✗ %s\n      %s\n", res.name, res.err)
+				failures = append(failures, fmt.Sprintf("%s > %s: %s", file, res.name, res.err))
+			}
+		}
+	}
+
+	fmt.Printf("\nTests: %d pasaron, %d fallaron (%s)\n", passed, failed, time.Since(start).Round(time.Millisecond))
+
+	if coverageDir != "" {
+		cov := core.StopCoverage()
+		covered, total := cov.Totals()
+		percent := 100.0
+		if total > 0 {
+			percent = 100 * float64(covered) / float64(total)
+		}
+		fmt.Printf("Cobertura: %.1f%% (%d/%d líneas)\n", percent, covered, total)
+		written, err := cov.WriteReports(coverageDir)
+		if err != nil {
+			fmt.Printf("Error escribiendo reporte de cobertura: %v\n", err)
+		}
+		for _, f := range written {
+			fmt.Printf("  -> %s\n", f)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+type testResult struct {
+	name string
+	err  string
+}
+
+func findTestFiles(target string) ([]string, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{target}, nil
+	}
+	var files []string
+	err = filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && isTestFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// isTestFile reports whether a .joss file found in a folder is a test: it
+// lives under a tests/ folder or its name ends in Test.joss. This keeps
+// "joss test ." from running the controllers and models of the project.
+func isTestFile(path string) bool {
+	if !strings.HasSuffix(path, ".joss") {
+		return false
+	}
+	if strings.HasSuffix(filepath.Base(path), "Test.joss") {
+		return true
+	}
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if dir == "tests" {
+			return true
+		}
+	}
+	return false
+}
+
+// runTestFile loads one test file and runs its test methods
+func runTestFile(file string) (results []testResult) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return []testResult{{name: filepath.Base(file), err: err.Error()}}
+	}
+
+	l := parser.NewLexer(string(data))
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return []testResult{{name: filepath.Base(file), err: "Errores de parseo: " + strings.Join(p.Errors(), "; ")}}
+	}
+
+	rt := core.NewRuntime()
+	core.RegisterSource(program, file)
+	// Models, policies, factories and seeders are available to the tests
+	rt.LoadClassDirs("app/models", "app/policies", "app/database/factories", "app/database/seeders")
+
+	// Loading the file registers classes (and runs Main/top-level code, if any)
+	if msg := catchPanic(func() { rt.Execute(program) }); msg != "" {
+		return []testResult{{name: filepath.Base(file), err: msg}}
+	}
+
+	for _, stmt := range program.Statements {
+		cls, ok := stmt.(*parser.ClassStatement)
+		if !ok || !strings.HasSuffix(cls.Name.Value, "Test") {
+			continue
+		}
+		var setUp *parser.MethodStatement
+		var tests []*parser.MethodStatement
+		for _, s := range cls.Body.Statements {
+			if m, ok := s.(*parser.MethodStatement); ok {
+				if m.Name.Value == "setUp" {
+					setUp = m
+				} else if strings.HasPrefix(m.Name.Value, "test") {
+					tests = append(tests, m)
+				}
+			}
+		}
+
+		for _, m := range tests {
+			name := cls.Name.Value + "::" + m.Name.Value
+			msg := catchPanic(func() {
+				instance := rt.NewInstance(cls.Name.Value)
+				defer rt.QueryFrame(name, file)()
+				if setUp != nil {
+					rt.CallMethodEvaluated(setUp, instance, nil)
+				}
+				rt.CallMethodEvaluated(m, instance, nil)
+			})
+			results = append(results, testResult{name: name, err: msg})
+		}
+	}
+
+	if len(results) == 0 {
+		results = append(results, testResult{name: filepath.Base(file)})
+	}
+	return results
+}
+
+func catchPanic(fn func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprintf("%v", r)
+		}
+	}()
+	fn()
+	return ""
+}
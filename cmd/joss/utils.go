@@ -88,18 +88,35 @@ func printHelp() {
 	fmt.Println("Comandos disponibles:")
 	fmt.Printf("  server start            - %s\n", tr("startServerWeb"))
 	fmt.Printf("  program start           - %s\n", tr("startProgramDesktop"))
-	fmt.Printf("  run [archivo]           - %s\n", tr("runJossScript"))
+	fmt.Printf("  run [archivo] [--profile] - %s\n", tr("runJossScript"))
+	fmt.Printf("  test [ruta] [--coverage]- %s\n", tr("runJossTests"))
 	fmt.Printf("  build [web|program]     - %s\n", tr("compileProjectDist"))
 	fmt.Printf("  make:controller [Name]  - %s\n", tr("CreateController"))
 	fmt.Printf("  make:middleware [Name]  - %s\n", tr("CreateMiddleware"))
 	fmt.Printf("  make:model [Name]       - %s\n", tr("CreateModel"))
+	fmt.Printf("  make:policy [Model]     - %s\n", tr("createPolicy"))
 	fmt.Printf("  make:view [Name]        - %s\n", tr("CreateView"))
 	fmt.Printf("  make:mvc [Name]         - %s\n", tr("CreateMVC"))
 	fmt.Printf("  make:crud [Tabla]       - %s\n", tr("CreateCRUD"))
 	fmt.Printf("  remove:crud [Tabla]     - %s\n", tr("removeCRUD"))
 	fmt.Printf("  make:migration [Name]   - %s\n", tr("createMigration"))
-	fmt.Printf("  migrate                 - %s\n", tr("exeMigrate"))
+	fmt.Printf("  make:migration --from-db [Table] - %s\n", tr("createMigrationFromDB"))
+	fmt.Printf("  schema:dump [--path=F]  - %s\n", tr("schemaDump"))
+	fmt.Printf("  migrate [--pretend]     - %s\n", tr("exeMigrate"))
 	fmt.Printf("  migrate:fresh           - %s\n", tr("exeMigrateFresh"))
+	fmt.Printf("  migrate:rollback [--step=N] - %s\n", tr("exeMigrateRollback"))
+	fmt.Printf("  migrate:reset           - %s\n", tr("exeMigrateReset"))
+	fmt.Printf("  migrate:refresh         - %s\n", tr("exeMigrateRefresh"))
+	fmt.Printf("  migrate:status          - %s\n", tr("exeMigrateStatus"))
+	fmt.Printf("  make:seeder [Name]      - %s\n", tr("createSeeder"))
+	fmt.Printf("  make:factory [Model]    - %s\n", tr("createFactory"))
+	fmt.Printf("  db:seed [--class=Name]  - %s\n", tr("exeDbSeed"))
+	fmt.Printf("  db:backup [--gzip] [--tables=a,b] - %s\n", tr("dbBackup"))
+	fmt.Printf("  db:restore [file]       - %s\n", tr("dbRestore"))
+	fmt.Printf("  permission:grant [perm] --role=R|--user=E - %s\n", tr("permissionGrant"))
+	fmt.Printf("  permission:revoke [perm] --role=R|--user=E - %s\n", tr("permissionRevoke"))
+	fmt.Printf("  permission:list [--role=R|--user=E] - %s\n", tr("permissionList"))
+	fmt.Printf("  oauth:mock [--port=9400] [--email=E] - %s\n", tr("oauthMock"))
 	fmt.Printf("  new [web|console] [path]- %s\n", tr("createProject"))
 	fmt.Printf("  change db [motor]       - %s\n", tr("changeDBMotor"))
 	fmt.Printf("  change db prefix [pref] - %s\n", tr("changeDBPrefix"))
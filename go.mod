@@ -9,6 +9,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/jchv/go-webview2 v0.0.0-20250406165304-0bcfea011047
+	github.com/lib/pq v1.10.9
 	github.com/oracle/oci-go-sdk/v65 v65.105.0
 	github.com/redis/go-redis/v9 v9.17.1
 	golang.org/x/crypto v0.45.0
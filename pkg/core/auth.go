@@ -76,10 +76,10 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 					"role_id":          roleId,
 					"token_expires_at": tokenExpires,
 					"verificado":       0,
-					// created_at / updated_at handled automatically by insertFromMap if omitted
 				}
+				stampColumns(insertData, true, "CURRENT_TIMESTAMP")
 
-				if r.insertFromMap(usersTable, insertData) {
+				if r.insertFromMap(r.ownConnection(), usersTable, insertData) {
 					fmt.Println("[Security] Usuario registrado exitosamente.")
 					return userToken
 				}
@@ -101,6 +101,12 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 				panic("Auth Error: No hay conexión a la base de datos configurada")
 			}
 
+			// Cuenta o IP bloqueada por intentos fallidos: ni siquiera se compara la contraseña
+			if wait := r.loginLockedFor(prefix, email); wait > 0 {
+				LogWarning("[Auth] Login blocked for '%s' (%s remaining)", email, wait)
+				return false
+			}
+
 			// Variables para Scan
 			var storedHash sql.NullString
 			var userId int
@@ -108,58 +114,40 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			var userToken sql.NullString
 			var roleName sql.NullString
 			var verificado int
+			var twoFactorConfirmed sql.NullString
 
 			// Join con roles
 			query := fmt.Sprintf(`
-				SELECT u.id, u.user_token, u.username, u.password, u.verificado, r.name 
+				SELECT u.id, u.user_token, u.username, u.password, u.verificado, r.name, u.two_factor_confirmed_at 
 				FROM %s u 
 				LEFT JOIN %s r ON u.role_id = r.id 
 				WHERE u.email = ?`, usersTable, rolesTable)
 
-			err := r.GetDB().QueryRow(query, email).Scan(&userId, &userToken, &userName, &storedHash, &verificado, &roleName)
+			err := r.Conn().QueryRow(query, email).Scan(&userId, &userToken, &userName, &storedHash, &verificado, &roleName, &twoFactorConfirmed)
 			if err != nil {
 				if err == sql.ErrNoRows {
 					LogError("[Auth] User not found for email: '%s'", email)
 				} else {
 					LogError("[Auth] Database error looking up '%s': %v", email, err)
 				}
+				r.recordLoginFailure(prefix, email)
 				return false
 			}
 
-			if verificado == 0 {
-				LogError("[Auth] Account not verified for '%s'", email)
-				return false // Fallar si no está verificado
-			}
-
 			err = bcrypt.CompareHashAndPassword([]byte(storedHash.String), []byte(password))
 			if err != nil {
 				LogError("[Auth] Password mismatch for '%s'", email)
+				r.recordLoginFailure(prefix, email)
 				return false
 			}
 
-			LogInfo("[Auth] Login successful for '%s' (ID: %d)", email, userId)
-
-			// Guardar en Sesión ($__session)
-			if sessVal, ok := r.Variables["$__session"]; ok {
-				if sessInst, ok := sessVal.(*Instance); ok {
-					sessInst.Fields["user_id"] = userId
-					sessInst.Fields["user_token"] = userToken.String
-					sessInst.Fields["user_name"] = userName.String
-					sessInst.Fields["user_email"] = email
-					sessInst.Fields["user_role"] = roleName.String
-					sessInst.Fields["last_login_at"] = time.Now().Format("2006-01-02 15:04:05")
-				}
-			}
-
-			// Actualizar last_login_at
-			updateQuery := fmt.Sprintf("UPDATE %s SET last_login_at = %s WHERE id = ?", usersTable, "CURRENT_TIMESTAMP")
-			if val, ok := r.Env["DB"]; ok && val == "mysql" {
-				updateQuery = fmt.Sprintf("UPDATE %s SET last_login_at = NOW() WHERE id = ?", usersTable)
+			twoFactor := twoFactorConfirmed.Valid && twoFactorConfirmed.String != ""
+			result, err := r.authenticatedLogin(prefix, usersTable, userId, email, userName.String, userToken.String, roleName.String, verificado != 0, twoFactor)
+			if err != nil {
+				LogError("[Auth] Login refused for '%s': %v", email, err)
+				return false
 			}
-			r.GetDB().Exec(updateQuery, userId)
-
-			// Retornar JWT Token
-			return r.generateJWT(userId, email, userName.String, roleName.String, false)
+			return result
 		}
 
 	case "check":
@@ -183,7 +171,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 
 			// Verificar existencia y expiración
 			query := fmt.Sprintf("SELECT id, token_expires_at FROM %s WHERE user_token = ? AND verificado = 0 LIMIT 1", usersTable)
-			err := r.GetDB().QueryRow(query, token).Scan(&id, &expiresAtStr)
+			err := r.Conn().QueryRow(query, token).Scan(&id, &expiresAtStr)
 
 			if err != nil {
 				return false // Token not found
@@ -206,7 +194,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			}
 
 			update := fmt.Sprintf("UPDATE %s SET verificado = 1 WHERE id = ?", usersTable)
-			_, err = r.GetDB().Exec(update, id)
+			_, err = r.Conn().Exec(update, id)
 
 			if err == nil {
 				return true
@@ -224,7 +212,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			// Verificar si existe el usuario
 			var userId int
 			queryCheck := fmt.Sprintf("SELECT id FROM %s WHERE email = ?", usersTable)
-			err := r.GetDB().QueryRow(queryCheck, email).Scan(&userId)
+			err := r.Conn().QueryRow(queryCheck, email).Scan(&userId)
 			if err != nil {
 				return false // Usuario no existe, por seguridad retornamos falso o genérico
 			}
@@ -235,7 +223,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			expiresAt := time.Now().Add(1 * time.Hour) // 1 Hora de validez
 
 			query := fmt.Sprintf("INSERT INTO %s (email, token, expires_at) VALUES (?, ?, ?)", resetsTable)
-			_, err = r.GetDB().Exec(query, email, token, expiresAt)
+			_, err = r.Conn().Exec(query, email, token, expiresAt)
 
 			if err == nil {
 				// Retornamos el token para que el controlador envíe el email usando SmtpClient
@@ -261,7 +249,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			var used int
 
 			query := fmt.Sprintf("SELECT email, expires_at, used FROM %s WHERE token = ? LIMIT 1", resetsTable)
-			err := r.GetDB().QueryRow(query, token).Scan(&email, &expiresAtStr, &used)
+			err := r.Conn().QueryRow(query, token).Scan(&email, &expiresAtStr, &used)
 
 			if err != nil {
 				fmt.Printf("[Auth Debug] Token Scan Error: %v\n", err) // Debug log
@@ -296,14 +284,14 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 
 			// Actualizar contraseña usuario
 			updUser := fmt.Sprintf("UPDATE %s SET password = ? WHERE email = ?", usersTable)
-			_, err = r.GetDB().Exec(updUser, hashedPassword, email)
+			_, err = r.Conn().Exec(updUser, hashedPassword, email)
 			if err != nil {
 				return false
 			}
 
 			// Marcar token como usado
 			updToken := fmt.Sprintf("UPDATE %s SET used = 1 WHERE token = ?", resetsTable)
-			r.GetDB().Exec(updToken, token)
+			r.Conn().Exec(updToken, token)
 
 			return true
 		}
@@ -318,7 +306,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			var id int
 			var verificado int
 			query := fmt.Sprintf("SELECT id, verificado FROM %s WHERE email = ?", usersTable)
-			err := r.GetDB().QueryRow(query, email).Scan(&id, &verificado)
+			err := r.Conn().QueryRow(query, email).Scan(&id, &verificado)
 
 			if err != nil {
 				return false
@@ -333,7 +321,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 			newExpiry := time.Now().Add(24 * time.Hour).Format("2006-01-02 15:04:05")
 
 			update := fmt.Sprintf("UPDATE %s SET user_token = ?, token_expires_at = ? WHERE id = ?", usersTable)
-			_, err = r.GetDB().Exec(update, newToken, newExpiry, id)
+			_, err = r.Conn().Exec(update, newToken, newExpiry, id)
 
 			if err == nil {
 				return newToken
@@ -362,7 +350,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 						LEFT JOIN %s r ON u.role_id = r.id 
 						WHERE u.id = ?`, usersTable, rolesTable)
 
-					err := r.GetDB().QueryRow(query, uid).Scan(&id, &username, &firstName, &lastName, &email, &pPhone, &roleId, &roleName, &userToken, &createdAt)
+					err := r.Conn().QueryRow(query, uid).Scan(&id, &username, &firstName, &lastName, &email, &pPhone, &roleId, &roleName, &userToken, &createdAt)
 					if err != nil {
 						fmt.Printf("[Auth Error] User Query Failed for ID %v: %v\n", uid, err)
 					}
@@ -434,6 +422,12 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 		return nil
 
 	case "refresh":
+		// Auth::refresh("jrt_...") rotates a refresh token from Auth::issueTokens
+		if len(args) == 1 {
+			if token, ok := args[0].(string); ok {
+				return r.rotateRefreshToken(prefix, token)
+			}
+		}
 		if len(args) == 1 {
 			if id, ok := args[0].(int); ok {
 				var email, username, roleName string
@@ -452,7 +446,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 					LEFT JOIN %s r ON u.role_id = r.id 
 					WHERE u.id = ?`, usersTable, rolesTable)
 
-				err := r.GetDB().QueryRow(query, id).Scan(&email, &username, &roleName)
+				err := r.Conn().QueryRow(query, id).Scan(&email, &username, &roleName)
 				if err != nil {
 					return false
 				}
@@ -509,7 +503,7 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 				}
 
 				query := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", usersTable, strings.Join(sets, ", "))
-				_, err := r.GetDB().Exec(query, vals...)
+				_, err := r.Conn().Exec(query, vals...)
 				return err == nil
 			}
 		}
@@ -521,12 +515,15 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 					return false
 				}
 				query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", usersTable)
-				_, err := r.GetDB().Exec(query, id)
+				_, err := r.Conn().Exec(query, id)
 				return err == nil
 			}
 		}
 
 	case "logout":
+		if r.GetDB() != nil {
+			r.revokeCurrentJWT(prefix)
+		}
 		if sessVal, ok := r.Variables["$__session"]; ok {
 			if sessInst, ok := sessVal.(*Instance); ok {
 				delete(sessInst.Fields, "user_id")
@@ -535,10 +532,31 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 				delete(sessInst.Fields, "user_email")
 				delete(sessInst.Fields, "user_role")
 				delete(sessInst.Fields, "last_login_at")
+				clearPendingTwoFactor(sessInst.Fields)
 			}
 		}
 		return true
 
+	case "enable2fa", "verify2fa", "disable2fa", "has2fa", "pending2fa", "recoveryCodes", "totp":
+		return r.executeTwoFactorMethod(method, usersTable, rolesTable, args)
+
+	case "unlock", "lockedFor":
+		return r.executeLockoutMethod(method, prefix, args)
+
+	case "revoke":
+		// Auth::revoke($id) revokes a personal token; Auth::revoke($permiso,
+		// $destino) a permission
+		if len(args) >= 2 {
+			return r.executePermissionMethod(method, prefix, args)
+		}
+		return r.executeTokenMethod(method, prefix, args)
+
+	case "can", "cannot", "permissions", "grant":
+		return r.executePermissionMethod(method, prefix, args)
+
+	case "createToken", "tokens", "tokenCan", "issueTokens":
+		return r.executeTokenMethod(method, prefix, args)
+
 	case "validateToken":
 		if len(args) == 1 {
 			tokenString := args[0].(string)
@@ -546,11 +564,11 @@ func (r *Runtime) executeAuthMethod(instance *Instance, method string, args []in
 				tokenString = tokenString[7:]
 			}
 
-			claims, valid := r.ValidateJWT(tokenString)
+			claims, valid := r.authenticateBearer(tokenString)
 			if valid {
 				if sessVal, ok := r.Variables["$__session"]; ok {
 					if sessInst, ok := sessVal.(*Instance); ok {
-						sessInst.Fields["user_id"] = int(claims["user_id"].(float64))
+						sessInst.Fields["user_id"] = claims["user_id"]
 						sessInst.Fields["user_email"] = claims["email"]
 						sessInst.Fields["user_name"] = claims["name"]
 						sessInst.Fields["user_role"] = claims["role"]
@@ -579,7 +597,10 @@ func (r *Runtime) ensureAuthTables(usersTable, rolesTable, prefix string) {
 		name VARCHAR(50) NOT NULL UNIQUE
 	);`, rolesTable)
 
-	if val, ok := r.Env["DB"]; ok && val == "mysql" {
+	isPostgres := r.DBDriver() == "postgres"
+	if isPostgres {
+		createRoles = postgresDDL(createRoles)
+	} else if val, ok := r.Env["DB"]; ok && val == "mysql" {
 		createRoles = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			name VARCHAR(50) NOT NULL UNIQUE
@@ -605,7 +626,9 @@ func (r *Runtime) ensureAuthTables(usersTable, rolesTable, prefix string) {
 		FOREIGN KEY(role_id) REFERENCES %s(id)
 	);`, usersTable, rolesTable)
 
-	if val, ok := r.Env["DB"]; ok && val == "mysql" {
+	if isPostgres {
+		createUsers = postgresDDL(createUsers)
+	} else if val, ok := r.Env["DB"]; ok && val == "mysql" {
 		createUsers = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			user_token VARCHAR(128) NOT NULL,
@@ -626,7 +649,11 @@ func (r *Runtime) ensureAuthTables(usersTable, rolesTable, prefix string) {
 	r.GetDB().Exec(createUsers)
 
 	// 3. Insertar Roles por defecto
-	r.GetDB().Exec(fmt.Sprintf("INSERT OR IGNORE INTO %s (name) VALUES ('admin'), ('client')", rolesTable))
+	if isPostgres {
+		r.GetDB().Exec(fmt.Sprintf("INSERT INTO %s (name) VALUES ('admin'), ('client') ON CONFLICT (name) DO NOTHING", rolesTable))
+	} else {
+		r.GetDB().Exec(fmt.Sprintf("INSERT OR IGNORE INTO %s (name) VALUES ('admin'), ('client')", rolesTable))
+	}
 	if val, ok := r.Env["DB"]; ok && val == "mysql" {
 		r.GetDB().Exec(fmt.Sprintf("INSERT INTO %s (name) VALUES ('admin'), ('client') ON DUPLICATE KEY UPDATE name=name", rolesTable))
 	}
@@ -634,22 +661,25 @@ func (r *Runtime) ensureAuthTables(usersTable, rolesTable, prefix string) {
 	authTablesEnsured = true
 
 	// 4. AUTO-MIGRACIÓN (Esto arregla el problema de SQLite)
-	isMySQL := false
-	if val, ok := r.Env["DB"]; ok && val == "mysql" {
-		isMySQL = true
-	}
+	dbDriver := r.DBDriver()
 
 	// Agregamos columnas si no existen (Patching)
-	patchColumn(r.GetDB(), usersTable, "username", "VARCHAR(50) NOT NULL DEFAULT ''", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "user_token", "VARCHAR(128) NOT NULL DEFAULT ''", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "first_name", "VARCHAR(100) NOT NULL DEFAULT ''", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "last_name", "VARCHAR(100) NOT NULL DEFAULT ''", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "phone", "VARCHAR(20) NOT NULL DEFAULT ''", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "verificado", "INTEGER DEFAULT 0", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "token_expires_at", "DATETIME", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "created_at", "DATETIME DEFAULT CURRENT_TIMESTAMP", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "updated_at", "DATETIME DEFAULT CURRENT_TIMESTAMP", isMySQL)
-	patchColumn(r.GetDB(), usersTable, "last_login_at", "DATETIME", isMySQL)
+	patchColumn(r.GetDB(), usersTable, "username", "VARCHAR(50) NOT NULL DEFAULT ''", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "user_token", "VARCHAR(128) NOT NULL DEFAULT ''", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "first_name", "VARCHAR(100) NOT NULL DEFAULT ''", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "last_name", "VARCHAR(100) NOT NULL DEFAULT ''", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "phone", "VARCHAR(20) NOT NULL DEFAULT ''", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "verificado", "INTEGER DEFAULT 0", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "token_expires_at", "DATETIME", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "created_at", "DATETIME DEFAULT CURRENT_TIMESTAMP", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "updated_at", "DATETIME DEFAULT CURRENT_TIMESTAMP", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "last_login_at", "DATETIME", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "two_factor_secret", "VARCHAR(64)", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "two_factor_recovery_codes", "TEXT", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "two_factor_confirmed_at", "DATETIME", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "two_factor_last_step", "INTEGER DEFAULT 0", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "two_factor_challenge", "VARCHAR(64)", dbDriver)
+	patchColumn(r.GetDB(), usersTable, "two_factor_challenge_expires", "INTEGER", dbDriver)
 	// 5. Crear Tabla Recuperación Contraseñas
 	resetsTable := prefix + "password_resets"
 	createResets := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
@@ -661,7 +691,9 @@ func (r *Runtime) ensureAuthTables(usersTable, rolesTable, prefix string) {
 		used INTEGER DEFAULT 0
 	);`, resetsTable)
 
-	if val, ok := r.Env["DB"]; ok && val == "mysql" {
+	if isPostgres {
+		createResets = postgresDDL(createResets)
+	} else if val, ok := r.Env["DB"]; ok && val == "mysql" {
 		createResets = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			email VARCHAR(100) NOT NULL,
@@ -672,9 +704,21 @@ func (r *Runtime) ensureAuthTables(usersTable, rolesTable, prefix string) {
 		);`, resetsTable)
 	}
 	r.GetDB().Exec(createResets)
+
+	// 6. Tablas de bloqueo por intentos fallidos y auditoría
+	r.ensureLockoutTables(prefix)
+
+	// 7. Tablas de permisos (RBAC)
+	EnsurePermissionTables(r.GetDB(), r.DBDriver(), prefix)
+
+	// 8. Tokens de API y lista de revocación de JWT
+	r.ensureTokenTables(prefix)
+
+	// 9. Cuentas OAuth vinculadas
+	r.ensureOAuthTables(prefix)
 }
 
-func patchColumn(db *sql.DB, table, col, def string, isMySQL bool) {
+func patchColumn(db *sql.DB, table, col, def string, driver string) {
 	// Verificar si la columna ya existe
 	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s LIMIT 1", col, table))
 	if err == nil {
@@ -686,8 +730,10 @@ func patchColumn(db *sql.DB, table, col, def string, isMySQL bool) {
 	fmt.Printf("[Auth] Auto-patching: Agregando columna '%s' a tabla '%s'...\n", col, table)
 
 	alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col, def)
-	if isMySQL {
+	if driver == "mysql" {
 		alter = fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col, def)
+	} else if driver == "postgres" {
+		alter = postgresDDL(alter)
 	}
 	_, err = db.Exec(alter)
 	// Ignoramos error si falla el alter, para no detener el runtime
@@ -706,11 +752,6 @@ func (r *Runtime) generateJWT(userId int, email string, userName string, roleNam
 		expirationTime = time.Now().Add(24 * 180 * time.Hour)
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "joss_default_secret_change_in_production"
-	}
-
 	claims := jwt.MapClaims{
 		"user_id": userId,
 		"email":   email,
@@ -719,8 +760,7 @@ func (r *Runtime) generateJWT(userId int, email string, userName string, roleNam
 		"exp":     expirationTime.Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := signJWT(claims)
 	if err != nil {
 		fmt.Printf("[Security] Error generando JWT: %v\n", err)
 		return false
@@ -729,11 +769,17 @@ func (r *Runtime) generateJWT(userId int, email string, userName string, roleNam
 	return tokenString
 }
 
-func (r *Runtime) ValidateJWT(tokenString string) (map[string]interface{}, bool) {
+// jwtSecretKey is JWT_SECRET, or a development default
+func jwtSecretKey() string {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		jwtSecret = "joss_default_secret_change_in_production"
 	}
+	return jwtSecret
+}
+
+func (r *Runtime) ValidateJWT(tokenString string) (map[string]interface{}, bool) {
+	jwtSecret := jwtSecretKey()
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -0,0 +1,328 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Login throttling for Auth::attempt (and the 2FA step of a pending login).
+//
+// Failures are counted per account ("email:<email>") and per client IP
+// ("ip:<ip>"). Once a counter reaches its limit the key is locked for
+// AUTH_LOCKOUT_SECONDS, doubling with every further failure up to
+// AUTH_LOCKOUT_MAX_SECONDS. Counters are forgotten after AUTH_ATTEMPT_WINDOW
+// without failures; a successful login clears the account counter. Counters
+// live in <prefix>login_attempts, or in Redis with AUTH_LOCKOUT_STORE=redis.
+// Lockouts and unlocks are recorded in <prefix>auth_audit.
+
+// loginThrottle is the failure counter of one key
+type loginThrottle struct {
+	failures    int
+	lockedUntil int64
+	lastFailed  int64
+}
+
+type lockoutConfig struct {
+	maxAttempts   int
+	ipMaxAttempts int
+	base          time.Duration
+	max           time.Duration
+	window        time.Duration
+}
+
+func (r *Runtime) lockoutConfig() lockoutConfig {
+	return lockoutConfig{
+		maxAttempts:   envInt(r.Env, "AUTH_MAX_ATTEMPTS", 5),
+		ipMaxAttempts: envInt(r.Env, "AUTH_IP_MAX_ATTEMPTS", 20),
+		base:          envDuration(r.Env, "AUTH_LOCKOUT_SECONDS", time.Minute),
+		max:           envDuration(r.Env, "AUTH_LOCKOUT_MAX_SECONDS", time.Hour),
+		window:        envDuration(r.Env, "AUTH_ATTEMPT_WINDOW", 15*time.Minute),
+	}
+}
+
+// lockDuration is the lock earned by the failures-th failure: none below
+// limit, then base doubled per extra failure and capped at max
+func (c lockoutConfig) lockDuration(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+	d := c.base
+	for i := limit; i < failures && d < c.max; i++ {
+		d *= 2
+	}
+	if c.max > 0 && d > c.max {
+		d = c.max
+	}
+	return d
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// requestIP is the client address injected by the HTTP handler ("" outside
+// a request, e.g. cron or CLI)
+func (r *Runtime) requestIP() string {
+	if reqInst, ok := r.Variables["$__request"].(*Instance); ok {
+		if ip, ok := reqInst.Fields["_ip"].(string); ok {
+			return ip
+		}
+	}
+	return ""
+}
+
+// loginLockedFor returns how long a login for email from the current IP
+// must wait, or 0 if it may proceed
+func (r *Runtime) loginLockedFor(prefix, email string) time.Duration {
+	now := Now().Unix()
+	var wait int64
+	keys := []string{accountThrottleKey(email)}
+	if ip := r.requestIP(); ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	for _, key := range keys {
+		if t, ok := r.loadThrottle(prefix, key); ok && t.lockedUntil-now > wait {
+			wait = t.lockedUntil - now
+		}
+	}
+	return time.Duration(wait) * time.Second
+}
+
+// recordLoginFailure counts a failed login for email and the current IP
+func (r *Runtime) recordLoginFailure(prefix, email string) {
+	cfg := r.lockoutConfig()
+	r.registerFailure(prefix, accountThrottleKey(email), cfg.maxAttempts, cfg, email, "")
+	if ip := r.requestIP(); ip != "" {
+		r.registerFailure(prefix, "ip:"+ip, cfg.ipMaxAttempts, cfg, email, ip)
+	}
+}
+
+func (r *Runtime) registerFailure(prefix, key string, limit int, cfg lockoutConfig, email, ip string) {
+	now := Now()
+	// The counter is incremented in the store itself, so concurrent
+	// failures (parallel requests, several servers) are all counted
+	failures, ok := r.incrementThrottle(prefix, key, cfg)
+	if !ok {
+		return
+	}
+	if lock := cfg.lockDuration(failures, limit); lock > 0 {
+		r.lockThrottle(prefix, key, now.Add(lock).Unix(), cfg)
+		event := "lockout"
+		if ip != "" {
+			event = "ip_lockout"
+		}
+		LogWarning("[Auth] %s bloqueado por %s tras %d intentos fallidos", key, lock, failures)
+		r.auditAuthEvent(prefix, event, email, ip, fmt.Sprintf("%d intentos fallidos, bloqueado %ds", failures, int(lock/time.Second)))
+	}
+}
+
+// clearLoginFailures resets the account counter after a successful login
+func (r *Runtime) clearLoginFailures(prefix, email string) {
+	r.deleteThrottle(prefix, accountThrottleKey(email))
+}
+
+// --- storage ---
+
+func (r *Runtime) lockoutUsesRedis() bool {
+	if r.Env["AUTH_LOCKOUT_STORE"] != "redis" {
+		return false
+	}
+	// Without a Redis connection the counters fall back to the database
+	return GlobalRedis != nil
+}
+
+func (r *Runtime) loadThrottle(prefix, key string) (loginThrottle, bool) {
+	var t loginThrottle
+	if r.lockoutUsesRedis() {
+		vals, err := GlobalRedis.HGetAll(Ctx, "auth:lockout:"+key).Result()
+		if err != nil || len(vals) == 0 {
+			return t, false
+		}
+		t.failures, _ = strconv.Atoi(vals["failures"])
+		t.lockedUntil, _ = strconv.ParseInt(vals["locked_until"], 10, 64)
+		t.lastFailed, _ = strconv.ParseInt(vals["last_failed_at"], 10, 64)
+		return t, true
+	}
+	if r.GetDB() == nil {
+		return t, false
+	}
+	query := fmt.Sprintf("SELECT failures, locked_until, last_failed_at FROM %slogin_attempts WHERE throttle_key = ?", prefix)
+	if err := r.Conn().QueryRow(query, key).Scan(&t.failures, &t.lockedUntil, &t.lastFailed); err != nil {
+		return loginThrottle{}, false
+	}
+	return t, true
+}
+
+// incrementThrottle adds one failure to key and returns the new count.
+// Counters idle for a window (counting from the end of the last lock) start
+// over: in the database by a conditional reset, in Redis by the key's TTL.
+func (r *Runtime) incrementThrottle(prefix, key string, cfg lockoutConfig) (int, bool) {
+	now := Now().Unix()
+	if r.lockoutUsesRedis() {
+		redisKey := "auth:lockout:" + key
+		n, err := GlobalRedis.HIncrBy(Ctx, redisKey, "failures", 1).Result()
+		if err != nil {
+			LogError("[Auth] No se pudo registrar el intento fallido: %v", err)
+			return 0, false
+		}
+		GlobalRedis.HSet(Ctx, redisKey, "last_failed_at", now)
+		r.extendThrottleTTL(redisKey, cfg)
+		return int(n), true
+	}
+	if r.GetDB() == nil {
+		return 0, false
+	}
+	table := prefix + "login_attempts"
+	stale := now - int64(cfg.window/time.Second)
+	r.Conn().Exec(fmt.Sprintf("UPDATE %s SET failures = 0, locked_until = 0 WHERE throttle_key = ? AND last_failed_at < ? AND locked_until < ?", table), key, stale, stale)
+
+	increment := fmt.Sprintf("UPDATE %s SET failures = failures + 1, last_failed_at = ? WHERE throttle_key = ?", table)
+	n, _ := rowsAffected(r.Conn().Exec(increment, now, key))
+	if n == 0 {
+		// First failure of the key; if a concurrent request inserted it
+		// first, the primary key rejects this row and the update counts it
+		_, err := r.Conn().Exec(fmt.Sprintf("INSERT INTO %s (throttle_key, failures, locked_until, last_failed_at) VALUES (?, 1, 0, ?)", table), key, now)
+		if err != nil {
+			r.Conn().Exec(increment, now, key)
+		}
+	}
+	// Drop counters nobody has touched for a window
+	r.Conn().Exec(fmt.Sprintf("DELETE FROM %s WHERE last_failed_at < ? AND locked_until < ?", table), stale, stale)
+
+	var failures int
+	if err := r.Conn().QueryRow(fmt.Sprintf("SELECT failures FROM %s WHERE throttle_key = ?", table), key).Scan(&failures); err != nil {
+		LogError("[Auth] No se pudo registrar el intento fallido: %v", err)
+		return 0, false
+	}
+	return failures, true
+}
+
+// redisLockUntil raises locked_until atomically
+var redisLockUntil = redis.NewScript(`
+	local current = tonumber(redis.call("HGET", KEYS[1], "locked_until") or "0")
+	if tonumber(ARGV[1]) > current then
+		redis.call("HSET", KEYS[1], "locked_until", ARGV[1])
+	end
+	return 1`)
+
+// lockThrottle locks key until the given unix time, never shortening a
+// longer lock set by a concurrent failure
+func (r *Runtime) lockThrottle(prefix, key string, until int64, cfg lockoutConfig) {
+	if r.lockoutUsesRedis() {
+		redisKey := "auth:lockout:" + key
+		redisLockUntil.Run(Ctx, GlobalRedis, []string{redisKey}, until)
+		r.extendThrottleTTL(redisKey, cfg)
+		return
+	}
+	r.Conn().Exec(fmt.Sprintf("UPDATE %slogin_attempts SET locked_until = ? WHERE throttle_key = ? AND locked_until < ?", prefix), until, key, until)
+}
+
+// extendThrottleTTL keeps a Redis counter while it is locked plus one window
+func (r *Runtime) extendThrottleTTL(redisKey string, cfg lockoutConfig) {
+	ttl := cfg.window
+	if until, err := GlobalRedis.HGet(Ctx, redisKey, "locked_until").Int64(); err == nil && until > 0 {
+		if remaining := time.Unix(until, 0).Sub(Now()); remaining > 0 {
+			ttl += remaining
+		}
+	}
+	if ttl > 0 {
+		GlobalRedis.Expire(Ctx, redisKey, ttl)
+	}
+}
+
+func (r *Runtime) deleteThrottle(prefix, key string) bool {
+	if r.lockoutUsesRedis() {
+		n, err := GlobalRedis.Del(Ctx, "auth:lockout:"+key).Result()
+		return err == nil && n > 0
+	}
+	if r.GetDB() == nil {
+		return false
+	}
+	n, _ := rowsAffected(r.Conn().Exec(fmt.Sprintf("DELETE FROM %slogin_attempts WHERE throttle_key = ?", prefix), key))
+	return n > 0
+}
+
+func rowsAffected(res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// auditAuthEvent appends a security event to <prefix>auth_audit
+func (r *Runtime) auditAuthEvent(prefix, event, email, ip, detail string) {
+	if r.GetDB() == nil {
+		return
+	}
+	if ip == "" {
+		ip = r.requestIP()
+	}
+	_, err := r.Conn().Exec(fmt.Sprintf("INSERT INTO %sauth_audit (event, email, ip, detail, created_at) VALUES (?, ?, ?, ?, ?)", prefix),
+		event, email, ip, detail, Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		LogError("[Auth] No se pudo registrar el evento '%s': %v", event, err)
+	}
+}
+
+// ensureLockoutTables creates the throttle and audit tables
+func (r *Runtime) ensureLockoutTables(prefix string) {
+	attempts := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %slogin_attempts (
+		throttle_key VARCHAR(191) NOT NULL PRIMARY KEY,
+		failures INTEGER NOT NULL DEFAULT 0,
+		locked_until BIGINT NOT NULL DEFAULT 0,
+		last_failed_at BIGINT NOT NULL DEFAULT 0
+	);`, prefix)
+	audit := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sauth_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event VARCHAR(50) NOT NULL,
+		email VARCHAR(100),
+		ip VARCHAR(45),
+		detail TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`, prefix)
+
+	if r.DBDriver() == "postgres" {
+		audit = postgresDDL(audit)
+	} else if val, ok := r.Env["DB"]; ok && val == "mysql" {
+		audit = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sauth_audit (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			event VARCHAR(50) NOT NULL,
+			email VARCHAR(100),
+			ip VARCHAR(45),
+			detail TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`, prefix)
+	}
+	r.GetDB().Exec(attempts)
+	r.GetDB().Exec(audit)
+}
+
+func (r *Runtime) executeLockoutMethod(method, prefix string, args []interface{}) interface{} {
+	switch method {
+	case "unlock":
+		// Auth::unlock(email) clears the account counter and its lock
+		if len(args) < 1 || args[0] == nil {
+			return false
+		}
+		email := fmt.Sprintf("%v", args[0])
+		if !r.deleteThrottle(prefix, accountThrottleKey(email)) {
+			return false
+		}
+		LogInfo("[Auth] Cuenta '%s' desbloqueada", email)
+		r.auditAuthEvent(prefix, "unlock", email, "", "")
+		return true
+
+	case "lockedFor":
+		// Auth::lockedFor(email) -> seconds until a login may be attempted
+		if len(args) < 1 || args[0] == nil {
+			return 0
+		}
+		return int(r.loginLockedFor(prefix, fmt.Sprintf("%v", args[0])) / time.Second)
+	}
+	return nil
+}
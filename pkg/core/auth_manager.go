@@ -17,14 +17,16 @@ func (r *Runtime) EnsureAuthTables() {
 	rolesTable := prefix + "roles"
 	usersTable := prefix + "users"
 
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := r.DBDriver()
 
 	// 1. Create Roles Table
 	var queryRoles string
-	if dbDriver == "sqlite" {
+	if dbDriver == "postgres" {
+		queryRoles = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(50) UNIQUE
+		)`, rolesTable)
+	} else if dbDriver == "sqlite" {
 		queryRoles = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name VARCHAR(50) UNIQUE
@@ -45,12 +47,29 @@ func (r *Runtime) EnsureAuthTables() {
 	} else {
 		insertRole = "INSERT IGNORE INTO"
 	}
-	r.GetDB().Exec(fmt.Sprintf("%s %s (id, name) VALUES (1, 'admin')", insertRole, rolesTable))
-	r.GetDB().Exec(fmt.Sprintf("%s %s (id, name) VALUES (2, 'client')", insertRole, rolesTable))
+	if dbDriver == "postgres" {
+		// PostgreSQL has no INSERT IGNORE, and explicit ids don't advance the SERIAL sequence
+		r.GetDB().Exec(fmt.Sprintf("INSERT INTO %s (id, name) VALUES (1, 'admin'), (2, 'client') ON CONFLICT DO NOTHING", rolesTable))
+		r.GetDB().Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), (SELECT MAX(id) FROM %s))", rolesTable, rolesTable))
+	} else {
+		r.GetDB().Exec(fmt.Sprintf("%s %s (id, name) VALUES (1, 'admin')", insertRole, rolesTable))
+		r.GetDB().Exec(fmt.Sprintf("%s %s (id, name) VALUES (2, 'client')", insertRole, rolesTable))
+	}
 
 	// 2. Create Users Table
 	var queryUsers string
-	if dbDriver == "sqlite" {
+	if dbDriver == "postgres" {
+		queryUsers = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255),
+			email VARCHAR(255) UNIQUE,
+			password VARCHAR(255),
+			role_id INTEGER DEFAULT 2,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (role_id) REFERENCES %s(id)
+		)`, usersTable, rolesTable)
+	} else if dbDriver == "sqlite" {
 		queryUsers = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name VARCHAR(255),
@@ -0,0 +1,376 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Permissions (RBAC).
+//
+// Permissions are names like "posts.edit" stored in <prefix>permissions and
+// granted to roles (<prefix>role_permissions) or directly to users
+// (<prefix>user_permissions). A granted "posts.*" covers every "posts.x"
+// and "*" covers everything. The admin role passes every check, as it does
+// in Auth::hasRole.
+//
+// Auth::can(ability, $model) first asks the policy of the model, the class
+// <Model>Policy (app/policies), for a method named after the last segment of
+// the ability ("posts.update" -> update($user, $post)). A before($user,
+// $ability) method that returns something other than null decides first.
+// Without a policy method the ability is checked as a permission.
+
+// EnsurePermissionTables creates the permission tables
+func EnsurePermissionTables(db dbExecutor, driver, prefix string) {
+	permissions := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %spermissions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(100) NOT NULL UNIQUE,
+		description VARCHAR(255),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`, prefix)
+	if driver == "postgres" {
+		permissions = postgresDDL(permissions)
+	} else if driver == "mysql" {
+		permissions = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %spermissions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL UNIQUE,
+			description VARCHAR(255),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`, prefix)
+	}
+	db.Exec(permissions)
+	db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %srole_permissions (
+		role_id INTEGER NOT NULL,
+		permission_id INTEGER NOT NULL,
+		PRIMARY KEY (role_id, permission_id)
+	);`, prefix))
+	db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %suser_permissions (
+		user_id INTEGER NOT NULL,
+		permission_id INTEGER NOT NULL,
+		PRIMARY KEY (user_id, permission_id)
+	);`, prefix))
+}
+
+// permissionMatches reports whether the granted permissions cover perm
+func permissionMatches(granted []string, perm string) bool {
+	for _, g := range granted {
+		if g == perm || g == "*" {
+			return true
+		}
+		if strings.HasSuffix(g, ".*") && strings.HasPrefix(perm, strings.TrimSuffix(g, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserPermissions returns the role and the permissions (through the role
+// and direct grants) of a user
+func UserPermissions(db dbExecutor, prefix string, userID interface{}) (string, []string) {
+	var role sql.NullString
+	db.QueryRow(fmt.Sprintf("SELECT r.name FROM %susers u LEFT JOIN %sroles r ON u.role_id = r.id WHERE u.id = ?", prefix, prefix), userID).Scan(&role)
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT p.name FROM %[1]spermissions p
+		JOIN %[1]srole_permissions rp ON rp.permission_id = p.id
+		JOIN %[1]susers u ON u.role_id = rp.role_id WHERE u.id = ?
+		UNION
+		SELECT p.name FROM %[1]spermissions p
+		JOIN %[1]suser_permissions up ON up.permission_id = p.id WHERE up.user_id = ?`, prefix), userID, userID)
+	if err != nil {
+		return role.String, nil
+	}
+	return role.String, scanNames(rows)
+}
+
+// RolePermissions returns the permissions granted to a role
+func RolePermissions(db dbExecutor, prefix, role string) []string {
+	rows, err := db.Query(fmt.Sprintf(`SELECT p.name FROM %[1]spermissions p
+		JOIN %[1]srole_permissions rp ON rp.permission_id = p.id
+		JOIN %[1]sroles r ON r.id = rp.role_id WHERE r.name = ? ORDER BY p.name`, prefix), role)
+	if err != nil {
+		return nil
+	}
+	return scanNames(rows)
+}
+
+// ListPermissions returns every defined permission
+func ListPermissions(db dbExecutor, prefix string) []string {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM %spermissions ORDER BY name", prefix))
+	if err != nil {
+		return nil
+	}
+	return scanNames(rows)
+}
+
+func scanNames(rows *sql.Rows) []string {
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CreatePermission defines a permission (no-op if it exists) and returns its id
+func CreatePermission(db dbExecutor, prefix, name, description string) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, fmt.Errorf("el nombre del permiso está vacío")
+	}
+	var id int64
+	query := fmt.Sprintf("SELECT id FROM %spermissions WHERE name = ?", prefix)
+	if db.QueryRow(query, name).Scan(&id) == nil {
+		return id, nil
+	}
+	if _, err := db.Exec(fmt.Sprintf("INSERT INTO %spermissions (name, description) VALUES (?, ?)", prefix), name, description); err != nil {
+		return 0, err
+	}
+	err := db.QueryRow(query, name).Scan(&id)
+	return id, err
+}
+
+// permissionSubject resolves the role (by name) or user (by id or email) a
+// permission is granted to. Missing roles are created when create is set.
+func permissionSubject(db dbExecutor, prefix, kind, subject string, create bool) (string, int64, error) {
+	var id int64
+	switch kind {
+	case "role":
+		query := fmt.Sprintf("SELECT id FROM %sroles WHERE name = ?", prefix)
+		if db.QueryRow(query, subject).Scan(&id) == nil {
+			return prefix + "role_permissions", id, nil
+		}
+		if !create {
+			return "", 0, fmt.Errorf("el rol '%s' no existe", subject)
+		}
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO %sroles (name) VALUES (?)", prefix), subject); err != nil {
+			return "", 0, err
+		}
+		err := db.QueryRow(query, subject).Scan(&id)
+		return prefix + "role_permissions", id, err
+	case "user":
+		column := "email"
+		if _, err := strconv.Atoi(subject); err == nil {
+			column = "id"
+		}
+		if db.QueryRow(fmt.Sprintf("SELECT id FROM %susers WHERE %s = ?", prefix, column), subject).Scan(&id) != nil {
+			return "", 0, fmt.Errorf("el usuario '%s' no existe", subject)
+		}
+		return prefix + "user_permissions", id, nil
+	}
+	return "", 0, fmt.Errorf("destino inválido '%s' (usa role o user)", kind)
+}
+
+// GrantPermission gives perm to a role or user, defining it if needed
+func GrantPermission(db dbExecutor, prefix, kind, subject, perm string) error {
+	table, subjectID, err := permissionSubject(db, prefix, kind, subject, true)
+	if err != nil {
+		return err
+	}
+	permID, err := CreatePermission(db, prefix, perm, "")
+	if err != nil {
+		return err
+	}
+	column := kind + "_id"
+	var exists int
+	if db.QueryRow(fmt.Sprintf("SELECT 1 FROM %s WHERE %s = ? AND permission_id = ?", table, column), subjectID, permID).Scan(&exists) == nil {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("INSERT INTO %s (%s, permission_id) VALUES (?, ?)", table, column), subjectID, permID)
+	return err
+}
+
+// RevokePermission removes perm from a role or user; false if it was not granted
+func RevokePermission(db dbExecutor, prefix, kind, subject, perm string) (bool, error) {
+	table, subjectID, err := permissionSubject(db, prefix, kind, subject, false)
+	if err != nil {
+		return false, err
+	}
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s_id = ? AND permission_id IN (SELECT id FROM %spermissions WHERE name = ?)", table, kind, prefix), subjectID, perm)
+	n, err := rowsAffected(res, err)
+	return n > 0, err
+}
+
+// --- runtime ---
+
+// currentPermissions loads the role and permissions of the logged-in user
+// once per request
+func (r *Runtime) currentPermissions(prefix string) (interface{}, string, []string) {
+	sess := r.sessionFields()
+	if sess == nil || sess["user_id"] == nil || r.GetDB() == nil {
+		return nil, "", nil
+	}
+	uid := sess["user_id"]
+	if cached, ok := r.Variables["$__permissions"].(*Instance); ok && fmt.Sprint(cached.Fields["user_id"]) == fmt.Sprint(uid) {
+		granted, _ := cached.Fields["granted"].([]string)
+		role, _ := cached.Fields["role"].(string)
+		return uid, role, granted
+	}
+	role, granted := UserPermissions(r.Conn(), prefix, uid)
+	r.Variables["$__permissions"] = &Instance{Fields: map[string]interface{}{"user_id": uid, "role": role, "granted": granted}}
+	return uid, role, granted
+}
+
+// authorize answers Auth::can(ability, target). A request authenticated
+// with a personal access token gets at most the token's abilities, whatever
+// the role, policies or permissions of its user allow.
+func (r *Runtime) authorize(prefix, ability string, target interface{}) bool {
+	uid, role, granted := r.currentPermissions(prefix)
+	if uid == nil || !r.currentTokenCan(ability) {
+		return false
+	}
+	if role == "admin" {
+		return true
+	}
+
+	if policy, args := r.policyFor(target); policy != nil {
+		method := ability
+		if i := strings.LastIndex(method, "."); i >= 0 {
+			method = method[i+1:]
+		}
+		user := r.executeAuthMethod(nil, "user", nil)
+		if before := r.findClassMethod(policy.Class, "before"); before != nil {
+			if res := r.CallMethodEvaluated(before, policy, []interface{}{user, ability}); res != nil {
+				return isTruthy(res)
+			}
+		}
+		if m := r.findClassMethod(policy.Class, method); m != nil {
+			return isTruthy(r.CallMethodEvaluated(m, policy, append([]interface{}{user}, args...)))
+		}
+	}
+	return permissionMatches(granted, ability)
+}
+
+// policyFor instantiates <Model>Policy for a model instance or class name
+func (r *Runtime) policyFor(target interface{}) (*Instance, []interface{}) {
+	var className string
+	var args []interface{}
+	switch t := target.(type) {
+	case *Instance:
+		if t.Class == nil {
+			return nil, nil
+		}
+		className = t.Class.Name.Value
+		args = []interface{}{t}
+	case string:
+		className = t
+	default:
+		return nil, nil
+	}
+	if _, ok := r.Classes[className+"Policy"]; !ok {
+		return nil, nil
+	}
+	policy := r.NewInstance(className + "Policy")
+	if policy == nil || policy.Class == nil {
+		return nil, nil
+	}
+	return policy, args
+}
+
+// permissionTarget reads {"role": "editor"} or {"user": 5} of grant/revoke
+func permissionTarget(opts interface{}) (string, string) {
+	if m, ok := opts.(map[string]interface{}); ok {
+		if role, ok := m["role"]; ok {
+			return "role", fmt.Sprint(role)
+		}
+		if user, ok := m["user"]; ok {
+			return "user", fmt.Sprint(user)
+		}
+	}
+	return "", ""
+}
+
+func (r *Runtime) executePermissionMethod(method, prefix string, args []interface{}) interface{} {
+	switch method {
+	case "can", "cannot":
+		if len(args) < 1 {
+			return method == "cannot"
+		}
+		var target interface{}
+		if len(args) > 1 {
+			target = args[1]
+		}
+		allowed := r.authorize(prefix, fmt.Sprint(args[0]), target)
+		if method == "cannot" {
+			return !allowed
+		}
+		return allowed
+
+	case "permissions":
+		// Auth::permissions() of the logged-in user, or of a user id
+		if len(args) > 0 && args[0] != nil {
+			if r.GetDB() == nil {
+				return []interface{}{}
+			}
+			_, granted := UserPermissions(r.Conn(), prefix, args[0])
+			return toStringList(granted)
+		}
+		_, _, granted := r.currentPermissions(prefix)
+		return toStringList(granted)
+
+	case "grant", "revoke":
+		// Auth::grant("posts.edit", {"role": "editor"}) / {"user": $id}
+		if len(args) < 2 {
+			panic(fmt.Sprintf("Auth Error: %s requiere el permiso y {\"role\": ...} o {\"user\": ...}", method))
+		}
+		if r.GetDB() == nil {
+			panic("Auth Error: No hay conexión a la base de datos configurada")
+		}
+		kind, subject := permissionTarget(args[1])
+		perm := fmt.Sprint(args[0])
+		delete(r.Variables, "$__permissions")
+		if method == "grant" {
+			if err := GrantPermission(r.Conn(), prefix, kind, subject, perm); err != nil {
+				panic(fmt.Sprintf("Auth Error: %v", err))
+			}
+			return true
+		}
+		revoked, err := RevokePermission(r.Conn(), prefix, kind, subject, perm)
+		if err != nil {
+			panic(fmt.Sprintf("Auth Error: %v", err))
+		}
+		return revoked
+	}
+	return nil
+}
+
+// permissionMiddleware is the "can:<permiso>" route middleware: guests go to
+// /login, users without the permission are denied (403 JSON under /api/)
+func (r *Runtime) permissionMiddleware(path, perm string) *Instance {
+	sess := r.sessionFields()
+	if sess == nil || sess["user_id"] == nil {
+		if strings.HasPrefix(path, "/api/") {
+			return &Instance{Fields: map[string]interface{}{
+				"_type":  "JSON",
+				"status": 401,
+				"data":   map[string]interface{}{"error": "Unauthorized"},
+			}}
+		}
+		return &Instance{Fields: map[string]interface{}{
+			"_type": "REDIRECT",
+			"url":   "/login",
+			"flash": map[string]interface{}{"error": "Debes iniciar sesión."},
+		}}
+	}
+	if r.authorize(r.tablePrefix(), perm, nil) {
+		return nil
+	}
+	LogWarning("[Auth] Permiso '%s' denegado al usuario %v en %s", perm, sess["user_id"], path)
+	if strings.HasPrefix(path, "/api/") {
+		return &Instance{Fields: map[string]interface{}{
+			"_type":  "JSON",
+			"status": 403,
+			"data":   map[string]interface{}{"error": "Forbidden"},
+		}}
+	}
+	return &Instance{Fields: map[string]interface{}{
+		"_type": "REDIRECT",
+		"url":   "/",
+		"flash": map[string]interface{}{"error": "Acceso denegado."},
+	}}
+}
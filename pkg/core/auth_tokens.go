@@ -0,0 +1,449 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// API tokens and JWT revocation.
+//
+// Personal access tokens ("jpat_...") are long-lived keys created with
+// Auth::createToken: named, limited to a list of abilities and optionally
+// expiring. Refresh tokens ("jrt_...") come paired with a short-lived JWT
+// (Auth::issueTokens) and rotate on every Auth::refresh: each one works once,
+// and presenting a rotated token again revokes its whole family (the chain
+// started by one login), since it means the token leaked. Only SHA-256
+// hashes are stored, in <prefix>auth_tokens.
+//
+// Every JWT carries a jti. Auth::logout and a reused refresh family add
+// entries to <prefix>token_revocations, checked by the auth_api middleware.
+
+const (
+	personalTokenPrefix = "jpat_"
+	refreshTokenPrefix  = "jrt_"
+	tokenTimeLayout     = "2006-01-02 15:04:05"
+)
+
+// authToken is a row of <prefix>auth_tokens
+type authToken struct {
+	id         int64
+	userID     int
+	kind       string
+	name       string
+	abilities  []string
+	family     string
+	replacedBy int64
+	lastUsed   int64
+	expires    int64
+	revoked    int64
+	created    int64
+}
+
+func newOpaqueToken(prefix string) string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ensureTokenTables creates the token and revocation tables
+func (r *Runtime) ensureTokenTables(prefix string) {
+	tokens := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sauth_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		name VARCHAR(100),
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		abilities TEXT,
+		family VARCHAR(64),
+		replaced_by INTEGER DEFAULT 0,
+		last_used_at BIGINT DEFAULT 0,
+		expires_at BIGINT DEFAULT 0,
+		revoked_at BIGINT DEFAULT 0,
+		created_at BIGINT DEFAULT 0
+	);`, prefix)
+	if r.DBDriver() == "postgres" {
+		tokens = postgresDDL(tokens)
+	} else if val, ok := r.Env["DB"]; ok && val == "mysql" {
+		tokens = strings.Replace(tokens, "id INTEGER PRIMARY KEY AUTOINCREMENT", "id INT AUTO_INCREMENT PRIMARY KEY", 1)
+	}
+	r.GetDB().Exec(tokens)
+	r.GetDB().Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %stoken_revocations (
+		jti VARCHAR(100) NOT NULL PRIMARY KEY,
+		expires_at BIGINT NOT NULL DEFAULT 0
+	);`, prefix))
+}
+
+// signJWT signs claims, adding a jti when missing
+func signJWT(claims jwt.MapClaims) (string, error) {
+	if _, ok := claims["jti"]; !ok {
+		claims["jti"] = uuid.New().String()
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecretKey()))
+}
+
+// accessTokenTTL is the life of the JWT of a token pair
+func (r *Runtime) accessTokenTTL() time.Duration {
+	return envDuration(r.Env, "AUTH_ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// refreshTokenTTL follows JWT_REFRESH_EXPIRY_MONTHS (default 6)
+func (r *Runtime) refreshTokenTTL() time.Duration {
+	return time.Duration(envInt(r.Env, "JWT_REFRESH_EXPIRY_MONTHS", 6)) * 30 * 24 * time.Hour
+}
+
+func (r *Runtime) insertToken(prefix string, t authToken, plain string) (int64, error) {
+	abilities, _ := json.Marshal(t.abilities)
+	_, err := r.Conn().Exec(fmt.Sprintf(`INSERT INTO %sauth_tokens (user_id, kind, name, token_hash, abilities, family, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, prefix), t.userID, t.kind, t.name, hashToken(plain), string(abilities), t.family, t.expires, Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = r.Conn().QueryRow(fmt.Sprintf("SELECT id FROM %sauth_tokens WHERE token_hash = ?", prefix), hashToken(plain)).Scan(&id)
+	return id, err
+}
+
+const authTokenColumns = "id, user_id, kind, name, abilities, family, replaced_by, last_used_at, expires_at, revoked_at, created_at"
+
+func scanAuthToken(row interface{ Scan(...interface{}) error }) (*authToken, error) {
+	var t authToken
+	var name, abilities, family sql.NullString
+	var replacedBy, lastUsed, expires, revoked, created sql.NullInt64
+	if err := row.Scan(&t.id, &t.userID, &t.kind, &name, &abilities, &family, &replacedBy, &lastUsed, &expires, &revoked, &created); err != nil {
+		return nil, err
+	}
+	t.name, t.family = name.String, family.String
+	t.replacedBy, t.lastUsed, t.expires, t.revoked, t.created = replacedBy.Int64, lastUsed.Int64, expires.Int64, revoked.Int64, created.Int64
+	json.Unmarshal([]byte(abilities.String), &t.abilities)
+	return &t, nil
+}
+
+func (r *Runtime) findToken(prefix, plain string) (*authToken, bool) {
+	if r.GetDB() == nil {
+		return nil, false
+	}
+	row := r.Conn().QueryRow(fmt.Sprintf("SELECT %s FROM %sauth_tokens WHERE token_hash = ?", authTokenColumns, prefix), hashToken(plain))
+	t, err := scanAuthToken(row)
+	return t, err == nil
+}
+
+func (t *authToken) expired() bool {
+	return t.expires > 0 && Now().Unix() >= t.expires
+}
+
+func (t *authToken) can(ability string) bool {
+	for _, a := range t.abilities {
+		if a == "*" || a == ability {
+			return true
+		}
+	}
+	return false
+}
+
+// publicToken is a token as listed by Auth::tokens()
+func (t *authToken) publicToken() map[string]interface{} {
+	unixTime := func(sec int64) interface{} {
+		if sec == 0 {
+			return nil
+		}
+		return time.Unix(sec, 0).Format(tokenTimeLayout)
+	}
+	return map[string]interface{}{
+		"id":           t.id,
+		"name":         t.name,
+		"abilities":    toStringList(t.abilities),
+		"last_used_at": unixTime(t.lastUsed),
+		"expires_at":   unixTime(t.expires),
+		"created_at":   unixTime(t.created),
+	}
+}
+
+// revokeJTI adds a JWT id (or "fam:<family>") to the revocation list until exp
+func (r *Runtime) revokeJTI(prefix, jti string, exp int64) {
+	if jti == "" || r.GetDB() == nil {
+		return
+	}
+	table := prefix + "token_revocations"
+	r.Conn().Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at < ?", table), Now().Unix())
+	r.Conn().Exec(fmt.Sprintf("DELETE FROM %s WHERE jti = ?", table), jti)
+	r.Conn().Exec(fmt.Sprintf("INSERT INTO %s (jti, expires_at) VALUES (?, ?)", table), jti, exp)
+}
+
+// jwtRevoked checks the jti and the refresh family of JWT claims
+func (r *Runtime) jwtRevoked(prefix string, claims map[string]interface{}) bool {
+	if r.GetDB() == nil {
+		return false
+	}
+	keys := []interface{}{fmt.Sprint(claims["jti"])}
+	if fam, ok := claims["fam"].(string); ok && fam != "" {
+		keys = append(keys, "fam:"+fam)
+	}
+	var n int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %stoken_revocations WHERE jti IN (?%s)", prefix, strings.Repeat(", ?", len(keys)-1))
+	// Without the table nothing was revoked yet
+	if r.Conn().QueryRow(query, keys...).Scan(&n) != nil {
+		return false
+	}
+	return n > 0
+}
+
+// tokenUserClaims returns the JWT claims of a user row
+func (r *Runtime) tokenUserClaims(prefix string, userID interface{}) (jwt.MapClaims, bool) {
+	var id int
+	var email, username, role sql.NullString
+	query := fmt.Sprintf("SELECT u.id, u.email, u.username, r.name FROM %susers u LEFT JOIN %sroles r ON u.role_id = r.id WHERE u.id = ?", prefix, prefix)
+	if err := r.Conn().QueryRow(query, userID).Scan(&id, &email, &username, &role); err != nil {
+		return nil, false
+	}
+	return jwt.MapClaims{"user_id": id, "email": email.String, "name": username.String, "role": role.String}, true
+}
+
+// authenticateBearer validates a JWT or personal access token from an
+// Authorization header and returns the user claims. The token in use is
+// kept in $__token for Auth::tokenCan.
+func (r *Runtime) authenticateBearer(token string) (map[string]interface{}, bool) {
+	prefix := r.tablePrefix()
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+
+	if strings.HasPrefix(token, personalTokenPrefix) {
+		t, ok := r.findToken(prefix, token)
+		if !ok || t.kind != "personal" || t.revoked > 0 || t.expired() {
+			return nil, false
+		}
+		claims, ok := r.tokenUserClaims(prefix, t.userID)
+		if !ok {
+			return nil, false
+		}
+		r.Conn().Exec(fmt.Sprintf("UPDATE %sauth_tokens SET last_used_at = ? WHERE id = ?", prefix), Now().Unix(), t.id)
+		r.Variables["$__token"] = &Instance{Fields: map[string]interface{}{"id": t.id, "kind": "personal", "abilities": toStringList(t.abilities)}}
+		return claims, true
+	}
+
+	claims, ok := r.ValidateJWT(token)
+	if !ok || r.jwtRevoked(prefix, claims) {
+		return nil, false
+	}
+	claims["user_id"] = stdInt(claims["user_id"], 0)
+	r.Variables["$__token"] = &Instance{Fields: map[string]interface{}{"kind": "jwt", "jti": claims["jti"], "exp": claims["exp"]}}
+	return claims, true
+}
+
+// currentTokenCan reports whether the token of the request allows ability.
+// Session and JWT requests carry every ability; personal tokens only theirs.
+func (r *Runtime) currentTokenCan(ability string) bool {
+	tok, ok := r.Variables["$__token"].(*Instance)
+	if !ok || tok.Fields["kind"] != "personal" {
+		return true
+	}
+	t := authToken{abilities: blueprintColumns(tok.Fields["abilities"])}
+	return t.can(ability)
+}
+
+// issueTokenPair returns a short-lived JWT and a refresh token of family
+func (r *Runtime) issueTokenPair(prefix string, userID interface{}, family string) interface{} {
+	claims, ok := r.tokenUserClaims(prefix, userID)
+	if !ok {
+		LogError("[Auth] issueTokens: usuario %v no encontrado", userID)
+		return false
+	}
+	if family == "" {
+		family = uuid.New().String()
+	}
+	ttl := r.accessTokenTTL()
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	claims["fam"] = family
+	access, err := signJWT(claims)
+	if err != nil {
+		LogError("[Auth] Error generando JWT: %v", err)
+		return false
+	}
+
+	refresh := newOpaqueToken(refreshTokenPrefix)
+	if _, err := r.insertToken(prefix, authToken{
+		userID:  stdInt(claims["user_id"], 0),
+		kind:    "refresh",
+		family:  family,
+		expires: Now().Add(r.refreshTokenTTL()).Unix(),
+	}, refresh); err != nil {
+		LogError("[Auth] Error guardando el refresh token: %v", err)
+		return false
+	}
+	return map[string]interface{}{
+		"access_token":  access,
+		"refresh_token": refresh,
+		"token_type":    "Bearer",
+		"expires_in":    int(ttl / time.Second),
+	}
+}
+
+// rotateRefreshToken exchanges a refresh token for a new pair. A token that
+// was already rotated revokes its whole family.
+func (r *Runtime) rotateRefreshToken(prefix, plain string) interface{} {
+	t, ok := r.findToken(prefix, plain)
+	if !ok || t.kind != "refresh" {
+		return false
+	}
+	if t.replacedBy > 0 {
+		LogWarning("[Auth] Refresh token reutilizado (usuario %d): se revoca la familia %s", t.userID, t.family)
+		r.revokeTokenFamily(prefix, t.family)
+		email := ""
+		if claims, ok := r.tokenUserClaims(prefix, t.userID); ok {
+			email = fmt.Sprint(claims["email"])
+		}
+		r.auditAuthEvent(prefix, "refresh_reuse", email, "", "familia "+t.family+" revocada")
+		return false
+	}
+	if t.revoked > 0 || t.expired() {
+		return false
+	}
+
+	pair := r.issueTokenPair(prefix, t.userID, t.family)
+	next, ok := pair.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	newToken, _ := r.findToken(prefix, next["refresh_token"].(string))
+	replacement := int64(-1)
+	if newToken != nil {
+		replacement = newToken.id
+	}
+	// Only the first concurrent rotation wins the row
+	res, err := r.Conn().Exec(fmt.Sprintf("UPDATE %sauth_tokens SET replaced_by = ?, revoked_at = ? WHERE id = ? AND replaced_by = 0", prefix), replacement, Now().Unix(), t.id)
+	if n, _ := rowsAffected(res, err); n == 0 {
+		r.revokeTokenFamily(prefix, t.family)
+		return false
+	}
+	return next
+}
+
+// revokeTokenFamily revokes every refresh token of a family and the JWTs
+// issued with them
+func (r *Runtime) revokeTokenFamily(prefix, family string) {
+	if family == "" {
+		return
+	}
+	now := Now().Unix()
+	r.Conn().Exec(fmt.Sprintf("UPDATE %sauth_tokens SET revoked_at = ? WHERE family = ? AND revoked_at = 0", prefix), now, family)
+	r.revokeJTI(prefix, "fam:"+family, now+int64(r.accessTokenTTL()/time.Second))
+}
+
+// revokeCurrentJWT puts the JWT of this session or request on the revocation list
+func (r *Runtime) revokeCurrentJWT(prefix string) {
+	if tok, ok := r.Variables["$__token"].(*Instance); ok && tok.Fields["kind"] == "jwt" {
+		r.revokeJTI(prefix, fmt.Sprint(tok.Fields["jti"]), int64(stdInt(tok.Fields["exp"], 0)))
+	}
+	if sess := r.sessionFields(); sess != nil {
+		if jti, ok := sess["token_jti"].(string); ok {
+			r.revokeJTI(prefix, jti, int64(stdInt(sess["token_exp"], 0)))
+		}
+		delete(sess, "token_jti")
+		delete(sess, "token_exp")
+	}
+}
+
+func (r *Runtime) executeTokenMethod(method, prefix string, args []interface{}) interface{} {
+	if r.GetDB() == nil {
+		panic("Auth Error: No hay conexión a la base de datos configurada")
+	}
+	var userID interface{}
+	if sess := r.sessionFields(); sess != nil {
+		userID = sess["user_id"]
+	}
+
+	switch method {
+	case "createToken":
+		// Auth::createToken("cli", ["posts:read"], 30) -> {"id", "token", ...}
+		if userID == nil {
+			LogError("[Auth] createToken requiere un usuario autenticado")
+			return false
+		}
+		name := "token"
+		if len(args) > 0 && args[0] != nil {
+			name = fmt.Sprint(args[0])
+		}
+		abilities := []string{"*"}
+		if len(args) > 1 && args[1] != nil {
+			abilities = blueprintColumns(args[1])
+		}
+		t := authToken{userID: stdInt(userID, 0), kind: "personal", name: name, abilities: abilities}
+		if len(args) > 2 {
+			if days := stdInt(args[2], 0); days > 0 {
+				t.expires = Now().AddDate(0, 0, days).Unix()
+			}
+		}
+		plain := newOpaqueToken(personalTokenPrefix)
+		id, err := r.insertToken(prefix, t, plain)
+		if err != nil {
+			panic(fmt.Sprintf("Auth Error: no se pudo crear el token: %v", err))
+		}
+		t.id, t.created = id, Now().Unix()
+		result := t.publicToken()
+		// The plain token is only available now
+		result["token"] = plain
+		return result
+
+	case "tokens":
+		if userID == nil {
+			return []interface{}{}
+		}
+		rows, err := r.Conn().Query(fmt.Sprintf("SELECT %s FROM %sauth_tokens WHERE user_id = ? AND kind = 'personal' AND revoked_at = 0 ORDER BY id", authTokenColumns, prefix), userID)
+		if err != nil {
+			return []interface{}{}
+		}
+		defer rows.Close()
+		list := []interface{}{}
+		for rows.Next() {
+			if t, err := scanAuthToken(rows); err == nil && !t.expired() {
+				list = append(list, t.publicToken())
+			}
+		}
+		return list
+
+	case "revoke":
+		// Auth::revoke(id) revokes a personal access token of the user
+		if len(args) < 1 || userID == nil {
+			return false
+		}
+		// Route parameters arrive as strings
+		id, err := strconv.Atoi(fmt.Sprint(args[0]))
+		if err != nil {
+			return false
+		}
+		res, err := r.Conn().Exec(fmt.Sprintf("UPDATE %sauth_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND kind = 'personal' AND revoked_at = 0", prefix), Now().Unix(), id, userID)
+		n, _ := rowsAffected(res, err)
+		return n > 0
+
+	case "tokenCan":
+		// Session and JWT requests carry every ability; personal tokens only theirs
+		if len(args) < 1 || userID == nil {
+			return false
+		}
+		return r.currentTokenCan(fmt.Sprint(args[0]))
+
+	case "issueTokens":
+		// Auth::issueTokens() after a login: short JWT + refresh token
+		if len(args) > 0 && args[0] != nil {
+			userID = args[0]
+		}
+		if userID == nil {
+			return false
+		}
+		return r.issueTokenPair(prefix, userID, "")
+	}
+	return nil
+}
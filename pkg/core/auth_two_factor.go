@@ -0,0 +1,516 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication (TOTP, RFC 6238: HMAC-SHA1, 6 digits, 30 s).
+//
+// Auth::enable2fa stores a new secret and hashed recovery codes; the first
+// Auth::verify2fa confirms it. From then on Auth::attempt does not log the
+// user in: it leaves a pending state in the session (two_factor_user_id)
+// and returns "2fa_required", and Auth::verify2fa completes the login. The
+// "auth" middleware sends pending sessions to TWO_FACTOR_PATH.
+//
+// Clients without a session (API) get a challenge instead: attempt returns
+// {status: "2fa_required", challenge, expires_in} and the token goes back in
+// Auth::verify2fa(code, challenge). Only its SHA-256 is stored in the users
+// row, and it is cleared once used.
+
+const (
+	totpPeriod         = 30
+	totpDigits         = 6
+	twoFactorPending   = "2fa_required"
+	twoFactorTimeout   = 5 * time.Minute
+	recoveryCodeCount  = 8
+	defaultTwoFactorTo = "/two-factor"
+)
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret in base32
+func NewTOTPSecret() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return base32NoPad.EncodeToString(b)
+}
+
+// TOTPCode returns the code of secret at t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	return totpAt(secret, t.Unix()/totpPeriod)
+}
+
+func totpAt(secret string, step int64) (string, error) {
+	key, err := base32NoPad.DecodeString(strings.ToUpper(strings.ReplaceAll(secret, " ", "")))
+	if err != nil {
+		return "", fmt.Errorf("secreto TOTP inválido")
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// verifyTOTP accepts the code of the current step or the adjacent ones (clock
+// drift) and returns the matched step; steps up to lastStep were already
+// used and are rejected so a code cannot be replayed
+func verifyTOTP(secret, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := t.Unix() / totpPeriod
+	for _, step := range []int64{current - 1, current, current + 1} {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpAt(secret, step)
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI is the otpauth:// URI read by authenticator apps
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// newRecoveryCodes returns the codes to show once and their hashes to store
+func newRecoveryCodes() ([]string, []string) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	var plain, hashed []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		rand.Read(b)
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		plain = append(plain, code)
+		hashed = append(hashed, hashRecoveryCode(code))
+	}
+	return plain, hashed
+}
+
+// hashRecoveryCode hashes a normalized code. Codes are random (50 bits), so
+// a fast hash is enough and verifying does not cost one bcrypt per code.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// twoFactorUser is the 2FA state of a user row
+type twoFactorUser struct {
+	id          int
+	email       string
+	username    string
+	userToken   string
+	role        string
+	verified    bool
+	secret      string
+	confirmed   bool
+	lastStep    int64
+	recoveryRaw string
+}
+
+func (r *Runtime) loadTwoFactorUser(usersTable, rolesTable string, id interface{}) (*twoFactorUser, bool) {
+	var u twoFactorUser
+	var email, username, userToken, role, secret, codes, confirmedAt sql.NullString
+	var lastStep, verified sql.NullInt64
+	query := fmt.Sprintf(`SELECT u.id, u.email, u.username, u.user_token, r.name, u.verificado, u.two_factor_secret,
+		u.two_factor_recovery_codes, u.two_factor_confirmed_at, u.two_factor_last_step
+		FROM %s u LEFT JOIN %s r ON u.role_id = r.id WHERE u.id = ?`, usersTable, rolesTable)
+	err := r.Conn().QueryRow(query, id).Scan(&u.id, &email, &username, &userToken, &role, &verified, &secret, &codes, &confirmedAt, &lastStep)
+	if err != nil {
+		LogError("[Auth] 2FA: usuario %v no encontrado: %v", id, err)
+		return nil, false
+	}
+	u.email, u.username, u.userToken, u.role = email.String, username.String, userToken.String, role.String
+	u.secret, u.recoveryRaw, u.lastStep = secret.String, codes.String, lastStep.Int64
+	u.verified = verified.Int64 != 0
+	u.confirmed = confirmedAt.Valid && confirmedAt.String != ""
+	return &u, true
+}
+
+// sessionFields returns the fields of the current session, if any
+func (r *Runtime) sessionFields() map[string]interface{} {
+	if sessInst, ok := r.Variables["$__session"].(*Instance); ok {
+		return sessInst.Fields
+	}
+	return nil
+}
+
+// PendingTwoFactor reports whether the session passed the password check and
+// waits for the 2FA code. Expired pending states are cleared.
+func PendingTwoFactor(sess map[string]interface{}) bool {
+	if sess == nil {
+		return false
+	}
+	if _, ok := sess["two_factor_user_id"]; !ok {
+		return false
+	}
+	// Session stores may hand numbers back as float64
+	if expires := stdInt(sess["two_factor_expires"], 0); expires > 0 && Now().Unix() > int64(expires) {
+		clearPendingTwoFactor(sess)
+		return false
+	}
+	return true
+}
+
+func clearPendingTwoFactor(sess map[string]interface{}) {
+	delete(sess, "two_factor_user_id")
+	delete(sess, "two_factor_expires")
+}
+
+// TwoFactorPath is where the auth middleware sends pending sessions
+func (r *Runtime) TwoFactorPath() string {
+	if path := r.Env["TWO_FACTOR_PATH"]; path != "" {
+		return path
+	}
+	return defaultTwoFactorTo
+}
+
+// authenticatedLogin is where every credential check ends (the password of
+// Auth::attempt, the provider of OAuth::callback): locked and unverified
+// accounts are refused, the rest go through beginLogin. With 2FA the failure
+// counters stay until Auth::verify2fa (a known password must not reset them).
+func (r *Runtime) authenticatedLogin(prefix, usersTable string, userId int, email, userName, userToken, roleName string, verified, twoFactor bool) (interface{}, error) {
+	if wait := r.loginLockedFor(prefix, email); wait > 0 {
+		return nil, fmt.Errorf("cuenta bloqueada por intentos fallidos, intenta de nuevo en %s", wait)
+	}
+	if !verified {
+		r.recordLoginFailure(prefix, email)
+		return nil, errors.New("la cuenta no está verificada")
+	}
+	if !twoFactor {
+		r.clearLoginFailures(prefix, email)
+	}
+	return r.beginLogin(usersTable, userId, email, userName, userToken, roleName, twoFactor), nil
+}
+
+// beginLogin finishes a password login, or leaves it pending when the user
+// has 2FA enabled. Returns the JWT, "2fa_required" when the pending state is
+// in the session, a challenge map for sessionless clients, or false.
+func (r *Runtime) beginLogin(usersTable string, userId int, email, userName, userToken, roleName string, twoFactor bool) interface{} {
+	if !twoFactor {
+		return r.completeLogin(usersTable, userId, email, userName, userToken, roleName)
+	}
+	LogInfo("[Auth] Password OK for '%s' (ID: %d), waiting for 2FA code", email, userId)
+	if sess := r.sessionFields(); sess != nil {
+		sess["two_factor_user_id"] = userId
+		sess["two_factor_expires"] = Now().Add(twoFactorTimeout).Unix()
+		return twoFactorPending
+	}
+	challenge, ok := r.newTwoFactorChallenge(usersTable, userId)
+	if !ok {
+		return false
+	}
+	return map[string]interface{}{
+		"status":     twoFactorPending,
+		"challenge":  challenge,
+		"expires_in": int(twoFactorTimeout.Seconds()),
+	}
+}
+
+// isTwoFactorPending reports whether a beginLogin result waits for the code
+func isTwoFactorPending(result interface{}) bool {
+	if m, ok := result.(map[string]interface{}); ok {
+		return m["status"] == twoFactorPending
+	}
+	return result == twoFactorPending
+}
+
+func hashTwoFactorChallenge(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTwoFactorChallenge stores a one-time token standing in for the pending
+// session of a client without one
+func (r *Runtime) newTwoFactorChallenge(usersTable string, userId int) (string, bool) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	query := fmt.Sprintf("UPDATE %s SET two_factor_challenge = ?, two_factor_challenge_expires = ? WHERE id = ?", usersTable)
+	if _, err := r.Conn().Exec(query, hashTwoFactorChallenge(token), Now().Add(twoFactorTimeout).Unix(), userId); err != nil {
+		LogError("[Auth] 2FA: no se pudo guardar el challenge: %v", err)
+		return "", false
+	}
+	return token, true
+}
+
+// twoFactorChallengeUser returns the user of a valid, unexpired challenge
+func (r *Runtime) twoFactorChallengeUser(usersTable, token string) interface{} {
+	if token == "" {
+		return nil
+	}
+	var id int
+	query := fmt.Sprintf("SELECT id FROM %s WHERE two_factor_challenge = ? AND two_factor_challenge_expires >= ?", usersTable)
+	if err := r.Conn().QueryRow(query, hashTwoFactorChallenge(token), Now().Unix()).Scan(&id); err != nil {
+		return nil
+	}
+	return id
+}
+
+func (r *Runtime) clearTwoFactorChallenge(usersTable string, userId int) {
+	r.Conn().Exec(fmt.Sprintf("UPDATE %s SET two_factor_challenge = NULL, two_factor_challenge_expires = NULL WHERE id = ?", usersTable), userId)
+}
+
+// completeLogin stores the user in the session and returns its JWT
+func (r *Runtime) completeLogin(usersTable string, userId int, email, userName, userToken, roleName string) interface{} {
+	LogInfo("[Auth] Login successful for '%s' (ID: %d)", email, userId)
+
+	// Guardar en Sesión ($__session)
+	if sess := r.sessionFields(); sess != nil {
+		clearPendingTwoFactor(sess)
+		sess["user_id"] = userId
+		sess["user_token"] = userToken
+		sess["user_name"] = userName
+		sess["user_email"] = email
+		sess["user_role"] = roleName
+		sess["last_login_at"] = Now().Format("2006-01-02 15:04:05")
+	}
+
+	// Actualizar last_login_at
+	updateQuery := fmt.Sprintf("UPDATE %s SET last_login_at = %s WHERE id = ?", usersTable, "CURRENT_TIMESTAMP")
+	if val, ok := r.Env["DB"]; ok && val == "mysql" {
+		updateQuery = fmt.Sprintf("UPDATE %s SET last_login_at = NOW() WHERE id = ?", usersTable)
+	}
+	r.Conn().Exec(updateQuery, userId)
+
+	// Retornar JWT Token (su jti queda en sesión para que logout lo revoque)
+	token := r.generateJWT(userId, email, userName, roleName, false)
+	if tokenString, ok := token.(string); ok {
+		if claims, ok := r.ValidateJWT(tokenString); ok {
+			if sess := r.sessionFields(); sess != nil {
+				sess["token_jti"] = claims["jti"]
+				sess["token_exp"] = stdInt(claims["exp"], 0)
+			}
+		}
+	}
+	return token
+}
+
+// twoFactorTarget is the user 2FA methods act on: the explicit id argument
+// or the logged-in user
+func (r *Runtime) twoFactorTarget(args []interface{}) interface{} {
+	if len(args) > 0 {
+		if id, ok := args[0].(int); ok {
+			return id
+		}
+		if id, ok := args[0].(int64); ok {
+			return int(id)
+		}
+	}
+	if sess := r.sessionFields(); sess != nil {
+		return sess["user_id"]
+	}
+	return nil
+}
+
+func (r *Runtime) executeTwoFactorMethod(method, usersTable, rolesTable string, args []interface{}) interface{} {
+	if r.GetDB() == nil {
+		panic("Auth Error: No hay conexión a la base de datos configurada")
+	}
+
+	switch method {
+	case "enable2fa":
+		id := r.twoFactorTarget(args)
+		if id == nil {
+			LogError("[Auth] enable2fa requiere un usuario autenticado")
+			return false
+		}
+		u, ok := r.loadTwoFactorUser(usersTable, rolesTable, id)
+		if !ok {
+			return false
+		}
+		if u.confirmed {
+			LogError("[Auth] 2FA ya está activo para el usuario %d; usa Auth::disable2fa() primero", u.id)
+			return false
+		}
+
+		secret := NewTOTPSecret()
+		plain, hashed := newRecoveryCodes()
+		codesJSON, _ := json.Marshal(hashed)
+		query := fmt.Sprintf("UPDATE %s SET two_factor_secret = ?, two_factor_recovery_codes = ?, two_factor_confirmed_at = NULL, two_factor_last_step = 0 WHERE id = ?", usersTable)
+		if _, err := r.Conn().Exec(query, secret, string(codesJSON), u.id); err != nil {
+			LogError("[Auth] enable2fa: %v", err)
+			return false
+		}
+
+		issuer := r.Env["TWO_FACTOR_ISSUER"]
+		if issuer == "" {
+			issuer = r.Env["APP_NAME"]
+		}
+		if issuer == "" {
+			issuer = "JosSecurity"
+		}
+		uri := TOTPURI(issuer, u.email, secret)
+		qr, err := QRCodeDataURI(uri)
+		if err != nil {
+			LogWarning("[Auth] No se pudo generar el QR de 2FA: %v", err)
+		}
+		return map[string]interface{}{
+			"secret":         secret,
+			"uri":            uri,
+			"qr":             qr,
+			"recovery_codes": toStringList(plain),
+		}
+
+	case "verify2fa":
+		if len(args) < 1 {
+			return false
+		}
+		code := fmt.Sprintf("%v", args[0])
+		sess := r.sessionFields()
+
+		// Login waiting for its second factor (session or challenge), or a
+		// logged-in user confirming the setup (or re-checking a code before
+		// a sensitive action)
+		challenge := ""
+		if len(args) > 1 && args[1] != nil {
+			challenge = fmt.Sprintf("%v", args[1])
+		}
+		pending := PendingTwoFactor(sess)
+		var id interface{}
+		if challenge != "" {
+			id = r.twoFactorChallengeUser(usersTable, challenge)
+			pending = id != nil
+		} else if pending {
+			id = sess["two_factor_user_id"]
+		} else if sess != nil {
+			id = sess["user_id"]
+		}
+		if id == nil {
+			return false
+		}
+		u, ok := r.loadTwoFactorUser(usersTable, rolesTable, id)
+		if !ok || u.secret == "" {
+			return false
+		}
+		// The code of a pending login is throttled like the password
+		prefix := r.tablePrefix()
+		if pending && r.loginLockedFor(prefix, u.email) > 0 {
+			LogWarning("[Auth] 2FA blocked for '%s' by failed attempts", u.email)
+			return false
+		}
+
+		if step, ok := verifyTOTP(u.secret, code, Now(), u.lastStep); ok {
+			update := fmt.Sprintf("UPDATE %s SET two_factor_last_step = ? WHERE id = ?", usersTable)
+			if !u.confirmed {
+				update = fmt.Sprintf("UPDATE %s SET two_factor_last_step = ?, two_factor_confirmed_at = CURRENT_TIMESTAMP WHERE id = ?", usersTable)
+			}
+			r.Conn().Exec(update, step, u.id)
+		} else if !u.confirmed || !r.useRecoveryCode(usersTable, u, code) {
+			// Recovery codes only stand in for the app once 2FA is active
+			LogError("[Auth] Código 2FA inválido para el usuario %d", u.id)
+			if pending {
+				r.recordLoginFailure(prefix, u.email)
+			}
+			return false
+		}
+
+		if pending {
+			r.clearLoginFailures(prefix, u.email)
+			if challenge != "" {
+				r.clearTwoFactorChallenge(usersTable, u.id)
+			}
+			return r.completeLogin(usersTable, u.id, u.email, u.username, u.userToken, u.role)
+		}
+		return true
+
+	case "disable2fa":
+		id := r.twoFactorTarget(args)
+		if id == nil {
+			return false
+		}
+		query := fmt.Sprintf("UPDATE %s SET two_factor_secret = NULL, two_factor_recovery_codes = NULL, two_factor_confirmed_at = NULL, two_factor_last_step = 0, two_factor_challenge = NULL, two_factor_challenge_expires = NULL WHERE id = ?", usersTable)
+		_, err := r.Conn().Exec(query, id)
+		return err == nil
+
+	case "has2fa":
+		id := r.twoFactorTarget(args)
+		if id == nil {
+			return false
+		}
+		u, ok := r.loadTwoFactorUser(usersTable, rolesTable, id)
+		return ok && u.confirmed
+
+	case "pending2fa":
+		return PendingTwoFactor(r.sessionFields())
+
+	case "recoveryCodes":
+		// Replaces the recovery codes and returns the new ones
+		id := r.twoFactorTarget(args)
+		if id == nil {
+			return false
+		}
+		u, ok := r.loadTwoFactorUser(usersTable, rolesTable, id)
+		if !ok || !u.confirmed {
+			return false
+		}
+		plain, hashed := newRecoveryCodes()
+		codesJSON, _ := json.Marshal(hashed)
+		r.Conn().Exec(fmt.Sprintf("UPDATE %s SET two_factor_recovery_codes = ? WHERE id = ?", usersTable), string(codesJSON), u.id)
+		return toStringList(plain)
+
+	case "totp":
+		// Current code of a secret (tests with Date::setTestNow)
+		if len(args) < 1 {
+			return nil
+		}
+		code, err := TOTPCode(fmt.Sprintf("%v", args[0]), Now())
+		if err != nil {
+			panic("Auth Error: " + err.Error())
+		}
+		return code
+	}
+	return nil
+}
+
+// useRecoveryCode consumes a recovery code of u
+func (r *Runtime) useRecoveryCode(usersTable string, u *twoFactorUser, code string) bool {
+	var hashes []string
+	if json.Unmarshal([]byte(u.recoveryRaw), &hashes) != nil {
+		return false
+	}
+	hash := hashRecoveryCode(code)
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			remaining := append(hashes[:i:i], hashes[i+1:]...)
+			codesJSON, _ := json.Marshal(remaining)
+			r.Conn().Exec(fmt.Sprintf("UPDATE %s SET two_factor_recovery_codes = ? WHERE id = ?", usersTable), string(codesJSON), u.id)
+			LogWarning("[Auth] Código de recuperación usado por el usuario %d (%d restantes)", u.id, len(remaining))
+			return true
+		}
+	}
+	return false
+}
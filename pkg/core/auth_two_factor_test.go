@@ -0,0 +1,182 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func freezeClock(t *testing.T, at time.Time) {
+	t.Helper()
+	SetTestNow(&at)
+	t.Cleanup(func() { SetTestNow(nil) })
+}
+
+// logToTempDir keeps the log of the test out of the package directory
+func logToTempDir(t *testing.T) {
+	t.Helper()
+	if err := SetLogFile(filepath.Join(t.TempDir(), "log.txt")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(CloseLogger)
+}
+
+func codeAtStep(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := totpAt(testTOTPSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	freezeClock(t, time.Unix(1_700_000_000, 0))
+	current := Now().Unix() / totpPeriod
+
+	for _, offset := range []int64{-1, 0, 1} {
+		step, ok := verifyTOTP(testTOTPSecret, codeAtStep(t, current+offset), Now(), 0)
+		if !ok || step != current+offset {
+			t.Errorf("offset %d: got step %d, ok %v", offset, step, ok)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if _, ok := verifyTOTP(testTOTPSecret, codeAtStep(t, current+offset), Now(), 0); ok {
+			t.Errorf("offset %d: code outside the window accepted", offset)
+		}
+	}
+}
+
+func TestVerifyTOTPRejectsUsedStep(t *testing.T) {
+	freezeClock(t, time.Unix(1_700_000_000, 0))
+	code, _ := TOTPCode(testTOTPSecret, Now())
+
+	step, ok := verifyTOTP(testTOTPSecret, code, Now(), 0)
+	if !ok {
+		t.Fatal("current code rejected")
+	}
+	if _, ok := verifyTOTP(testTOTPSecret, code, Now(), step); ok {
+		t.Error("reused code accepted")
+	}
+	// Nor an older one still inside the window
+	if _, ok := verifyTOTP(testTOTPSecret, codeAtStep(t, step-1), Now(), step); ok {
+		t.Error("code older than the last used step accepted")
+	}
+
+	freezeClock(t, Now().Add(totpPeriod*time.Second))
+	next, _ := TOTPCode(testTOTPSecret, Now())
+	if _, ok := verifyTOTP(testTOTPSecret, next, Now(), step); !ok {
+		t.Error("code of the next step rejected")
+	}
+}
+
+// twoFactorRuntime returns a runtime on a fresh SQLite database with a
+// verified user (id 1) whose 2FA is confirmed; it returns the secret and
+// recovery codes
+func twoFactorRuntime(t *testing.T) (*Runtime, string, []string) {
+	t.Helper()
+	logToTempDir(t)
+	r := NewRuntime()
+	r.Env = map[string]string{
+		"DB":         "sqlite",
+		"DB_PATH":    filepath.Join(t.TempDir(), "test.sqlite"),
+		"PREFIX":     "js_",
+		"JWT_SECRET": "test-secret",
+	}
+	r.DB = nil
+	// Auth tables are created once per process; each test has its own DB
+	authTablesEnsured = false
+	t.Cleanup(func() {
+		delete(r.Variables, "$__session")
+		if r.DB != nil {
+			r.DB.Close()
+		}
+	})
+
+	if r.executeAuthMethod(nil, "create", []interface{}{map[string]interface{}{
+		"username": "ana", "email": "ana@example.com", "password": "secreto123",
+	}}) == false {
+		t.Fatal("could not create the user")
+	}
+	r.Conn().Exec("UPDATE js_users SET verificado = 1")
+
+	r.Variables["$__session"] = &Instance{Fields: map[string]interface{}{"user_id": 1}}
+	setup, ok := r.executeAuthMethod(nil, "enable2fa", nil).(map[string]interface{})
+	if !ok {
+		t.Fatal("enable2fa failed")
+	}
+	secret := setup["secret"].(string)
+	code, _ := TOTPCode(secret, Now())
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{code}) != true {
+		t.Fatal("could not confirm 2FA")
+	}
+	delete(r.Variables, "$__session")
+
+	var recovery []string
+	for _, c := range setup["recovery_codes"].([]interface{}) {
+		recovery = append(recovery, c.(string))
+	}
+	return r, secret, recovery
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	freezeClock(t, time.Unix(1_700_000_000, 0))
+	r, _, recovery := twoFactorRuntime(t)
+
+	r.Variables["$__session"] = &Instance{Fields: map[string]interface{}{"user_id": 1}}
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{recovery[0]}) != true {
+		t.Fatal("recovery code rejected")
+	}
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{recovery[0]}) != false {
+		t.Error("recovery code accepted twice")
+	}
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{recovery[1]}) != true {
+		t.Error("another recovery code rejected")
+	}
+}
+
+func TestSessionlessLoginGetsChallenge(t *testing.T) {
+	freezeClock(t, time.Unix(1_700_000_000, 0))
+	r, secret, _ := twoFactorRuntime(t)
+
+	result, ok := r.executeAuthMethod(nil, "attempt", []interface{}{"ana@example.com", "secreto123"}).(map[string]interface{})
+	if !ok || result["status"] != twoFactorPending {
+		t.Fatalf("attempt without session: got %v", result)
+	}
+	challenge := result["challenge"].(string)
+
+	freezeClock(t, Now().Add(totpPeriod*time.Second))
+	code, _ := TOTPCode(secret, Now())
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{code}) != false {
+		t.Error("code accepted without session or challenge")
+	}
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{code, "not-the-challenge"}) != false {
+		t.Error("code accepted with a wrong challenge")
+	}
+	if token, ok := r.executeAuthMethod(nil, "verify2fa", []interface{}{code, challenge}).(string); !ok || token == "" {
+		t.Fatal("valid code and challenge did not log in")
+	}
+
+	// The challenge is single-use
+	freezeClock(t, Now().Add(totpPeriod*time.Second))
+	code, _ = TOTPCode(secret, Now())
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{code, challenge}) != false {
+		t.Error("challenge accepted twice")
+	}
+}
+
+func TestTwoFactorChallengeExpires(t *testing.T) {
+	freezeClock(t, time.Unix(1_700_000_000, 0))
+	r, secret, _ := twoFactorRuntime(t)
+
+	result, _ := r.executeAuthMethod(nil, "attempt", []interface{}{"ana@example.com", "secreto123"}).(map[string]interface{})
+	challenge, _ := result["challenge"].(string)
+
+	freezeClock(t, Now().Add(twoFactorTimeout+time.Minute))
+	code, _ := TOTPCode(secret, Now())
+	if r.executeAuthMethod(nil, "verify2fa", []interface{}{code, challenge}) != false {
+		t.Error("expired challenge accepted")
+	}
+}
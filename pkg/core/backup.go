@@ -0,0 +1,883 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Database backups (joss db:backup / db:restore and the Backup class).
+//
+//	sql    DROP + CREATE of every table with the engine's own DDL, then one
+//	       INSERT per row. Restores into the same engine (PostgreSQL dumps are
+//	       data only: DELETE + INSERT over the migrated tables).
+//	jsonl  One JSON object per line: a header, then a "table" line followed by
+//	       its rows. Restores into any engine whose tables exist (joss migrate),
+//	       so it is the format to move data between engines.
+//
+// Both may be gzipped; restore detects it from the content, not the name.
+
+// DefaultBackupDir is where backups are written unless a path is given
+const DefaultBackupDir = "storage/backups"
+
+// backupTimeLayout is the timestamp in backup file names; retention reads it
+// back, so files that do not follow it are never pruned
+const backupTimeLayout = "20060102_150405"
+
+// BackupOptions configures WriteBackup
+type BackupOptions struct {
+	Format string   // "sql" (default) or "jsonl"
+	Gzip   bool     // compress the file (.gz)
+	Tables []string // tables to include, with or without prefix (empty = all)
+	Path   string   // destination file (default: Dir/backup_<timestamp>.<ext>)
+	Dir    string   // destination directory (default: DefaultBackupDir)
+}
+
+// BackupResult summarizes a backup or a restore
+type BackupResult struct {
+	Path   string
+	Format string
+	Tables int
+	Rows   int
+}
+
+// backupHeader is the first line of a jsonl archive
+type backupHeader struct {
+	Format    string   `json:"format"`
+	Version   int      `json:"version"`
+	Driver    string   `json:"driver"`
+	Prefix    string   `json:"prefix"`
+	CreatedAt string   `json:"created_at"`
+	Tables    []string `json:"tables"`
+}
+
+// backupTableLine opens the rows of a table in a jsonl archive
+type backupTableLine struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Create  []string `json:"create,omitempty"`
+}
+
+// BackupFileName returns the default file name for a backup taken now
+func BackupFileName(format string, gz bool) string {
+	name := "backup_" + Now().Format(backupTimeLayout) + "." + format
+	if gz {
+		name += ".gz"
+	}
+	return name
+}
+
+// WriteBackup dumps the tables of db to a file. Every table is read from one
+// snapshot (see backupSnapshot), so rows written meanwhile never leave the
+// dump half updated. The file is written under a temporary name and renamed
+// when complete, so retention never sees halves.
+func WriteBackup(db *sql.DB, driver, prefix string, opts BackupOptions) (BackupResult, error) {
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = "sql"
+	}
+	if format != "sql" && format != "jsonl" {
+		return BackupResult{}, fmt.Errorf("formato '%s' no soportado (sql o jsonl)", opts.Format)
+	}
+
+	snap, release, err := backupSnapshot(db, driver)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	defer release()
+
+	tables, err := backupTables(snap, driver)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	if len(opts.Tables) > 0 {
+		if tables, err = selectBackupTables(tables, opts.Tables, prefix); err != nil {
+			return BackupResult{}, err
+		}
+	}
+
+	path := opts.Path
+	if path == "" {
+		dir := opts.Dir
+		if dir == "" {
+			dir = DefaultBackupDir
+		}
+		path = filepath.Join(dir, BackupFileName(format, opts.Gzip))
+		// Two backups within the same second must not overwrite each other
+		ext := "." + format
+		if opts.Gzip {
+			ext += ".gz"
+		}
+		base := strings.TrimSuffix(path, ext)
+		for n := 2; ; n++ {
+			if _, err := os.Stat(path); err != nil {
+				break
+			}
+			path = fmt.Sprintf("%s_%d%s", base, n, ext)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return BackupResult{}, err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	var out io.Writer = f
+	var zw *gzip.Writer
+	if opts.Gzip {
+		zw = gzip.NewWriter(f)
+		out = zw
+	}
+	w := bufio.NewWriter(out)
+
+	result := BackupResult{Path: path, Format: format, Tables: len(tables)}
+	if format == "sql" {
+		result.Rows, err = writeSQLBackup(w, snap, driver, tables)
+	} else {
+		result.Rows, err = writeJSONLBackup(w, snap, driver, prefix, tables)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return BackupResult{}, err
+	}
+	return result, os.Rename(tmp, path)
+}
+
+// backupQuerier is what a dump reads through: the snapshot of backupSnapshot
+type backupQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// backupSnapshot opens the read-only transaction a dump runs in and returns
+// the func that ends it. MySQL needs START TRANSACTION WITH CONSISTENT
+// SNAPSHOT under REPEATABLE READ, which database/sql can't ask for, so it
+// runs on a dedicated connection; PostgreSQL uses a REPEATABLE READ
+// transaction and SQLite a plain one (its reads see a single state).
+func backupSnapshot(db *sql.DB, driver string) (backupQuerier, func(), error) {
+	ctx := context.Background()
+	if driver == "mysql" {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, stmt := range []string{"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ", "START TRANSACTION WITH CONSISTENT SNAPSHOT"} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				conn.Close()
+				return nil, nil, err
+			}
+		}
+		return snapshotConn{conn}, func() {
+			conn.ExecContext(ctx, "COMMIT")
+			conn.Close()
+		}, nil
+	}
+
+	var opts *sql.TxOptions
+	if driver == "postgres" {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, func() { tx.Rollback() }, nil
+}
+
+// snapshotConn runs the dump's queries on the connection holding the snapshot
+type snapshotConn struct {
+	conn *sql.Conn
+}
+
+func (c snapshotConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (c snapshotConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+// backupTables lists the base tables of the database
+func backupTables(db backupQuerier, driver string) ([]string, error) {
+	query := "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name"
+	if driver == "sqlite" {
+		query = "SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+	} else if driver == "postgres" {
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name"
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// selectBackupTables keeps the requested tables; names may omit the prefix
+func selectBackupTables(all, wanted []string, prefix string) ([]string, error) {
+	var tables []string
+	for _, name := range wanted {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := ""
+		for _, t := range all {
+			if t == name || t == prefix+name {
+				found = t
+				break
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("la tabla '%s' no existe", name)
+		}
+		tables = append(tables, found)
+	}
+	return tables, nil
+}
+
+// backupIdent quotes a table or column name for the engine of the dump
+func backupIdent(driver, name string) string {
+	if driver == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// tableDDL returns the statements that recreate a table (nil for PostgreSQL,
+// whose dumps are data only)
+func tableDDL(db backupQuerier, driver, table string) ([]string, error) {
+	switch driver {
+	case "sqlite":
+		rows, err := db.Query("SELECT sql FROM sqlite_master WHERE tbl_name = ? AND sql IS NOT NULL ORDER BY type = 'table' DESC, name", table)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var ddl []string
+		for rows.Next() {
+			var stmt string
+			if err := rows.Scan(&stmt); err != nil {
+				return nil, err
+			}
+			ddl = append(ddl, stmt)
+		}
+		return ddl, rows.Err()
+	case "mysql":
+		var name, stmt string
+		if err := db.QueryRow("SHOW CREATE TABLE "+backupIdent(driver, table)).Scan(&name, &stmt); err != nil {
+			return nil, err
+		}
+		return []string{stmt}, nil
+	}
+	return nil, nil
+}
+
+// backupRows runs fn for every row of table with the values ready to encode
+func backupRows(db backupQuerier, driver, table string, fn func(cols []string, vals []interface{}, binary []bool) error) ([]string, int, error) {
+	rows, err := db.Query("SELECT * FROM " + backupIdent(driver, table))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+	types, _ := rows.ColumnTypes()
+	binary := make([]bool, len(cols))
+	for i, t := range types {
+		name := strings.ToUpper(t.DatabaseTypeName())
+		switch driver {
+		case "mysql":
+			// MySQL returns text as []byte too, so only its binary types are blobs
+			binary[i] = strings.Contains(name, "BLOB") || strings.Contains(name, "BINARY")
+		case "postgres":
+			binary[i] = name == "BYTEA"
+		default:
+			binary[i] = true
+		}
+	}
+
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, count, err
+		}
+		if err := fn(cols, vals, binary); err != nil {
+			return nil, count, err
+		}
+		count++
+	}
+	return cols, count, rows.Err()
+}
+
+func writeSQLBackup(w *bufio.Writer, db backupQuerier, driver string, tables []string) (int, error) {
+	fmt.Fprintf(w, "-- JosSecurity backup\n-- driver: %s\n-- created_at: %s\n\n", driver, Now().Format("2006-01-02 15:04:05"))
+	switch driver {
+	case "sqlite":
+		w.WriteString("PRAGMA foreign_keys=OFF;\n\n")
+	case "mysql":
+		w.WriteString("SET FOREIGN_KEY_CHECKS=0;\n\n")
+	}
+
+	total := 0
+	for _, table := range tables {
+		ident := backupIdent(driver, table)
+		fmt.Fprintf(w, "-- table: %s\n", table)
+		ddl, err := tableDDL(db, driver, table)
+		if err != nil {
+			return total, fmt.Errorf("tabla %s: %v", table, err)
+		}
+		if ddl == nil {
+			fmt.Fprintf(w, "DELETE FROM %s;\n", ident)
+		} else {
+			fmt.Fprintf(w, "DROP TABLE IF EXISTS %s;\n", ident)
+			for _, stmt := range ddl {
+				w.WriteString(stmt + ";\n")
+			}
+		}
+
+		var quoted string
+		cols, count, err := backupRows(db, driver, table, func(cols []string, vals []interface{}, binary []bool) error {
+			if quoted == "" {
+				names := make([]string, len(cols))
+				for i, c := range cols {
+					names[i] = backupIdent(driver, c)
+				}
+				quoted = strings.Join(names, ", ")
+			}
+			literals := make([]string, len(vals))
+			for i, v := range vals {
+				literals[i] = sqlLiteral(driver, v, binary[i])
+			}
+			_, err := fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES (%s);\n", ident, quoted, strings.Join(literals, ", "))
+			return err
+		})
+		if err != nil {
+			return total, fmt.Errorf("tabla %s: %v", table, err)
+		}
+		// Rows keep their ids, so move the SERIAL sequence past them
+		if driver == "postgres" && count > 0 && hasBackupColumn(cols, "id") {
+			fmt.Fprintf(w, "SELECT setval(pg_get_serial_sequence('%s', 'id'), (SELECT MAX(id) FROM %s));\n", table, ident)
+		}
+		w.WriteString("\n")
+		total += count
+	}
+
+	switch driver {
+	case "sqlite":
+		w.WriteString("PRAGMA foreign_keys=ON;\n")
+	case "mysql":
+		w.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+	return total, nil
+}
+
+// sqlLiteral renders a scanned value as an SQL literal of the engine
+func sqlLiteral(driver string, v interface{}, binary bool) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if binary {
+			if driver == "postgres" {
+				return `'\x` + hex.EncodeToString(val) + "'::bytea"
+			}
+			return "X'" + hex.EncodeToString(val) + "'"
+		}
+		return sqlString(driver, string(val))
+	case string:
+		return sqlString(driver, val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		if driver == "postgres" {
+			return strings.ToUpper(strconv.FormatBool(val))
+		}
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return sqlString(driver, val.Format("2006-01-02 15:04:05"))
+	}
+	return sqlString(driver, fmt.Sprintf("%v", v))
+}
+
+// sqlString quotes a string; MySQL also treats backslashes as escapes
+func sqlString(driver, s string) string {
+	if driver == "mysql" {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func hasBackupColumn(cols []string, name string) bool {
+	for _, c := range cols {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSONLBackup(w *bufio.Writer, db backupQuerier, driver, prefix string, tables []string) (int, error) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	header := backupHeader{Format: "joss-backup", Version: 1, Driver: driver, Prefix: prefix, CreatedAt: Now().Format("2006-01-02 15:04:05"), Tables: tables}
+	if err := enc.Encode(header); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, table := range tables {
+		ddl, err := tableDDL(db, driver, table)
+		if err != nil {
+			return total, fmt.Errorf("tabla %s: %v", table, err)
+		}
+		started := false
+		writeTable := func(cols []string) error {
+			started = true
+			return enc.Encode(backupTableLine{Table: table, Columns: cols, Create: ddl})
+		}
+		cols, count, err := backupRows(db, driver, table, func(cols []string, vals []interface{}, binary []bool) error {
+			if !started {
+				if err := writeTable(cols); err != nil {
+					return err
+				}
+			}
+			row := make([]interface{}, len(vals))
+			for i, v := range vals {
+				row[i] = jsonBackupValue(v, binary[i])
+			}
+			return enc.Encode(row)
+		})
+		if err != nil {
+			return total, fmt.Errorf("tabla %s: %v", table, err)
+		}
+		if !started {
+			if err := writeTable(cols); err != nil {
+				return total, err
+			}
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// jsonBackupValue makes a scanned value JSON friendly; blobs are wrapped as
+// {"$base64": "..."} so they are told apart from text on restore
+func jsonBackupValue(v interface{}, binary bool) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		if binary {
+			return map[string]string{"$base64": base64.StdEncoding.EncodeToString(val)}
+		}
+		return string(val)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	}
+	return v
+}
+
+// RestoreBackup loads a backup written by WriteBackup into db. Restored
+// tables are replaced, the others are left alone. The restore runs in one
+// transaction, but on MySQL DROP/CREATE TABLE commit implicitly, so there a
+// failed sql restore (or a jsonl one that creates missing tables) leaves the
+// tables before the error restored: it is not atomic.
+func RestoreBackup(db *sql.DB, driver, prefix, path string) (BackupResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return BackupResult{}, err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	first, _ := br.Peek(1)
+	format := "sql"
+	if len(first) == 1 && first[0] == '{' {
+		format = "jsonl"
+	}
+
+	// One connection, so foreign key switches apply to the restore itself
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	defer conn.Close()
+	// The connection goes back to the pool afterwards: restore the previous
+	// setting instead of assuming it was on
+	switch driver {
+	case "sqlite":
+		var enabled int
+		conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled)
+		conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF")
+		defer conn.ExecContext(ctx, fmt.Sprintf("PRAGMA foreign_keys=%d", enabled))
+	case "mysql":
+		var enabled int
+		conn.QueryRowContext(ctx, "SELECT @@FOREIGN_KEY_CHECKS").Scan(&enabled)
+		conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=0")
+		defer conn.ExecContext(ctx, fmt.Sprintf("SET FOREIGN_KEY_CHECKS=%d", enabled))
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	result := BackupResult{Path: path, Format: format}
+	if format == "sql" {
+		err = restoreSQL(tx, driver, br, &result)
+	} else {
+		err = restoreJSONL(tx, driver, prefix, br, &result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return BackupResult{}, err
+	}
+	return result, tx.Commit()
+}
+
+func restoreSQL(tx *sql.Tx, driver string, br *bufio.Reader, result *BackupResult) error {
+	for first := true; ; first = false {
+		stmt, comments, err := nextSQLStatement(br, driver == "mysql")
+		if first {
+			if source := backupCommentValue(comments, "driver"); source != "" && source != driver {
+				return fmt.Errorf("el respaldo es de %s y la base de datos es %s; usa un respaldo --format=jsonl para cambiar de motor", source, driver)
+			}
+		}
+		if stmt != "" {
+			upper := strings.ToUpper(stmt)
+			switch {
+			// Foreign key switches are handled by RestoreBackup
+			case strings.HasPrefix(upper, "PRAGMA FOREIGN_KEYS"), strings.HasPrefix(upper, "SET FOREIGN_KEY_CHECKS"):
+			default:
+				if _, xerr := tx.Exec(stmt); xerr != nil {
+					return fmt.Errorf("%v\n  en: %s", xerr, truncateStatement(stmt))
+				}
+				if strings.HasPrefix(upper, "INSERT") {
+					result.Rows++
+				} else if strings.HasPrefix(upper, "DROP TABLE") || strings.HasPrefix(upper, "DELETE FROM") {
+					result.Tables++
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// nextSQLStatement reads up to the next ";" outside string literals and
+// returns the "--" comment lines found before the statement
+func nextSQLStatement(br *bufio.Reader, backslashEscapes bool) (string, []string, error) {
+	var sb strings.Builder
+	var comments []string
+	inQuote, escaped := false, false
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return strings.TrimSpace(sb.String()), comments, err
+		}
+		switch {
+		case inQuote:
+			sb.WriteByte(c)
+			if escaped {
+				escaped = false
+			} else if backslashEscapes && c == '\\' {
+				escaped = true
+			} else if c == '\'' {
+				inQuote = false
+			}
+		case sb.Len() == 0 && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+		case sb.Len() == 0 && c == '-':
+			line, err := br.ReadString('\n')
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(line, "-")))
+			if err != nil {
+				return "", comments, err
+			}
+		case c == '\'':
+			inQuote = true
+			sb.WriteByte(c)
+		case c == ';':
+			return strings.TrimSpace(sb.String()), comments, nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// backupCommentValue finds "key: value" among header comments
+func backupCommentValue(comments []string, key string) string {
+	for _, c := range comments {
+		if v, ok := strings.CutPrefix(c, key+":"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func truncateStatement(stmt string) string {
+	if len(stmt) > 200 {
+		return stmt[:200] + "..."
+	}
+	return stmt
+}
+
+func restoreJSONL(tx *sql.Tx, driver, prefix string, br *bufio.Reader, result *BackupResult) error {
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	var header backupHeader
+	if err := dec.Decode(&header); err != nil || header.Format != "joss-backup" {
+		return fmt.Errorf("el archivo no es un respaldo jsonl de JosSecurity")
+	}
+
+	var (
+		table   string
+		insert  *sql.Stmt
+		columns []string
+		hasID   bool
+	)
+	closeTable := func() {
+		if insert != nil {
+			insert.Close()
+			insert = nil
+		}
+		if driver == "postgres" && hasID {
+			tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE((SELECT MAX(id) FROM %s), 1))", table, backupIdent(driver, table)))
+		}
+	}
+
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if len(raw) > 0 && raw[0] == '{' {
+			closeTable()
+			var line backupTableLine
+			if err := json.Unmarshal(raw, &line); err != nil {
+				return err
+			}
+			// Archives taken with another PREFIX land on this project's tables
+			table = line.Table
+			if header.Prefix != prefix && strings.HasPrefix(table, header.Prefix) {
+				table = prefix + strings.TrimPrefix(table, header.Prefix)
+			}
+			if err := prepareRestoreTable(tx, driver, header, line, table); err != nil {
+				return err
+			}
+			columns = line.Columns
+			hasID = hasBackupColumn(columns, "id")
+			names := make([]string, len(columns))
+			marks := make([]string, len(columns))
+			for i, c := range columns {
+				names[i] = backupIdent(driver, c)
+				marks[i] = "?"
+				if driver == "postgres" {
+					marks[i] = "$" + strconv.Itoa(i+1)
+				}
+			}
+			stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", backupIdent(driver, table), strings.Join(names, ", "), strings.Join(marks, ", ")))
+			if err != nil {
+				return fmt.Errorf("tabla %s: %v", table, err)
+			}
+			insert = stmt
+			result.Tables++
+			continue
+		}
+
+		if insert == nil {
+			return fmt.Errorf("fila fuera de una tabla en el respaldo")
+		}
+		// json.Unmarshal has no UseNumber, and ids must not become floats
+		var row []interface{}
+		rowDec := json.NewDecoder(bytes.NewReader(raw))
+		rowDec.UseNumber()
+		if err := rowDec.Decode(&row); err != nil {
+			return err
+		}
+		values := make([]interface{}, len(row))
+		for i, v := range row {
+			values[i] = restoreValue(v)
+		}
+		if _, err := insert.Exec(values...); err != nil {
+			return fmt.Errorf("tabla %s: %v", table, err)
+		}
+		result.Rows++
+	}
+	closeTable()
+	return nil
+}
+
+// prepareRestoreTable empties the table, creating it from the archived DDL
+// when it does not exist and the archive comes from the same engine
+func prepareRestoreTable(tx *sql.Tx, driver string, header backupHeader, line backupTableLine, table string) error {
+	exists := false
+	var n int
+	switch driver {
+	case "sqlite":
+		exists = tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name = ?", table).Scan(&n) == nil && n > 0
+	case "postgres":
+		exists = tx.QueryRow("SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1", table).Scan(&n) == nil && n > 0
+	default:
+		exists = tx.QueryRow("SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).Scan(&n) == nil && n > 0
+	}
+
+	if exists {
+		_, err := tx.Exec("DELETE FROM " + backupIdent(driver, table))
+		return err
+	}
+	if header.Driver != driver || len(line.Create) == 0 || table != line.Table {
+		return fmt.Errorf("la tabla %s no existe; ejecuta 'joss migrate' antes de restaurar", table)
+	}
+	for _, stmt := range line.Create {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("tabla %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+func restoreValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		if s, ok := val["$base64"].(string); ok {
+			b, _ := base64.StdEncoding.DecodeString(s)
+			return b
+		}
+	}
+	return v
+}
+
+// BackupRetention decides which backups to delete: the newest Keep are kept
+// and those older than KeepDays days are removed (0 disables each rule)
+type BackupRetention struct {
+	Keep     int
+	KeepDays int
+}
+
+// Expired returns the names to delete, among file names that follow the
+// backup_<timestamp> pattern; other names are never returned
+func (rule BackupRetention) Expired(names []string) []string {
+	type backupFile struct {
+		name string
+		at   time.Time
+	}
+	var files []backupFile
+	for _, name := range names {
+		if at, ok := backupTime(name); ok {
+			files = append(files, backupFile{name, at})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].at.Equal(files[j].at) {
+			return files[i].name > files[j].name
+		}
+		return files[i].at.After(files[j].at)
+	})
+
+	var expired []string
+	limit := Now().AddDate(0, 0, -rule.KeepDays)
+	for i, f := range files {
+		if (rule.Keep > 0 && i >= rule.Keep) || (rule.KeepDays > 0 && f.at.Before(limit)) {
+			expired = append(expired, f.name)
+		}
+	}
+	return expired
+}
+
+func backupTime(name string) (time.Time, bool) {
+	base := filepath.Base(name)
+	if !strings.HasPrefix(base, "backup_") || len(base) < len("backup_")+len(backupTimeLayout) {
+		return time.Time{}, false
+	}
+	at, err := time.ParseInLocation(backupTimeLayout, base[len("backup_"):len("backup_")+len(backupTimeLayout)], time.Local)
+	return at, err == nil
+}
+
+// ListBackups returns the backup files of dir, newest first
+func ListBackups(dir string) []string {
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		if _, ok := backupTime(e.Name()); ok && !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names
+}
+
+// PruneBackups deletes the backups of dir expired by rule
+func PruneBackups(dir string, rule BackupRetention) []string {
+	expired := rule.Expired(ListBackups(dir))
+	for _, name := range expired {
+		os.Remove(filepath.Join(dir, name))
+	}
+	return expired
+}
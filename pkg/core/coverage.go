@@ -0,0 +1,359 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jossecurity/joss/pkg/parser"
+)
+
+// Coverage records how many times each executable line of Joss scripts and
+// views ran. Scripts are instrumented through executeStatement (statements are
+// mapped to files by RegisterSource); views through compileViewToJOSS.
+type Coverage struct {
+	mu         sync.Mutex
+	files      map[string]map[int]*int64 // file -> line -> hits
+	statements sync.Map                  // parser.Statement -> *int64
+	Exclude    []string                  // path prefixes left out of reports (e.g. tests/)
+}
+
+var activeCoverage atomic.Pointer[Coverage]
+
+// StartCoverage enables line coverage for every source registered from now on
+func StartCoverage() *Coverage {
+	c := &Coverage{files: make(map[string]map[int]*int64)}
+	activeCoverage.Store(c)
+	return c
+}
+
+// ActiveCoverage returns the running coverage recorder or nil
+func ActiveCoverage() *Coverage {
+	return activeCoverage.Load()
+}
+
+// StopCoverage disables recording; collected hits are kept in the returned recorder
+func StopCoverage() *Coverage {
+	return activeCoverage.Swap(nil)
+}
+
+func (c *Coverage) excluded(file string) bool {
+	clean := filepath.ToSlash(filepath.Clean(file))
+	for _, prefix := range c.Exclude {
+		p := filepath.ToSlash(filepath.Clean(prefix))
+		if clean == p || strings.HasPrefix(clean, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// counter returns the hit counter of file:line, declaring the line executable
+func (c *Coverage) counter(file string, line int) *int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines, ok := c.files[file]
+	if !ok {
+		lines = make(map[int]*int64)
+		c.files[file] = lines
+	}
+	cnt, ok := lines[line]
+	if !ok {
+		cnt = new(int64)
+		lines[line] = cnt
+	}
+	return cnt
+}
+
+// register walks the whole program (including closures and ternary blocks)
+// and maps every executable statement to its file:line counter
+func (c *Coverage) register(program *parser.Program, filename string) {
+	if c.excluded(filename) {
+		return
+	}
+	stmtType := reflect.TypeOf((*parser.Statement)(nil)).Elem()
+
+	var walk func(v reflect.Value, inClass bool)
+	walk = func(v reflect.Value, inClass bool) {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if v.IsNil() {
+				return
+			}
+			if v.Kind() == reflect.Ptr && v.CanInterface() && v.Type().Implements(stmtType) {
+				stmt := v.Interface().(parser.Statement)
+				if coverable(stmt, inClass) {
+					if line := statementLine(stmt); line > 0 {
+						c.statements.Store(stmt, c.counter(filename, line))
+					}
+				}
+				if cls, ok := stmt.(*parser.ClassStatement); ok {
+					if cls.Body != nil {
+						for _, s := range cls.Body.Statements {
+							walk(reflect.ValueOf(s), true)
+						}
+					}
+					return
+				}
+			}
+			walk(v.Elem(), false)
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i), false)
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i), false)
+			}
+		case reflect.Map:
+			iter := v.MapRange()
+			for iter.Next() {
+				walk(iter.Key(), false)
+				walk(iter.Value(), false)
+			}
+		}
+	}
+	for _, stmt := range program.Statements {
+		walk(reflect.ValueOf(stmt), false)
+	}
+}
+
+// coverable reports whether executeStatement runs the statement itself
+func coverable(stmt parser.Statement, inClass bool) bool {
+	switch stmt.(type) {
+	case *parser.ClassStatement, *parser.BlockStatement, *parser.InitStatement, *parser.MethodStatement:
+		return false
+	case *parser.LetStatement:
+		// Class properties are evaluated by `new`, not executeStatement
+		return !inClass
+	}
+	return true
+}
+
+// hit counts one execution of stmt (no-op for unregistered statements)
+func (c *Coverage) hit(stmt parser.Statement) {
+	if cnt, ok := c.statements.Load(stmt); ok {
+		atomic.AddInt64(cnt.(*int64), 1)
+	}
+}
+
+// HitLine counts one execution of file:line (used by compiled views)
+func (c *Coverage) HitLine(file string, line int) {
+	if c.excluded(file) {
+		return
+	}
+	atomic.AddInt64(c.counter(file, line), 1)
+}
+
+// DeclareLine marks file:line as executable without counting a hit
+func (c *Coverage) DeclareLine(file string, line int) {
+	if c.excluded(file) {
+		return
+	}
+	c.counter(file, line)
+}
+
+// CoverageFile is the per-file result of a coverage run
+type CoverageFile struct {
+	Path  string
+	Lines map[int]int64
+}
+
+// Covered returns the number of executable lines hit at least once
+func (f CoverageFile) Covered() int {
+	n := 0
+	for _, hits := range f.Lines {
+		if hits > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Percent returns the line coverage percentage
+func (f CoverageFile) Percent() float64 {
+	if len(f.Lines) == 0 {
+		return 100
+	}
+	return 100 * float64(f.Covered()) / float64(len(f.Lines))
+}
+
+func (f CoverageFile) sortedLines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for l := range f.Lines {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Files returns a snapshot of the results ordered by path
+func (c *Coverage) Files() []CoverageFile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]CoverageFile, 0, len(c.files))
+	for path, lines := range c.files {
+		f := CoverageFile{Path: path, Lines: make(map[int]int64, len(lines))}
+		for l, cnt := range lines {
+			f.Lines[l] = atomic.LoadInt64(cnt)
+		}
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Totals returns covered and executable line counts across all files
+func (c *Coverage) Totals() (covered, total int) {
+	for _, f := range c.Files() {
+		covered += f.Covered()
+		total += len(f.Lines)
+	}
+	return covered, total
+}
+
+// WriteLCOV writes the tracefile format read by genhtml, Codecov, IDEs, etc.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range c.Files() {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.Path)
+		for _, l := range f.sortedLines() {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l, f.Lines[l])
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(f.Lines), f.Covered())
+	}
+	return bw.Flush()
+}
+
+// WriteHTML writes a self-contained report with the annotated sources
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	files := c.Files()
+	covered, total := c.Totals()
+	percent := 100.0
+	if total > 0 {
+		percent = 100 * float64(covered) / float64(total)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>Cobertura Joss</title><style>
+body{font-family:system-ui,sans-serif;margin:2rem;color:#222}table{border-collapse:collapse}
+td,th{padding:.3rem .8rem;border-bottom:1px solid #ddd;text-align:left}
+pre{margin:0;font-size:13px}.src{border:1px solid #ddd;margin:1rem 0 2rem}
+.src div{white-space:pre;font-family:monospace;font-size:13px;padding:0 .5rem}
+.hit{background:#e6ffed}.miss{background:#ffeef0}.n{color:#999;display:inline-block;width:4em}
+.c{color:#666;display:inline-block;width:4em}</style></head><body>`)
+	fmt.Fprintf(bw, "<h1>Cobertura: %.1f%% (%d/%d líneas)</h1><table><tr><th>Archivo</th><th>Líneas</th><th>%%</th></tr>", percent, covered, total)
+	for i, f := range files {
+		fmt.Fprintf(bw, `<tr><td><a href="#f%d">%s</a></td><td>%d/%d</td><td>%.1f%%</td></tr>`,
+			i, html.EscapeString(f.Path), f.Covered(), len(f.Lines), f.Percent())
+	}
+	bw.WriteString("</table>")
+
+	for i, f := range files {
+		fmt.Fprintf(bw, `<h2 id="f%d">%s — %.1f%%</h2><div class="src">`, i, html.EscapeString(f.Path), f.Percent())
+		source, err := os.ReadFile(f.Path)
+		if err != nil {
+			// Source not on disk (VFS build): list the executable lines only
+			for _, l := range f.sortedLines() {
+				class := "miss"
+				if f.Lines[l] > 0 {
+					class = "hit"
+				}
+				fmt.Fprintf(bw, `<div class="%s"><span class="n">%d</span><span class="c">%d×</span></div>`, class, l, f.Lines[l])
+			}
+		} else {
+			for idx, text := range strings.Split(string(source), "\n") {
+				l := idx + 1
+				class, count := "", ""
+				if hits, ok := f.Lines[l]; ok {
+					class, count = "miss", "0×"
+					if hits > 0 {
+						class, count = "hit", strconv.FormatInt(hits, 10)+"×"
+					}
+				}
+				fmt.Fprintf(bw, `<div class="%s"><span class="n">%d</span><span class="c">%s</span>%s</div>`,
+					class, l, count, html.EscapeString(strings.TrimRight(text, "\r")))
+			}
+		}
+		bw.WriteString("</div>")
+	}
+	bw.WriteString("</body></html>\n")
+	return bw.Flush()
+}
+
+// WriteReports writes <dir>/lcov.info and <dir>/index.html
+func (c *Coverage) WriteReports(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	lcovPath := filepath.Join(dir, "lcov.info")
+	htmlPath := filepath.Join(dir, "index.html")
+
+	f, err := os.Create(lcovPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.WriteLCOV(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.Close()
+
+	f, err = os.Create(htmlPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := c.WriteHTML(f); err != nil {
+		return nil, err
+	}
+	return []string{lcovPath, htmlPath}, nil
+}
+
+// --- View instrumentation ---
+// While coverage runs, every line of a view/layout/include is suffixed with a
+// marker naming its file and line. The markers survive @extends/@include
+// merging, so compileViewToJOSS can attribute each directive to its source.
+
+var viewMarkerRe = regexp.MustCompile("\x01([^\x01\x02]*):(\\d+)\x02")
+
+// markViewSource annotates a view file's lines when coverage is active
+func markViewSource(content, file string) string {
+	c := activeCoverage.Load()
+	if c == nil || c.excluded(file) {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i := range lines {
+		lines[i] = lines[i] + fmt.Sprintf("\x01%s:%d\x02", file, i+1)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripViewMarkers removes coverage markers from text
+func stripViewMarkers(s string) string {
+	if !strings.Contains(s, "\x01") {
+		return s
+	}
+	return viewMarkerRe.ReplaceAllString(s, "")
+}
+
+// viewMarkerAt returns the file:line of the source line containing offset i
+func viewMarkerAt(s string, i int) (string, int, bool) {
+	m := viewMarkerRe.FindStringSubmatch(s[i:])
+	if m == nil {
+		return "", 0, false
+	}
+	line, _ := strconv.Atoi(m[2])
+	return m[1], line, true
+}
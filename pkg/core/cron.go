@@ -24,11 +24,11 @@ func (r *Runtime) executeCronMethod(instance *Instance, method string, args []in
 
 				// Check if exists
 				var id int
-				err := r.GetDB().QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE name = ?", tableName), name).Scan(&id)
+				err := r.Conn().QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE name = ?", tableName), name).Scan(&id)
 				if err == sql.ErrNoRows {
-					_, err = r.GetDB().Exec(fmt.Sprintf("INSERT INTO %s (name, schedule, status) VALUES (?, ?, 'idle')", tableName), name, schedule)
+					_, err = r.Conn().Exec(fmt.Sprintf("INSERT INTO %s (name, schedule, status) VALUES (?, ?, 'idle')", tableName), name, schedule)
 				} else if err == nil {
-					_, err = r.GetDB().Exec(fmt.Sprintf("UPDATE %s SET schedule = ? WHERE id = ?", tableName), schedule, id)
+					_, err = r.Conn().Exec(fmt.Sprintf("UPDATE %s SET schedule = ? WHERE id = ?", tableName), schedule, id)
 				}
 				if err != nil {
 					fmt.Printf("[Cron] Error registrando tarea %s: %v\n", name, err)
@@ -45,14 +45,14 @@ func (r *Runtime) executeCronMethod(instance *Instance, method string, args []in
 					tableName := prefix + "cron"
 
 					var isRunning bool
-					err := r.GetDB().QueryRow(fmt.Sprintf("SELECT is_running FROM %s WHERE name = ?", tableName), name).Scan(&isRunning)
+					err := r.Conn().QueryRow(fmt.Sprintf("SELECT is_running FROM %s WHERE name = ?", tableName), name).Scan(&isRunning)
 					if err == nil && isRunning {
 						fmt.Printf("[Cron] Tarea '%s' ya está en ejecución. Saltando.\n", name)
 						return nil
 					}
 
 					// Lock
-					_, err = r.GetDB().Exec(fmt.Sprintf("UPDATE %s SET is_running = 1, status = 'running' WHERE name = ?", tableName), name)
+					_, err = r.Conn().Exec(fmt.Sprintf("UPDATE %s SET is_running = 1, status = 'running' WHERE name = ?", tableName), name)
 					if err != nil {
 						fmt.Printf("[Cron] Error bloqueando tarea %s: %v\n", name, err)
 						return nil
@@ -74,11 +74,11 @@ func (r *Runtime) executeCronMethod(instance *Instance, method string, args []in
 						if rec := recover(); rec != nil {
 							fmt.Printf("[Cron] Error en tarea %s: %v\n", name, rec)
 							if r.GetDB() != nil {
-								r.GetDB().Exec(fmt.Sprintf("UPDATE %s SET is_running = 0, status = 'error', last_run_at = CURRENT_TIMESTAMP WHERE name = ?", tableName), name)
+								newR.Conn().Exec(fmt.Sprintf("UPDATE %s SET is_running = 0, status = 'error', last_run_at = CURRENT_TIMESTAMP WHERE name = ?", tableName), name)
 							}
 						} else {
 							if r.GetDB() != nil {
-								r.GetDB().Exec(fmt.Sprintf("UPDATE %s SET is_running = 0, status = 'completed', last_run_at = CURRENT_TIMESTAMP WHERE name = ?", tableName), name)
+								newR.Conn().Exec(fmt.Sprintf("UPDATE %s SET is_running = 0, status = 'completed', last_run_at = CURRENT_TIMESTAMP WHERE name = ?", tableName), name)
 							}
 						}
 					}()
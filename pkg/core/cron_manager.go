@@ -36,12 +36,11 @@ func (r *Runtime) EnsureCronTable() {
 	// In SQLite, "INTEGER PRIMARY KEY AUTO_INCREMENT" is syntax error.
 
 	// We can check r.Env["DB"]
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := r.DBDriver()
 
-	if dbDriver == "mysql" {
+	if dbDriver == "postgres" {
+		query = postgresDDL(query)
+	} else if dbDriver == "mysql" {
 		query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			id INT AUTO_INCREMENT PRIMARY KEY,
@@ -16,20 +16,31 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 
 	// Initialize internal state if needed
 	if _, ok := instance.Fields["_wheres"]; !ok {
-		instance.Fields["_wheres"] = []string{}
-		instance.Fields["_bindings"] = []interface{}{}
-		instance.Fields["_select"] = "*"
-		instance.Fields["_table"] = ""
+		initQueryState(instance)
+		if r.isModelClass(instance.Class) {
+			instance.Fields["_model"] = true
+		}
 	}
 
 	switch method {
+	case "connection":
+		// connection("analytics") -> builder bound to that named connection
+		name := argString(args, 0, "")
+		r.connectionName(name) // fail early on unknown names
+		if isModel(instance) {
+			// Post::connection("archivo")->where(...)
+			instance.Fields["connection"] = name
+			return instance
+		}
+		return &Instance{Class: instance.Class, Fields: map[string]interface{}{"connection": name}}
+
 	case "table":
 		if len(args) > 0 {
 			tableName, ok := args[0].(string)
 			if !ok {
 				panic(fmt.Sprintf("GranMySQL Error: table() expects string, got %T", args[0]))
 			}
-			instance.Fields["_table"] = quoteIdentifier(r.applyTablePrefix(tableName))
+			instance.Fields["_table"] = quoteIdentifier(r.builderTable(instance, tableName))
 		}
 		return instance // Return this for chaining
 
@@ -49,12 +60,12 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 						// Try to find the part with "."
 						for i, p := range parts {
 							if strings.Contains(p, ".") {
-								parts[i] = r.applyColumnPrefix(p)
+								parts[i] = r.builderColumn(instance, p)
 							}
 						}
 						strCols = append(strCols, strings.Join(parts, " "))
 					} else {
-						strCols = append(strCols, r.applyColumnPrefix(colStr))
+						strCols = append(strCols, r.builderColumn(instance, colStr))
 					}
 				}
 				instance.Fields["_select"] = strings.Join(strCols, ", ")
@@ -66,6 +77,12 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 		// Support both old and new API
 		// Old API: where("json") - uses tabla, comparar, comparable properties
 		// New API: where(col, val) or where(col, op, val) - fluent builder
+		// Nested:  where(function($q) { $q->where(...)->orWhere(...) })
+
+		if len(args) == 1 && isClosure(args[0]) {
+			r.addNestedWhere(instance, "AND", args[0])
+			return instance
+		}
 
 		if len(args) == 1 {
 			// Old API: where("json") or where("array")
@@ -77,12 +94,13 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 			col := instance.Fields["comparar"]
 			val := instance.Fields["comparable"]
 
-			if r.GetDB() == nil {
+			conn := r.builderConnection(instance)
+			if conn.db == nil {
 				return "[]"
 			}
 
 			query := fmt.Sprintf("SELECT * FROM %v WHERE %v = ?", table, col)
-			rows, err := r.GetDB().Query(query, val)
+			rows, err := r.connExec(conn).Query(query, val)
 			if err != nil {
 				fmt.Printf("[GranMySQL] Error en where: %v\n", err)
 				return "[]"
@@ -97,32 +115,118 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 		}
 
 		// New fluent builder API
-		wheres := instance.Fields["_wheres"].([]string)
-		bindings := instance.Fields["_bindings"].([]interface{})
+		r.addBasicWhere(instance, "AND", args)
+		return instance
+
+	case "orWhere":
+		if len(args) == 1 && isClosure(args[0]) {
+			r.addNestedWhere(instance, "OR", args[0])
+		} else {
+			r.addBasicWhere(instance, "OR", args)
+		}
+		return instance
+
+	case "whereIn", "whereNotIn", "orWhereIn", "orWhereNotIn":
+		if len(args) < 2 {
+			panic(fmt.Sprintf("GranDB Error: %s() requiere columna y lista de valores", method))
+		}
+		values, ok := args[1].([]interface{})
+		if !ok {
+			panic(fmt.Sprintf("GranDB Error: %s() espera un array, se obtuvo %T", method, args[1]))
+		}
+		col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+		not := strings.Contains(method, "Not")
+		var cond string
+		if len(values) == 0 {
+			// IN () is invalid SQL: an empty list matches nothing (or everything, for NOT IN)
+			cond = "1 = 0"
+			if not {
+				cond = "1 = 1"
+			}
+		} else {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+			keyword := "IN"
+			if not {
+				keyword = "NOT IN"
+			}
+			cond = fmt.Sprintf("%s %s (%s)", col, keyword, placeholders)
+		}
+		addWhere(instance, whereBoolean(method), cond, values...)
+		return instance
 
+	case "whereNull", "whereNotNull", "orWhereNull", "orWhereNotNull":
+		if len(args) < 1 {
+			panic(fmt.Sprintf("GranDB Error: %s() requiere una columna", method))
+		}
+		col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+		cond := col + " IS NULL"
+		if strings.Contains(method, "Not") {
+			cond = col + " IS NOT NULL"
+		}
+		addWhere(instance, whereBoolean(method), cond)
+		return instance
+
+	case "whereBetween", "whereNotBetween", "orWhereBetween", "orWhereNotBetween":
+		var bounds []interface{}
 		if len(args) == 2 {
-			col := quoteIdentifier(r.applyColumnPrefix(args[0].(string)))
-			val := args[1]
-			wheres = append(wheres, fmt.Sprintf("%s = ?", col))
-			bindings = append(bindings, val)
+			bounds, _ = args[1].([]interface{})
 		} else if len(args) == 3 {
-			col := quoteIdentifier(r.applyColumnPrefix(args[0].(string)))
-			op := args[1].(string)
-			val := args[2]
-			wheres = append(wheres, fmt.Sprintf("%s %s ?", col, op))
-			bindings = append(bindings, val)
+			bounds = []interface{}{args[1], args[2]}
+		}
+		if len(bounds) != 2 {
+			panic(fmt.Sprintf("GranDB Error: %s() requiere columna y [min, max]", method))
+		}
+		col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+		keyword := "BETWEEN"
+		if strings.Contains(method, "Not") {
+			keyword = "NOT BETWEEN"
 		}
+		addWhere(instance, whereBoolean(method), fmt.Sprintf("%s %s ? AND ?", col, keyword), bounds...)
+		return instance
+
+	case "distinct":
+		instance.Fields["_distinct"] = true
+		return instance
 
-		instance.Fields["_wheres"] = wheres
-		instance.Fields["_bindings"] = bindings
+	case "groupBy":
+		cols := []string{}
+		for _, arg := range args {
+			if list, ok := arg.([]interface{}); ok {
+				for _, c := range list {
+					cols = append(cols, quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", c))))
+				}
+			} else {
+				cols = append(cols, quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", arg))))
+			}
+		}
+		instance.Fields["_group"] = strings.Join(cols, ", ")
+		return instance
+
+	case "having", "orHaving":
+		if len(args) < 2 {
+			panic(fmt.Sprintf("GranDB Error: %s() requiere columna/expresión y valor", method))
+		}
+		col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+		op, val := "=", args[1]
+		if len(args) >= 3 {
+			op, val = checkOperator(fmt.Sprintf("%v", args[1])), args[2]
+		}
+		havings, _ := instance.Fields["_havings"].([]string)
+		havingBindings, _ := instance.Fields["_havingBindings"].([]interface{})
+		cond := fmt.Sprintf("%s %s ?", col, op)
+		if method == "orHaving" && len(havings) > 0 {
+			cond = "OR " + cond
+		}
+		instance.Fields["_havings"] = append(havings, cond)
+		instance.Fields["_havingBindings"] = append(havingBindings, val)
 		return instance
 
 	case "innerJoin":
 		if len(args) >= 4 {
-			table := r.applyTablePrefix(args[0].(string))
-			first := r.applyColumnPrefix(args[1].(string))
+			table := r.builderTable(instance, args[0].(string))
+			first := r.builderColumn(instance, args[1].(string))
 			op := args[2].(string)
-			second := r.applyColumnPrefix(args[3].(string))
+			second := r.builderColumn(instance, args[3].(string))
 			if _, ok := instance.Fields["_joins"]; !ok {
 				instance.Fields["_joins"] = []string{}
 			}
@@ -133,10 +237,10 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 
 	case "leftJoin":
 		if len(args) >= 4 {
-			table := r.applyTablePrefix(args[0].(string))
-			first := r.applyColumnPrefix(args[1].(string))
+			table := r.builderTable(instance, args[0].(string))
+			first := r.builderColumn(instance, args[1].(string))
 			op := args[2].(string)
-			second := r.applyColumnPrefix(args[3].(string))
+			second := r.builderColumn(instance, args[3].(string))
 			if _, ok := instance.Fields["_joins"]; !ok {
 				instance.Fields["_joins"] = []string{}
 			}
@@ -147,10 +251,10 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 
 	case "rightJoin":
 		if len(args) >= 4 {
-			table := r.applyTablePrefix(args[0].(string))
-			first := r.applyColumnPrefix(args[1].(string))
+			table := r.builderTable(instance, args[0].(string))
+			first := r.builderColumn(instance, args[1].(string))
 			op := args[2].(string)
-			second := r.applyColumnPrefix(args[3].(string))
+			second := r.builderColumn(instance, args[3].(string))
 			if _, ok := instance.Fields["_joins"]; !ok {
 				instance.Fields["_joins"] = []string{}
 			}
@@ -161,7 +265,7 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 
 	case "orderBy":
 		if len(args) >= 2 {
-			col := quoteIdentifier(r.applyColumnPrefix(args[0].(string)))
+			col := quoteIdentifier(r.builderColumn(instance, args[0].(string)))
 			dir := strings.ToUpper(args[1].(string))
 			if dir != "ASC" && dir != "DESC" {
 				dir = "ASC"
@@ -195,43 +299,196 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 		return instance
 
 	case "get":
+		if isModel(instance) {
+			return r.modelGet(instance)
+		}
 		return r.executeGetMethod(instance, args)
 
+	case "paginate":
+		return r.executePaginateMethod(instance, args)
+
+	case "simplePaginate":
+		return r.executeSimplePaginateMethod(instance, args)
+
+	case "cursorPaginate":
+		return r.executeCursorPaginateMethod(instance, args)
+
 	case "count":
 		return r.executeCountMethod(instance, args)
 
+	case "sum", "avg", "min", "max":
+		return r.executeAggregateMethod(instance, strings.ToUpper(method), args)
+
+	case "exists":
+		return r.executeExistsMethod(instance)
+
+	case "doesntExist":
+		return !r.executeExistsMethod(instance)
+
 	case "first":
+		if isModel(instance) {
+			return r.modelFirst(instance)
+		}
 		return r.executeFirstMethod(instance, args)
 
 	case "insert":
 		return r.executeInsertMethod(instance, args)
 
+	case "insertMany":
+		return r.executeInsertManyMethod(instance, args)
+
+	case "upsert":
+		return r.executeUpsertMethod(instance, args)
+
+	case "chunk":
+		return r.executeChunkMethod(instance, args)
+
+	case "chunkById":
+		return r.executeChunkByIdMethod(instance, args)
+
+	case "cursor":
+		return r.executeCursorMethod(instance)
+
+	case "insertGetId":
+		conn := r.builderConnection(instance)
+		if conn.db == nil {
+			panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+		}
+		if len(args) == 1 {
+			if data, ok := args[0].(map[string]interface{}); ok {
+				touchTimestamps(instance, data, true)
+				return r.insertGetId(conn, r.getTable(instance), data)
+			}
+		}
+		panic("GranDB Error: insertGetId() requiere un mapa de columnas")
+
 	case "update":
+		if isModel(instance) && isLoadedModel(instance) {
+			// $user->update({...}) on a loaded model: fill and save that row
+			r.executeModelMethod(instance, "fill", args)
+			return r.saveModel(instance)
+		}
 		return r.executeUpdateMethod(instance, args)
 
 	case "delete":
+		if isModel(instance) && isLoadedModel(instance) {
+			// $user->delete() on a loaded model deletes that row
+			return r.deleteModel(instance, false)
+		}
+		if usesSoftDeletes(instance) {
+			return r.softDeleteQuery(instance)
+		}
+		return r.executeDeleteMethod(instance)
+
+	case "forceDelete":
+		if isModel(instance) && isLoadedModel(instance) {
+			return r.deleteModel(instance, true)
+		}
+		if _, ok := instance.Fields["_trashed"]; !ok {
+			instance.Fields["_trashed"] = "with"
+		}
 		return r.executeDeleteMethod(instance)
 
+	case "restore":
+		if !usesSoftDeletes(instance) {
+			panic(fmt.Sprintf("GranDB Error: %s no usa softDeletes", instance.Class.Name.Value))
+		}
+		if isLoadedModel(instance) {
+			return r.restoreModel(instance)
+		}
+		return r.restoreTrashed(instance)
+
+	case "trashed":
+		return usesSoftDeletes(instance) && instance.Fields[deletedAtColumn] != nil
+
+	case "withTrashed":
+		instance.Fields["_trashed"] = "with"
+		return instance
+
+	case "onlyTrashed":
+		instance.Fields["_trashed"] = "only"
+		return instance
+
+	case "withoutGlobalScope", "withoutGlobalScopes":
+		var names []string
+		for _, arg := range args {
+			names = append(names, stringList(arg)...)
+		}
+		withoutScopes(instance, names)
+		return instance
+
+	case "all", "find", "findOrFail", "with", "load", "fill", "create", "save", "fresh", "refresh", "toArray",
+		"hasMany", "hasOne", "belongsTo", "belongsToMany", "attach", "detach", "sync", "factory":
+		return r.executeModelMethod(instance, method, args)
+
 	case "deleteAll":
 		return r.executeDeleteAllMethod(instance)
 
 	case "truncate":
 		return r.executeTruncateMethod(instance)
 
+	case "transaction":
+		if len(args) == 0 {
+			panic("GranDB Error: transaction() requiere una función")
+		}
+		return r.runTransaction(r.builderConnection(instance), args[0])
+
+	case "beginTransaction":
+		if err := r.beginTransactionOn(r.builderConnection(instance)); err != nil {
+			panic(fmt.Sprintf("GranDB Error en beginTransaction: %v", err))
+		}
+		return true
+
+	case "commit":
+		if err := r.commitTransactionOn(r.builderConnection(instance)); err != nil {
+			panic(fmt.Sprintf("GranDB Error en commit: %v", err))
+		}
+		return true
+
+	case "rollBack", "rollback":
+		if err := r.rollbackTransactionOn(r.builderConnection(instance)); err != nil {
+			panic(fmt.Sprintf("GranDB Error en rollBack: %v", err))
+		}
+		return true
+
+	case "transactionLevel":
+		return int64(r.transactionLevelOn(r.builderConnection(instance)))
+
+	case "enableQueryLog":
+		r.EnableQueryLog()
+		return true
+
+	case "disableQueryLog":
+		r.DisableQueryLog()
+		return true
+
+	case "getQueryLog":
+		return queryLogMaps(r.QueryLog())
+
 	case "query":
+		// query(sql) or query(sql, [bindings]) with ? placeholders
 		if len(args) > 0 {
 			if sqlStr, ok := args[0].(string); ok {
-				if r.GetDB() == nil {
+				conn := r.builderConnection(instance)
+				if conn.db == nil {
 					return nil
 				}
+				var bindings []interface{}
+				if len(args) > 1 {
+					if list, ok := args[1].([]interface{}); ok {
+						bindings = list
+					} else {
+						bindings = args[1:]
+					}
+				}
 
 				// Check if it is a SELECT query
 				trimmed := strings.ToUpper(strings.TrimSpace(sqlStr))
 				if strings.HasPrefix(trimmed, "SELECT") || strings.HasPrefix(trimmed, "SHOW") || strings.HasPrefix(trimmed, "DESCRIBE") {
-					rows, err := r.GetDB().Query(sqlStr)
+					rows, err := r.connExec(conn).Query(sqlStr, bindings...)
 					if err != nil {
-						fmt.Printf("[GranMySQL] Error query SELECT: %v\n", err)
-						return nil
+						LogError("[GranMySQL] Error en query: %v", err)
+						panic(fmt.Sprintf("GranMySQL Error en query: %v", err))
 					}
 					defer rows.Close()
 					rowsMap := rowsToMap(rows)
@@ -243,15 +500,22 @@ func (r *Runtime) executeGranMySQLMethod(instance *Instance, method string, args
 					return result
 				}
 
-				// Otherwise Exec (INSERT, UPDATE, DELETE, ALTER...)
-				_, err := r.GetDB().Exec(sqlStr)
+				// Otherwise Exec (INSERT, UPDATE, DELETE, ALTER...). Errors panic
+				// like the other builder methods, so GranDB::transaction rolls back
+				_, err := r.connExec(conn).Exec(sqlStr, bindings...)
 				if err != nil {
-					fmt.Printf("[GranMySQL] Error query EXEC: %v\n", err)
-					return false
+					LogError("[GranMySQL] Error en query: %v", err)
+					panic(fmt.Sprintf("GranMySQL Error en query: %v", err))
 				}
 				return true
 			}
 		}
+
+	default:
+		// Local scopes: $query->active() calls scopeActive($query)
+		if isModel(instance) && r.callLocalScope(instance, method, args) {
+			return instance
+		}
 	}
 	return nil
 }
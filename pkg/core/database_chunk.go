@@ -0,0 +1,169 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// chunk, chunkById and cursor read big results without loading every row:
+//
+//	User::where("active", 1)->chunk(500, func($users, $page) { ... })   // return false to stop
+//	User::where("active", 1)->chunkById(500, func($users, $page) { ... })
+//	foreach (User::where("active", 1)->cursor() as $user) { ... }
+
+// executeChunkMethod handles .chunk(size, fn): one query of size rows per
+// page, ordered by the primary key unless orderBy was used. Returns false if
+// fn stopped it by returning false.
+func (r *Runtime) executeChunkMethod(instance *Instance, args []interface{}) interface{} {
+	if len(args) < 2 || !isClosure(args[1]) {
+		panic("GranDB Error: chunk() requiere un tamaño y una función: chunk(100, func($filas) { ... })")
+	}
+	size := positiveInt(args[0], 0)
+	if size < 1 {
+		panic("GranDB Error: el tamaño de chunk() debe ser mayor que 0")
+	}
+	fn := args[1]
+	if _, ok := instance.Fields["_order"]; !ok {
+		// Without a stable order pages could skip or repeat rows
+		instance.Fields["_order"] = quoteIdentifier(r.builderColumn(instance, primaryKey(instance))) + " ASC"
+	}
+
+	saved := snapshotQuery(instance)
+	defer resetQuery(instance)
+	for page := 1; ; page++ {
+		restoreQuery(instance, saved)
+		items := r.fetchPage(instance, size, (page-1)*size)
+		if len(items) == 0 {
+			return true
+		}
+		if res := r.applyFunction(fn, []interface{}{items, page}); res == false {
+			return false
+		}
+		if len(items) < size {
+			return true
+		}
+	}
+}
+
+// executeChunkByIdMethod handles .chunkById(size, fn, column = primary key):
+// like chunk, but each page is selected with "column > last value" instead of
+// OFFSET, so it stays fast on big tables and fn may update the rows it gets
+// (even the columns the query filters on) without pages skipping any
+func (r *Runtime) executeChunkByIdMethod(instance *Instance, args []interface{}) interface{} {
+	if len(args) < 2 || !isClosure(args[1]) {
+		panic("GranDB Error: chunkById() requiere un tamaño y una función: chunkById(100, func($filas) { ... })")
+	}
+	size := positiveInt(args[0], 0)
+	if size < 1 {
+		panic("GranDB Error: el tamaño de chunkById() debe ser mayor que 0")
+	}
+	fn := args[1]
+	column := primaryKey(instance)
+	if len(args) > 2 {
+		if col, ok := args[2].(string); ok && col != "" {
+			column = col
+		}
+	}
+	quoted := quoteIdentifier(r.builderColumn(instance, column))
+	key := column[strings.LastIndex(column, ".")+1:]
+
+	// The previous wheres are grouped so an orWhere among them can't escape
+	// the "column > last" condition
+	groupWheresFrom(instance, 0, 0)
+	instance.Fields["_order"] = quoted + " ASC"
+	saved := snapshotQuery(instance)
+	defer resetQuery(instance)
+	var last interface{}
+	for page := 1; ; page++ {
+		restoreQuery(instance, saved)
+		if last != nil {
+			addWhere(instance, "AND", quoted+" > ?", last)
+		}
+		items := r.fetchPage(instance, size, 0)
+		if len(items) == 0 {
+			return true
+		}
+		if res := r.applyFunction(fn, []interface{}{items, page}); res == false {
+			return false
+		}
+		if len(items) < size {
+			return true
+		}
+		last = cursorValue(items[len(items)-1], key)
+		if last == nil {
+			panic(fmt.Sprintf("GranDB Error: chunkById() necesita la columna '%s' en los resultados", key))
+		}
+	}
+}
+
+// QueryCursor is the result of .cursor(): foreach reads its rows one at a
+// time from a single query. Model builders yield models (without eager loads).
+type QueryCursor struct {
+	r        *Runtime
+	query    string
+	bindings []interface{}
+	model    *Instance     // prototype of the model, nil for plain builders
+	conn     *dbConnection // connection of the builder
+}
+
+func (c *QueryCursor) String() string { return "cursor" }
+
+// executeCursorMethod handles .cursor()
+func (r *Runtime) executeCursorMethod(instance *Instance) interface{} {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
+		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+	}
+	r.applyScopes(instance)
+	query, bindings := r.compileQuery(instance, selectColumns(instance), true)
+	cursor := &QueryCursor{r: r, query: query, bindings: bindings, conn: conn}
+	if isModel(instance) {
+		cursor.model = r.newModel(instance.Class.Name.Value)
+		takeEagerLoads(instance)
+	}
+	resetQuery(instance)
+	return cursor
+}
+
+// Each runs the query and calls fn with every row until it returns false.
+// The rows are closed when the loop ends, also on break or errors.
+//
+// Inside a transaction every query shares one connection, and MySQL can't
+// run another statement on it while a result is still being read ("busy
+// buffer"), so there the rows are read in full before the loop starts.
+func (c *QueryCursor) Each(fn func(item interface{}) bool) {
+	inTx := c.r.txOn(c.conn) != nil
+	rows, err := c.r.connRead(c.conn).Query(c.query, c.bindings...)
+	if err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en cursor: %v", err))
+	}
+	defer rows.Close()
+
+	var casts map[string]string
+	if c.model != nil {
+		casts = modelCasts(c.model)
+	}
+	yield := func(row map[string]interface{}) bool {
+		if c.model != nil {
+			return fn(hydrateModel(c.model, casts, row))
+		}
+		return fn(row)
+	}
+	if inTx {
+		buffered := rowsToMap(rows)
+		if err := rows.Err(); err != nil {
+			panic(fmt.Sprintf("GranMySQL Error en cursor: %v", err))
+		}
+		rows.Close()
+		for _, row := range buffered {
+			if !yield(row) {
+				return
+			}
+		}
+		return
+	}
+	scanRows(rows, yield)
+	if err := rows.Err(); err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en cursor: %v", err))
+	}
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Connection settings read from env.joss.
+//
+//	DB_PORT           MySQL port (3306) / PostgreSQL port (5432)
+//	DB_SOCKET         MySQL unix socket, replaces host:port
+//	DB_PARAMS         extra DSN params, e.g. "charset=utf8mb4&parseTime=true"
+//	DB_TLS            MySQL: "true", "skip-verify" or "preferred"
+//	DB_SSLMODE        PostgreSQL sslmode (disable)
+//	DB_SSL_CA         CA bundle (PEM) used to verify the server
+//	DB_SSL_CERT/KEY   client certificate (PEM) for mutual TLS
+//	DB_MAX_OPEN       max open connections (25)
+//	DB_MAX_IDLE       max idle connections (25)
+//	DB_CONN_LIFETIME  max connection lifetime, seconds or Go duration (5m)
+//	DB_READ_HOST      comma-separated read replicas (same credentials, or
+//	                  DB_READ_USER / DB_READ_PASS / DB_READ_PORT)
+
+// MySQLDSN builds the go-sql-driver DSN from the env settings
+func MySQLDSN(env map[string]string) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = env["DB_USER"]
+	cfg.Passwd = env["DB_PASS"]
+	cfg.DBName = env["DB_NAME"]
+
+	if socket := env["DB_SOCKET"]; socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = socket
+	} else {
+		port := env["DB_PORT"]
+		if port == "" {
+			port = "3306"
+		}
+		cfg.Net = "tcp"
+		cfg.Addr = env["DB_HOST"] + ":" + port
+	}
+
+	if params := strings.Trim(env["DB_PARAMS"], "?"); params != "" {
+		values, err := url.ParseQuery(params)
+		if err != nil {
+			return "", fmt.Errorf("DB_PARAMS inválido: %v", err)
+		}
+		// Round-trip through the driver's parser so charset, parseTime, loc,
+		// timeouts etc. are validated the same way as in a literal DSN
+		parsed, err := mysql.ParseDSN("/?" + values.Encode())
+		if err != nil {
+			return "", fmt.Errorf("DB_PARAMS inválido: %v", err)
+		}
+		parsed.User, parsed.Passwd, parsed.DBName = cfg.User, cfg.Passwd, cfg.DBName
+		parsed.Net, parsed.Addr = cfg.Net, cfg.Addr
+		cfg = parsed
+	}
+
+	tlsName, err := mysqlTLS(env)
+	if err != nil {
+		return "", err
+	}
+	if tlsName != "" {
+		cfg.TLSConfig = tlsName
+	}
+
+	return cfg.FormatDSN(), nil
+}
+
+// mysqlTLS registers the TLS config described by DB_TLS/DB_SSL_* and returns
+// the name to reference from the DSN ("" when TLS is off)
+func mysqlTLS(env map[string]string) (string, error) {
+	mode := strings.ToLower(env["DB_TLS"])
+	ca, cert, key := env["DB_SSL_CA"], env["DB_SSL_CERT"], env["DB_SSL_KEY"]
+
+	if ca == "" && cert == "" {
+		switch mode {
+		case "", "false", "0":
+			return "", nil
+		case "true", "1", "skip-verify", "preferred":
+			if mode == "1" {
+				mode = "true"
+			}
+			return mode, nil
+		}
+		return "", fmt.Errorf("DB_TLS inválido: %s", mode)
+	}
+
+	tlsCfg := &tls.Config{ServerName: env["DB_HOST"]}
+	if mode == "skip-verify" {
+		tlsCfg.InsecureSkipVerify = true
+	}
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return "", fmt.Errorf("no se pudo leer DB_SSL_CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("DB_SSL_CA no contiene certificados PEM válidos")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return "", fmt.Errorf("no se pudo cargar DB_SSL_CERT/DB_SSL_KEY: %v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{pair}
+	}
+
+	// One config per host, so replicas verify their own server name
+	name := "joss-" + env["DB_HOST"]
+	if err := mysql.RegisterTLSConfig(name, tlsCfg); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// configurePool applies DB_MAX_OPEN, DB_MAX_IDLE and DB_CONN_LIFETIME
+func configurePool(db *sql.DB, env map[string]string) {
+	db.SetMaxOpenConns(envInt(env, "DB_MAX_OPEN", 25))
+	db.SetMaxIdleConns(envInt(env, "DB_MAX_IDLE", 25))
+	db.SetConnMaxLifetime(envDuration(env, "DB_CONN_LIFETIME", 5*time.Minute))
+}
+
+func envInt(env map[string]string, key string, def int) int {
+	if val, ok := env[key]; ok && val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+		fmt.Printf("[Security] %s inválido (%s), usando %d\n", key, val, def)
+	}
+	return def
+}
+
+// envDuration accepts plain seconds ("300") or a Go duration ("5m")
+func envDuration(env map[string]string, key string, def time.Duration) time.Duration {
+	val, ok := env[key]
+	if !ok || val == "" {
+		return def
+	}
+	if n, err := strconv.Atoi(val); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	if d, err := time.ParseDuration(val); err == nil {
+		return d
+	}
+	fmt.Printf("[Security] %s inválido (%s), usando %v\n", key, val, def)
+	return def
+}
+
+// driverDSN returns the sql driver name and DSN for a MySQL/PostgreSQL env
+func driverDSN(dbDriver string, env map[string]string) (string, string, error) {
+	if dbDriver == "postgres" {
+		return postgresDriverName, PostgresDSN(env), nil
+	}
+	dsn, err := MySQLDSN(env)
+	return "mysql", dsn, err
+}
+
+// replicaEnvs returns one env per DB_READ_HOST entry, inheriting the primary's
+// settings unless overridden by DB_READ_USER, DB_READ_PASS or DB_READ_PORT
+func replicaEnvs(env map[string]string) []map[string]string {
+	var envs []map[string]string
+	for _, host := range strings.Split(env["DB_READ_HOST"], ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		replica := make(map[string]string, len(env))
+		for k, v := range env {
+			replica[k] = v
+		}
+		delete(replica, "DB_SOCKET")
+		replica["DB_HOST"] = host
+		for _, key := range []string{"USER", "PASS", "PORT"} {
+			if val, ok := env["DB_READ_"+key]; ok {
+				replica["DB_"+key] = val
+			}
+		}
+		envs = append(envs, replica)
+	}
+	return envs
+}
+
+// openReplicas connects the read replicas configured in DB_READ_HOST
+func (r *Runtime) openReplicas(dbDriver string) {
+	for _, env := range replicaEnvs(r.Env) {
+		sqlDriver, dsn, err := driverDSN(dbDriver, env)
+		if err != nil {
+			fmt.Printf("[Security] Error en configuración de réplica %s: %v\n", env["DB_HOST"], err)
+			continue
+		}
+		db, err := sql.Open(sqlDriver, dsn)
+		if err != nil {
+			fmt.Printf("[Security] Error conectando a réplica %s: %v\n", env["DB_HOST"], err)
+			continue
+		}
+		configurePool(db, r.Env)
+		fmt.Printf("[Security] Réplica de lectura: %s\n", env["DB_HOST"])
+		r.ReadDBs = append(r.ReadDBs, db)
+	}
+}
+
+var replicaCursor uint64
+
+// ReadConn returns the connection for builder SELECTs: a read replica
+// (round-robin) when configured, otherwise the same as Conn(). Inside a
+// transaction, and for the rest of the request once it has written to the
+// primary, reads stay on the primary so they see their own writes.
+func (r *Runtime) ReadConn() dbExecutor {
+	return r.connRead(r.ownConnection())
+}
+
+// connRead is ReadConn for the connection c
+func (r *Runtime) connRead(c *dbConnection) dbExecutor {
+	if r.txOn(c) == nil && len(c.replicas) > 0 && !r.wrotePrimary[c.db] && !r.Pretending() {
+		n := atomic.AddUint64(&replicaCursor, 1)
+		return r.observe(c.replicas[n%uint64(len(c.replicas))])
+	}
+	return r.connExec(c)
+}
+
+// primaryConn is Conn() when replicas are configured: statements that write
+// pin the request to the primary (see ReadConn)
+type primaryConn struct {
+	dbExecutor
+	r  *Runtime
+	db *sql.DB
+}
+
+func (c primaryConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	c.r.markPrimaryWrite(c.db)
+	return c.dbExecutor.Exec(query, args...)
+}
+
+func (c primaryConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if isWriteStatement(query) {
+		c.r.markPrimaryWrite(c.db)
+	}
+	return c.dbExecutor.Query(query, args...)
+}
+
+func (c primaryConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	if isWriteStatement(query) {
+		c.r.markPrimaryWrite(c.db)
+	}
+	return c.dbExecutor.QueryRow(query, args...)
+}
+
+func (r *Runtime) markPrimaryWrite(db *sql.DB) {
+	if r.wrotePrimary == nil {
+		r.wrotePrimary = make(map[*sql.DB]bool)
+	}
+	r.wrotePrimary[db] = true
+}
+
+// isWriteStatement reports whether a query run through Query/QueryRow
+// modifies data (INSERT ... RETURNING and the like)
+func isWriteStatement(query string) bool {
+	verb, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	switch strings.ToUpper(verb) {
+	case "SELECT", "WITH", "SHOW", "EXPLAIN", "PRAGMA", "DESCRIBE":
+		return false
+	}
+	return true
+}
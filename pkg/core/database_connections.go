@@ -0,0 +1,246 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Named connections. DB_CONNECTIONS lists the connections of a project; the
+// first one is the default and uses the plain DB_* settings, the others read
+// theirs with the upper-cased name as prefix:
+//
+//	DB_CONNECTIONS="main,analytics"
+//	ANALYTICS_DB="postgres"
+//	ANALYTICS_DB_HOST="10.0.0.5"
+//	ANALYTICS_DB_NAME="metricas"
+//	ANALYTICS_PREFIX=""          (optional, defaults to PREFIX)
+//
+// Every builder resolves its *dbConnection once (builderConnection) and runs
+// its queries, prefixes and transactions on it, so closures called from the
+// builder (where(fn), when...) still see the runtime's own connection.
+
+// connectionKeys are the settings a named connection never inherits from
+// the default one
+var connectionKeys = []string{
+	"DB", "DB_HOST", "DB_PORT", "DB_NAME", "DB_USER", "DB_PASS", "DB_PATH", "DB_SOCKET",
+	"DB_PARAMS", "DB_TLS", "DB_SSLMODE", "DB_SSL_CA", "DB_SSL_CERT", "DB_SSL_KEY",
+	"DB_READ_HOST", "DB_READ_USER", "DB_READ_PASS", "DB_READ_PORT",
+}
+
+// dbConnection is the pool, replicas and settings of one connection
+type dbConnection struct {
+	name     string
+	env      map[string]string
+	db       *sql.DB
+	replicas []*sql.DB
+}
+
+// Named pools are shared by every runtime, like the default r.DB
+var (
+	connectionsMu sync.Mutex
+	connections   = map[string]*dbConnection{}
+)
+
+// ConnectionNames returns the names in DB_CONNECTIONS (first = default)
+func ConnectionNames(env map[string]string) []string {
+	var names []string
+	for _, name := range strings.Split(env["DB_CONNECTIONS"], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// connectionName resolves name to "" for the default connection and panics
+// on names missing from DB_CONNECTIONS
+func (r *Runtime) connectionName(name string) string {
+	if name == "" || name == "default" {
+		return ""
+	}
+	names := ConnectionNames(r.baseEnv())
+	for i, n := range names {
+		if n == name {
+			if i == 0 {
+				return ""
+			}
+			return name
+		}
+	}
+	panic(fmt.Sprintf("GranDB Error: la conexión '%s' no está definida en DB_CONNECTIONS", name))
+}
+
+// baseEnv returns the env of the default connection
+func (r *Runtime) baseEnv() map[string]string {
+	if r.connection != nil {
+		return r.defaultConn.env
+	}
+	return r.Env
+}
+
+// ConnectionEnv builds the settings of a named connection: the default env
+// without its connection keys, overlaid with the NAME_-prefixed keys
+func ConnectionEnv(base map[string]string, name string) map[string]string {
+	env := make(map[string]string, len(base))
+	for k, v := range base {
+		env[k] = v
+	}
+	for _, key := range connectionKeys {
+		delete(env, key)
+	}
+	prefix := strings.ToUpper(name) + "_"
+	for k, v := range base {
+		if strings.HasPrefix(k, prefix) {
+			env[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return env
+}
+
+// namedConnection returns the pool of a named connection, opening it on first use
+func (r *Runtime) namedConnection(name string) *dbConnection {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+	if c, ok := connections[name]; ok {
+		return c
+	}
+
+	env := ConnectionEnv(r.baseEnv(), name)
+	dbDriver := NormalizeDriver(env["DB"])
+	sqlDriver, dsn := dbDriver, env["DB_PATH"]
+	if dbDriver == "sqlite" {
+		if dsn == "" {
+			dsn = "database.sqlite"
+		}
+		fmt.Printf("[Security] Conexión '%s': SQLite %s\n", name, dsn)
+	} else {
+		if env["DB_HOST"] == "" && env["DB_SOCKET"] == "" {
+			panic(fmt.Sprintf("GranDB Error: la conexión '%s' no tiene %s_DB_HOST configurado", name, strings.ToUpper(name)))
+		}
+		var err error
+		sqlDriver, dsn, err = driverDSN(dbDriver, env)
+		if err != nil {
+			panic(fmt.Sprintf("GranDB Error: configuración de la conexión '%s': %v", name, err))
+		}
+		fmt.Printf("[Security] Conexión '%s': %s %s\n", name, dbDriver, env["DB_HOST"]+env["DB_SOCKET"])
+	}
+
+	db, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		panic(fmt.Sprintf("GranDB Error: no se pudo abrir la conexión '%s': %v", name, err))
+	}
+	if dbDriver == "sqlite" {
+		db.Exec("PRAGMA journal_mode=WAL;")
+		db.Exec("PRAGMA busy_timeout = 5000;")
+	}
+	configurePool(db, env)
+
+	c := &dbConnection{name: name, env: env, db: db}
+	if dbDriver != "sqlite" {
+		replicas := &Runtime{Env: env}
+		replicas.openReplicas(dbDriver)
+		c.replicas = replicas.ReadDBs
+	}
+	connections[name] = c
+	return c
+}
+
+// ConnectionName returns the connection this runtime is bound to ("" = default)
+func (r *Runtime) ConnectionName() string {
+	if r.connection == nil {
+		return ""
+	}
+	return r.connection.name
+}
+
+// ConnectionRuntime returns a runtime bound to the named connection: r.Env,
+// r.Conn() and transactions of the copy use that connection, while builders
+// without connection() still reach the default one. It returns r itself for
+// the default connection. Migrations run their Schema statements on it.
+func (r *Runtime) ConnectionRuntime(name string) *Runtime {
+	target := r.connectionName(name)
+	if target == r.ConnectionName() {
+		return r
+	}
+	var c *dbConnection
+	if target == "" {
+		c = r.defaultConn
+	} else {
+		c = r.namedConnection(target)
+	}
+	rt := r.Fork()
+	rt.Env, rt.DB, rt.ReadDBs = c.env, c.db, c.replicas
+	rt.connection = nil
+	if target != "" {
+		rt.connection = c
+		rt.defaultConn = r.defaultConnection()
+	}
+	return rt
+}
+
+// defaultConnection returns the default connection (connecting it lazily)
+func (r *Runtime) defaultConnection() *dbConnection {
+	if r.connection != nil {
+		return r.defaultConn
+	}
+	return r.ownConnection()
+}
+
+// ownConnection is the connection the runtime itself is bound to
+func (r *Runtime) ownConnection() *dbConnection {
+	return &dbConnection{name: r.ConnectionName(), env: r.Env, db: r.GetDB(), replicas: r.ReadDBs}
+}
+
+// resolveConnection returns the connection called name ("" = default)
+func (r *Runtime) resolveConnection(name string) *dbConnection {
+	target := r.connectionName(name)
+	switch {
+	case target == r.ConnectionName():
+		return r.ownConnection()
+	case target == "":
+		return r.defaultConn
+	}
+	return r.namedConnection(target)
+}
+
+// builderEnv returns the settings of the builder's connection without
+// connecting it (table prefixes only need the env)
+func (r *Runtime) builderEnv(instance *Instance) map[string]string {
+	name, _ := instance.Fields["connection"].(string)
+	target := r.connectionName(name)
+	switch {
+	case target == r.ConnectionName():
+		return r.Env
+	case target == "":
+		return r.defaultConn.env
+	}
+	return r.namedConnection(target).env
+}
+
+// builderConnection returns the connection a builder runs on: the one set
+// with connection() or the model's $this->connection, else the default
+func (r *Runtime) builderConnection(instance *Instance) *dbConnection {
+	name, _ := instance.Fields["connection"].(string)
+	return r.resolveConnection(name)
+}
+
+// driver returns the normalized engine of the connection
+func (c *dbConnection) driver() string {
+	return NormalizeDriver(c.env["DB"])
+}
+
+// closeConnections rolls back transactions left open on other connections
+// (see Free)
+func (r *Runtime) closeConnections() {
+	for name, tx := range r.connTx {
+		label := name
+		if label == "" {
+			label = "principal"
+		}
+		fmt.Printf("[GranDB] Transacción sin cerrar en la conexión '%s': rollback\n", label)
+		tx.tx.Rollback()
+		delete(r.connTx, name)
+	}
+}
@@ -8,36 +8,41 @@ import (
 // executeDeleteMethod handles delete operations for GranMySQL/GranDB
 // Usage: $model.where("id", 1).delete()
 func (r *Runtime) executeDeleteMethod(instance *Instance) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
 	}
 
 	// Get table and where conditions
 	table := r.getTable(instance)
 	wheres := instance.Fields["_wheres"].([]string)
-	bindings := instance.Fields["_bindings"].([]interface{})
 
 	// Build query
 	query := fmt.Sprintf("DELETE FROM %s", table)
 
-	// Add WHERE clause if present
+	// Add WHERE clause if present (checked before scopes add their own)
 	if len(wheres) > 0 {
-		query += " WHERE " + strings.Join(wheres, " AND ")
+		r.applyScopes(instance)
+		wheres = instance.Fields["_wheres"].([]string)
+		query += " WHERE " + compileWheres(wheres)
 	} else {
 		fmt.Println("[GranDB] Warning: delete() without WHERE clause will delete all rows")
 		fmt.Println("[GranDB] Aborting delete for safety. Use deleteAll() to delete all rows.")
 		return false
 	}
 
+	bindings := instance.Fields["_bindings"].([]interface{})
+
 	fmt.Printf("[GranDB] Delete Query: %s\n", query)
 	fmt.Printf("[GranDB] Bindings: %v\n", bindings)
 
 	// Reset state before execution
 	instance.Fields["_wheres"] = []string{}
 	instance.Fields["_bindings"] = []interface{}{}
+	resetScopes(instance)
 
 	// Execute query
-	result, err := r.GetDB().Exec(query, bindings...)
+	result, err := r.connExec(conn).Exec(query, bindings...)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en delete: %v", err))
 	}
@@ -52,7 +57,8 @@ func (r *Runtime) executeDeleteMethod(instance *Instance) interface{} {
 // executeDeleteAllMethod handles delete all operations (without WHERE clause)
 // Usage: $model.deleteAll()
 func (r *Runtime) executeDeleteAllMethod(instance *Instance) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
 	}
 
@@ -67,7 +73,7 @@ func (r *Runtime) executeDeleteAllMethod(instance *Instance) interface{} {
 	instance.Fields["_bindings"] = []interface{}{}
 
 	// Execute query
-	result, err := r.GetDB().Exec(query)
+	result, err := r.connExec(conn).Exec(query)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en deleteAll: %v", err))
 	}
@@ -83,17 +89,15 @@ func (r *Runtime) executeDeleteAllMethod(instance *Instance) interface{} {
 // Usage: $model.truncate()
 // Note: TRUNCATE is faster but cannot be rolled back and resets auto-increment
 func (r *Runtime) executeTruncateMethod(instance *Instance) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		return false
 	}
 
 	table := instance.Fields["_table"].(string)
 
 	// Get database driver
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := conn.driver()
 
 	var query string
 	if dbDriver == "sqlite" {
@@ -101,20 +105,30 @@ func (r *Runtime) executeTruncateMethod(instance *Instance) interface{} {
 		query = fmt.Sprintf("DELETE FROM %s", table)
 		fmt.Printf("[GranDB] Truncate Query (SQLite): %s\n", query)
 
-		_, err := r.GetDB().Exec(query)
+		_, err := r.connExec(conn).Exec(query)
 		if err != nil {
 			fmt.Printf("[GranDB] Error truncate: %v\n", err)
 			return false
 		}
 
 		// Reset auto-increment sequence
-		r.GetDB().Exec(fmt.Sprintf("DELETE FROM sqlite_sequence WHERE name='%s'", strings.TrimPrefix(table, "`")))
+		r.connExec(conn).Exec(fmt.Sprintf("DELETE FROM sqlite_sequence WHERE name='%s'", strings.TrimPrefix(table, "`")))
+	} else if dbDriver == "postgres" {
+		// RESTART IDENTITY resets the SERIAL sequences like MySQL's auto-increment
+		query = fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY", table)
+		fmt.Printf("[GranDB] Truncate Query (PostgreSQL): %s\n", query)
+
+		_, err := r.connExec(conn).Exec(query)
+		if err != nil {
+			fmt.Printf("[GranDB] Error truncate: %v\n", err)
+			return false
+		}
 	} else {
 		// MySQL has native TRUNCATE
 		query = fmt.Sprintf("TRUNCATE TABLE %s", table)
 		fmt.Printf("[GranDB] Truncate Query (MySQL): %s\n", query)
 
-		_, err := r.GetDB().Exec(query)
+		_, err := r.connExec(conn).Exec(query)
 		if err != nil {
 			fmt.Printf("[GranDB] Error truncate: %v\n", err)
 			return false
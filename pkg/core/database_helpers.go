@@ -9,6 +9,16 @@ import (
 // rowsToMap converts SQL rows to []map[string]interface{}
 func rowsToMap(rows *sql.Rows) []map[string]interface{} {
 	var results []map[string]interface{}
+	scanRows(rows, func(row map[string]interface{}) bool {
+		results = append(results, row)
+		return true
+	})
+	return results
+}
+
+// scanRows calls fn with each row as a map until fn returns false, so large
+// results can be processed without holding them all in memory
+func scanRows(rows *sql.Rows, fn func(row map[string]interface{}) bool) {
 	cols, _ := rows.Columns()
 	vals := make([]interface{}, len(cols))
 	valPtrs := make([]interface{}, len(cols))
@@ -16,20 +26,33 @@ func rowsToMap(rows *sql.Rows) []map[string]interface{} {
 		valPtrs[i] = &vals[i]
 	}
 
+	// DATETIME/TIMESTAMP/DATE columns become Date instances
+	dateCols := make([]bool, len(cols))
+	typeNames := make([]string, len(cols))
+	if types, err := rows.ColumnTypes(); err == nil {
+		for i, ct := range types {
+			typeNames[i] = ct.DatabaseTypeName()
+			dateCols[i] = isDateColumn(typeNames[i])
+		}
+	}
+
 	for rows.Next() {
 		rows.Scan(valPtrs...)
 		row := make(map[string]interface{})
 		for i, colName := range cols {
 			valVal := vals[i]
-			if b, ok := valVal.([]byte); ok {
+			if dateCols[i] && valVal != nil {
+				row[colName] = dbDateColumnValue(valVal, typeNames[i])
+			} else if b, ok := valVal.([]byte); ok {
 				row[colName] = string(b)
 			} else {
 				row[colName] = valVal
 			}
 		}
-		results = append(results, row)
+		if !fn(row) {
+			return
+		}
 	}
-	return results
 }
 
 // rowsToJSON converts SQL rows to JSON string (legacy support)
@@ -88,10 +111,35 @@ func (r *Runtime) applyTablePrefix(name string) string {
 	if r.Env == nil {
 		return name
 	}
-	prefix := "js_"
-	if val, ok := r.Env["PREFIX"]; ok {
-		prefix = val
+	return prefixTable(envPrefix(r.Env), name)
+}
+
+// applyColumnPrefix adds prefix to table part of column name
+func (r *Runtime) applyColumnPrefix(name string) string {
+	if r.Env == nil {
+		return name
+	}
+	return prefixColumn(envPrefix(r.Env), name)
+}
+
+// builderTable/builderColumn apply the PREFIX of the builder's connection
+func (r *Runtime) builderTable(instance *Instance, name string) string {
+	return prefixTable(envPrefix(r.builderEnv(instance)), name)
+}
+
+func (r *Runtime) builderColumn(instance *Instance, name string) string {
+	return prefixColumn(envPrefix(r.builderEnv(instance)), name)
+}
+
+// envPrefix returns the table prefix configured in env (default js_)
+func envPrefix(env map[string]string) string {
+	if val, ok := env["PREFIX"]; ok {
+		return val
 	}
+	return "js_"
+}
+
+func prefixTable(prefix, name string) string {
 	if prefix == "" {
 		return name
 	}
@@ -101,15 +149,7 @@ func (r *Runtime) applyTablePrefix(name string) string {
 	return name
 }
 
-// applyColumnPrefix adds prefix to table part of column name
-func (r *Runtime) applyColumnPrefix(name string) string {
-	if r.Env == nil {
-		return name
-	}
-	prefix := "js_"
-	if val, ok := r.Env["PREFIX"]; ok {
-		prefix = val
-	}
+func prefixColumn(prefix, name string) string {
 	if prefix == "" {
 		return name
 	}
@@ -146,11 +186,7 @@ func (r *Runtime) getTable(instance *Instance) string {
 		return ""
 	}
 
-	prefix := "js_"
-	if val, ok := r.Env["PREFIX"]; ok {
-		prefix = val
-	}
-	tableName := prefix + strings.ToLower(r.pluralize(className))
+	tableName := envPrefix(r.builderEnv(instance)) + strings.ToLower(r.pluralize(className))
 	instance.Fields["_table"] = tableName
 	return tableName
 }
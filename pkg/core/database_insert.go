@@ -2,13 +2,15 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // executeInsertMethod handles insert operations for GranMySQL/GranDB
 // Supports both array-based and map-based inserts
 func (r *Runtime) executeInsertMethod(instance *Instance, args []interface{}) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
 	}
 
@@ -18,7 +20,8 @@ func (r *Runtime) executeInsertMethod(instance *Instance, args []interface{}) in
 	// Usage: $model.insert({"name": "John", "email": "john@example.com"})
 	if len(args) == 1 {
 		if data, ok := args[0].(map[string]interface{}); ok {
-			return r.insertFromMap(table, data)
+			touchTimestamps(instance, data, true)
+			return r.insertFromMap(conn, table, data)
 		}
 	}
 
@@ -29,7 +32,7 @@ func (r *Runtime) executeInsertMethod(instance *Instance, args []interface{}) in
 		vals, ok2 := args[1].([]interface{})
 
 		if ok1 && ok2 {
-			return r.insertFromArrays(table, cols, vals)
+			return r.insertFromArrays(conn, table, cols, vals)
 		}
 	}
 
@@ -37,23 +40,60 @@ func (r *Runtime) executeInsertMethod(instance *Instance, args []interface{}) in
 }
 
 // insertFromMap performs insert using a map of column-value pairs
-func (r *Runtime) insertFromMap(table string, data map[string]interface{}) bool {
+func (r *Runtime) insertFromMap(conn *dbConnection, table string, data map[string]interface{}) bool {
 	if len(data) == 0 {
 		return false
 	}
 
-	colNames := []string{}
-	placeholders := []string{}
-	bindings := []interface{}{}
+	query, bindings := buildInsertFromMap(table, data)
 
-	// Auto-add timestamps if not present
-	if _, hasCreatedAt := data["created_at"]; !hasCreatedAt {
-		data["created_at"] = "CURRENT_TIMESTAMP"
+	fmt.Printf("[GranDB] Insert Query: %s\n", query)
+	fmt.Printf("[GranDB] Bindings: %v\n", bindings)
+
+	_, err := r.connExec(conn).Exec(query, bindings...)
+	if err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en insert: %v", err))
 	}
-	if _, hasUpdatedAt := data["updated_at"]; !hasUpdatedAt {
-		data["updated_at"] = "CURRENT_TIMESTAMP"
+
+	return true
+}
+
+// insertGetId inserts a row and returns its generated id.
+// PostgreSQL has no LastInsertId, so it uses INSERT ... RETURNING id.
+func (r *Runtime) insertGetId(conn *dbConnection, table string, data map[string]interface{}) interface{} {
+	if len(data) == 0 {
+		return nil
 	}
 
+	query, bindings := buildInsertFromMap(table, data)
+
+	if conn.driver() == "postgres" {
+		var id int64
+		err := r.connExec(conn).QueryRow(query+" RETURNING id", bindings...).Scan(&id)
+		if err != nil {
+			panic(fmt.Sprintf("GranMySQL Error en insertGetId: %v", err))
+		}
+		return id
+	}
+
+	result, err := r.connExec(conn).Exec(query, bindings...)
+	if err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en insertGetId: %v", err))
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// buildInsertFromMap builds the INSERT statement for a map of column-value pairs.
+// Timestamps are added by the caller (touchTimestamps).
+func buildInsertFromMap(table string, data map[string]interface{}) (string, []interface{}) {
+	colNames := []string{}
+	placeholders := []string{}
+	bindings := []interface{}{}
+
 	// Build column names, placeholders, and bindings
 	for colName, value := range data {
 		// Skip unsupported types (like maps)
@@ -72,25 +112,305 @@ func (r *Runtime) insertFromMap(table string, data map[string]interface{}) bool
 		}
 	}
 
-	// Build and execute query
 	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
 		table,
 		strings.Join(colNames, ", "),
 		strings.Join(placeholders, ", "))
+	return query, bindings
+}
 
-	fmt.Printf("[GranDB] Insert Query: %s\n", query)
-	fmt.Printf("[GranDB] Bindings: %v\n", bindings)
+// maxBindings keeps multi-row statements under the placeholder limit of the
+// engines (SQLite 32766, MySQL/PostgreSQL 65535)
+const maxBindings = 30000
 
-	_, err := r.GetDB().Exec(query, bindings...)
-	if err != nil {
-		panic(fmt.Sprintf("GranMySQL Error en insert: %v", err))
+// insertRows normalizes the rows argument of insertMany/upsert: a list of
+// maps or a single map. Timestamps are added like insert().
+func insertRows(instance *Instance, val interface{}, method string) []map[string]interface{} {
+	var rows []map[string]interface{}
+	switch v := val.(type) {
+	case map[string]interface{}:
+		rows = append(rows, v)
+	case []map[string]interface{}:
+		rows = v
+	case []interface{}:
+		for _, item := range v {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				panic(fmt.Sprintf("GranDB Error: %s() requiere una lista de mapas", method))
+			}
+			rows = append(rows, row)
+		}
+	default:
+		panic(fmt.Sprintf("GranDB Error: %s() requiere una lista de mapas", method))
 	}
 
-	return true
+	for i, row := range rows {
+		data := make(map[string]interface{}, len(row)+2)
+		for k, v := range row {
+			if _, nested := v.(map[string]interface{}); !nested {
+				data[k] = v
+			}
+		}
+		touchTimestamps(instance, data, true)
+		rows[i] = data
+	}
+	return rows
+}
+
+// rowColumns returns the union of the columns of rows, sorted
+func rowColumns(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var cols []string
+	for _, row := range rows {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				cols = append(cols, col)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// rowGroup is a run of rows with the same columns
+type rowGroup struct {
+	cols []string
+	rows []map[string]interface{}
+}
+
+// groupRowsByColumns splits rows by their set of columns (groups in order of
+// first appearance), so every INSERT only lists columns all its rows have and
+// a column a row leaves out takes its DEFAULT instead of NULL
+func groupRowsByColumns(rows []map[string]interface{}) []rowGroup {
+	var groups []rowGroup
+	index := make(map[string]int)
+	for _, row := range rows {
+		cols := rowColumns([]map[string]interface{}{row})
+		key := strings.Join(cols, "\x00")
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, rowGroup{cols: cols})
+		}
+		groups[i].rows = append(groups[i].rows, row)
+	}
+	return groups
+}
+
+// buildInsertRows builds one INSERT with a VALUES group per row; every row
+// must have the columns cols (see groupRowsByColumns)
+func buildInsertRows(table string, cols []string, rows []map[string]interface{}) (string, []interface{}) {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdentifier(col)
+	}
+	groups := make([]string, 0, len(rows))
+	bindings := make([]interface{}, 0, len(rows)*len(cols))
+	for _, row := range rows {
+		placeholders := make([]string, len(cols))
+		for i, col := range cols {
+			if strVal, ok := row[col].(string); ok && isSQLFunction(strVal) {
+				placeholders[i] = strVal
+			} else {
+				placeholders[i] = "?"
+				bindings = append(bindings, row[col])
+			}
+		}
+		groups = append(groups, "("+strings.Join(placeholders, ", ")+")")
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(quoted, ", "), strings.Join(groups, ", "))
+	return query, bindings
+}
+
+// batchRows splits rows in batches of at most size rows (or fewer, so a
+// statement stays under maxBindings)
+func batchRows(rows []map[string]interface{}, cols, size int) [][]map[string]interface{} {
+	limit := maxBindings
+	if cols > 0 {
+		limit = maxBindings / cols
+	}
+	if size <= 0 || size > limit {
+		size = limit
+	}
+	var batches [][]map[string]interface{}
+	for start := 0; start < len(rows); start += size {
+		batches = append(batches, rows[start:minInt(start+size, len(rows))])
+	}
+	return batches
+}
+
+// executeInsertManyMethod handles .insertMany(rows, batchSize = 500): one
+// multi-row INSERT per batch, all batches in one transaction. Returns the
+// number of inserted rows.
+func (r *Runtime) executeInsertManyMethod(instance *Instance, args []interface{}) interface{} {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
+		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+	}
+	if len(args) < 1 {
+		panic("GranDB Error: insertMany() requiere una lista de mapas")
+	}
+	rows := insertRows(instance, args[0], "insertMany")
+	if len(rows) == 0 {
+		return int64(0)
+	}
+	size := 500
+	if len(args) > 1 {
+		size = positiveInt(args[1], size)
+	}
+
+	table := r.getTable(instance)
+	var statements []insertStatement
+	for _, group := range groupRowsByColumns(rows) {
+		for _, batch := range batchRows(group.rows, len(group.cols), size) {
+			query, bindings := buildInsertRows(table, group.cols, batch)
+			statements = append(statements, insertStatement{query, bindings})
+		}
+	}
+	fmt.Printf("[GranDB] Insert Many: %d filas en %d lote(s) en %s\n", len(rows), len(statements), table)
+
+	var inserted int64
+	run := func() {
+		for _, st := range statements {
+			result, err := r.connExec(conn).Exec(st.query, st.bindings...)
+			if err != nil {
+				panic(fmt.Sprintf("GranMySQL Error en insertMany: %v", err))
+			}
+			n, _ := result.RowsAffected()
+			inserted += n
+		}
+	}
+	if len(statements) > 1 {
+		r.withTransaction(conn, run)
+	} else {
+		run()
+	}
+	return inserted
+}
+
+type insertStatement struct {
+	query    string
+	bindings []interface{}
+}
+
+// executeUpsertMethod handles .upsert(rows, uniqueBy, update): inserts the
+// rows and, for those that collide on uniqueBy, updates the update columns
+// (by default every column except uniqueBy and created_at). MySQL uses
+// ON DUPLICATE KEY UPDATE (any unique key); SQLite and PostgreSQL use
+// ON CONFLICT (uniqueBy), which must match a unique index.
+func (r *Runtime) executeUpsertMethod(instance *Instance, args []interface{}) interface{} {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
+		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+	}
+	if len(args) < 2 {
+		panic("GranDB Error: upsert() requiere filas y columnas únicas: upsert(filas, [\"email\"], [\"name\"])")
+	}
+	rows := insertRows(instance, args[0], "upsert")
+	if len(rows) == 0 {
+		return int64(0)
+	}
+	uniqueBy := stringList(args[1])
+	if len(uniqueBy) == 0 {
+		panic("GranDB Error: upsert() requiere al menos una columna única")
+	}
+
+	table := r.getTable(instance)
+	var explicit []string
+	if len(args) > 2 && args[2] != nil {
+		explicit = stringList(args[2])
+	}
+
+	// Rows are grouped by columns, and each group only updates the columns
+	// it has, so a column missing from a row is never overwritten with NULL
+	driver := conn.driver()
+	var statements []insertStatement
+	for _, group := range groupRowsByColumns(rows) {
+		var update []string
+		if explicit != nil {
+			for _, col := range explicit {
+				if containsString(group.cols, col) {
+					update = append(update, col)
+				}
+			}
+			if usesTimestamps(instance) && !containsString(update, "updated_at") && containsString(group.cols, "updated_at") {
+				update = append(update, "updated_at")
+			}
+		} else {
+			for _, col := range group.cols {
+				if !containsString(uniqueBy, col) && col != "created_at" {
+					update = append(update, col)
+				}
+			}
+		}
+		suffix := upsertClause(driver, uniqueBy, update)
+		for _, batch := range batchRows(group.rows, len(group.cols), 500) {
+			query, bindings := buildInsertRows(table, group.cols, batch)
+			statements = append(statements, insertStatement{query + " " + suffix, bindings})
+		}
+	}
+	fmt.Printf("[GranDB] Upsert: %d filas en %s (únicas: %s)\n", len(rows), table, strings.Join(uniqueBy, ", "))
+
+	var affected int64
+	run := func() {
+		for _, st := range statements {
+			result, err := r.connExec(conn).Exec(st.query, st.bindings...)
+			if err != nil {
+				panic(fmt.Sprintf("GranMySQL Error en upsert: %v", err))
+			}
+			n, _ := result.RowsAffected()
+			affected += n
+		}
+	}
+	if len(statements) > 1 {
+		r.withTransaction(conn, run)
+	} else {
+		run()
+	}
+	return affected
+}
+
+// upsertClause builds the conflict clause of an upsert for the driver
+func upsertClause(driver string, uniqueBy, update []string) string {
+	sets := make([]string, 0, len(update))
+	if driver == "mysql" {
+		for _, col := range update {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", quoteIdentifier(col), quoteIdentifier(col)))
+		}
+		if len(sets) == 0 {
+			// Nothing to update: keep the existing row
+			col := quoteIdentifier(uniqueBy[0])
+			sets = append(sets, fmt.Sprintf("%s = %s", col, col))
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+
+	quoted := make([]string, len(uniqueBy))
+	for i, col := range uniqueBy {
+		quoted[i] = quoteIdentifier(col)
+	}
+	if len(update) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quoted, ", "))
+	}
+	for _, col := range update {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", quoteIdentifier(col), quoteIdentifier(col)))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quoted, ", "), strings.Join(sets, ", "))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
 
 // insertFromArrays performs insert using separate arrays for columns and values
-func (r *Runtime) insertFromArrays(table string, cols []interface{}, vals []interface{}) bool {
+func (r *Runtime) insertFromArrays(conn *dbConnection, table string, cols []interface{}, vals []interface{}) bool {
 	if len(cols) != len(vals) {
 		fmt.Println("[GranDB] Error: Column and value count mismatch")
 		return false
@@ -114,7 +434,7 @@ func (r *Runtime) insertFromArrays(table string, cols []interface{}, vals []inte
 		strings.Join(colNames, ", "),
 		strings.Join(placeholders, ", "))
 
-	_, err := r.GetDB().Exec(query, bindings...)
+	_, err := r.connExec(conn).Exec(query, bindings...)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en insert from arrays: %v", err))
 	}
@@ -122,7 +442,8 @@ func (r *Runtime) insertFromArrays(table string, cols []interface{}, vals []inte
 	return true
 }
 
-// isSQLFunction checks if a string is a SQL function that should not be quoted
+// isSQLFunction checks if a string is exactly one of the SQL keywords that
+// should not be quoted; anything else (e.g. "Nulla facilisi") is bound
 func isSQLFunction(value string) bool {
 	upperValue := strings.ToUpper(strings.TrimSpace(value))
 	sqlFunctions := []string{
@@ -134,7 +455,7 @@ func isSQLFunction(value string) bool {
 	}
 
 	for _, fn := range sqlFunctions {
-		if upperValue == fn || strings.HasPrefix(upperValue, fn) {
+		if upperValue == fn {
 			return true
 		}
 	}
@@ -0,0 +1,933 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jossecurity/joss/pkg/parser"
+)
+
+// Active-record layer for classes that extend GranMySQL/GranDB.
+//
+// A model keeps its columns directly in Fields, so `$user->name` reads and
+// assigns them like any other property. Builder state and bookkeeping live in
+// "_"-prefixed fields, and the configuration properties below are never sent
+// to the database.
+
+// modelConfigFields are model properties that are configuration, not columns
+var modelConfigFields = map[string]bool{
+	"tabla": true, "primaryKey": true, "casts": true, "fillable": true, "hidden": true,
+	"comparar": true, "comparable": true, "timestamps": true, "softDeletes": true, "globalScopes": true,
+	"connection": true,
+}
+
+// modelRelation describes the relation a builder was created from
+type modelRelation struct {
+	kind       string // hasMany, hasOne, belongsTo, belongsToMany
+	related    string // related class name
+	foreignKey string // column on the related table (hasMany/hasOne) or on the parent (belongsTo)
+	localKey   string // column on the parent (hasMany/hasOne) or on the related table (belongsTo)
+	pivot      string // belongsToMany pivot table
+	pivotFK    string // pivot column pointing to the parent
+	pivotRK    string // pivot column pointing to the related model
+	parentKey  interface{}
+	// bindings used by the single-parent key constraint (the first where),
+	// replaced by a whereIn when eager loading
+	keyBindings int
+}
+
+// eagerLoad is one with() entry: a relation name, its nested relations and
+// an optional constraint closure
+type eagerLoad struct {
+	name       string
+	nested     []eagerLoad
+	constraint interface{}
+}
+
+// isModelClass reports whether class is a user class extending GranMySQL/GranDB
+func (r *Runtime) isModelClass(class *parser.ClassStatement) bool {
+	depth := 0
+	for class != nil {
+		name := class.Name.Value
+		if name == "GranMySQL" || name == "GranDB" {
+			return depth > 0
+		}
+		if class.SuperClass == nil {
+			return false
+		}
+		class = r.Classes[class.SuperClass.Value]
+		depth++
+	}
+	return false
+}
+
+func isModel(instance *Instance) bool {
+	model, _ := instance.Fields["_model"].(bool)
+	return model
+}
+
+// isLoadedModel reports whether instance is a saved row with no pending where()
+func isLoadedModel(instance *Instance) bool {
+	exists, _ := instance.Fields["_exists"].(bool)
+	wheres, _ := instance.Fields["_wheres"].([]string)
+	return exists && len(wheres) == 0
+}
+
+// newModel instantiates a model class (properties + constructor)
+func (r *Runtime) newModel(className string) *Instance {
+	if _, ok := r.Classes[className]; !ok {
+		panic(fmt.Sprintf("GranDB Error: modelo '%s' no encontrado", className))
+	}
+	model := r.NewInstance(className)
+	if model == nil {
+		panic(fmt.Sprintf("GranDB Error: no se pudo crear el modelo '%s'", className))
+	}
+	model.Fields["_model"] = true
+	return model
+}
+
+func primaryKey(instance *Instance) string {
+	if pk, ok := instance.Fields["primaryKey"].(string); ok && pk != "" {
+		return pk
+	}
+	return "id"
+}
+
+func stringList(val interface{}) []string {
+	var out []string
+	switch v := val.(type) {
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, fmt.Sprintf("%v", item))
+		}
+	case []string:
+		out = v
+	case string:
+		if v != "" {
+			out = []string{v}
+		}
+	}
+	return out
+}
+
+// modelAttributes returns the column values of a model
+func modelAttributes(instance *Instance) map[string]interface{} {
+	relations, _ := instance.Fields["_relations"].(map[string]bool)
+	attrs := make(map[string]interface{})
+	for k, v := range instance.Fields {
+		if strings.HasPrefix(k, "_") || modelConfigFields[k] || relations[k] {
+			continue
+		}
+		switch v.(type) {
+		case *BoundMethod, *parser.FunctionLiteral:
+			continue
+		}
+		attrs[k] = v
+	}
+	return attrs
+}
+
+// modelArray returns attributes (minus hidden) plus loaded relations. With
+// deep set, related models are converted to maps as well.
+func modelArray(instance *Instance, deep bool) map[string]interface{} {
+	out := modelAttributes(instance)
+	for _, h := range stringList(instance.Fields["hidden"]) {
+		delete(out, h)
+	}
+	relations, _ := instance.Fields["_relations"].(map[string]bool)
+	for name := range relations {
+		val := instance.Fields[name]
+		if deep {
+			val = modelsToArrays(val)
+		}
+		out[name] = val
+	}
+	return out
+}
+
+func modelsToArrays(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *Instance:
+		if isModel(v) {
+			return modelArray(v, true)
+		}
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = modelsToArrays(item)
+		}
+		return out
+	}
+	return val
+}
+
+// castAttribute converts a database value according to the casts property
+func castAttribute(kind string, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	switch strings.ToLower(kind) {
+	case "int", "integer":
+		switch v := val.(type) {
+		case int64:
+			return v
+		case float64:
+			return int64(v)
+		case bool:
+			if v {
+				return int64(1)
+			}
+			return int64(0)
+		default:
+			if i, err := strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64); err == nil {
+				return i
+			}
+		}
+	case "float", "double", "decimal", "real":
+		switch v := val.(type) {
+		case float64:
+			return v
+		case int64:
+			return float64(v)
+		default:
+			if f, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64); err == nil {
+				return f
+			}
+		}
+	case "bool", "boolean":
+		switch v := val.(type) {
+		case bool:
+			return v
+		case int64:
+			return v != 0
+		case float64:
+			return v != 0
+		default:
+			s := strings.ToLower(fmt.Sprintf("%v", v))
+			return s == "1" || s == "true" || s == "t" || s == "yes" || s == "on"
+		}
+	case "string":
+		return fmt.Sprintf("%v", val)
+	case "json", "array", "object":
+		if s, ok := val.(string); ok {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+				return decoded
+			}
+		}
+	case "date", "datetime", "timestamp":
+		t, ok := dateValue(val)
+		if !ok {
+			if t, ok = toDate(val); !ok {
+				return val
+			}
+		} else if strings.ToLower(kind) != "date" {
+			return val
+		}
+		date := NewDate(t)
+		// A "date" cast prints and encodes as "Y-m-d"
+		if strings.ToLower(kind) == "date" {
+			date.Fields["_date_only"] = true
+		}
+		return date
+	}
+	return val
+}
+
+// uncastAttribute converts a cast value back to something the driver can bind
+func uncastAttribute(kind string, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	switch strings.ToLower(kind) {
+	case "json", "array", "object":
+		if _, ok := val.(string); ok {
+			return val
+		}
+		if b, err := json.Marshal(val); err == nil {
+			return string(b)
+		}
+	case "bool", "boolean":
+		if isTruthy(val) {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return val
+}
+
+func modelCasts(instance *Instance) map[string]string {
+	casts := make(map[string]string)
+	if m, ok := instance.Fields["casts"].(map[string]interface{}); ok {
+		for k, v := range m {
+			casts[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return casts
+}
+
+// hydrateModels turns result rows into instances of the model class
+func (r *Runtime) hydrateModels(className string, rows []map[string]interface{}) []interface{} {
+	results := make([]interface{}, 0, len(rows))
+	if len(rows) == 0 {
+		return results
+	}
+	prototype := r.newModel(className)
+	casts := modelCasts(prototype)
+	for _, row := range rows {
+		results = append(results, hydrateModel(prototype, casts, row))
+	}
+	return results
+}
+
+// hydrateModel builds a loaded model from a row, cloning prototype
+func hydrateModel(prototype *Instance, casts map[string]string, row map[string]interface{}) *Instance {
+	model := prototype.Clone()
+	original := make(map[string]interface{}, len(row))
+	for col, val := range row {
+		if kind, ok := casts[col]; ok {
+			val = castAttribute(kind, val)
+		}
+		model.Fields[col] = val
+		original[col] = val
+	}
+	model.Fields["_original"] = original
+	model.Fields["_exists"] = true
+	return model
+}
+
+// takeEagerLoads removes and returns the pending with() list of a builder
+func takeEagerLoads(instance *Instance) []eagerLoad {
+	loads, _ := instance.Fields["_with"].([]eagerLoad)
+	delete(instance.Fields, "_with")
+	return loads
+}
+
+// modelGet runs the builder and returns hydrated models with their eager loads
+func (r *Runtime) modelGet(instance *Instance) []interface{} {
+	loads := takeEagerLoads(instance)
+	rows, _ := r.executeGetMethod(instance, nil).([]map[string]interface{})
+	models := r.hydrateModels(instance.Class.Name.Value, rows)
+	r.eagerLoadRelations(models, loads)
+	return models
+}
+
+func (r *Runtime) modelFirst(instance *Instance) interface{} {
+	loads := takeEagerLoads(instance)
+	row, _ := r.executeFirstMethod(instance, nil).(map[string]interface{})
+	if row == nil {
+		return nil
+	}
+	models := r.hydrateModels(instance.Class.Name.Value, []map[string]interface{}{row})
+	r.eagerLoadRelations(models, loads)
+	return models[0]
+}
+
+// parseEagerLoads normalizes with() arguments: "posts", ["posts", "roles"],
+// "posts.comments" or {"posts": function($q) { ... }}
+func parseEagerLoads(args []interface{}) []eagerLoad {
+	type spec struct {
+		path       string
+		constraint interface{}
+	}
+	var specs []spec
+	var collect func(val interface{})
+	collect = func(val interface{}) {
+		switch v := val.(type) {
+		case string:
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					specs = append(specs, spec{path: p})
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				specs = append(specs, spec{path: k, constraint: v[k]})
+			}
+		}
+	}
+	for _, arg := range args {
+		collect(arg)
+	}
+
+	var loads []eagerLoad
+	index := make(map[string]int)
+	for _, s := range specs {
+		head, rest, nested := strings.Cut(s.path, ".")
+		i, ok := index[head]
+		if !ok {
+			loads = append(loads, eagerLoad{name: head})
+			i = len(loads) - 1
+			index[head] = i
+		}
+		if nested {
+			loads[i].nested = append(loads[i].nested, parseEagerLoads([]interface{}{map[string]interface{}{rest: s.constraint}})...)
+		} else if s.constraint != nil {
+			loads[i].constraint = s.constraint
+		}
+	}
+	return mergeEagerLoads(loads)
+}
+
+// mergeEagerLoads joins entries for the same relation ("posts.a", "posts.b")
+func mergeEagerLoads(loads []eagerLoad) []eagerLoad {
+	var out []eagerLoad
+	index := make(map[string]int)
+	for _, l := range loads {
+		if i, ok := index[l.name]; ok {
+			out[i].nested = append(out[i].nested, l.nested...)
+			if l.constraint != nil {
+				out[i].constraint = l.constraint
+			}
+			continue
+		}
+		index[l.name] = len(out)
+		out = append(out, l)
+	}
+	for i := range out {
+		out[i].nested = mergeEagerLoads(out[i].nested)
+	}
+	return out
+}
+
+// groupWheresFrom wraps the wheres added after index i (and their bindings,
+// after j) in parentheses, so an orWhere among them can't escape the
+// constraints before them
+func groupWheresFrom(builder *Instance, i, j int) {
+	wheres, _ := builder.Fields["_wheres"].([]string)
+	bindings, _ := builder.Fields["_bindings"].([]interface{})
+	if len(wheres) <= i {
+		return
+	}
+	added, addedBindings := wheres[i:], append([]interface{}{}, bindings[j:]...)
+	builder.Fields["_wheres"] = append([]string{}, wheres[:i]...)
+	builder.Fields["_bindings"] = append([]interface{}{}, bindings[:j]...)
+	addWhere(builder, "AND", "("+compileWheres(added)+")", addedBindings...)
+}
+
+// findClassMethod looks up a user-defined method in the class hierarchy
+func (r *Runtime) findClassMethod(class *parser.ClassStatement, name string) *parser.MethodStatement {
+	for class != nil {
+		for _, stmt := range class.Body.Statements {
+			if method, ok := stmt.(*parser.MethodStatement); ok && method.Name.Value == name && method.Body != nil {
+				return method
+			}
+		}
+		if class.SuperClass == nil {
+			return nil
+		}
+		class = r.Classes[class.SuperClass.Value]
+	}
+	return nil
+}
+
+// relationBuilder calls the relation method `name` on a model
+func (r *Runtime) relationBuilder(model *Instance, name string) (*Instance, *modelRelation) {
+	method := r.findClassMethod(model.Class, name)
+	if method == nil {
+		panic(fmt.Sprintf("GranDB Error: la relación '%s' no está definida en %s", name, model.Class.Name.Value))
+	}
+	builder, ok := r.CallMethodEvaluated(method, model, nil).(*Instance)
+	if !ok {
+		panic(fmt.Sprintf("GranDB Error: %s::%s() debe retornar una relación (hasMany, hasOne, belongsTo o belongsToMany)", model.Class.Name.Value, name))
+	}
+	rel, ok := builder.Fields["_relation"].(*modelRelation)
+	if !ok {
+		panic(fmt.Sprintf("GranDB Error: %s::%s() debe retornar una relación (hasMany, hasOne, belongsTo o belongsToMany)", model.Class.Name.Value, name))
+	}
+	return builder, rel
+}
+
+// eagerLoadRelations loads each relation for all models with one query per
+// relation (instead of one per model) and stores it on every model
+func (r *Runtime) eagerLoadRelations(models []interface{}, loads []eagerLoad) {
+	if len(models) == 0 || len(loads) == 0 {
+		return
+	}
+	parents := make([]*Instance, 0, len(models))
+	for _, m := range models {
+		if inst, ok := m.(*Instance); ok {
+			parents = append(parents, inst)
+		}
+	}
+	if len(parents) == 0 {
+		return
+	}
+
+	for _, load := range loads {
+		builder, rel := r.relationBuilder(parents[0], load.name)
+
+		// Replace the single-parent constraint added by the relation with one
+		// matching all parents; the relation's other wheres are kept, grouped
+		wheres, _ := builder.Fields["_wheres"].([]string)
+		bindings, _ := builder.Fields["_bindings"].([]interface{})
+		relWheres, relBindings := wheres[1:], bindings[rel.keyBindings:]
+		builder.Fields["_wheres"] = []string{}
+		builder.Fields["_bindings"] = []interface{}{}
+
+		parentCol, childCol, whereCol := rel.localKey, rel.foreignKey, rel.foreignKey
+		switch rel.kind {
+		case "belongsTo":
+			parentCol, childCol, whereCol = rel.foreignKey, rel.localKey, rel.localKey
+		case "belongsToMany":
+			childCol, whereCol = "_pivot_key", rel.pivot+"."+rel.pivotFK
+		}
+
+		keys := []interface{}{}
+		seen := make(map[string]bool)
+		for _, p := range parents {
+			val := p.Fields[parentCol]
+			if val == nil {
+				continue
+			}
+			k := fmt.Sprintf("%v", val)
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, val)
+			}
+		}
+
+		var children []interface{}
+		if len(keys) > 0 {
+			r.executeGranMySQLMethod(builder, "whereIn", []interface{}{whereCol, keys})
+			if len(relWheres) > 0 {
+				addWhere(builder, "AND", "("+compileWheres(relWheres)+")", relBindings...)
+			}
+			if load.constraint != nil {
+				before, _ := builder.Fields["_wheres"].([]string)
+				beforeBindings, _ := builder.Fields["_bindings"].([]interface{})
+				r.applyFunction(load.constraint, []interface{}{builder})
+				groupWheresFrom(builder, len(before), len(beforeBindings))
+			}
+			builder.Fields["_with"] = load.nested
+			children = r.modelGet(builder)
+		}
+
+		grouped := make(map[string][]interface{})
+		for _, c := range children {
+			child := c.(*Instance)
+			k := fmt.Sprintf("%v", child.Fields[childCol])
+			grouped[k] = append(grouped[k], child)
+		}
+
+		for _, p := range parents {
+			matches := grouped[fmt.Sprintf("%v", p.Fields[parentCol])]
+			if p.Fields[parentCol] == nil {
+				matches = nil
+			}
+			if rel.kind == "hasMany" || rel.kind == "belongsToMany" {
+				if matches == nil {
+					matches = []interface{}{}
+				}
+				p.Fields[load.name] = matches
+			} else if len(matches) > 0 {
+				p.Fields[load.name] = matches[0]
+			} else {
+				p.Fields[load.name] = nil
+			}
+			markRelation(p, load.name)
+		}
+	}
+}
+
+func markRelation(model *Instance, name string) {
+	relations, _ := model.Fields["_relations"].(map[string]bool)
+	if relations == nil {
+		relations = make(map[string]bool)
+	}
+	relations[name] = true
+	model.Fields["_relations"] = relations
+}
+
+// snakeCase converts "BlogPost" to "blog_post"
+func snakeCase(s string) string {
+	var sb strings.Builder
+	for i, c := range s {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(c))
+		} else {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+func argString(args []interface{}, i int, def string) string {
+	if i < len(args) {
+		if s, ok := args[i].(string); ok && s != "" {
+			return s
+		}
+	}
+	return def
+}
+
+// newRelation builds the related model's query for a relation declared on parent
+func (r *Runtime) newRelation(parent *Instance, kind string, args []interface{}) *Instance {
+	if len(args) < 1 {
+		panic(fmt.Sprintf("GranDB Error: %s() requiere el nombre del modelo relacionado", kind))
+	}
+	relatedClass := fmt.Sprintf("%v", args[0])
+	related := r.newModel(relatedClass)
+	initQueryState(related)
+	parentName := snakeCase(parent.Class.Name.Value)
+	relatedName := snakeCase(relatedClass)
+
+	rel := &modelRelation{kind: kind, related: relatedClass}
+	switch kind {
+	case "hasMany", "hasOne":
+		rel.foreignKey = argString(args, 1, parentName+"_id")
+		rel.localKey = argString(args, 2, primaryKey(parent))
+		rel.parentKey = parent.Fields[rel.localKey]
+		r.addBasicWhere(related, "AND", []interface{}{rel.foreignKey, rel.parentKey})
+	case "belongsTo":
+		rel.foreignKey = argString(args, 1, relatedName+"_id")
+		rel.localKey = argString(args, 2, primaryKey(related))
+		rel.parentKey = parent.Fields[rel.foreignKey]
+		r.addBasicWhere(related, "AND", []interface{}{rel.localKey, rel.parentKey})
+	case "belongsToMany":
+		names := []string{parentName, relatedName}
+		sort.Strings(names)
+		rel.pivot = r.builderTable(related, argString(args, 1, strings.Join(names, "_")))
+		rel.pivotFK = argString(args, 2, parentName+"_id")
+		rel.pivotRK = argString(args, 3, relatedName+"_id")
+		rel.localKey = primaryKey(parent)
+		rel.parentKey = parent.Fields[rel.localKey]
+
+		table := r.getTable(related)
+		related.Fields["_select"] = fmt.Sprintf("%s.*, %s AS %s",
+			quoteIdentifier(table), quoteIdentifier(rel.pivot+"."+rel.pivotFK), quoteIdentifier("_pivot_key"))
+		related.Fields["_joins"] = []string{fmt.Sprintf("INNER JOIN %s ON %s = %s",
+			quoteIdentifier(rel.pivot), quoteIdentifier(rel.pivot+"."+rel.pivotRK), quoteIdentifier(table+"."+primaryKey(related)))}
+		r.addBasicWhere(related, "AND", []interface{}{rel.pivot + "." + rel.pivotFK, rel.parentKey})
+	}
+	bindings, _ := related.Fields["_bindings"].([]interface{})
+	rel.keyBindings = len(bindings)
+	related.Fields["_relation"] = rel
+	return related
+}
+
+// modelQuery returns a fresh builder on the same table, for save/delete by
+// key: it keeps the model options but skips global scopes and soft deletes
+func (r *Runtime) modelQuery(model *Instance) *Instance {
+	q := &Instance{Class: model.Class, Fields: map[string]interface{}{}}
+	for k := range modelConfigFields {
+		if v, ok := model.Fields[k]; ok {
+			q.Fields[k] = v
+		}
+	}
+	initQueryState(q)
+	q.Fields["_table"] = r.getTable(model)
+	q.Fields["_model"] = true
+	q.Fields["_scoped"] = true
+	return q
+}
+
+func (r *Runtime) whereKey(model *Instance) *Instance {
+	pk := primaryKey(model)
+	id, ok := model.Fields[pk]
+	if !ok || id == nil {
+		panic(fmt.Sprintf("GranDB Error: el modelo %s no tiene '%s'", model.Class.Name.Value, pk))
+	}
+	q := r.modelQuery(model)
+	r.addBasicWhere(q, "AND", []interface{}{pk, id})
+	return q
+}
+
+// fillModel assigns attributes, honoring the fillable list when defined
+func fillModel(model *Instance, data map[string]interface{}) {
+	fillable := stringList(model.Fields["fillable"])
+	allowed := make(map[string]bool, len(fillable))
+	for _, f := range fillable {
+		allowed[f] = true
+	}
+	for k, v := range data {
+		if len(allowed) > 0 && !allowed[k] {
+			continue
+		}
+		if strings.HasPrefix(k, "_") || modelConfigFields[k] {
+			continue
+		}
+		model.Fields[k] = v
+	}
+}
+
+// dirtyAttributes returns the attributes changed since the model was loaded
+func dirtyAttributes(model *Instance) map[string]interface{} {
+	original, _ := model.Fields["_original"].(map[string]interface{})
+	dirty := make(map[string]interface{})
+	for k, v := range modelAttributes(model) {
+		old, ok := original[k]
+		if !ok || fmt.Sprintf("%v", old) != fmt.Sprintf("%v", v) {
+			dirty[k] = v
+		}
+	}
+	return dirty
+}
+
+func (r *Runtime) saveModel(model *Instance) bool {
+	casts := modelCasts(model)
+	exists, _ := model.Fields["_exists"].(bool)
+
+	var attrs map[string]interface{}
+	if exists {
+		attrs = dirtyAttributes(model)
+		if len(attrs) == 0 {
+			return true
+		}
+	} else {
+		attrs = modelAttributes(model)
+	}
+
+	data := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		if kind, ok := casts[k]; ok {
+			v = uncastAttribute(kind, v)
+		}
+		data[k] = v
+	}
+
+	touchTimestamps(model, data, !exists)
+	if exists {
+		r.executeUpdateMethod(r.whereKey(model), []interface{}{data})
+	} else {
+		pk := primaryKey(model)
+		id := r.insertGetId(r.builderConnection(model), r.getTable(model), data)
+		if _, hasKey := model.Fields[pk]; !hasKey && id != nil {
+			model.Fields[pk] = id
+		}
+		model.Fields["_exists"] = true
+	}
+	for _, col := range []string{"created_at", "updated_at"} {
+		if val, ok := data[col]; ok {
+			if _, given := attrs[col]; !given {
+				r.setModelColumn(model, col, val)
+			}
+		}
+	}
+
+	original := make(map[string]interface{})
+	for k, v := range modelAttributes(model) {
+		original[k] = v
+	}
+	model.Fields["_original"] = original
+	return true
+}
+
+// executeModelMethod handles the active-record methods of models
+func (r *Runtime) executeModelMethod(instance *Instance, method string, args []interface{}) interface{} {
+	switch method {
+	case "all":
+		return r.modelGet(instance)
+
+	case "find", "findOrFail":
+		if len(args) < 1 {
+			panic(fmt.Sprintf("GranDB Error: %s() requiere un id", method))
+		}
+		pk := primaryKey(instance)
+		if ids, ok := args[0].([]interface{}); ok {
+			r.executeGranMySQLMethod(instance, "whereIn", []interface{}{pk, ids})
+			return r.modelGet(instance)
+		}
+		r.addBasicWhere(instance, "AND", []interface{}{pk, args[0]})
+		found := r.modelFirst(instance)
+		if found == nil && method == "findOrFail" {
+			panic(fmt.Sprintf("GranDB Error: %s con %s = %v no encontrado", instance.Class.Name.Value, pk, args[0]))
+		}
+		return found
+
+	case "with":
+		loads, _ := instance.Fields["_with"].([]eagerLoad)
+		instance.Fields["_with"] = mergeEagerLoads(append(loads, parseEagerLoads(args)...))
+		return instance
+
+	case "load":
+		r.eagerLoadRelations([]interface{}{instance}, parseEagerLoads(args))
+		return instance
+
+	case "fill":
+		if len(args) > 0 {
+			if data, ok := args[0].(map[string]interface{}); ok {
+				fillModel(instance, data)
+			}
+		}
+		return instance
+
+	case "create":
+		model := r.newModel(instance.Class.Name.Value)
+		if len(args) > 0 {
+			if data, ok := args[0].(map[string]interface{}); ok {
+				fillModel(model, data)
+			}
+		}
+		r.saveModel(model)
+		return model
+
+	case "save":
+		return r.saveModel(instance)
+
+	case "fresh", "refresh":
+		if exists, _ := instance.Fields["_exists"].(bool); !exists {
+			return nil
+		}
+		q := r.whereKey(instance)
+		row, _ := r.executeFirstMethod(q, nil).(map[string]interface{})
+		if row == nil {
+			return nil
+		}
+		fresh := r.hydrateModels(instance.Class.Name.Value, []map[string]interface{}{row})[0].(*Instance)
+		if method == "fresh" {
+			return fresh
+		}
+		for k := range modelAttributes(instance) {
+			delete(instance.Fields, k)
+		}
+		for k, v := range modelAttributes(fresh) {
+			instance.Fields[k] = v
+		}
+		instance.Fields["_original"] = fresh.Fields["_original"]
+		return instance
+
+	case "toArray":
+		return modelArray(instance, true)
+
+	case "hasMany", "hasOne", "belongsTo", "belongsToMany":
+		return r.newRelation(instance, method, args)
+
+	case "attach", "detach", "sync":
+		return r.executePivotMethod(instance, method, args)
+
+	case "factory":
+		return r.modelFactory(instance, args)
+	}
+	return nil
+}
+
+// executePivotMethod handles attach/detach/sync on a belongsToMany relation
+func (r *Runtime) executePivotMethod(instance *Instance, method string, args []interface{}) interface{} {
+	rel, ok := instance.Fields["_relation"].(*modelRelation)
+	if !ok || rel.kind != "belongsToMany" {
+		panic(fmt.Sprintf("GranDB Error: %s() solo está disponible en relaciones belongsToMany", method))
+	}
+	if rel.parentKey == nil {
+		panic(fmt.Sprintf("GranDB Error: %s() requiere un modelo guardado", method))
+	}
+
+	ids := []interface{}{}
+	var extra map[string]interface{}
+	if len(args) > 0 {
+		switch v := args[0].(type) {
+		case []interface{}:
+			ids = v
+		case *Instance:
+			ids = []interface{}{v.Fields[primaryKey(v)]}
+		case nil:
+		default:
+			ids = []interface{}{v}
+		}
+	}
+	if len(args) > 1 {
+		extra, _ = args[1].(map[string]interface{})
+	}
+
+	// The pivot lives on the related model's connection
+	conn := r.builderConnection(instance)
+	pivot := quoteIdentifier(rel.pivot)
+	fk, rk := quoteIdentifier(rel.pivotFK), quoteIdentifier(rel.pivotRK)
+
+	attach := func(list []interface{}) {
+		for _, id := range list {
+			cols := []string{fk, rk}
+			placeholders := []string{"?", "?"}
+			values := []interface{}{rel.parentKey, id}
+			keys := make([]string, 0, len(extra))
+			for k := range extra {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				cols = append(cols, quoteIdentifier(k))
+				placeholders = append(placeholders, "?")
+				values = append(values, extra[k])
+			}
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", pivot, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+			if _, err := r.connExec(conn).Exec(query, values...); err != nil {
+				panic(fmt.Sprintf("GranMySQL Error en attach: %v", err))
+			}
+		}
+	}
+	detach := func(list []interface{}, all bool) int64 {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", pivot, fk)
+		values := []interface{}{rel.parentKey}
+		if !all {
+			if len(list) == 0 {
+				return 0
+			}
+			query += fmt.Sprintf(" AND %s IN (%s)", rk, strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", "))
+			values = append(values, list...)
+		}
+		res, err := r.connExec(conn).Exec(query, values...)
+		if err != nil {
+			panic(fmt.Sprintf("GranMySQL Error en detach: %v", err))
+		}
+		n, _ := res.RowsAffected()
+		return n
+	}
+
+	switch method {
+	case "attach":
+		attach(ids)
+		return true
+	case "detach":
+		return detach(ids, len(args) == 0 || args[0] == nil)
+	}
+
+	// sync: keep exactly ids
+	current := []interface{}{}
+	rows, err := r.connExec(conn).Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", rk, pivot, fk), rel.parentKey)
+	if err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en sync: %v", err))
+	}
+	for _, row := range rowsToMap(rows) {
+		current = append(current, row[rel.pivotRK])
+	}
+	rows.Close()
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[fmt.Sprintf("%v", id)] = true
+	}
+	have := make(map[string]bool)
+	detached := []interface{}{}
+	for _, id := range current {
+		k := fmt.Sprintf("%v", id)
+		have[k] = true
+		if !wanted[k] {
+			detached = append(detached, id)
+		}
+	}
+	attached := []interface{}{}
+	for _, id := range ids {
+		if !have[fmt.Sprintf("%v", id)] {
+			attached = append(attached, id)
+		}
+	}
+	detach(detached, false)
+	attach(attached)
+	return map[string]interface{}{"attached": attached, "detached": detached}
+}
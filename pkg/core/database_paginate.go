@@ -0,0 +1,396 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Pagination results are plain maps so they can be passed to views and
+// Response::json as they are:
+//
+//	paginate        data, total, per_page, current_page, last_page, from, to,
+//	                first_page_url, last_page_url, next_page_url, prev_page_url,
+//	                path, page_name
+//	simplePaginate  data, per_page, current_page, from, to, has_more,
+//	                next_page_url, prev_page_url, path
+//	cursorPaginate  data, per_page, next_cursor, prev_cursor,
+//	                next_page_url, prev_page_url, path
+
+const defaultPerPage = 15
+
+// requestURL returns the current request path and query string values
+func (r *Runtime) requestURL() (string, url.Values) {
+	path, query := "/", url.Values{}
+	if reqInst, ok := r.Variables["$__request"].(*Instance); ok {
+		if p, ok := reqInst.Fields["_path"].(string); ok && p != "" {
+			path = p
+		}
+		if raw, ok := reqInst.Fields["_query"].(string); ok {
+			if parsed, err := url.ParseQuery(raw); err == nil {
+				query = parsed
+			}
+		}
+	}
+	return path, query
+}
+
+// pageURL returns path with param replaced in the current query string
+func pageURL(path string, query url.Values, param, value string) string {
+	values := url.Values{}
+	for k, v := range query {
+		values[k] = v
+	}
+	values.Set(param, value)
+	return path + "?" + values.Encode()
+}
+
+// positiveInt parses a page/per-page argument, falling back to def
+func positiveInt(val interface{}, def int) int {
+	n := def
+	switch v := val.(type) {
+	case int:
+		n = v
+	case int64:
+		n = int(v)
+	case float64:
+		n = int(v)
+	case string:
+		if parsed, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			n = parsed
+		}
+	}
+	if n < 1 {
+		return def
+	}
+	return n
+}
+
+// paginationArgs reads (perPage, pageName) and the current page from the request
+func (r *Runtime) paginationArgs(args []interface{}, defName string) (int, string, string, url.Values) {
+	perPage := defaultPerPage
+	if len(args) > 0 {
+		perPage = positiveInt(args[0], defaultPerPage)
+	}
+	param := defName
+	if len(args) > 1 {
+		if name, ok := args[1].(string); ok && name != "" {
+			param = name
+		}
+	}
+	path, query := r.requestURL()
+	return perPage, param, path, query
+}
+
+// snapshotQuery copies the builder state so it can run more than one query
+func snapshotQuery(instance *Instance) map[string]interface{} {
+	saved := make(map[string]interface{}, len(instance.Fields))
+	for k, v := range instance.Fields {
+		saved[k] = v
+	}
+	return saved
+}
+
+func restoreQuery(instance *Instance, saved map[string]interface{}) {
+	for k := range instance.Fields {
+		if _, ok := saved[k]; !ok {
+			delete(instance.Fields, k)
+		}
+	}
+	for k, v := range saved {
+		instance.Fields[k] = v
+	}
+}
+
+// fetchPage runs the builder with limit/offset, returning models for model classes
+func (r *Runtime) fetchPage(instance *Instance, limit, offset int) []interface{} {
+	instance.Fields["_limit"] = limit
+	instance.Fields["_offset"] = offset
+	if isModel(instance) {
+		return r.modelGet(instance)
+	}
+	rows, _ := r.executeGetMethod(instance, nil).([]map[string]interface{})
+	items := make([]interface{}, len(rows))
+	for i, row := range rows {
+		items[i] = row
+	}
+	return items
+}
+
+// executePaginateMethod handles .paginate(perPage, pageName)
+func (r *Runtime) executePaginateMethod(instance *Instance, args []interface{}) interface{} {
+	perPage, param, path, query := r.paginationArgs(args, "page")
+	page := positiveInt(query.Get(param), 1)
+
+	saved := snapshotQuery(instance)
+	total := r.executeCountMethod(instance, nil).(int)
+	restoreQuery(instance, saved)
+
+	lastPage := (total + perPage - 1) / perPage
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	items := r.fetchPage(instance, perPage, (page-1)*perPage)
+
+	result := pageBounds(items, page, perPage)
+	result["total"] = total
+	result["last_page"] = lastPage
+	result["page_name"] = param
+	result["path"] = path
+	result["first_page_url"] = pageURL(path, query, param, "1")
+	result["last_page_url"] = pageURL(path, query, param, strconv.Itoa(lastPage))
+	result["prev_page_url"] = nil
+	result["next_page_url"] = nil
+	if page > 1 {
+		result["prev_page_url"] = pageURL(path, query, param, strconv.Itoa(minInt(page-1, lastPage)))
+	}
+	if page < lastPage {
+		result["next_page_url"] = pageURL(path, query, param, strconv.Itoa(page+1))
+	}
+	return result
+}
+
+// executeSimplePaginateMethod handles .simplePaginate(perPage, pageName): no
+// COUNT query, it fetches one extra row to know whether there is a next page
+func (r *Runtime) executeSimplePaginateMethod(instance *Instance, args []interface{}) interface{} {
+	perPage, param, path, query := r.paginationArgs(args, "page")
+	page := positiveInt(query.Get(param), 1)
+
+	items := r.fetchPage(instance, perPage+1, (page-1)*perPage)
+	hasMore := len(items) > perPage
+	if hasMore {
+		items = items[:perPage]
+	}
+
+	result := pageBounds(items, page, perPage)
+	result["has_more"] = hasMore
+	result["path"] = path
+	result["prev_page_url"] = nil
+	result["next_page_url"] = nil
+	if page > 1 {
+		result["prev_page_url"] = pageURL(path, query, param, strconv.Itoa(page-1))
+	}
+	if hasMore {
+		result["next_page_url"] = pageURL(path, query, param, strconv.Itoa(page+1))
+	}
+	return result
+}
+
+func pageBounds(items []interface{}, page, perPage int) map[string]interface{} {
+	result := map[string]interface{}{
+		"data":         items,
+		"per_page":     perPage,
+		"current_page": page,
+		"from":         nil,
+		"to":           nil,
+	}
+	if len(items) > 0 {
+		from := (page-1)*perPage + 1
+		result["from"] = from
+		result["to"] = from + len(items) - 1
+	}
+	return result
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// paginationCursor is the decoded ?cursor= value: the last seen key and the
+// direction to move from it
+type paginationCursor struct {
+	Value    interface{} `json:"v"`
+	Previous bool        `json:"p,omitempty"`
+}
+
+func encodeCursor(c paginationCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (paginationCursor, bool) {
+	var c paginationCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &c) != nil || c.Value == nil {
+		return c, false
+	}
+	return c, true
+}
+
+// executeCursorPaginateMethod handles .cursorPaginate(perPage, column, direction).
+// Pages are selected with "column > last value" instead of OFFSET, so they stay
+// fast on large tables and do not skip rows when new ones are inserted. The
+// column must be unique and sortable (default: the primary key).
+func (r *Runtime) executeCursorPaginateMethod(instance *Instance, args []interface{}) interface{} {
+	perPage := defaultPerPage
+	if len(args) > 0 {
+		perPage = positiveInt(args[0], defaultPerPage)
+	}
+	column := "id"
+	if isModel(instance) {
+		column = primaryKey(instance)
+	}
+	if len(args) > 1 {
+		if col, ok := args[1].(string); ok && col != "" {
+			column = col
+		}
+	}
+	desc := false
+	if len(args) > 2 {
+		desc = strings.EqualFold(fmt.Sprintf("%v", args[2]), "DESC")
+	}
+	path, query := r.requestURL()
+	cursor, hasCursor := decodeCursor(query.Get("cursor"))
+
+	// Walking backwards flips both the comparison and the order; the rows are
+	// reversed again below
+	forwardDesc := desc
+	if hasCursor && cursor.Previous {
+		forwardDesc = !desc
+	}
+	quoted := quoteIdentifier(r.builderColumn(instance, column))
+	if hasCursor {
+		op := ">"
+		if forwardDesc {
+			op = "<"
+		}
+		// Keep user OR conditions grouped so the cursor applies to all of them
+		if wheres, _ := instance.Fields["_wheres"].([]string); len(wheres) > 1 {
+			instance.Fields["_wheres"] = []string{"(" + compileWheres(wheres) + ")"}
+		}
+		addWhere(instance, "AND", fmt.Sprintf("%s %s ?", quoted, op), cursor.Value)
+	}
+	dir := "ASC"
+	if forwardDesc {
+		dir = "DESC"
+	}
+	instance.Fields["_order"] = fmt.Sprintf("%s %s", quoted, dir)
+
+	items := r.fetchPage(instance, perPage+1, 0)
+	delete(instance.Fields, "_offset")
+	hasMore := len(items) > perPage
+	if hasMore {
+		items = items[:perPage]
+	}
+	if hasCursor && cursor.Previous {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	// There is a next page if we moved back from one, or more rows follow;
+	// a previous page if we came from a cursor, or more rows precede
+	hasNext := hasMore
+	hasPrev := hasCursor
+	if hasCursor && cursor.Previous {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	result := map[string]interface{}{
+		"data":          items,
+		"per_page":      perPage,
+		"path":          path,
+		"next_cursor":   nil,
+		"prev_cursor":   nil,
+		"next_page_url": nil,
+		"prev_page_url": nil,
+	}
+	if len(items) == 0 {
+		return result
+	}
+	key := column
+	if idx := strings.LastIndex(key, "."); idx >= 0 {
+		key = key[idx+1:]
+	}
+	if hasNext {
+		next := encodeCursor(paginationCursor{Value: cursorValue(items[len(items)-1], key)})
+		result["next_cursor"] = next
+		result["next_page_url"] = pageURL(path, query, "cursor", next)
+	}
+	if hasPrev {
+		prev := encodeCursor(paginationCursor{Value: cursorValue(items[0], key), Previous: true})
+		result["prev_cursor"] = prev
+		result["prev_page_url"] = pageURL(path, query, "cursor", prev)
+	}
+	return result
+}
+
+// cursorValue reads the cursor column from a row map or model
+func cursorValue(item interface{}, key string) interface{} {
+	var val interface{}
+	switch v := item.(type) {
+	case map[string]interface{}:
+		val = v[key]
+	case *Instance:
+		val = v.Fields[key]
+	}
+	if b, ok := val.([]byte); ok {
+		return string(b)
+	}
+	// Dates go back as the "Y-m-d H:i:s" they are compared against in SQL
+	if t, ok := dateValue(val); ok {
+		return dateString(t.In(dateLocation))
+	}
+	return val
+}
+
+// paginationLinks renders the @pagination directive: an accessible <nav> with
+// previous/next links, plus page numbers for paginate() results
+func (r *Runtime) paginationLinks(val interface{}) string {
+	p, ok := val.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	prev, _ := p["prev_page_url"].(string)
+	next, _ := p["next_page_url"].(string)
+	lastPage := positiveInt(p["last_page"], 0)
+	if prev == "" && next == "" && lastPage <= 1 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<nav aria-label="Paginación"><ul class="pagination">`)
+	writeEdge := func(href, rel, label, symbol string) {
+		if href == "" {
+			fmt.Fprintf(&sb, `<li class="page-item disabled"><span class="page-link" aria-disabled="true" aria-label="%s">%s</span></li>`, label, symbol)
+			return
+		}
+		fmt.Fprintf(&sb, `<li class="page-item"><a class="page-link" href="%s" rel="%s" aria-label="%s">%s</a></li>`, html.EscapeString(href), rel, label, symbol)
+	}
+
+	writeEdge(prev, "prev", "Página anterior", "&laquo;")
+	if lastPage > 0 {
+		current := positiveInt(p["current_page"], 1)
+		path, _ := p["path"].(string)
+		param, _ := p["page_name"].(string)
+		_, query := r.requestURL()
+		gap := false
+		for n := 1; n <= lastPage; n++ {
+			// First, last and two pages around the current one
+			if n != 1 && n != lastPage && (n < current-2 || n > current+2) {
+				if !gap {
+					sb.WriteString(`<li class="page-item disabled" aria-hidden="true"><span class="page-link">&hellip;</span></li>`)
+					gap = true
+				}
+				continue
+			}
+			gap = false
+			if n == current {
+				fmt.Fprintf(&sb, `<li class="page-item active"><span class="page-link" aria-current="page">%d</span></li>`, n)
+				continue
+			}
+			href := pageURL(path, query, param, strconv.Itoa(n))
+			fmt.Fprintf(&sb, `<li class="page-item"><a class="page-link" href="%s" aria-label="Ir a la página %d">%d</a></li>`, html.EscapeString(href), n, n)
+		}
+	}
+	writeEdge(next, "next", "Página siguiente", "&raquo;")
+	sb.WriteString(`</ul></nav>`)
+	return sb.String()
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// PostgreSQL support.
+//
+// The rest of the runtime writes MySQL/SQLite flavoured SQL: `?` placeholders
+// and backtick-quoted identifiers. Instead of threading a dialect through every
+// query, the "joss-postgres" driver wraps lib/pq and rewrites each statement
+// (`?` -> `$n`, backticks -> double quotes) before it reaches the server, so
+// GranDB, Auth, Schema, transactions and raw queries all work unchanged.
+
+const postgresDriverName = "joss-postgres"
+
+func init() {
+	sql.Register(postgresDriverName, &pgDriver{base: &pq.Driver{}})
+}
+
+// NormalizeDriver maps the DB setting to "mysql", "sqlite" or "postgres"
+func NormalizeDriver(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "postgres", "postgresql", "pgsql", "pg":
+		return "postgres"
+	case "sqlite", "sqlite3":
+		return "sqlite"
+	case "":
+		return "mysql"
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// DBDriver returns the normalized engine configured in env (default mysql)
+func (r *Runtime) DBDriver() string {
+	return NormalizeDriver(r.Env["DB"])
+}
+
+// PostgresDSN builds a connection URL from DB_HOST, DB_PORT (5432), DB_USER,
+// DB_PASS, DB_NAME, DB_SSLMODE (disable), DB_SSL_CA/CERT/KEY and DB_PARAMS
+func PostgresDSN(env map[string]string) string {
+	port := env["DB_PORT"]
+	if port == "" {
+		port = "5432"
+	}
+	sslMode := env["DB_SSLMODE"]
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	query, _ := url.ParseQuery(strings.Trim(env["DB_PARAMS"], "?"))
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("sslmode", sslMode)
+	for key, param := range map[string]string{"DB_SSL_CA": "sslrootcert", "DB_SSL_CERT": "sslcert", "DB_SSL_KEY": "sslkey"} {
+		if val := env[key]; val != "" {
+			query.Set(param, val)
+		}
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(env["DB_USER"], env["DB_PASS"]),
+		Host:     env["DB_HOST"] + ":" + port,
+		Path:     "/" + env["DB_NAME"],
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// OpenPostgres opens a PostgreSQL pool through the rewriting driver
+func OpenPostgres(dsn string) (*sql.DB, error) {
+	return sql.Open(postgresDriverName, dsn)
+}
+
+// RebindPostgres converts `?` placeholders to `$1..$n` and backtick identifiers
+// to double quotes, leaving string literals and quoted identifiers untouched
+func RebindPostgres(query string) string {
+	if !strings.ContainsAny(query, "?`") {
+		return query
+	}
+	var sb strings.Builder
+	sb.Grow(len(query) + 8)
+	n := 0
+	inSingle, inDouble := false, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case inSingle:
+			if c == '\'' {
+				inSingle = false
+			}
+			sb.WriteByte(c)
+		case inDouble:
+			if c == '"' {
+				inDouble = false
+			}
+			sb.WriteByte(c)
+		case c == '\'':
+			inSingle = true
+			sb.WriteByte(c)
+		case c == '"':
+			inDouble = true
+			sb.WriteByte(c)
+		case c == '`':
+			sb.WriteByte('"')
+		case c == '?':
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// postgresDDL adapts the SQLite flavour of the built-in system tables
+func postgresDDL(query string) string {
+	return strings.NewReplacer(
+		"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+		"DATETIME", "TIMESTAMP",
+		"BOOLEAN DEFAULT 0", "SMALLINT DEFAULT 0",
+	).Replace(query)
+}
+
+// --- driver wrapper ---
+
+type pgDriver struct {
+	base driver.Driver
+}
+
+func (d *pgDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{conn: conn}, nil
+}
+
+type pgConn struct {
+	conn driver.Conn
+}
+
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(RebindPostgres(query))
+}
+
+func (c *pgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, RebindPostgres(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c *pgConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *pgConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *pgConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Begin()
+}
+
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, RebindPostgres(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, RebindPostgres(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *pgConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *pgConn) ResetSession(ctx context.Context) error {
+	if s, ok := c.conn.(driver.SessionResetter); ok {
+		return s.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *pgConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -2,21 +2,123 @@ package core
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/jossecurity/joss/pkg/parser"
 )
 
-// executeGetMethod handles .get()
-func (r *Runtime) executeGetMethod(instance *Instance, args []interface{}) interface{} {
-	if r.GetDB() == nil {
-		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+// allowedOperators are the comparison operators accepted by where()/having();
+// anything else would be interpolated into the SQL, so it is rejected
+var allowedOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+	"LIKE": true, "NOT LIKE": true, "ILIKE": true, "NOT ILIKE": true, "REGEXP": true,
+}
+
+func checkOperator(op string) string {
+	upper := strings.ToUpper(strings.TrimSpace(op))
+	if !allowedOperators[upper] {
+		panic(fmt.Sprintf("GranDB Error: operador no permitido '%s'", op))
+	}
+	return upper
+}
+
+func isClosure(val interface{}) bool {
+	switch val.(type) {
+	case *parser.FunctionLiteral, *BoundMethod:
+		return true
+	}
+	return false
+}
+
+// whereBoolean returns the connector of a where method (orWhere* -> OR)
+func whereBoolean(method string) string {
+	if strings.HasPrefix(method, "or") {
+		return "OR"
+	}
+	return "AND"
+}
+
+// addWhere appends a condition; OR conditions are stored with an "OR " prefix
+// and resolved by compileWheres
+func addWhere(instance *Instance, boolean string, cond string, bindings ...interface{}) {
+	wheres, _ := instance.Fields["_wheres"].([]string)
+	existing, _ := instance.Fields["_bindings"].([]interface{})
+	if boolean == "OR" {
+		cond = "OR " + cond
 	}
+	instance.Fields["_wheres"] = append(wheres, cond)
+	instance.Fields["_bindings"] = append(existing, bindings...)
+}
+
+// addBasicWhere handles where(col, val) and where(col, op, val)
+func (r *Runtime) addBasicWhere(instance *Instance, boolean string, args []interface{}) {
+	if len(args) == 2 {
+		col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+		if args[1] == nil {
+			addWhere(instance, boolean, col+" IS NULL")
+			return
+		}
+		addWhere(instance, boolean, fmt.Sprintf("%s = ?", col), args[1])
+	} else if len(args) == 3 {
+		col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+		op := checkOperator(fmt.Sprintf("%v", args[1]))
+		addWhere(instance, boolean, fmt.Sprintf("%s %s ?", col, op), args[2])
+	}
+}
+
+// addNestedWhere runs fn with a fresh builder and wraps its conditions in parentheses
+func (r *Runtime) addNestedWhere(instance *Instance, boolean string, fn interface{}) {
+	group := &Instance{Class: instance.Class, Fields: map[string]interface{}{
+		"_wheres":   []string{},
+		"_bindings": []interface{}{},
+		"_select":   "*",
+		"_table":    "",
+	}}
+	// The group resolves prefixes on the outer builder's connection
+	if name, ok := instance.Fields["connection"]; ok {
+		group.Fields["connection"] = name
+	}
+	r.applyFunction(fn, []interface{}{group})
+
+	wheres, _ := group.Fields["_wheres"].([]string)
+	if len(wheres) == 0 {
+		return
+	}
+	bindings, _ := group.Fields["_bindings"].([]interface{})
+	addWhere(instance, boolean, "("+compileWheres(wheres)+")", bindings...)
+}
+
+// compileWheres joins conditions with AND, or OR for those added by orWhere*
+func compileWheres(wheres []string) string {
+	var sb strings.Builder
+	for i, w := range wheres {
+		cond, boolean := w, "AND"
+		if strings.HasPrefix(w, "OR ") {
+			cond, boolean = w[3:], "OR"
+		}
+		if i > 0 {
+			sb.WriteString(" " + boolean + " ")
+		}
+		sb.WriteString(cond)
+	}
+	return sb.String()
+}
 
+// compileHavings joins having conditions the same way
+func compileHavings(havings []string) string {
+	return compileWheres(havings)
+}
+
+// compileQuery builds "SELECT <columns> FROM ... WHERE ... GROUP BY ... HAVING ..."
+// plus ORDER/LIMIT/OFFSET when withOrder is set, returning SQL and bindings in order
+func (r *Runtime) compileQuery(instance *Instance, columns string, withOrder bool) (string, []interface{}) {
 	table := r.getTable(instance)
-	sel := instance.Fields["_select"].(string)
-	wheres := instance.Fields["_wheres"].([]string)
-	bindings := instance.Fields["_bindings"].([]interface{})
+	wheres, _ := instance.Fields["_wheres"].([]string)
+	bindings, _ := instance.Fields["_bindings"].([]interface{})
+	args := append([]interface{}{}, bindings...)
 
-	query := fmt.Sprintf("SELECT %s FROM %s", sel, table)
+	query := fmt.Sprintf("SELECT %s FROM %s", columns, table)
 
 	if joins, ok := instance.Fields["_joins"]; ok {
 		for _, j := range joins.([]string) {
@@ -25,25 +127,64 @@ func (r *Runtime) executeGetMethod(instance *Instance, args []interface{}) inter
 	}
 
 	if len(wheres) > 0 {
-		query += " WHERE " + strings.Join(wheres, " AND ")
+		query += " WHERE " + compileWheres(wheres)
 	}
 
-	// Add Order By
-	if order, ok := instance.Fields["_order"]; ok {
-		query += " ORDER BY " + order.(string)
+	if group, ok := instance.Fields["_group"].(string); ok && group != "" {
+		query += " GROUP BY " + group
 	}
 
-	// Add Limit
-	if limit, ok := instance.Fields["_limit"]; ok {
-		query += fmt.Sprintf(" LIMIT %d", limit.(int))
+	if havings, ok := instance.Fields["_havings"].([]string); ok && len(havings) > 0 {
+		query += " HAVING " + compileHavings(havings)
+		if hb, ok := instance.Fields["_havingBindings"].([]interface{}); ok {
+			args = append(args, hb...)
+		}
 	}
 
-	// Add Offset
-	if offset, ok := instance.Fields["_offset"]; ok {
-		query += fmt.Sprintf(" OFFSET %d", offset.(int))
+	if withOrder {
+		// Add Order By
+		if order, ok := instance.Fields["_order"]; ok {
+			query += " ORDER BY " + order.(string)
+		}
+
+		// Add Limit
+		if limit, ok := instance.Fields["_limit"]; ok {
+			query += fmt.Sprintf(" LIMIT %d", limit.(int))
+		}
+
+		// Add Offset
+		if offset, ok := instance.Fields["_offset"]; ok {
+			query += fmt.Sprintf(" OFFSET %d", offset.(int))
+		}
 	}
 
-	// Reset state
+	return query, args
+}
+
+// selectColumns returns the select list, with DISTINCT if requested
+func selectColumns(instance *Instance) string {
+	sel, _ := instance.Fields["_select"].(string)
+	if sel == "" {
+		sel = "*"
+	}
+	if distinct, _ := instance.Fields["_distinct"].(bool); distinct {
+		return "DISTINCT " + sel
+	}
+	return sel
+}
+
+// initQueryState sets up an empty builder on instance
+func initQueryState(instance *Instance) {
+	instance.Fields["_wheres"] = []string{}
+	instance.Fields["_bindings"] = []interface{}{}
+	instance.Fields["_select"] = "*"
+	if _, ok := instance.Fields["_table"]; !ok {
+		instance.Fields["_table"] = ""
+	}
+}
+
+// resetQuery clears the builder state after a query runs
+func resetQuery(instance *Instance) {
 	instance.Fields["_wheres"] = []string{}
 	instance.Fields["_bindings"] = []interface{}{}
 	instance.Fields["_select"] = "*"
@@ -51,8 +192,27 @@ func (r *Runtime) executeGetMethod(instance *Instance, args []interface{}) inter
 	delete(instance.Fields, "_order")
 	delete(instance.Fields, "_limit")
 	delete(instance.Fields, "_offset")
+	delete(instance.Fields, "_distinct")
+	delete(instance.Fields, "_group")
+	delete(instance.Fields, "_havings")
+	delete(instance.Fields, "_havingBindings")
+	resetScopes(instance)
+}
 
-	rows, err := r.GetDB().Query(query, bindings...)
+// executeGetMethod handles .get()
+func (r *Runtime) executeGetMethod(instance *Instance, args []interface{}) interface{} {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
+		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+	}
+	r.applyScopes(instance)
+
+	query, bindings := r.compileQuery(instance, selectColumns(instance), true)
+
+	// Reset state
+	resetQuery(instance)
+
+	rows, err := r.connRead(conn).Query(query, bindings...)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en get: %v", err))
 	}
@@ -63,40 +223,20 @@ func (r *Runtime) executeGetMethod(instance *Instance, args []interface{}) inter
 
 // executeFirstMethod handles .first()
 func (r *Runtime) executeFirstMethod(instance *Instance, args []interface{}) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
 	}
+	r.applyScopes(instance)
 
-	table := r.getTable(instance)
-	sel := instance.Fields["_select"].(string)
-	wheres := instance.Fields["_wheres"].([]string)
-	bindings := instance.Fields["_bindings"].([]interface{})
-
-	query := fmt.Sprintf("SELECT %s FROM %s", sel, table)
-
-	if joins, ok := instance.Fields["_joins"]; ok {
-		for _, j := range joins.([]string) {
-			query += " " + j
-		}
-	}
-
-	if len(wheres) > 0 {
-		query += " WHERE " + strings.Join(wheres, " AND ")
-	}
-
-	if order, ok := instance.Fields["_order"]; ok {
-		query += " ORDER BY " + order.(string)
-	}
-
-	query += " LIMIT 1"
+	instance.Fields["_limit"] = 1
+	delete(instance.Fields, "_offset")
+	query, bindings := r.compileQuery(instance, selectColumns(instance), true)
 
 	// Reset state
-	instance.Fields["_wheres"] = []string{}
-	instance.Fields["_bindings"] = []interface{}{}
-	instance.Fields["_joins"] = []string{}
-	delete(instance.Fields, "_order")
+	resetQuery(instance)
 
-	rows, err := r.GetDB().Query(query, bindings...)
+	rows, err := r.connRead(conn).Query(query, bindings...)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en first: %v", err))
 	}
@@ -111,33 +251,93 @@ func (r *Runtime) executeFirstMethod(instance *Instance, args []interface{}) int
 
 // executeCountMethod handles .count()
 func (r *Runtime) executeCountMethod(instance *Instance, args []interface{}) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
 	}
-	table := r.getTable(instance)
-	wheres := instance.Fields["_wheres"].([]string)
-	bindings := instance.Fields["_bindings"].([]interface{})
-
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", table)
-
-	if joins, ok := instance.Fields["_joins"]; ok {
-		for _, j := range joins.([]string) {
-			query += " " + j
-		}
-	}
+	r.applyScopes(instance)
 
-	if len(wheres) > 0 {
-		query += " WHERE " + strings.Join(wheres, " AND ")
+	var query string
+	var bindings []interface{}
+	_, grouped := instance.Fields["_group"].(string)
+	distinct, _ := instance.Fields["_distinct"].(bool)
+	if grouped || distinct {
+		// Count the groups / distinct rows, not the underlying rows
+		inner, innerBindings := r.compileQuery(instance, selectColumns(instance), false)
+		query, bindings = fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS joss_count", inner), innerBindings
+	} else {
+		query, bindings = r.compileQuery(instance, "COUNT(*)", false)
 	}
 
-	instance.Fields["_wheres"] = []string{}
-	instance.Fields["_bindings"] = []interface{}{}
-	instance.Fields["_joins"] = []string{}
+	resetQuery(instance)
 
 	var count int
-	err := r.GetDB().QueryRow(query, bindings...).Scan(&count)
+	err := r.connRead(conn).QueryRow(query, bindings...).Scan(&count)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en count: %v", err))
 	}
 	return count
 }
+
+// executeAggregateMethod handles .sum(col), .avg(col), .min(col) and .max(col).
+// Returns null when no rows match.
+func (r *Runtime) executeAggregateMethod(instance *Instance, fn string, args []interface{}) interface{} {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
+		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+	}
+	r.applyScopes(instance)
+	if len(args) < 1 {
+		panic(fmt.Sprintf("GranDB Error: %s() requiere una columna", strings.ToLower(fn)))
+	}
+	col := quoteIdentifier(r.builderColumn(instance, fmt.Sprintf("%v", args[0])))
+	query, bindings := r.compileQuery(instance, fmt.Sprintf("%s(%s) AS aggregate", fn, col), false)
+
+	resetQuery(instance)
+
+	rows, err := r.connRead(conn).Query(query, bindings...)
+	if err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en %s: %v", strings.ToLower(fn), err))
+	}
+	defer rows.Close()
+
+	results := rowsToMap(rows)
+	if len(results) == 0 {
+		return nil
+	}
+	return aggregateValue(results[0]["aggregate"])
+}
+
+// executeExistsMethod handles .exists()
+func (r *Runtime) executeExistsMethod(instance *Instance) bool {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
+		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
+	}
+	r.applyScopes(instance)
+	inner, bindings := r.compileQuery(instance, "1", false)
+
+	resetQuery(instance)
+
+	// bool: PostgreSQL returns a boolean, MySQL/SQLite return 0/1
+	var exists bool
+	err := r.connRead(conn).QueryRow(fmt.Sprintf("SELECT EXISTS(%s)", inner), bindings...).Scan(&exists)
+	if err != nil {
+		panic(fmt.Sprintf("GranMySQL Error en exists: %v", err))
+	}
+	return exists
+}
+
+// aggregateValue converts driver numeric results (MySQL returns DECIMAL as
+// text) to int64/float64
+func aggregateValue(val interface{}) interface{} {
+	if v, ok := val.(string); ok {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return normalizeNumber(val)
+}
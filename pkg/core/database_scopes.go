@@ -0,0 +1,223 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Model options that change how the builder reads and writes:
+//
+//	$this->timestamps = false             no automatic created_at/updated_at
+//	$this->softDeletes = true             delete() sets deleted_at, reads skip trashed rows
+//	$this->globalScopes = ["active"]      local scopes applied to every query
+//
+// Local scopes are methods named scopeXxx($query, ...args) and are called as
+// $query->xxx(...args). Scopes and the soft delete filter are added when the
+// query runs, so withTrashed()/withoutGlobalScope() work anywhere in the chain.
+
+const deletedAtColumn = "deleted_at"
+
+// usesTimestamps reports whether created_at/updated_at are filled on write.
+// Plain builders always do; models unless $this->timestamps = false.
+func usesTimestamps(instance *Instance) bool {
+	if enabled, ok := instance.Fields["timestamps"].(bool); ok {
+		return enabled
+	}
+	return true
+}
+
+func usesSoftDeletes(instance *Instance) bool {
+	enabled, _ := instance.Fields["softDeletes"].(bool)
+	return enabled && isModel(instance)
+}
+
+// freshTimestamp is the value written to timestamp columns. Models use the
+// application clock (TIMEZONE, Date::setTestNow) so the saved instance holds
+// the same value as the row; plain builders keep the database clock.
+func freshTimestamp(instance *Instance) interface{} {
+	if isModel(instance) {
+		return Now().Format("2006-01-02 15:04:05")
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// touchTimestamps fills updated_at (and created_at when creating) unless given
+func touchTimestamps(instance *Instance, data map[string]interface{}, creating bool) {
+	if !usesTimestamps(instance) {
+		return
+	}
+	stampColumns(data, creating, freshTimestamp(instance))
+}
+
+// stampColumns sets created_at (when creating) and updated_at unless present
+func stampColumns(data map[string]interface{}, creating bool, now interface{}) {
+	if _, ok := data["created_at"]; creating && !ok {
+		data["created_at"] = now
+	}
+	if _, ok := data["updated_at"]; !ok {
+		data["updated_at"] = now
+	}
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	runes := []rune(s)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// callLocalScope runs scopeXxx on a model builder; false if it is not defined
+func (r *Runtime) callLocalScope(instance *Instance, name string, args []interface{}) bool {
+	method := r.findClassMethod(instance.Class, "scope"+upperFirst(name))
+	if method == nil {
+		return false
+	}
+	r.CallMethodEvaluated(method, instance, append([]interface{}{instance}, args...))
+	return true
+}
+
+// groupOrWheres wraps the current conditions in parentheses when they contain
+// an OR, so conditions appended afterwards apply to all of them
+func groupOrWheres(instance *Instance) {
+	wheres, _ := instance.Fields["_wheres"].([]string)
+	for _, w := range wheres {
+		if strings.HasPrefix(w, "OR ") {
+			instance.Fields["_wheres"] = []string{"(" + compileWheres(wheres) + ")"}
+			return
+		}
+	}
+}
+
+// applyScopes adds the global scopes and the soft delete filter of a model
+// query. It runs once per query, right before it is compiled.
+func (r *Runtime) applyScopes(instance *Instance) {
+	if !isModel(instance) {
+		return
+	}
+	if done, _ := instance.Fields["_scoped"].(bool); done {
+		return
+	}
+	instance.Fields["_scoped"] = true
+
+	removed, _ := instance.Fields["_withoutScopes"].(map[string]bool)
+	names := stringList(instance.Fields["globalScopes"])
+	trashed, _ := instance.Fields["_trashed"].(string)
+	softDeletes := usesSoftDeletes(instance) && trashed != "with"
+
+	if removed["*"] || (len(names) == 0 && !softDeletes) {
+		names = nil
+		if !softDeletes {
+			return
+		}
+	}
+	groupOrWheres(instance)
+
+	for _, name := range names {
+		if removed[name] {
+			continue
+		}
+		// Each scope gets its own builder so its OR conditions stay grouped
+		group := &Instance{Class: instance.Class, Fields: map[string]interface{}{
+			"_model":  true,
+			"_scoped": true,
+		}}
+		initQueryState(group)
+		if !r.callLocalScope(group, name, nil) {
+			panic(fmt.Sprintf("GranDB Error: el scope global '%s' no está definido en %s (falta scope%s)", name, instance.Class.Name.Value, upperFirst(name)))
+		}
+		if wheres, _ := group.Fields["_wheres"].([]string); len(wheres) > 0 {
+			bindings, _ := group.Fields["_bindings"].([]interface{})
+			addWhere(instance, "AND", "("+compileWheres(wheres)+")", bindings...)
+		}
+	}
+
+	if softDeletes {
+		col := quoteIdentifier(r.getTable(instance) + "." + deletedAtColumn)
+		if trashed == "only" {
+			addWhere(instance, "AND", col+" IS NOT NULL")
+		} else {
+			addWhere(instance, "AND", col+" IS NULL")
+		}
+	}
+}
+
+// resetScopes clears the per-query scope state
+func resetScopes(instance *Instance) {
+	delete(instance.Fields, "_scoped")
+	delete(instance.Fields, "_trashed")
+	delete(instance.Fields, "_withoutScopes")
+}
+
+// withoutScopes handles withoutGlobalScope(name) / withoutGlobalScopes([names])
+func withoutScopes(instance *Instance, names []string) {
+	removed, _ := instance.Fields["_withoutScopes"].(map[string]bool)
+	if removed == nil {
+		removed = make(map[string]bool)
+	}
+	if len(names) == 0 {
+		names = []string{"*"}
+	}
+	for _, name := range names {
+		removed[name] = true
+	}
+	instance.Fields["_withoutScopes"] = removed
+}
+
+// softDeleteQuery marks the rows matched by a model query as deleted
+func (r *Runtime) softDeleteQuery(instance *Instance) interface{} {
+	if wheres, _ := instance.Fields["_wheres"].([]string); len(wheres) == 0 {
+		fmt.Println("[GranDB] Warning: delete() without WHERE clause will delete all rows")
+		fmt.Println("[GranDB] Aborting delete for safety. Use deleteAll() to delete all rows.")
+		return false
+	}
+	return r.executeUpdateMethod(instance, []interface{}{map[string]interface{}{deletedAtColumn: freshTimestamp(instance)}})
+}
+
+// restoreTrashed clears deleted_at on the (trashed) rows matched by a model query
+func (r *Runtime) restoreTrashed(instance *Instance) interface{} {
+	if _, ok := instance.Fields["_trashed"]; !ok {
+		instance.Fields["_trashed"] = "with"
+	}
+	return r.executeUpdateMethod(instance, []interface{}{map[string]interface{}{deletedAtColumn: nil}})
+}
+
+// deleteModel deletes a loaded model: soft delete when enabled, unless forced
+func (r *Runtime) deleteModel(model *Instance, force bool) bool {
+	if usesSoftDeletes(model) && !force {
+		r.updateModelColumns(model, map[string]interface{}{deletedAtColumn: freshTimestamp(model)})
+		return true
+	}
+	r.executeDeleteMethod(r.whereKey(model))
+	model.Fields["_exists"] = false
+	return true
+}
+
+// restoreModel un-deletes a soft deleted model
+func (r *Runtime) restoreModel(model *Instance) bool {
+	r.updateModelColumns(model, map[string]interface{}{deletedAtColumn: nil})
+	return true
+}
+
+// updateModelColumns writes data to the model's row and mirrors it (plus the
+// touched updated_at) on the instance
+func (r *Runtime) updateModelColumns(model *Instance, data map[string]interface{}) {
+	r.executeUpdateMethod(r.whereKey(model), []interface{}{data})
+	for col, val := range data {
+		r.setModelColumn(model, col, val)
+	}
+}
+
+// setModelColumn stores a value written by the framework (timestamps,
+// deleted_at) on the model, cast and marked as clean
+func (r *Runtime) setModelColumn(model *Instance, col string, val interface{}) {
+	if kind, ok := modelCasts(model)[col]; ok && val != nil {
+		val = castAttribute(kind, val)
+	}
+	model.Fields[col] = val
+	if original, ok := model.Fields["_original"].(map[string]interface{}); ok {
+		original[col] = val
+	}
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// dbExecutor is satisfied by both *sql.DB and *sql.Tx, so query code can run
+// inside or outside a transaction without knowing which
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// dbTransaction is the transaction bound to a runtime. Nested transactions
+// are emulated with savepoints (level 1 is the real BEGIN).
+type dbTransaction struct {
+	tx    *sql.Tx
+	level int
+}
+
+// Conn returns the active transaction of this runtime, or the shared pool
+func (r *Runtime) Conn() dbExecutor {
+	return r.connExec(r.ownConnection())
+}
+
+// connExec returns the executor for c: its open transaction, or its pool
+func (r *Runtime) connExec(c *dbConnection) dbExecutor {
+	if r.Pretending() {
+		return pretendConn{}
+	}
+	var conn dbExecutor
+	if tx := r.txOn(c); tx != nil {
+		conn = r.observe(tx.tx)
+	} else if c.db != nil {
+		conn = r.observe(c.db)
+	} else {
+		return nil
+	}
+	if len(c.replicas) > 0 {
+		return primaryConn{dbExecutor: conn, r: r, db: c.db}
+	}
+	return conn
+}
+
+// txOn returns the open transaction of c (nil = none). The runtime's own
+// connection keeps it in r.tx, the others in r.connTx.
+func (r *Runtime) txOn(c *dbConnection) *dbTransaction {
+	if c.name == r.ConnectionName() {
+		return r.tx
+	}
+	return r.connTx[c.name]
+}
+
+func (r *Runtime) setTxOn(c *dbConnection, tx *dbTransaction) {
+	if c.name == r.ConnectionName() {
+		r.tx = tx
+		return
+	}
+	if tx == nil {
+		delete(r.connTx, c.name)
+		return
+	}
+	if r.connTx == nil {
+		r.connTx = make(map[string]*dbTransaction)
+	}
+	r.connTx[c.name] = tx
+}
+
+// TransactionLevel returns how many transactions are open (0 = none)
+func (r *Runtime) TransactionLevel() int {
+	return r.transactionLevelOn(r.ownConnection())
+}
+
+func (r *Runtime) transactionLevelOn(c *dbConnection) int {
+	tx := r.txOn(c)
+	if tx == nil {
+		return 0
+	}
+	return tx.level
+}
+
+// BeginTransaction starts a transaction, or a savepoint if one is already open
+func (r *Runtime) BeginTransaction() error {
+	return r.beginTransactionOn(r.ownConnection())
+}
+
+func (r *Runtime) beginTransactionOn(c *dbConnection) error {
+	if open := r.txOn(c); open != nil {
+		name := savepointName(open.level + 1)
+		if _, err := open.tx.Exec("SAVEPOINT " + name); err != nil {
+			return err
+		}
+		open.level++
+		return nil
+	}
+
+	if c.db == nil {
+		return fmt.Errorf("no hay conexión a la base de datos configurada")
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	r.setTxOn(c, &dbTransaction{tx: tx, level: 1})
+	return nil
+}
+
+// CommitTransaction commits the innermost transaction (or releases its savepoint)
+func (r *Runtime) CommitTransaction() error {
+	return r.commitTransactionOn(r.ownConnection())
+}
+
+func (r *Runtime) commitTransactionOn(c *dbConnection) error {
+	open := r.txOn(c)
+	if open == nil {
+		return fmt.Errorf("no hay una transacción activa")
+	}
+	if open.level > 1 {
+		_, err := open.tx.Exec("RELEASE SAVEPOINT " + savepointName(open.level))
+		open.level--
+		return err
+	}
+	r.setTxOn(c, nil)
+	return open.tx.Commit()
+}
+
+// RollbackTransaction undoes the innermost transaction (or rolls back to its savepoint)
+func (r *Runtime) RollbackTransaction() error {
+	return r.rollbackTransactionOn(r.ownConnection())
+}
+
+func (r *Runtime) rollbackTransactionOn(c *dbConnection) error {
+	open := r.txOn(c)
+	if open == nil {
+		return fmt.Errorf("no hay una transacción activa")
+	}
+	if open.level > 1 {
+		_, err := open.tx.Exec("ROLLBACK TO SAVEPOINT " + savepointName(open.level))
+		open.level--
+		return err
+	}
+	r.setTxOn(c, nil)
+	return open.tx.Rollback()
+}
+
+func savepointName(level int) string {
+	return fmt.Sprintf("joss_sp_%d", level)
+}
+
+// runTransaction executes fn inside a transaction. Any panic (a Joss `throw`
+// or a query error) rolls back and is re-raised so callers can catch it.
+func (r *Runtime) runTransaction(c *dbConnection, fn interface{}) (result interface{}) {
+	if err := r.beginTransactionOn(c); err != nil {
+		panic(fmt.Sprintf("GranDB Error en transaction: %v", err))
+	}
+	level := r.transactionLevelOn(c)
+
+	defer func() {
+		if err := recover(); err != nil {
+			// Only unwind if the block didn't already close this level itself
+			if r.transactionLevelOn(c) == level {
+				if rbErr := r.rollbackTransactionOn(c); rbErr != nil {
+					fmt.Printf("[GranDB] Error en rollback: %v\n", rbErr)
+				}
+			}
+			panic(err)
+		}
+	}()
+
+	result = r.applyFunction(fn, []interface{}{})
+
+	if r.transactionLevelOn(c) == level {
+		if err := r.commitTransactionOn(c); err != nil {
+			panic(fmt.Sprintf("GranDB Error en commit: %v", err))
+		}
+	}
+	return result
+}
+
+// withTransaction runs fn in a transaction (a savepoint if one is open),
+// rolling back and re-raising if it panics
+func (r *Runtime) withTransaction(c *dbConnection, fn func()) {
+	if err := r.beginTransactionOn(c); err != nil {
+		panic(fmt.Sprintf("GranDB Error en transaction: %v", err))
+	}
+	level := r.transactionLevelOn(c)
+	defer func() {
+		if err := recover(); err != nil {
+			if r.transactionLevelOn(c) == level {
+				r.rollbackTransactionOn(c)
+			}
+			panic(err)
+		}
+	}()
+	fn()
+	if err := r.commitTransactionOn(c); err != nil {
+		panic(fmt.Sprintf("GranDB Error en commit: %v", err))
+	}
+}
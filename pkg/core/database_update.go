@@ -8,11 +8,13 @@ import (
 // executeUpdateMethod handles update operations for GranMySQL/GranDB
 // Usage: $model.where("id", 1).update({"name": "Jane", "email": "jane@example.com"})
 func (r *Runtime) executeUpdateMethod(instance *Instance, args []interface{}) interface{} {
-	if r.GetDB() == nil {
+	conn := r.builderConnection(instance)
+	if conn.db == nil {
 		panic("GranMySQL Error: No hay conexión a la base de datos configurada")
 	}
 
-	// Get table and where conditions
+	// Get table and where conditions (global scopes / soft deletes included)
+	r.applyScopes(instance)
 	table := r.getTable(instance)
 	wheres := instance.Fields["_wheres"].([]string)
 	bindings := instance.Fields["_bindings"].([]interface{})
@@ -36,9 +38,7 @@ func (r *Runtime) executeUpdateMethod(instance *Instance, args []interface{}) in
 	}
 
 	// Auto-update timestamp if not present
-	if _, hasUpdatedAt := data["updated_at"]; !hasUpdatedAt {
-		data["updated_at"] = "CURRENT_TIMESTAMP"
-	}
+	touchTimestamps(instance, data, false)
 
 	// Build SET clause
 	setClauses := []string{}
@@ -59,7 +59,7 @@ func (r *Runtime) executeUpdateMethod(instance *Instance, args []interface{}) in
 
 	// Add WHERE clause if present
 	if len(wheres) > 0 {
-		query += " WHERE " + strings.Join(wheres, " AND ")
+		query += " WHERE " + compileWheres(wheres)
 		// Append where bindings after update bindings
 		updateBindings = append(updateBindings, bindings...)
 	} else {
@@ -72,9 +72,10 @@ func (r *Runtime) executeUpdateMethod(instance *Instance, args []interface{}) in
 	// Reset state before execution
 	instance.Fields["_wheres"] = []string{}
 	instance.Fields["_bindings"] = []interface{}{}
+	resetScopes(instance)
 
 	// Execute query
-	result, err := r.GetDB().Exec(query, updateBindings...)
+	result, err := r.connExec(conn).Exec(query, updateBindings...)
 	if err != nil {
 		panic(fmt.Sprintf("GranMySQL Error en update: %v", err))
 	}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// DebugToolbar renders the query toolbar injected at the bottom of HTML
+// responses when DEBUG_TOOLBAR is on (never in production)
+func (r *Runtime) DebugToolbar(label string, entries []QueryEntry, elapsed time.Duration) string {
+	var total time.Duration
+	for _, e := range entries {
+		total += e.Duration
+	}
+	slow := slowQueryThreshold(r.Env)
+	showBindings := envFlag(r.Env, "DEBUG_TOOLBAR_BINDINGS")
+	threshold := nPlusOneThreshold(r.Env)
+	if threshold == 0 {
+		threshold = 5
+	}
+	repeated := DetectNPlusOne(entries, threshold)
+	repeatedShapes := make(map[string]bool, len(repeated))
+	for _, w := range repeated {
+		repeatedShapes[w.SQL] = true
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<div id="joss-debugbar" style="position:fixed;left:0;right:0;bottom:0;z-index:2147483647;font:12px/1.4 monospace;background:#1e1e2e;color:#cdd6f4;box-shadow:0 -2px 8px rgba(0,0,0,.3)">`)
+	sb.WriteString(`<div onclick="var p=document.getElementById('joss-debugbar-panel');p.style.display=p.style.display==='none'?'block':'none'" style="cursor:pointer;padding:4px 10px;display:flex;gap:16px">`)
+	fmt.Fprintf(&sb, `<strong style="color:#89b4fa">JOSS</strong><span>%s</span><span>%s</span><span>%d consultas · %s</span>`,
+		html.EscapeString(label), formatDuration(elapsed), len(entries), formatDuration(total))
+	if len(repeated) > 0 {
+		fmt.Fprintf(&sb, `<span style="color:#f9e2af">⚠ %d posible(s) N+1</span>`, len(repeated))
+	}
+	sb.WriteString(`</div>`)
+
+	sb.WriteString(`<div id="joss-debugbar-panel" style="display:none;max-height:40vh;overflow:auto;padding:6px 10px;border-top:1px solid #45475a">`)
+	for _, w := range repeated {
+		fmt.Fprintf(&sb, `<div style="color:#f9e2af;margin-bottom:4px">N+1: %d× %s <span style="color:#a6adc8">(%s)</span></div>`,
+			w.Count, html.EscapeString(w.SQL), html.EscapeString(queryLocation(w.File, w.Line)))
+	}
+	sb.WriteString(`<table style="width:100%;border-collapse:collapse">`)
+	for i, e := range entries {
+		color := "#cdd6f4"
+		switch {
+		case e.Error != "":
+			color = "#f38ba8"
+		case slow > 0 && e.Duration >= slow:
+			color = "#fab387"
+		case repeatedShapes[queryShape(e.SQL)]:
+			color = "#f9e2af"
+		}
+		fmt.Fprintf(&sb, `<tr style="border-bottom:1px solid #313244;color:%s;vertical-align:top">`, color)
+		fmt.Fprintf(&sb, `<td style="padding:2px 6px">%d</td><td style="padding:2px 6px;white-space:nowrap">%s</td>`, i+1, formatDuration(e.Duration))
+		fmt.Fprintf(&sb, `<td style="padding:2px 6px;white-space:nowrap;color:#a6adc8">%s</td>`, html.EscapeString(queryLocation(e.File, e.Line)))
+		fmt.Fprintf(&sb, `<td style="padding:2px 6px;word-break:break-all">%s`, html.EscapeString(e.SQL))
+		if len(e.Bindings) > 0 {
+			// Bindings carry passwords, tokens and personal data: the page
+			// shows them only when DEBUG_TOOLBAR_BINDINGS opts in
+			fmt.Fprintf(&sb, ` <span style="color:#a6adc8">%s</span>`, html.EscapeString(formatBindings(e.Bindings, showBindings)))
+		}
+		if e.Error != "" {
+			fmt.Fprintf(&sb, `<br>%s`, html.EscapeString(e.Error))
+		}
+		sb.WriteString(`</td></tr>`)
+	}
+	sb.WriteString(`</table></div></div>`)
+	return sb.String()
+}
+
+// InjectToolbar inserts the toolbar before </body>, or appends it
+func InjectToolbar(page, toolbar string) string {
+	if i := strings.LastIndex(page, "</body>"); i >= 0 {
+		return page[:i] + toolbar + page[i:]
+	}
+	return page + toolbar
+}
@@ -2,11 +2,9 @@ package core
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/jossecurity/joss/pkg/parser"
 )
 
@@ -76,6 +74,13 @@ func (r *Runtime) Dispatch(method, path string, reqData, sessData map[string]int
 
 	// Middleware Execution
 	for _, mw := range middleware {
+		// can:posts.edit requires a permission (see Auth::can)
+		if perm, ok := strings.CutPrefix(mw, "can:"); ok {
+			if res := r.permissionMiddleware(path, perm); res != nil {
+				return res, nil
+			}
+			continue
+		}
 		switch mw {
 		case "auth":
 			// Check if logged in
@@ -85,6 +90,18 @@ func (r *Runtime) Dispatch(method, path string, reqData, sessData map[string]int
 					isLoggedIn = true
 				}
 			}
+			if !isLoggedIn && PendingTwoFactor(r.sessionFields()) {
+				// Password already checked, the second factor is missing
+				return &Instance{
+					Fields: map[string]interface{}{
+						"_type": "REDIRECT",
+						"url":   r.TwoFactorPath(),
+						"flash": map[string]interface{}{
+							"error": "Ingresa tu código de verificación.",
+						},
+					},
+				}, nil
+			}
 			if !isLoggedIn {
 				return &Instance{
 					Fields: map[string]interface{}{
@@ -96,6 +113,16 @@ func (r *Runtime) Dispatch(method, path string, reqData, sessData map[string]int
 					},
 				}, nil
 			}
+		case "2fa":
+			// Only sessions waiting for their 2FA code (the challenge page)
+			if !PendingTwoFactor(r.sessionFields()) {
+				return &Instance{
+					Fields: map[string]interface{}{
+						"_type": "REDIRECT",
+						"url":   "/login",
+					},
+				}, nil
+			}
 		case "guest":
 			// Check if NOT logged in
 			isLoggedIn := false
@@ -161,19 +188,9 @@ func (r *Runtime) Dispatch(method, path string, reqData, sessData map[string]int
 				}}, nil
 			}
 
-			// Verify JWT
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				secret := os.Getenv("JWT_SECRET")
-				if secret == "" {
-					secret = "joss_default_secret_change_in_production"
-				}
-				return []byte(secret), nil
-			})
-
-			if err != nil || !token.Valid {
+			// Verify JWT (not revoked) or personal access token
+			claims, valid := r.authenticateBearer(tokenString)
+			if !valid {
 				return &Instance{Fields: map[string]interface{}{
 					"_type":  "JSON",
 					"status": 401,
@@ -181,19 +198,11 @@ func (r *Runtime) Dispatch(method, path string, reqData, sessData map[string]int
 				}}, nil
 			}
 
-			// Success: Inject user info into request?
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				// Inject into $__user or similar if needed. For now, pass.
-				// Maybe populate $__session with user info for this request context?
-				if sessInst, ok := r.Variables["$__session"].(*Instance); ok {
-					if uid, ok := claims["user_id"].(float64); ok {
-						sessInst.Fields["user_id"] = int(uid)
-					} else {
-						sessInst.Fields["user_id"] = claims["user_id"]
-					}
-					sessInst.Fields["user_email"] = claims["email"]
-					sessInst.Fields["user_name"] = claims["name"]
-				}
+			// Populate $__session with user info for this request context
+			if sessInst, ok := r.Variables["$__session"].(*Instance); ok {
+				sessInst.Fields["user_id"] = claims["user_id"]
+				sessInst.Fields["user_email"] = claims["email"]
+				sessInst.Fields["user_name"] = claims["name"]
 			}
 
 		default:
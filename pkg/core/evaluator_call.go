@@ -27,6 +27,11 @@ func (r *Runtime) CallMethod(method *parser.MethodStatement, instance *Instance,
 		return r.executeNativeMethod(instance, method.Name.Value, evalArgs)
 	}
 
+	if p := activeProfiler.Load(); p != nil || r.queries != nil {
+		r.profileEnter(p, r.profileFrameFor(method, instance))
+		defer r.profileLeave(p)
+	}
+
 	// Save previous "this" if exists (for nested calls)
 	prevThis := r.Variables["this"]
 	r.Variables["this"] = instance
@@ -71,6 +76,11 @@ func (r *Runtime) CallMethodEvaluated(method *parser.MethodStatement, instance *
 		return r.executeNativeMethod(instance, method.Name.Value, args)
 	}
 
+	if p := activeProfiler.Load(); p != nil || r.queries != nil {
+		r.profileEnter(p, r.profileFrameFor(method, instance))
+		defer r.profileLeave(p)
+	}
+
 	// Save previous "this" if exists (for nested calls)
 	prevThis := r.Variables["this"]
 	r.Variables["this"] = instance
@@ -135,6 +145,10 @@ func (r *Runtime) executeCall(call *parser.CallExpression) interface{} {
 
 	if fn == nil {
 		if ident, ok := call.Function.(*parser.Identifier); ok {
+			// Standard library last, so user functions may reuse its names
+			if res, ok := r.callStdlib(ident.Value, args); ok {
+				return res
+			}
 			panic(fmt.Sprintf("Error: Función '%s' no encontrada", ident.Value))
 		}
 		return nil
@@ -159,6 +173,14 @@ func (r *Runtime) applyFunction(fn interface{}, args []interface{}) interface{}
 					Body: &parser.BlockStatement{Statements: []parser.Statement{}},
 				}
 			}
+			if r.isModelClass(classStmt) {
+				// User::find(1), User::where(...): a real model instance (properties + constructor)
+				model := r.newModel(bound.StaticClass)
+				if method := r.findClassMethod(classStmt, bound.Method.Name.Value); method != nil {
+					return r.CallMethodEvaluated(method, model, evalArgs)
+				}
+				return r.executeNativeMethod(model, bound.Method.Name.Value, evalArgs)
+			}
 			dummyInstance := &Instance{
 				Class:  classStmt,
 				Fields: make(map[string]interface{}),
@@ -196,8 +218,22 @@ func (r *Runtime) CallFunction(fn interface{}, args []interface{}) interface{} {
 	return r.applyFunction(fn, args)
 }
 
+// NewInstance creates an instance of a user class (properties + constructor), like `new Class()`
+func (r *Runtime) NewInstance(className string) *Instance {
+	inst, _ := r.evaluateNew(&parser.NewExpression{Class: &parser.Identifier{Value: className}}).(*Instance)
+	return inst
+}
+
 func (r *Runtime) callBuiltin(name string, args []interface{}) (interface{}, bool) {
 	switch name {
+	case "__coverage_hit":
+		// Emitted by compileViewToJOSS while coverage is active
+		if c := activeCoverage.Load(); c != nil && len(args) >= 2 {
+			if file, ok := args[0].(string); ok {
+				c.HitLine(file, toInt(args[1]))
+			}
+		}
+		return nil, true
 	case "html_escape":
 		if len(args) > 0 {
 			return html.EscapeString(fmt.Sprintf("%v", args[0])), true
@@ -221,6 +257,12 @@ func (r *Runtime) callBuiltin(name string, args []interface{}) (interface{}, boo
 			}
 		}
 		return fmt.Sprintf(`<input type="hidden" name="_token" value="%s">`, tokenVal), true
+	case "pagination_links":
+		// Emitted by the @pagination directive
+		if len(args) > 0 {
+			return r.paginationLinks(args[0]), true
+		}
+		return "", true
 	case "print", "echo":
 		for _, arg := range args {
 			fmt.Println(arg)
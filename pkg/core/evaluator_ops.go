@@ -130,6 +130,13 @@ func (r *Runtime) evaluateIndex(ie *parser.IndexExpression) interface{} {
 		return nil
 	}
 
+	// Models expose their columns by key too, so $row["name"] keeps working
+	if inst, ok := left.(*Instance); ok && inst != nil && isModel(inst) {
+		if key, ok := index.(string); ok {
+			return inst.Fields[key]
+		}
+	}
+
 	if str, ok := left.(string); ok {
 		if idx, ok := index.(int64); ok {
 			if idx >= 0 && idx < int64(len(str)) {
@@ -258,6 +265,9 @@ func (r *Runtime) evaluateInfix(ie *parser.InfixExpression) interface{} {
 			if res, ok := r.callBuiltin(fnName, []interface{}{left}); ok {
 				return res
 			}
+			if res, ok := r.callStdlib(fnName, []interface{}{left}); ok {
+				return res
+			}
 			fmt.Printf("Error: Función '%s' no encontrada para pipe\n", fnName)
 			return nil
 
@@ -281,6 +291,9 @@ func (r *Runtime) evaluateInfix(ie *parser.InfixExpression) interface{} {
 					if res, ok := r.callBuiltin(ident.Value, args); ok {
 						return res
 					}
+					if res, ok := r.callStdlib(ident.Value, args); ok {
+						return res
+					}
 					fmt.Printf("Error: Función '%s' no encontrada en pipe call\n", ident.Value)
 					return nil
 				}
@@ -403,6 +416,11 @@ func (r *Runtime) evaluateInfix(ie *parser.InfixExpression) interface{} {
 		}
 	}
 
+	// Date comparisons (Date vs Date or Date vs date string)
+	if res, ok := compareDates(ie.Operator, left, right); ok {
+		return res
+	}
+
 	lStr := ""
 	rStr := ""
 	if left != nil {
@@ -711,7 +729,7 @@ func (r *Runtime) evaluatePostfix(pe *parser.PostfixExpression) interface{} {
 
 func isNativeClass(name string) bool {
 	switch name {
-	case "Session", "Math", "Auth", "View", "Request", "Response", "Redirect", "Log", "System", "Router", "Security", "Server", "GranDB", "GranMySQL", "Stack", "Queue", "SmtpClient", "Cron", "Task", "WebSocket", "Redis":
+	case "Session", "Math", "Auth", "View", "Request", "Response", "Redirect", "Log", "System", "Router", "Security", "Server", "GranDB", "GranMySQL", "Stack", "Queue", "SmtpClient", "Cron", "Task", "WebSocket", "Redis", "Date", "Carbon":
 		return true
 	}
 	return false
@@ -50,6 +50,11 @@ func (r *Runtime) checkType(val interface{}, typeName string) bool {
 		_, ok := val.(*Instance)
 		return ok
 	default:
+		// Date and Carbon name the same class
+		if typeName == "Date" || typeName == "Carbon" {
+			_, ok := dateValue(val)
+			return ok
+		}
 		// Check for specific class instance
 		if inst, ok := val.(*Instance); ok {
 			curr := inst.Class
@@ -3,6 +3,8 @@ package core
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jossecurity/joss/pkg/parser"
 )
@@ -99,7 +101,45 @@ func (r *Runtime) registerClass(stmt *parser.ClassStatement) {
 	r.Classes[stmt.Name.Value] = stmt
 }
 
+// LoadClassDirs registers the classes (and functions) defined in the .joss
+// files under dirs, without running any code. Used by the CLI and the test
+// runner to make models, factories and seeders available.
+func (r *Runtime) LoadClassDirs(dirs ...string) {
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".joss") {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			p := parser.NewParser(parser.NewLexer(string(data)))
+			program := p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				fmt.Printf("Error de parseo en %s: %s\n", path, strings.Join(p.Errors(), "; "))
+				return nil
+			}
+			for _, stmt := range program.Statements {
+				switch s := stmt.(type) {
+				case *parser.ClassStatement:
+					r.registerClass(s)
+				case *parser.MethodStatement:
+					r.Functions[s.Name.Value] = s
+				}
+			}
+			return nil
+		})
+	}
+}
+
 func (r *Runtime) executeStatement(stmt parser.Statement) interface{} {
+	if r.profile != nil {
+		r.profileLine(stmt)
+	}
+	if c := activeCoverage.Load(); c != nil {
+		c.hit(stmt)
+	}
 	switch s := stmt.(type) {
 	case *parser.LetStatement:
 		var val interface{}
@@ -215,6 +255,8 @@ func (r *Runtime) executeImport(stmt *parser.ImportStatement) interface{} {
 		return nil
 	}
 
+	RegisterSource(program, filename)
+
 	// Execute imported program in current runtime (shared scope)
 	for _, s := range program.Statements {
 		r.executeStatement(s)
@@ -262,6 +304,10 @@ func (r *Runtime) executeForeach(fs *parser.ForeachStatement) interface{} {
 				break
 			}
 		}
+	} else if cursor, ok := iterable.(*QueryCursor); ok {
+		cursor.Each(func(item interface{}) bool {
+			return !executeIter(item)
+		})
 	} else {
 		fmt.Printf("Error: Foreach espera un array o canal, se obtuvo: %T\n", iterable)
 	}
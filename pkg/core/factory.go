@@ -0,0 +1,257 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jossecurity/joss/pkg/parser"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Factories build models (or rows of a table) from fake data:
+//
+//	class PostFactory extends Factory {
+//	    Init constructor() { $this->model = "Post" }   // default: class name without "Factory"
+//	    func definition() { return {"title": Faker::sentence(), "user_id": func() { return User::factory()->create()->id }} }
+//	    func draft() { return $this->state({"status": "draft"}) }
+//	}
+//
+//	Post::factory()->count(10)->create()
+//	Post::factory()->draft()->make({"title": "Hola"})   // not saved
+//	Factory::users(5)->admin()->create()               // Auth users (password "password")
+//
+// Factories without model write to $this->tabla. Closures in the attributes
+// are called with the attributes built so far.
+
+const factoriesDir = "app/database/factories"
+
+var factoryMethods = []string{"users", "count", "state", "sequence", "role", "admin", "unverified", "raw", "make", "create"}
+
+// modelFactory handles Model::factory([count])
+func (r *Runtime) modelFactory(model *Instance, args []interface{}) *Instance {
+	modelName := model.Class.Name.Value
+	name := modelName + "Factory"
+	// Factories are loaded at boot (server, joss test, db:seed); r.Classes is
+	// shared between requests, so it is never written here
+	if _, ok := r.Classes[name]; !ok {
+		panic(fmt.Sprintf("Factory Error: no existe %s (crea %s/%s.joss con `joss make:factory %s`)", name, factoriesDir, name, modelName))
+	}
+	factory := r.NewInstance(name)
+	if model, _ := factory.Fields["model"].(string); model == "" {
+		factory.Fields["model"] = modelName
+	}
+	if len(args) > 0 {
+		factory.Fields["_count"] = int(fakerArgInt(args, 0, 1))
+	}
+	return factory
+}
+
+func (r *Runtime) executeFactoryMethod(instance *Instance, method string, args []interface{}) interface{} {
+	switch method {
+	case "users":
+		// Factory::users([count]): users of the Auth tables
+		prefix := "js_"
+		if val, ok := r.Env["PREFIX"]; ok {
+			prefix = val
+		}
+		r.ensureAuthTables(prefix+"users", prefix+"roles", prefix)
+		factory := &Instance{Class: instance.Class, Fields: map[string]interface{}{
+			"tabla": prefix + "users",
+			"_auth": true,
+		}}
+		if len(args) > 0 {
+			factory.Fields["_count"] = int(fakerArgInt(args, 0, 1))
+		}
+		return factory
+
+	case "count":
+		instance.Fields["_count"] = int(fakerArgInt(args, 0, 1))
+		return instance
+
+	case "state":
+		if len(args) > 0 {
+			if state, ok := args[0].(map[string]interface{}); ok {
+				states, _ := instance.Fields["_states"].([]map[string]interface{})
+				instance.Fields["_states"] = append(states, state)
+			}
+		}
+		return instance
+
+	case "sequence":
+		// sequence({"role_id": 1}, {"role_id": 2}): one state per item, cycling
+		instance.Fields["_sequence"] = args
+		return instance
+
+	case "role":
+		if len(args) > 0 {
+			return r.executeFactoryMethod(instance, "state", []interface{}{map[string]interface{}{"role_id": r.roleID(args[0])}})
+		}
+		return instance
+	case "admin":
+		return r.executeFactoryMethod(instance, "role", []interface{}{"admin"})
+	case "unverified":
+		return r.executeFactoryMethod(instance, "state", []interface{}{map[string]interface{}{"verificado": int64(0)}})
+
+	case "raw", "make", "create":
+		var overrides map[string]interface{}
+		if len(args) > 0 {
+			overrides, _ = args[0].(map[string]interface{})
+		}
+		count, many := instance.Fields["_count"].(int)
+		if !many {
+			count = 1
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			attrs := r.factoryAttributes(instance, i, overrides)
+			if method == "raw" {
+				items = append(items, attrs)
+			} else {
+				items = append(items, r.factoryItem(instance, attrs, method == "create"))
+			}
+		}
+		if !many {
+			return items[0]
+		}
+		return items
+	}
+	return nil
+}
+
+// roleID resolves a role name of the Auth roles table (ids pass through)
+func (r *Runtime) roleID(role interface{}) interface{} {
+	name, ok := role.(string)
+	if !ok {
+		return role
+	}
+	prefix := "js_"
+	if val, ok := r.Env["PREFIX"]; ok {
+		prefix = val
+	}
+	var id int64
+	err := r.Conn().QueryRow(fmt.Sprintf("SELECT id FROM %sroles WHERE name = ?", prefix), name).Scan(&id)
+	if err != nil {
+		panic(fmt.Sprintf("Factory Error: el rol '%s' no existe", name))
+	}
+	return id
+}
+
+// factoryAttributes builds the attributes of item i: definition(), states,
+// sequence and overrides, in that order
+func (r *Runtime) factoryAttributes(factory *Instance, i int, overrides map[string]interface{}) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	if auth, _ := factory.Fields["_auth"].(bool); auth {
+		attrs = authUserDefinition()
+	} else if method := r.findClassMethod(factory.Class, "definition"); method != nil {
+		def, ok := r.CallMethodEvaluated(method, factory, nil).(map[string]interface{})
+		if !ok {
+			panic(fmt.Sprintf("Factory Error: %s::definition() debe retornar un mapa", factory.Class.Name.Value))
+		}
+		for k, v := range def {
+			attrs[k] = v
+		}
+	} else {
+		panic(fmt.Sprintf("Factory Error: %s no define definition()", factory.Class.Name.Value))
+	}
+
+	states, _ := factory.Fields["_states"].([]map[string]interface{})
+	if seq, _ := factory.Fields["_sequence"].([]interface{}); len(seq) > 0 {
+		if state, ok := seq[i%len(seq)].(map[string]interface{}); ok {
+			states = append(states, state)
+		}
+	}
+	for _, state := range append(states, overrides) {
+		for k, v := range state {
+			attrs[k] = v
+		}
+	}
+
+	// Lazy attributes: "user_id": func() { return User::factory()->create()->id }
+	for k, v := range attrs {
+		if fn, ok := v.(*parser.FunctionLiteral); ok {
+			attrs[k] = r.applyFunction(fn, []interface{}{attrs})
+		}
+	}
+	return attrs
+}
+
+// factoryItem turns attributes into a model (saved when persist) or, for
+// table factories, inserts the row and returns it as a map with its id
+func (r *Runtime) factoryItem(factory *Instance, attrs map[string]interface{}, persist bool) interface{} {
+	if modelName, _ := factory.Fields["model"].(string); modelName != "" {
+		model := r.newModel(modelName)
+		// Factories set every attribute, fillable or not
+		for k, v := range attrs {
+			if !strings.HasPrefix(k, "_") && !modelConfigFields[k] {
+				model.Fields[k] = v
+			}
+		}
+		if persist {
+			r.saveModel(model)
+		}
+		return model
+	}
+
+	table, _ := factory.Fields["tabla"].(string)
+	if table == "" {
+		panic(fmt.Sprintf("Factory Error: %s necesita $this->model o $this->tabla", factory.Class.Name.Value))
+	}
+	data := make(map[string]interface{}, len(attrs)+3)
+	for k, v := range attrs {
+		data[k] = v
+	}
+	if auth, _ := factory.Fields["_auth"].(bool); auth {
+		data["password"] = factoryPassword(factory, data["password"])
+	}
+	if !persist {
+		return data
+	}
+	if usesTimestamps(factory) {
+		stampColumns(data, true, Now().Format("2006-01-02 15:04:05"))
+	}
+	if id := r.insertGetId(r.ownConnection(), r.schemaTable(table), data); id != nil {
+		data["id"] = id
+	}
+	return data
+}
+
+// factoryPassword hashes a plain password like Auth::create, reusing the hash
+// for repeated passwords so seeding many users stays fast
+func factoryPassword(factory *Instance, val interface{}) interface{} {
+	plain, ok := val.(string)
+	if !ok || strings.HasPrefix(plain, "$2") {
+		return val
+	}
+	hashes, _ := factory.Fields["_hashes"].(map[string]string)
+	if hashes == nil {
+		hashes = make(map[string]string)
+		factory.Fields["_hashes"] = hashes
+	}
+	if hash, ok := hashes[plain]; ok {
+		return hash
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("Factory Error: no se pudo encriptar la contraseña: %v", err))
+	}
+	hashes[plain] = string(hashed)
+	return string(hashed)
+}
+
+// authUserDefinition is the definition of Factory::users(): a verified client
+// that can log in with Auth::attempt(email, "password")
+func authUserDefinition() map[string]interface{} {
+	first, last := fakePick(fakeFirstNames), fakePick(fakeLastNames)
+	return map[string]interface{}{
+		"user_token": uuid.New().String(),
+		"username":   fakeUnique("userName", nil),
+		"first_name": first,
+		"last_name":  last,
+		"email":      fakeUnique("email", nil),
+		"phone":      fakeValue("phone", nil),
+		"password":   "password",
+		"role_id":    int64(2),
+		"verificado": int64(1),
+	}
+}
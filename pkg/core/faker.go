@@ -0,0 +1,330 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Faker: random data for seeders, factories and tests (Spanish locale).
+//
+//	Faker::name()                     "Lucía Herrera"
+//	Faker::unique()->email()          never repeats within the process
+//	Faker::numberBetween(1, 10)
+//	Faker::dateTimeBetween("-1 year") Date
+//	Faker::seed(42)                   reproducible sequences
+
+var fakerMethods = []string{
+	"seed", "unique",
+	// Person
+	"name", "firstName", "lastName", "userName", "email", "safeEmail", "phone", "phoneNumber", "password",
+	// Company and address
+	"company", "address", "streetAddress", "city", "country", "postcode", "url", "ipv4", "hexColor", "uuid",
+	// Text
+	"word", "words", "sentence", "paragraph", "text", "slug",
+	// Numbers and choices
+	"numberBetween", "randomNumber", "randomFloat", "boolean", "randomElement",
+	// Dates
+	"date", "dateTime", "dateTimeBetween",
+}
+
+var (
+	fakerMu     sync.Mutex
+	fakerRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	fakerUnique = map[string]bool{}
+)
+
+var (
+	fakeFirstNames = []string{"Ana", "Luis", "María", "José", "Carlos", "Sofía", "Valentina", "Diego", "Camila", "Jorge",
+		"Lucía", "Miguel", "Fernanda", "Alejandro", "Daniela", "Javier", "Paula", "Andrés", "Gabriela", "Ricardo",
+		"Mariana", "Fernando", "Isabel", "Raúl", "Elena", "Sergio", "Carmen", "Pablo", "Laura", "Héctor",
+		"Natalia", "Emilio", "Renata", "Tomás", "Ximena", "Hugo", "Regina", "Iván", "Valeria", "Mateo"}
+	fakeLastNames = []string{"García", "Hernández", "López", "Martínez", "González", "Pérez", "Rodríguez", "Sánchez",
+		"Ramírez", "Torres", "Flores", "Rivera", "Gómez", "Díaz", "Cruz", "Morales", "Reyes", "Jiménez", "Ruiz",
+		"Vargas", "Castillo", "Ortiz", "Mendoza", "Romero", "Navarro", "Aguilar", "Herrera", "Medina", "Castro", "Vega"}
+	fakeCities    = []string{"Ciudad de México", "Guadalajara", "Monterrey", "Puebla", "Querétaro", "Mérida", "Bogotá", "Medellín", "Lima", "Santiago", "Buenos Aires", "Madrid", "Barcelona", "Valencia", "Quito", "Montevideo"}
+	fakeCountries = []string{"México", "Colombia", "Perú", "Chile", "Argentina", "España", "Ecuador", "Uruguay", "Guatemala", "Costa Rica", "Bolivia", "Paraguay"}
+	fakeStreets   = []string{"Av. Reforma", "Calle Hidalgo", "Av. Juárez", "Calle Morelos", "Av. Insurgentes", "Calle Zaragoza", "Av. Libertad", "Calle Independencia", "Av. Universidad", "Calle Allende"}
+	fakeCompanies = []string{"S.A. de C.V.", "S.L.", "y Asociados", "Grupo", "Soluciones", "Consultores"}
+	fakeDomains   = []string{"example.com", "example.org", "example.net"}
+	fakeWords     = strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat nulla pariatur excepteur sint occaecat cupidatat non proident sunt culpa qui officia deserunt mollit anim id est laborum")
+
+	fakeAccents   = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "ü", "u", "Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ñ", "N")
+	fakeRelative  = regexp.MustCompile(`^([+-]?\d+)\s*(second|minute|hour|day|week|month|year)s?$`)
+	fakeSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+func fakeIntn(n int) int {
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+	return fakerRand.Intn(n)
+}
+
+func fakePick(list []string) string {
+	return list[fakeIntn(len(list))]
+}
+
+func fakeNumber(min, max int64) int64 {
+	if max < min {
+		min, max = max, min
+	}
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+	return min + fakerRand.Int63n(max-min+1)
+}
+
+func fakeDigits(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteByte(byte('0' + fakeIntn(10)))
+	}
+	return sb.String()
+}
+
+// fakeASCII lowercases and strips accents, for emails and user names
+func fakeASCII(s string) string {
+	return strings.ToLower(strings.ReplaceAll(fakeAccents.Replace(s), " ", ""))
+}
+
+func fakeWordList(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fakePick(fakeWords)
+	}
+	return words
+}
+
+func fakeSentence(words int) string {
+	s := strings.Join(fakeWordList(words), " ")
+	return upperFirst(s) + "."
+}
+
+func fakeParagraph(sentences int) string {
+	parts := make([]string, sentences)
+	for i := range parts {
+		parts[i] = fakeSentence(4 + fakeIntn(8))
+	}
+	return strings.Join(parts, " ")
+}
+
+// fakeTime parses dateTimeBetween bounds: Date, "2024-01-31", "now" or "-1 year"
+func fakeTime(val interface{}) time.Time {
+	if s, ok := val.(string); ok {
+		if m := fakeRelative.FindStringSubmatch(strings.TrimSpace(s)); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			now := Now()
+			switch m[2] {
+			case "second":
+				return now.Add(time.Duration(n) * time.Second)
+			case "minute":
+				return now.Add(time.Duration(n) * time.Minute)
+			case "hour":
+				return now.Add(time.Duration(n) * time.Hour)
+			case "day":
+				return now.AddDate(0, 0, n)
+			case "week":
+				return now.AddDate(0, 0, 7*n)
+			case "month":
+				return now.AddDate(0, n, 0)
+			case "year":
+				return now.AddDate(n, 0, 0)
+			}
+		}
+	}
+	t, ok := toDate(val)
+	if !ok {
+		panic(fmt.Sprintf("Faker Error: fecha no reconocida '%v'", val))
+	}
+	return t
+}
+
+func fakeDateBetween(start, end time.Time) time.Time {
+	if end.Before(start) {
+		start, end = end, start
+	}
+	span := end.Unix() - start.Unix()
+	return time.Unix(start.Unix()+fakeNumber(0, span), 0).In(dateLocation)
+}
+
+func fakerArgInt(args []interface{}, i int, def int64) int64 {
+	if i < len(args) {
+		switch v := args[i].(type) {
+		case int64:
+			return v
+		case int:
+			return int64(v)
+		case float64:
+			return int64(v)
+		}
+	}
+	return def
+}
+
+func fakerArgFloat(args []interface{}, i int, def float64) float64 {
+	if i < len(args) {
+		switch v := args[i].(type) {
+		case int64:
+			return float64(v)
+		case float64:
+			return v
+		}
+	}
+	return def
+}
+
+func (r *Runtime) executeFakerMethod(instance *Instance, method string, args []interface{}) interface{} {
+	switch method {
+	case "seed":
+		fakerMu.Lock()
+		fakerRand = rand.New(rand.NewSource(fakerArgInt(args, 0, time.Now().UnixNano())))
+		fakerMu.Unlock()
+		return nil
+
+	case "unique":
+		// Faker::unique()->email(); Faker::unique(true) forgets the values seen
+		if len(args) > 0 && isTruthy(args[0]) {
+			fakerMu.Lock()
+			fakerUnique = map[string]bool{}
+			fakerMu.Unlock()
+		}
+		return &Instance{Class: instance.Class, Fields: map[string]interface{}{"_unique": true}}
+	}
+
+	if unique, _ := instance.Fields["_unique"].(bool); unique {
+		return fakeUnique(method, args)
+	}
+	return fakeValue(method, args)
+}
+
+// fakeUnique returns a value of method not returned before by a unique() call
+func fakeUnique(method string, args []interface{}) interface{} {
+	for i := 0; i < 10000; i++ {
+		val := fakeValue(method, args)
+		key := method + ":" + fmt.Sprintf("%v", val)
+		fakerMu.Lock()
+		seen := fakerUnique[key]
+		fakerUnique[key] = true
+		fakerMu.Unlock()
+		if !seen {
+			return val
+		}
+	}
+	panic(fmt.Sprintf("Faker Error: no quedan valores únicos para %s()", method))
+}
+
+func fakeValue(method string, args []interface{}) interface{} {
+	switch method {
+	case "firstName":
+		return fakePick(fakeFirstNames)
+	case "lastName":
+		return fakePick(fakeLastNames)
+	case "name":
+		return fakePick(fakeFirstNames) + " " + fakePick(fakeLastNames)
+	case "userName":
+		return fakeASCII(fakePick(fakeFirstNames)) + "." + fakeASCII(fakePick(fakeLastNames)) + fakeDigits(2)
+	case "email", "safeEmail":
+		return fakeASCII(fakePick(fakeFirstNames)) + "." + fakeASCII(fakePick(fakeLastNames)) + fakeDigits(3) + "@" + fakePick(fakeDomains)
+	case "phone", "phoneNumber":
+		return "55 " + fakeDigits(4) + " " + fakeDigits(4)
+	case "password":
+		return fmt.Sprintf("%s%s!%s", upperFirst(fakePick(fakeWords)), fakeDigits(4), fakePick(fakeWords))
+
+	case "company":
+		return fakePick(fakeLastNames) + " " + fakePick(fakeCompanies)
+	case "streetAddress":
+		return fmt.Sprintf("%s %d", fakePick(fakeStreets), fakeNumber(1, 999))
+	case "address":
+		return fmt.Sprintf("%s %d, %s, %s", fakePick(fakeStreets), fakeNumber(1, 999), fakePick(fakeCities), fakePick(fakeCountries))
+	case "city":
+		return fakePick(fakeCities)
+	case "country":
+		return fakePick(fakeCountries)
+	case "postcode":
+		return fakeDigits(5)
+	case "url":
+		return "https://www." + fakePick(fakeWords) + fakePick(fakeWords) + "." + strings.TrimPrefix(fakePick(fakeDomains), "example.")
+	case "ipv4":
+		return fmt.Sprintf("%d.%d.%d.%d", fakeNumber(1, 223), fakeNumber(0, 255), fakeNumber(0, 255), fakeNumber(1, 254))
+	case "hexColor":
+		return fmt.Sprintf("#%06x", fakeNumber(0, 0xffffff))
+	case "uuid":
+		return uuid.New().String()
+
+	case "word":
+		return fakePick(fakeWords)
+	case "words":
+		return strings.Join(fakeWordList(int(fakerArgInt(args, 0, 3))), " ")
+	case "sentence":
+		return fakeSentence(int(fakerArgInt(args, 0, 6)))
+	case "paragraph":
+		return fakeParagraph(int(fakerArgInt(args, 0, 3)))
+	case "text":
+		// text(maxChars): paragraphs cut at a word boundary
+		max := int(fakerArgInt(args, 0, 200))
+		text := fakeParagraph(1 + max/80)
+		if len(text) > max {
+			text = text[:max]
+			if i := strings.LastIndex(text, " "); i > 0 {
+				text = text[:i]
+			}
+			text = strings.TrimRight(text, ".") + "."
+		}
+		return text
+	case "slug":
+		words := fakeWordList(int(fakerArgInt(args, 0, 3)))
+		return fakeSlugChars.ReplaceAllString(strings.Join(words, "-"), "-")
+
+	case "numberBetween":
+		return fakeNumber(fakerArgInt(args, 0, 0), fakerArgInt(args, 1, math.MaxInt32))
+	case "randomNumber":
+		digits := fakerArgInt(args, 0, 6)
+		return fakeNumber(0, int64(math.Pow10(int(digits)))-1)
+	case "randomFloat":
+		decimals := fakerArgInt(args, 0, 2)
+		min, max := fakerArgFloat(args, 1, 0), fakerArgFloat(args, 2, 1000)
+		fakerMu.Lock()
+		val := min + fakerRand.Float64()*(max-min)
+		fakerMu.Unlock()
+		scale := math.Pow10(int(decimals))
+		return math.Round(val*scale) / scale
+	case "boolean":
+		// boolean(chanceOfTrue = 50)
+		return fakeNumber(1, 100) <= fakerArgInt(args, 0, 50)
+	case "randomElement":
+		if len(args) > 0 {
+			if list, ok := args[0].([]interface{}); ok && len(list) > 0 {
+				return list[fakeIntn(len(list))]
+			}
+		}
+		return nil
+
+	case "date":
+		layout := "Y-m-d"
+		if len(args) > 0 {
+			if s, ok := args[0].(string); ok {
+				layout = s
+			}
+		}
+		t := fakeDateBetween(Now().AddDate(-30, 0, 0), Now())
+		return formatDate(t, layout, lookupDateLocale(""))
+	case "dateTime":
+		return NewDate(fakeDateBetween(Now().AddDate(-30, 0, 0), Now()))
+	case "dateTimeBetween":
+		var start, end interface{} = "-30 years", "now"
+		if len(args) > 0 {
+			start = args[0]
+		}
+		if len(args) > 1 {
+			end = args[1]
+		}
+		return NewDate(fakeDateBetween(fakeTime(start), fakeTime(end)))
+	}
+	panic(fmt.Sprintf("Faker Error: método '%s' no existe", method))
+}
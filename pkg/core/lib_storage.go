@@ -199,6 +199,12 @@ func (r *Runtime) getOCIClient() (objectstorage.ObjectStorageClient, context.Con
 }
 
 func (r *Runtime) ociPut(userToken, fileName, content string) bool {
+	return r.ociPutReader(userToken, fileName, strings.NewReader(content), int64(len(content)))
+}
+
+// ociPutReader uploads size bytes read from body, so large files are
+// streamed instead of loaded in memory
+func (r *Runtime) ociPutReader(userToken, fileName string, body io.Reader, size int64) bool {
 	fmt.Println("[OCI Debug] Initializing Client...")
 	client, ctx, err := r.getOCIClient()
 	if err != nil {
@@ -218,11 +224,11 @@ func (r *Runtime) ociPut(userToken, fileName, content string) bool {
 		NamespaceName: &namespace,
 		BucketName:    &bucketName,
 		ObjectName:    &objectName,
-		PutObjectBody: io.NopCloser(strings.NewReader(content)),
-		ContentLength: common.Int64(int64(len(content))),
+		PutObjectBody: io.NopCloser(body),
+		ContentLength: common.Int64(size),
 	}
 
-	fmt.Printf("[OCI Debug] Uploading %s (%d bytes)...\n", objectName, len(content))
+	fmt.Printf("[OCI Debug] Uploading %s (%d bytes)...\n", objectName, size)
 	_, err = client.PutObject(ctx, req)
 	if err != nil {
 		fmt.Printf("[OCI Error] PutObject: %v\n", err)
@@ -343,6 +349,40 @@ func (r *Runtime) ociDelete(userToken, fileName string) bool {
 	return err == nil
 }
 
+// ociList returns the object names of the bucket under prefix
+func (r *Runtime) ociList(prefix string) ([]string, error) {
+	client, ctx, err := r.getOCIClient()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := r.Env["OCI_NAMESPACE"]
+	bucketName := r.Env["OCI_BUCKET_NAME"]
+
+	var names []string
+	var start *string
+	for {
+		req := objectstorage.ListObjectsRequest{
+			NamespaceName: &namespace,
+			BucketName:    &bucketName,
+			Prefix:        &prefix,
+			Start:         start,
+			Limit:         common.Int(1000),
+		}
+		resp, err := client.ListObjects(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.ListObjects.Objects {
+			names = append(names, *item.Name)
+		}
+		if resp.ListObjects.NextStartWith == nil {
+			return names, nil
+		}
+		start = resp.ListObjects.NextStartWith
+	}
+}
+
 // Helper to get User ID
 func (r *Runtime) getUserIdFromToken(usersTable, token string) int {
 	if r.GetDB() == nil {
@@ -372,7 +412,9 @@ func (r *Runtime) ensureStorageTable(tableName string) {
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`, tableName)
 
-	if val, ok := r.Env["DB"]; ok && val == "mysql" {
+	if r.DBDriver() == "postgres" {
+		createCtx = postgresDDL(createCtx)
+	} else if r.DBDriver() == "mysql" {
 		createCtx = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			user_id INT NOT NULL,
@@ -33,6 +33,28 @@ func InitLogger() {
 	})
 }
 
+// SetLogFile points the global logger at path instead of log.txt, closing
+// the previous file. Tests use it to keep the log out of the source tree.
+func SetLogFile(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// InitLogger must not replace it afterwards
+	loggerOnce.Do(func() {})
+	if GlobalLogger == nil {
+		GlobalLogger = &Logger{file: f}
+		return nil
+	}
+	GlobalLogger.mu.Lock()
+	defer GlobalLogger.mu.Unlock()
+	if GlobalLogger.file != nil {
+		GlobalLogger.file.Close()
+	}
+	GlobalLogger.file = f
+	return nil
+}
+
 // LogError writes an error message to log.txt and stdout
 func LogError(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
@@ -67,6 +89,23 @@ func LogInfo(format string, args ...interface{}) {
 	}
 }
 
+// LogWarning writes a warning message to log.txt and stdout
+func LogWarning(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	logMsg := fmt.Sprintf("[%s] [WARN] %s\n", timestamp, msg)
+
+	// Write to Stdout
+	fmt.Print(logMsg)
+
+	// Write to File
+	if GlobalLogger != nil && GlobalLogger.file != nil {
+		GlobalLogger.mu.Lock()
+		defer GlobalLogger.mu.Unlock()
+		GlobalLogger.file.WriteString(logMsg)
+	}
+}
+
 // CloseLogger closes the log file
 func CloseLogger() {
 	if GlobalLogger != nil && GlobalLogger.file != nil {
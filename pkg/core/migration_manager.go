@@ -26,12 +26,11 @@ func (r *Runtime) EnsureMigrationTable() {
 	);
 	`, tableName)
 
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := r.DBDriver()
 
-	if dbDriver == "mysql" {
+	if dbDriver == "postgres" {
+		query = postgresDDL(query)
+	} else if dbDriver == "mysql" {
 		query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			id INT AUTO_INCREMENT PRIMARY KEY,
@@ -111,22 +110,145 @@ func (r *Runtime) LogMigration(migration string, batch int) {
 	}
 	tableName := prefix + "migration"
 
-	_, err := r.GetDB().Exec(fmt.Sprintf("INSERT INTO %s (migration, batch) VALUES (?, ?)", tableName), migration, batch)
+	// Conn: inside the migration's transaction when there is one
+	_, err := r.Conn().Exec(fmt.Sprintf("INSERT INTO %s (migration, batch) VALUES (?, ?)", tableName), migration, batch)
 	if err != nil {
 		fmt.Printf("[Migration] Error registrando migración %s: %v\n", migration, err)
 	}
 }
 
+// MigrationRecord is one row of the migration table
+type MigrationRecord struct {
+	Migration string
+	Batch     int
+}
+
+// GetMigrationRecords returns the executed migrations in the order they ran
+func (r *Runtime) GetMigrationRecords() []MigrationRecord {
+	var records []MigrationRecord
+	if r.GetDB() == nil {
+		return records
+	}
+
+	prefix := "js_"
+	if val, ok := r.Env["PREFIX"]; ok {
+		prefix = val
+	}
+	tableName := prefix + "migration"
+
+	rows, err := r.GetDB().Query(fmt.Sprintf("SELECT migration, batch FROM %s ORDER BY batch, id", tableName))
+	if err != nil {
+		return records
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec MigrationRecord
+		if err := rows.Scan(&rec.Migration, &rec.Batch); err == nil {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// DeleteMigration removes a rolled back migration from the migration table
+func (r *Runtime) DeleteMigration(migration string) {
+	if r.GetDB() == nil {
+		return
+	}
+
+	prefix := "js_"
+	if val, ok := r.Env["PREFIX"]; ok {
+		prefix = val
+	}
+	tableName := prefix + "migration"
+
+	_, err := r.Conn().Exec(fmt.Sprintf("DELETE FROM %s WHERE migration = ?", tableName), migration)
+	if err != nil {
+		fmt.Printf("[Migration] Error eliminando registro de %s: %v\n", migration, err)
+	}
+}
+
+// migrationMode changes how Schema statements run during `joss migrate*`
+type migrationMode struct {
+	pretend bool     // record the SQL instead of executing it
+	queries []string // SQL recorded in pretend mode
+}
+
+// SetMigrationMode is called around each migration. While active, Schema
+// errors panic so the migration is rolled back instead of half applied; with
+// pretend, Schema statements are only recorded (see PretendedQueries).
+func (r *Runtime) SetMigrationMode(active, pretend bool) {
+	if !active {
+		r.migration = nil
+		return
+	}
+	r.migration = &migrationMode{pretend: pretend}
+}
+
+// PretendedQueries returns the SQL recorded since SetMigrationMode(true, true)
+func (r *Runtime) PretendedQueries() []string {
+	if r.migration == nil {
+		return nil
+	}
+	return r.migration.queries
+}
+
+// Pretending reports whether a migration is being simulated (--pretend)
+func (r *Runtime) Pretending() bool {
+	return r.migration != nil && r.migration.pretend
+}
+
+// pretendConn is the connection while a migration is simulated: Schema
+// statements are recorded before reaching it (schemaExec), and anything else
+// (queries, GranDB, hasTable...) would need the real database, so it stops
+// the migration instead
+type pretendConn struct{}
+
+func (pretendConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	panic(pretendError(query))
+}
+
+func (pretendConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	panic(pretendError(query))
+}
+
+func (pretendConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	panic(pretendError(query))
+}
+
+func pretendError(query string) string {
+	return fmt.Sprintf("Migration Error: --pretend solo simula el Schema Builder y esta migración usa la base de datos directamente (%s). Ejecútala sin --pretend", query)
+}
+
+// TransactionalDDL reports whether CREATE/ALTER/DROP can be rolled back.
+// MySQL commits implicitly on DDL, so its migrations run without a transaction.
+func (r *Runtime) TransactionalDDL() bool {
+	return r.DBDriver() != "mysql"
+}
+
+// schemaExec runs a Schema statement on the current connection (the
+// migration's transaction when there is one)
+func (r *Runtime) schemaExec(query string) error {
+	if r.Pretending() {
+		r.migration.queries = append(r.migration.queries, query)
+		return nil
+	}
+	fmt.Printf("[Schema] Ejecutando: %s\n", query)
+	_, err := r.Conn().Exec(query)
+	if err != nil && r.migration != nil {
+		panic(fmt.Sprintf("Schema Error: %v\n  SQL: %s", err, query))
+	}
+	return err
+}
+
 // DropAllTables drops all user tables from the database
 func (r *Runtime) DropAllTables() {
 	if r.GetDB() == nil {
 		return
 	}
 
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := r.DBDriver()
 
 	var tables []string
 
@@ -155,6 +277,30 @@ func (r *Runtime) DropAllTables() {
 				fmt.Printf("[Migration] Tabla %s eliminada\n", table)
 			}
 		}
+	} else if dbDriver == "postgres" {
+		// PostgreSQL: tables of the current schema; CASCADE drops dependent constraints
+		rows, err := r.GetDB().Query("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'")
+		if err != nil {
+			fmt.Printf("[Migration] Error obteniendo tablas: %v\n", err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var tableName string
+			if err := rows.Scan(&tableName); err == nil {
+				tables = append(tables, tableName)
+			}
+		}
+
+		for _, table := range tables {
+			_, err := r.GetDB().Exec(fmt.Sprintf("DROP TABLE IF EXISTS \"%s\" CASCADE", table))
+			if err != nil {
+				fmt.Printf("[Migration] Error eliminando tabla %s: %v\n", table, err)
+			} else {
+				fmt.Printf("[Migration] Tabla %s eliminada\n", table)
+			}
+		}
 	} else {
 		// MySQL: Get all tables from current database
 		dbName := r.Env["DB_NAME"]
@@ -35,13 +35,17 @@ func (r *Runtime) RegisterNativeClasses() {
 	// GranDB
 	r.registerNative("GranDB", []string{}, (*Runtime).executeGranMySQLMethod)
 	// Alias for compatibility
-	r.registerNative("GranMySQL", []string{"table", "select", "where", "innerJoin", "leftJoin", "rightJoin", "get", "first", "insert", "update", "delete", "deleteAll", "truncate", "query", "orderBy", "limit", "offset", "count"}, (*Runtime).executeGranMySQLMethod)
+	r.registerNative("GranMySQL", []string{"table", "select", "where", "innerJoin", "leftJoin", "rightJoin", "get", "first", "insert", "insertGetId", "update", "delete", "deleteAll", "truncate", "query", "orderBy", "limit", "offset", "count", "transaction", "beginTransaction", "commit", "rollBack", "rollback", "transactionLevel", "orWhere", "whereIn", "whereNotIn", "orWhereIn", "orWhereNotIn", "whereNull", "whereNotNull", "orWhereNull", "orWhereNotNull", "whereBetween", "whereNotBetween", "orWhereBetween", "orWhereNotBetween", "distinct", "groupBy", "having", "orHaving", "sum", "avg", "min", "max", "exists", "doesntExist", "paginate", "simplePaginate", "cursorPaginate", "insertMany", "upsert", "chunk", "chunkById", "cursor", "enableQueryLog", "disableQueryLog", "getQueryLog", "connection"}, (*Runtime).executeGranMySQLMethod)
 	r.NativeHandlers["GranMySQL"] = (*Runtime).executeGranMySQLMethod
 
 	// Auth
-	r.registerNative("Auth", []string{"user", "check", "guest", "id", "logout", "attempt", "create", "hasRole", "verify", "refresh", "delete"}, (*Runtime).executeAuthMethod)
+	r.registerNative("Auth", []string{"user", "check", "guest", "id", "logout", "attempt", "create", "hasRole", "verify", "refresh", "delete", "enable2fa", "verify2fa", "disable2fa", "has2fa", "pending2fa", "recoveryCodes", "totp", "unlock", "lockedFor", "can", "cannot", "permissions", "grant", "revoke", "createToken", "tokens", "tokenCan", "issueTokens"}, (*Runtime).executeAuthMethod)
 	r.Variables["Auth"] = &Instance{Class: r.Classes["Auth"], Fields: make(map[string]interface{})}
 
+	// OAuth (social login / OpenID Connect)
+	r.registerNative("OAuth", []string{"redirect", "url", "callback", "error", "accounts", "unlink"}, (*Runtime).executeOAuthMethod)
+	r.Variables["OAuth"] = &Instance{Class: r.Classes["OAuth"], Fields: make(map[string]interface{})}
+
 	// System
 	r.registerNative("System", []string{"env", "Run", "load_driver", "log"}, (*Runtime).executeSystemMethod)
 	r.Variables["System"] = &Instance{Class: r.Classes["System"], Fields: make(map[string]interface{})}
@@ -101,6 +105,11 @@ func (r *Runtime) RegisterNativeClasses() {
 	// Middleware
 	r.registerNative("Middleware", []string{}, nil)
 
+	// Seeders, factories and fake data
+	r.registerNative("Seeder", []string{"call"}, (*Runtime).executeSeederMethod)
+	r.registerNative("Factory", factoryMethods, (*Runtime).executeFactoryMethod)
+	r.registerNative("Faker", fakerMethods, (*Runtime).executeFakerMethod)
+
 	// Math
 	r.registerNative("Math", []string{"random", "floor", "ceil", "abs"}, (*Runtime).executeMathMethod)
 	r.Variables["Math"] = &Instance{Class: r.Classes["Math"], Fields: make(map[string]interface{})}
@@ -114,13 +123,26 @@ func (r *Runtime) RegisterNativeClasses() {
 	r.Variables["UUID"] = &Instance{Class: r.Classes["UUID"], Fields: make(map[string]interface{})}
 
 	// Str
-	r.registerNative("Str", []string{"length", "random", "startsWith", "substring"}, (*Runtime).executeStrMethod)
+	r.registerNative("Str", append([]string{"length", "random", "startsWith", "substring"}, strMethods...), (*Runtime).executeStrMethod)
 	r.Variables["Str"] = &Instance{Class: r.Classes["Str"], Fields: make(map[string]interface{})}
 
+	// Date (alias Carbon)
+	r.registerNative("Date", dateMethods, (*Runtime).executeDateMethod)
+	r.Variables["Date"] = &Instance{Class: r.Classes["Date"], Fields: make(map[string]interface{})}
+	r.registerNative("Carbon", dateMethods, (*Runtime).executeDateMethod)
+	r.Variables["Carbon"] = &Instance{Class: r.Classes["Carbon"], Fields: make(map[string]interface{})}
+	dateClassMu.Lock()
+	dateClass = r.Classes["Date"]
+	dateClassMu.Unlock()
+
 	// UserStorage
 	r.registerNative("UserStorage", []string{"put", "get", "getToFile", "update", "path", "exists", "delete"}, (*Runtime).executeUserStorageMethod)
 	r.Variables["UserStorage"] = &Instance{Class: r.Classes["UserStorage"], Fields: make(map[string]interface{})}
 
+	// Backup
+	r.registerNative("Backup", []string{"run", "restore", "list", "prune"}, (*Runtime).executeBackupMethod)
+	r.Variables["Backup"] = &Instance{Class: r.Classes["Backup"], Fields: make(map[string]interface{})}
+
 	// SQLite (Native)
 	r.registerNative("SQLite", []string{"open", "query", "close"}, (*Runtime).executeSQLiteMethod)
 	r.Variables["SQLite"] = &Instance{Class: r.Classes["SQLite"], Fields: make(map[string]interface{})}
@@ -168,6 +190,10 @@ func (r *Runtime) RegisterNativeClasses() {
 	// Sitemap
 	r.registerNative("Sitemap", []string{"add", "generate"}, (*Runtime).executeSitemapMethod)
 	r.Variables["Sitemap"] = &Instance{Class: r.Classes["Sitemap"], Fields: make(map[string]interface{})}
+
+	// TestClient (In-process HTTP testing)
+	r.registerNative("TestClient", []string{"get", "post", "put", "patch", "delete", "json", "upload", "withSession", "withHeader", "withCookie", "followRedirects", "session", "csrfToken"}, (*Runtime).executeTestClientMethod)
+	r.registerNative("TestResponse", []string{"status", "body", "header", "json", "view", "viewData", "assertStatus", "assertOk", "assertSee", "assertDontSee", "assertRedirect", "assertJson", "assertViewIs", "assertViewHas"}, (*Runtime).executeTestResponseMethod)
 }
 
 func (r *Runtime) executeNativeMethod(instance *Instance, method string, args []interface{}) interface{} {
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Backup Native Class Implementation
+// Usage (config/cron.joss):
+//
+//	Cron::schedule("backup_diario", "03:00", {
+//	    Backup::run({"gzip": true, "keep": 7, "storage": true})
+//	})
+//
+// Backups stay in storage/backups (never under the public assets). With
+// "storage" and STORAGE=OCI they are also uploaded to the bucket as
+// backups/<archivo>, and the retention rules apply there too.
+func (r *Runtime) executeBackupMethod(instance *Instance, method string, args []interface{}) interface{} {
+	var opts map[string]interface{}
+	if len(args) > 0 {
+		opts, _ = args[0].(map[string]interface{})
+	}
+	if opts == nil {
+		opts = map[string]interface{}{}
+	}
+	dir := DefaultBackupDir
+	if d, ok := opts["dir"].(string); ok && d != "" {
+		dir = d
+	}
+	retention := BackupRetention{Keep: stdInt(opts["keep"], 0), KeepDays: stdInt(opts["keepDays"], 0)}
+
+	switch method {
+	case "run":
+		conn := r.resolveConnection(stdString(opts["connection"]))
+		if conn.db == nil {
+			panic("Backup Error: no hay conexión a la base de datos")
+		}
+		format, _ := opts["format"].(string)
+		path, _ := opts["path"].(string)
+		result, err := WriteBackup(conn.db, conn.driver(), envPrefix(conn.env), BackupOptions{
+			Format: format,
+			Gzip:   isTruthy(opts["gzip"]),
+			Tables: backupTableOption(opts["tables"]),
+			Path:   path,
+			Dir:    dir,
+		})
+		if err != nil {
+			panic(fmt.Sprintf("Backup Error: %v", err))
+		}
+		fmt.Printf("[Backup] %s (%d tablas, %d filas)\n", result.Path, result.Tables, result.Rows)
+
+		if isTruthy(opts["storage"]) {
+			r.uploadBackup(result.Path, retention)
+		}
+		if path == "" {
+			for _, name := range PruneBackups(dir, retention) {
+				fmt.Printf("[Backup] Eliminado por retención: %s\n", name)
+			}
+		}
+		return result.Path
+
+	case "restore":
+		if len(args) < 1 {
+			panic("Backup Error: restore requiere la ruta del respaldo")
+		}
+		path, _ := args[0].(string)
+		if len(args) > 1 {
+			opts, _ = args[1].(map[string]interface{})
+		}
+		conn := r.resolveConnection(stdString(opts["connection"]))
+		if conn.db == nil {
+			panic("Backup Error: no hay conexión a la base de datos")
+		}
+		result, err := RestoreBackup(conn.db, conn.driver(), envPrefix(conn.env), path)
+		if err != nil {
+			panic(fmt.Sprintf("Backup Error: %v", err))
+		}
+		fmt.Printf("[Backup] Restaurado %s (%d tablas, %d filas)\n", path, result.Tables, result.Rows)
+		return true
+
+	case "list":
+		names := ListBackups(dir)
+		list := make([]interface{}, len(names))
+		for i, name := range names {
+			list[i] = filepath.Join(dir, name)
+		}
+		return list
+
+	case "prune":
+		removed := PruneBackups(dir, retention)
+		if isTruthy(opts["storage"]) && r.Env["STORAGE"] == "OCI" {
+			removed = append(removed, r.pruneRemoteBackups(retention)...)
+		}
+		return toStringList(removed)
+	}
+	return nil
+}
+
+// tablePrefix returns PREFIX of the runtime's connection
+func (r *Runtime) tablePrefix() string {
+	return envPrefix(r.Env)
+}
+
+// backupTableOption accepts "users,posts" or ["users", "posts"]
+func backupTableOption(val interface{}) []string {
+	if s, ok := val.(string); ok {
+		return strings.Split(s, ",")
+	}
+	return blueprintColumns(val)
+}
+
+// uploadBackup copies a backup to the UserStorage backend. Only OCI is
+// remote: the local backend already keeps it in storage/backups.
+func (r *Runtime) uploadBackup(path string, retention BackupRetention) {
+	if r.Env["STORAGE"] != "OCI" {
+		fmt.Println("[Backup] STORAGE es local: el respaldo queda en " + path)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Sprintf("Backup Error: %v", err))
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		panic(fmt.Sprintf("Backup Error: %v", err))
+	}
+	if !r.ociPutReader("backups", filepath.Base(path), f, info.Size()) {
+		panic("Backup Error: no se pudo subir el respaldo a OCI")
+	}
+	for _, name := range r.pruneRemoteBackups(retention) {
+		fmt.Printf("[Backup] Eliminado de OCI por retención: %s\n", name)
+	}
+}
+
+func (r *Runtime) pruneRemoteBackups(retention BackupRetention) []string {
+	if retention.Keep == 0 && retention.KeepDays == 0 {
+		return nil
+	}
+	names, err := r.ociList("backups/")
+	if err != nil {
+		LogError("[Backup] No se pudieron listar los respaldos en OCI: %v", err)
+		return nil
+	}
+	var removed []string
+	for _, name := range retention.Expired(names) {
+		if r.ociDelete("backups", filepath.Base(name)) {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
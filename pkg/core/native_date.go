@@ -0,0 +1,755 @@
+package core
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jossecurity/joss/pkg/parser"
+)
+
+// Date (alias Carbon): immutable date/time values. Every arithmetic or timezone
+// method returns a new Date, so values read from the database are never mutated.
+
+var dateMethods = []string{
+	// Constructors (static)
+	"now", "today", "tomorrow", "yesterday", "parse", "create", "fromTimestamp", "setTestNow", "hasTestNow",
+	// Formatting
+	"format", "toDateString", "toTimeString", "toDateTimeString", "toIsoString", "toString", "timestamp",
+	"diffForHumans", "locale",
+	// Getters
+	"year", "month", "day", "hour", "minute", "second", "dayOfWeek", "dayOfYear", "daysInMonth", "timezone",
+	// Timezone
+	"tz", "setTimezone", "utc",
+	// Arithmetic
+	"addSeconds", "addMinutes", "addHours", "addDays", "addWeeks", "addMonths", "addYears",
+	"subSeconds", "subMinutes", "subHours", "subDays", "subWeeks", "subMonths", "subYears",
+	"startOfDay", "endOfDay", "startOfWeek", "endOfWeek", "startOfMonth", "endOfMonth", "startOfYear", "endOfYear",
+	"diffInSeconds", "diffInMinutes", "diffInHours", "diffInDays", "diffInWeeks", "diffInMonths", "diffInYears",
+	// Comparison
+	"equals", "isBefore", "isAfter", "between", "isSameDay", "isPast", "isFuture", "isToday", "isWeekend", "min", "max",
+	"copy",
+}
+
+var (
+	dateClass    *parser.ClassStatement
+	dateClassMu  sync.RWMutex
+	dateLocation = time.Local
+	dateJSONISO  bool
+	dateConfig   sync.Once
+
+	testNowMu sync.RWMutex
+	testNow   *time.Time
+)
+
+// Now returns the current time, honoring Date::setTestNow (fake clock for tests)
+func Now() time.Time {
+	testNowMu.RLock()
+	defer testNowMu.RUnlock()
+	if testNow != nil {
+		return testNow.In(dateLocation)
+	}
+	return time.Now().In(dateLocation)
+}
+
+// SetTestNow freezes Now(); nil restores the real clock
+func SetTestNow(t *time.Time) {
+	testNowMu.Lock()
+	testNow = t
+	testNowMu.Unlock()
+}
+
+// configureDates applies TIMEZONE (e.g. "America/Mexico_City") and
+// DATE_JSON_FORMAT from the first env loaded; both are process-wide, so later
+// LoadEnv calls (one per request) don't touch them
+func configureDates(env map[string]string) {
+	dateConfig.Do(func() {
+		if tz, ok := env["TIMEZONE"]; ok && tz != "" {
+			if loc, err := time.LoadLocation(tz); err == nil {
+				dateLocation = loc
+			} else {
+				fmt.Printf("[Date] Zona horaria inválida '%s': %v\n", tz, err)
+			}
+		}
+		dateJSONISO = strings.EqualFold(env["DATE_JSON_FORMAT"], "iso8601")
+	})
+}
+
+// NewDate wraps a time.Time as a Joss Date instance
+func NewDate(t time.Time) *Instance {
+	dateClassMu.RLock()
+	cls := dateClass
+	dateClassMu.RUnlock()
+	return &Instance{Class: cls, Fields: map[string]interface{}{"_time": t}}
+}
+
+// dateValue extracts the time of a Date instance
+func dateValue(val interface{}) (time.Time, bool) {
+	if inst, ok := val.(*Instance); ok && inst != nil && inst.Fields != nil {
+		if t, ok := inst.Fields["_time"].(time.Time); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dateString is how a date prints and concatenates: "Y-m-d H:i:s", like the
+// DATETIME strings it replaces
+func dateString(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// isDateOnly reports whether a Date came from a DATE column, which prints
+// and encodes without the time
+func isDateOnly(inst *Instance) bool {
+	only, _ := inst.Fields["_date_only"].(bool)
+	return only
+}
+
+// instanceDateString is dateString, or "Y-m-d" for DATE columns
+func instanceDateString(inst *Instance) string {
+	t, _ := dateValue(inst)
+	if isDateOnly(inst) {
+		return t.Format("2006-01-02")
+	}
+	return dateString(t)
+}
+
+// dateJSON keeps the "Y-m-d H:i:s" wire format of DATETIME columns unless the
+// app opts into ISO-8601 with DATE_JSON_FORMAT="iso8601"
+func dateJSON(t time.Time) ([]byte, error) {
+	if dateJSONISO {
+		return json.Marshal(t.Format(time.RFC3339))
+	}
+	return json.Marshal(dateString(t))
+}
+
+// Value lets dates be bound as SQL parameters (naive "Y-m-d H:i:s" in the app timezone)
+func (i *Instance) Value() (driver.Value, error) {
+	if t, ok := dateValue(i); ok {
+		return t.In(dateLocation).Format("2006-01-02 15:04:05"), nil
+	}
+	return nil, fmt.Errorf("no se puede usar una instancia de %s como parámetro SQL", i.className())
+}
+
+func (i *Instance) className() string {
+	if i.Class != nil && i.Class.Name != nil {
+		return i.Class.Name.Value
+	}
+	return "objeto"
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseDate accepts common layouts plus "now", "today", "tomorrow", "yesterday"
+func parseDate(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now := Now().In(loc)
+	switch strings.ToLower(s) {
+	case "", "now":
+		return now, nil
+	case "today":
+		return startOfDay(now), nil
+	case "tomorrow":
+		return startOfDay(now).AddDate(0, 0, 1), nil
+	case "yesterday":
+		return startOfDay(now).AddDate(0, 0, -1), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0).In(loc), nil
+	}
+	return time.Time{}, fmt.Errorf("formato de fecha no reconocido: '%s'", s)
+}
+
+// toDate converts a Date, string or unix timestamp argument
+func toDate(val interface{}) (time.Time, bool) {
+	if t, ok := dateValue(val); ok {
+		return t, true
+	}
+	switch v := val.(type) {
+	case nil:
+		return Now(), true
+	case time.Time:
+		return v, true
+	case string:
+		t, err := parseDate(v, dateLocation)
+		return t, err == nil
+	case int64:
+		return time.Unix(v, 0).In(dateLocation), true
+	case float64:
+		return time.Unix(int64(v), 0).In(dateLocation), true
+	}
+	return time.Time{}, false
+}
+
+func loadLocation(val interface{}) *time.Location {
+	if name, ok := val.(string); ok && name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+		panic(fmt.Sprintf("Date Error: zona horaria inválida '%s'", name))
+	}
+	return dateLocation
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// addMonthsNoOverflow keeps Jan 31 + 1 month on Feb 28/29 (like Carbon)
+func addMonthsNoOverflow(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	target := first.AddDate(0, months, 0)
+	lastDay := target.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(target.Year(), target.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// --- Localization ---
+
+type dateLocale struct {
+	months, monthsShort, days, daysShort []string
+	ago, fromNow, justNow                string
+	units                                map[string][2]string // unit -> singular, plural
+}
+
+var dateLocales = map[string]dateLocale{
+	"es": {
+		months:      []string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		monthsShort: []string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+		days:        []string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		daysShort:   []string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		ago:         "hace %s", fromNow: "dentro de %s", justNow: "justo ahora",
+		units: map[string][2]string{
+			"second": {"segundo", "segundos"}, "minute": {"minuto", "minutos"}, "hour": {"hora", "horas"},
+			"day": {"día", "días"}, "week": {"semana", "semanas"}, "month": {"mes", "meses"}, "year": {"año", "años"},
+		},
+	},
+	"en": {
+		months:      []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		monthsShort: []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		days:        []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		daysShort:   []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		ago:         "%s ago", fromNow: "in %s", justNow: "just now",
+		units: map[string][2]string{
+			"second": {"second", "seconds"}, "minute": {"minute", "minutes"}, "hour": {"hour", "hours"},
+			"day": {"day", "days"}, "week": {"week", "weeks"}, "month": {"month", "months"}, "year": {"year", "years"},
+		},
+	},
+	"pt": {
+		months:      []string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		monthsShort: []string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		days:        []string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		daysShort:   []string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+		ago:         "há %s", fromNow: "em %s", justNow: "agora mesmo",
+		units: map[string][2]string{
+			"second": {"segundo", "segundos"}, "minute": {"minuto", "minutos"}, "hour": {"hora", "horas"},
+			"day": {"dia", "dias"}, "week": {"semana", "semanas"}, "month": {"mês", "meses"}, "year": {"ano", "anos"},
+		},
+	},
+	"fr": {
+		months:      []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		monthsShort: []string{"janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc"},
+		days:        []string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		daysShort:   []string{"dim", "lun", "mar", "mer", "jeu", "ven", "sam"},
+		ago:         "il y a %s", fromNow: "dans %s", justNow: "à l'instant",
+		units: map[string][2]string{
+			"second": {"seconde", "secondes"}, "minute": {"minute", "minutes"}, "hour": {"heure", "heures"},
+			"day": {"jour", "jours"}, "week": {"semaine", "semaines"}, "month": {"mois", "mois"}, "year": {"an", "ans"},
+		},
+	},
+}
+
+func lookupDateLocale(locale string) dateLocale {
+	locale = strings.ToLower(locale)
+	if l, ok := dateLocales[locale]; ok {
+		return l
+	}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if l, ok := dateLocales[locale[:i]]; ok {
+			return l
+		}
+	}
+	return dateLocales["en"]
+}
+
+// formatDate implements PHP/Carbon style tokens (d, m, Y, H, i, s, D, l, M, F, ...).
+// A backslash escapes the next character.
+func formatDate(t time.Time, layout string, loc dateLocale) string {
+	var sb strings.Builder
+	runes := []rune(layout)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if c == '\\' && i+1 < len(runes) {
+			i++
+			sb.WriteRune(runes[i])
+			continue
+		}
+		switch c {
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'j':
+			sb.WriteString(strconv.Itoa(t.Day()))
+		case 'D':
+			sb.WriteString(loc.daysShort[t.Weekday()])
+		case 'l':
+			sb.WriteString(loc.days[t.Weekday()])
+		case 'N':
+			wd := int(t.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			sb.WriteString(strconv.Itoa(wd))
+		case 'w':
+			sb.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'z':
+			sb.WriteString(strconv.Itoa(t.YearDay() - 1))
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'n':
+			sb.WriteString(strconv.Itoa(int(t.Month())))
+		case 'M':
+			sb.WriteString(loc.monthsShort[t.Month()-1])
+		case 'F':
+			sb.WriteString(loc.months[t.Month()-1])
+		case 't':
+			sb.WriteString(strconv.Itoa(time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()))
+		case 'Y':
+			sb.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case 'a':
+			sb.WriteString(strings.ToLower(t.Format("PM")))
+		case 'A':
+			sb.WriteString(t.Format("PM"))
+		case 'g':
+			sb.WriteString(t.Format("3"))
+		case 'h':
+			sb.WriteString(t.Format("03"))
+		case 'G':
+			sb.WriteString(strconv.Itoa(t.Hour()))
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'i':
+			fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 's':
+			fmt.Fprintf(&sb, "%02d", t.Second())
+		case 'v':
+			fmt.Fprintf(&sb, "%03d", t.Nanosecond()/1e6)
+		case 'e':
+			sb.WriteString(t.Location().String())
+		case 'T':
+			sb.WriteString(t.Format("MST"))
+		case 'P':
+			sb.WriteString(t.Format("-07:00"))
+		case 'O':
+			sb.WriteString(t.Format("-0700"))
+		case 'c':
+			sb.WriteString(t.Format(time.RFC3339))
+		case 'U':
+			sb.WriteString(strconv.FormatInt(t.Unix(), 10))
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// diffForHumans renders "hace 3 días" / "in 2 hours" relative to other
+func diffForHumans(t, other time.Time, loc dateLocale) string {
+	diff := t.Sub(other)
+	future := diff > 0
+	secs := math.Abs(diff.Seconds())
+
+	var n int
+	var unit string
+	switch {
+	case secs < 10:
+		return loc.justNow
+	case secs < 60:
+		n, unit = int(secs), "second"
+	case secs < 3600:
+		n, unit = int(secs/60), "minute"
+	case secs < 86400:
+		n, unit = int(secs/3600), "hour"
+	case secs < 7*86400:
+		n, unit = int(secs/86400), "day"
+	case secs < 30*86400:
+		n, unit = int(secs/(7*86400)), "week"
+	case secs < 365*86400:
+		n, unit = int(secs/(30*86400)), "month"
+	default:
+		n, unit = int(secs/(365*86400)), "year"
+	}
+	word := loc.units[unit][1]
+	if n == 1 {
+		word = loc.units[unit][0]
+	}
+	amount := fmt.Sprintf("%d %s", n, word)
+	if future {
+		return fmt.Sprintf(loc.fromNow, amount)
+	}
+	return fmt.Sprintf(loc.ago, amount)
+}
+
+func monthsBetween(a, b time.Time) int {
+	months := (b.Year()-a.Year())*12 + int(b.Month()-a.Month())
+	// Not a full month yet
+	if months > 0 && addMonthsNoOverflow(a, months).After(b) {
+		months--
+	} else if months < 0 && addMonthsNoOverflow(a, months).Before(b) {
+		months++
+	}
+	return months
+}
+
+// executeDateMethod handles Date::/Carbon:: statics and date instance methods
+func (r *Runtime) executeDateMethod(instance *Instance, method string, args []interface{}) interface{} {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+	other := func(i int) time.Time {
+		if i >= len(args) {
+			return Now()
+		}
+		t, ok := toDate(args[i])
+		if !ok {
+			panic(fmt.Sprintf("Date Error: '%v' no es una fecha válida", args[i]))
+		}
+		return t
+	}
+	locale := lookupDateLocale(r.GetLocale())
+
+	// Static constructors
+	switch method {
+	case "now":
+		return NewDate(Now().In(loadLocation(arg(0))))
+	case "today":
+		return NewDate(startOfDay(Now().In(loadLocation(arg(0)))))
+	case "tomorrow":
+		return NewDate(startOfDay(Now().In(loadLocation(arg(0)))).AddDate(0, 0, 1))
+	case "yesterday":
+		return NewDate(startOfDay(Now().In(loadLocation(arg(0)))).AddDate(0, 0, -1))
+	case "parse":
+		if t, ok := dateValue(arg(0)); ok {
+			return NewDate(t)
+		}
+		if ts, ok := arg(0).(int64); ok {
+			return NewDate(time.Unix(ts, 0).In(loadLocation(arg(1))))
+		}
+		t, err := parseDate(stdString(arg(0)), loadLocation(arg(1)))
+		if err != nil {
+			panic("Date Error: " + err.Error())
+		}
+		return NewDate(t)
+	case "create":
+		// Date::create(year, month = 1, day = 1, hour = 0, minute = 0, second = 0, tz?)
+		tzArg := interface{}(nil)
+		nums := []int{0, 1, 1, 0, 0, 0}
+		for i, a := range args {
+			if s, ok := a.(string); ok {
+				tzArg = s
+				break
+			}
+			if i < len(nums) {
+				nums[i] = stdInt(a, nums[i])
+			}
+		}
+		return NewDate(time.Date(nums[0], time.Month(nums[1]), nums[2], nums[3], nums[4], nums[5], 0, loadLocation(tzArg)))
+	case "fromTimestamp":
+		return NewDate(time.Unix(int64(stdInt(arg(0), 0)), 0).In(loadLocation(arg(1))))
+	case "setTestNow":
+		if arg(0) == nil {
+			SetTestNow(nil)
+			return nil
+		}
+		t := other(0)
+		SetTestNow(&t)
+		return NewDate(t)
+	case "hasTestNow":
+		testNowMu.RLock()
+		defer testNowMu.RUnlock()
+		return testNow != nil
+	}
+
+	t, isDate := dateValue(instance)
+	if !isDate {
+		// Instance methods called statically act on "now" (Date::format("Y") )
+		t = Now()
+	}
+
+	switch method {
+	// Formatting
+	case "format":
+		return formatDate(t, stdString(arg(0)), locale)
+	case "locale":
+		return formatDate(t, stdString(arg(1)), lookupDateLocale(stdString(arg(0))))
+	case "toDateString":
+		return t.Format("2006-01-02")
+	case "toTimeString":
+		return t.Format("15:04:05")
+	case "toDateTimeString":
+		return t.Format("2006-01-02 15:04:05")
+	case "toString":
+		return instanceDateString(instance)
+	case "toIsoString":
+		return t.Format(time.RFC3339)
+	case "timestamp":
+		return t.Unix()
+	case "diffForHumans":
+		return diffForHumans(t, other(0), locale)
+
+	// Getters
+	case "year":
+		return int64(t.Year())
+	case "month":
+		return int64(t.Month())
+	case "day":
+		return int64(t.Day())
+	case "hour":
+		return int64(t.Hour())
+	case "minute":
+		return int64(t.Minute())
+	case "second":
+		return int64(t.Second())
+	case "dayOfWeek":
+		return int64(t.Weekday())
+	case "dayOfYear":
+		return int64(t.YearDay())
+	case "daysInMonth":
+		return int64(time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day())
+	case "timezone":
+		return t.Location().String()
+
+	// Timezone conversion (same instant, different wall clock)
+	case "tz", "setTimezone":
+		return NewDate(t.In(loadLocation(arg(0))))
+	case "utc":
+		return NewDate(t.UTC())
+
+	// Arithmetic
+	case "addSeconds", "subSeconds":
+		return NewDate(t.Add(time.Duration(signedAmount(method, arg(0))) * time.Second))
+	case "addMinutes", "subMinutes":
+		return NewDate(t.Add(time.Duration(signedAmount(method, arg(0))) * time.Minute))
+	case "addHours", "subHours":
+		return NewDate(t.Add(time.Duration(signedAmount(method, arg(0))) * time.Hour))
+	case "addDays", "subDays":
+		return NewDate(t.AddDate(0, 0, signedAmount(method, arg(0))))
+	case "addWeeks", "subWeeks":
+		return NewDate(t.AddDate(0, 0, 7*signedAmount(method, arg(0))))
+	case "addMonths", "subMonths":
+		return NewDate(addMonthsNoOverflow(t, signedAmount(method, arg(0))))
+	case "addYears", "subYears":
+		return NewDate(addMonthsNoOverflow(t, 12*signedAmount(method, arg(0))))
+	case "startOfDay":
+		return NewDate(startOfDay(t))
+	case "endOfDay":
+		return NewDate(startOfDay(t).Add(24*time.Hour - time.Nanosecond))
+	case "startOfWeek":
+		// Weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return NewDate(startOfDay(t).AddDate(0, 0, -offset))
+	case "endOfWeek":
+		offset := (int(t.Weekday()) + 6) % 7
+		return NewDate(startOfDay(t).AddDate(0, 0, 7-offset).Add(-time.Nanosecond))
+	case "startOfMonth":
+		return NewDate(time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()))
+	case "endOfMonth":
+		return NewDate(time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond))
+	case "startOfYear":
+		return NewDate(time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location()))
+	case "endOfYear":
+		return NewDate(time.Date(t.Year()+1, 1, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond))
+
+	// Differences (absolute unless the second argument is false)
+	case "diffInSeconds", "diffInMinutes", "diffInHours", "diffInDays", "diffInWeeks", "diffInMonths", "diffInYears":
+		o := other(0)
+		var n int64
+		switch method {
+		case "diffInSeconds":
+			n = int64(o.Sub(t) / time.Second)
+		case "diffInMinutes":
+			n = int64(o.Sub(t) / time.Minute)
+		case "diffInHours":
+			n = int64(o.Sub(t) / time.Hour)
+		case "diffInDays":
+			n = int64(o.Sub(t) / (24 * time.Hour))
+		case "diffInWeeks":
+			n = int64(o.Sub(t) / (7 * 24 * time.Hour))
+		case "diffInMonths":
+			n = int64(monthsBetween(t, o))
+		case "diffInYears":
+			n = int64(monthsBetween(t, o) / 12)
+		}
+		if abs, ok := arg(1).(bool); ok && !abs {
+			return n
+		}
+		if n < 0 {
+			n = -n
+		}
+		return n
+
+	// Comparison
+	case "equals":
+		return t.Equal(other(0))
+	case "isBefore":
+		return t.Before(other(0))
+	case "isAfter":
+		return t.After(other(0))
+	case "between":
+		a, b := other(0), other(1)
+		if a.After(b) {
+			a, b = b, a
+		}
+		return !t.Before(a) && !t.After(b)
+	case "isSameDay":
+		o := other(0).In(t.Location())
+		return t.Year() == o.Year() && t.YearDay() == o.YearDay()
+	case "isPast":
+		return t.Before(Now())
+	case "isFuture":
+		return t.After(Now())
+	case "isToday":
+		n := Now().In(t.Location())
+		return t.Year() == n.Year() && t.YearDay() == n.YearDay()
+	case "isWeekend":
+		return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+	case "min":
+		if o := other(0); o.Before(t) {
+			return NewDate(o)
+		}
+		return NewDate(t)
+	case "max":
+		if o := other(0); o.After(t) {
+			return NewDate(o)
+		}
+		return NewDate(t)
+	case "copy":
+		return NewDate(t)
+	}
+	return nil
+}
+
+// signedAmount returns the amount (default 1) negated for sub* methods
+func signedAmount(method string, val interface{}) int {
+	n := stdInt(val, 1)
+	if strings.HasPrefix(method, "sub") {
+		return -n
+	}
+	return n
+}
+
+// compareDates handles <, >, <=, >=, ==, != between two dates (or a date and a date string)
+func compareDates(op string, left, right interface{}) (interface{}, bool) {
+	lt, lok := dateValue(left)
+	rt, rok := dateValue(right)
+	if !lok && !rok {
+		return nil, false
+	}
+	if !lok {
+		if s, ok := left.(string); ok {
+			if t, err := parseDate(s, rt.Location()); err == nil {
+				lt, lok = t, true
+			}
+		}
+	}
+	if !rok {
+		if s, ok := right.(string); ok {
+			if t, err := parseDate(s, lt.Location()); err == nil {
+				rt, rok = t, true
+			}
+		}
+	}
+	if !lok || !rok {
+		return nil, false
+	}
+	switch op {
+	case "<":
+		return lt.Before(rt), true
+	case ">":
+		return lt.After(rt), true
+	case "<=":
+		return !lt.After(rt), true
+	case ">=":
+		return !lt.Before(rt), true
+	case "==":
+		return lt.Equal(rt), true
+	case "!=":
+		return !lt.Equal(rt), true
+	}
+	return nil, false
+}
+
+// isDateColumn reports whether a database type name holds dates
+func isDateColumn(typeName string) bool {
+	switch strings.ToUpper(typeName) {
+	case "DATETIME", "TIMESTAMP", "DATE", "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITHOUT TIME ZONE":
+		return true
+	}
+	return false
+}
+
+// dbDateColumnValue converts a scanned date column; DATE values keep their
+// date-only format when printed or encoded
+func dbDateColumnValue(val interface{}, typeName string) interface{} {
+	v := dbDateValue(val)
+	if inst, ok := v.(*Instance); ok && strings.EqualFold(typeName, "DATE") {
+		inst.Fields["_date_only"] = true
+	}
+	return v
+}
+
+// dbDateValue converts a scanned DATETIME value to a Date (nil/zero dates stay as is)
+func dbDateValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		// Naive DB timestamps are read in the app timezone
+		if v.Location() == time.UTC {
+			v = time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), dateLocation)
+		}
+		return NewDate(v)
+	case []byte:
+		return dbDateValue(string(v))
+	case string:
+		if v == "" || strings.HasPrefix(v, "0000-00-00") {
+			return v
+		}
+		if t, err := parseDate(v, dateLocation); err == nil {
+			return NewDate(t)
+		}
+		return v
+	}
+	return val
+}
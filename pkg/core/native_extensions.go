@@ -211,5 +211,8 @@ func (r *Runtime) executeStrMethod(instance *Instance, method string, args []int
 		}
 		return string(runes[start:end])
 	}
+	if res, ok := r.callStdlib(method, args); ok {
+		return res
+	}
 	return nil
 }
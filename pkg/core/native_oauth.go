@@ -0,0 +1,336 @@
+package core
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OAuth Native Class Implementation
+// Usage (routes.joss + controller):
+//
+//	Router::get("/auth/{provider}", "SocialController@redirect")
+//	Router::get("/auth/{provider}/callback", "SocialController@callback")
+//
+//	function redirect($provider) { return OAuth::redirect($provider) }
+//	function callback($provider) {
+//	    (OAuth::callback($provider)) ? {
+//	        return Redirect::to("/dashboard")
+//	    } : {
+//	        return Redirect::to("/login")->with("error", OAuth::error())
+//	    }
+//	}
+//
+// The callback logs in the user linked to the provider account. An unknown
+// account is linked to the logged-in user, to the user with the same email
+// (only when the provider verified it) or to a new user (unless
+// OAUTH_REGISTER=false). Links live in <prefix>oauth_accounts; users with
+// 2FA still have to enter their code after the callback.
+
+const oauthStateTTL = 10 * time.Minute
+
+func (r *Runtime) executeOAuthMethod(instance *Instance, method string, args []interface{}) interface{} {
+	provider := ""
+	if len(args) > 0 && args[0] != nil {
+		provider = fmt.Sprintf("%v", args[0])
+	}
+
+	switch method {
+	case "redirect", "url":
+		// OAuth::redirect("google", {"prompt": "select_account"})
+		p, err := r.oauthProvider(provider)
+		if err != nil {
+			panic("OAuth Error: " + err.Error())
+		}
+		sess := r.sessionFields()
+		if sess == nil {
+			panic("OAuth Error: se requiere una sesión para guardar el state")
+		}
+		state, verifier, nonce := randomURLToken(32), randomURLToken(48), randomURLToken(32)
+		sess["oauth_provider"] = p.name
+		sess["oauth_state"] = state
+		sess["oauth_verifier"] = verifier
+		sess["oauth_nonce"] = nonce
+		sess["oauth_expires"] = Now().Add(oauthStateTTL).Unix()
+
+		var extra map[string]interface{}
+		if len(args) > 1 {
+			extra, _ = args[1].(map[string]interface{})
+		}
+		authURL := p.authURL(state, verifier, nonce, extra)
+		if method == "url" {
+			return authURL
+		}
+		return r.createWebResponse("REDIRECT", authURL, nil, 302)
+
+	case "callback":
+		delete(r.Variables, "$__oauth_error")
+		profile, err := r.oauthCallback(provider)
+		if err != nil {
+			LogWarning("[OAuth] %s: %v", provider, err)
+			r.Variables["$__oauth_error"] = err.Error()
+			return false
+		}
+		return profile
+
+	case "error":
+		// Reason of the last failed callback, for the login page
+		if msg, ok := r.Variables["$__oauth_error"].(string); ok {
+			return msg
+		}
+		return nil
+
+	case "accounts":
+		userID := r.oauthCurrentUser()
+		if userID == 0 || r.GetDB() == nil {
+			return []interface{}{}
+		}
+		prefix := r.tablePrefix()
+		r.ensureAuthTables(prefix+"users", prefix+"roles", prefix)
+		rows, err := r.Conn().Query(fmt.Sprintf("SELECT provider, provider_user_id, email, created_at FROM %soauth_accounts WHERE user_id = ? ORDER BY provider", prefix), userID)
+		if err != nil {
+			return []interface{}{}
+		}
+		defer rows.Close()
+		list := []interface{}{}
+		for rows.Next() {
+			var name, id string
+			var email, created interface{}
+			if rows.Scan(&name, &id, &email, &created) == nil {
+				list = append(list, map[string]interface{}{"provider": name, "id": id, "email": dbString(email), "created_at": dbString(created)})
+			}
+		}
+		return list
+
+	case "unlink":
+		userID := r.oauthCurrentUser()
+		if userID == 0 || provider == "" || r.GetDB() == nil {
+			return false
+		}
+		prefix := r.tablePrefix()
+		r.ensureAuthTables(prefix+"users", prefix+"roles", prefix)
+		n, _ := rowsAffected(r.Conn().Exec(fmt.Sprintf("DELETE FROM %soauth_accounts WHERE user_id = ? AND provider = ?", prefix), userID, strings.ToLower(provider)))
+		return n > 0
+	}
+	return nil
+}
+
+func dbString(v interface{}) interface{} {
+	switch s := v.(type) {
+	case []byte:
+		return string(s)
+	case time.Time:
+		return s.Format("2006-01-02 15:04:05")
+	}
+	return v
+}
+
+// oauthCurrentUser is the id of the logged-in user, or 0
+func (r *Runtime) oauthCurrentUser() int {
+	if sess := r.sessionFields(); sess != nil {
+		return stdInt(sess["user_id"], 0)
+	}
+	return 0
+}
+
+func (r *Runtime) oauthInput(key string) string {
+	if reqInst, ok := r.Variables["$__request"].(*Instance); ok {
+		if v, ok := reqInst.Fields[key]; ok && v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return ""
+}
+
+// oauthCallback completes the flow started by OAuth::redirect
+func (r *Runtime) oauthCallback(name string) (map[string]interface{}, error) {
+	sess := r.sessionFields()
+	if sess == nil {
+		return nil, errors.New("no hay una sesión activa")
+	}
+	state, _ := sess["oauth_state"].(string)
+	verifier, _ := sess["oauth_verifier"].(string)
+	nonce, _ := sess["oauth_nonce"].(string)
+	started, _ := sess["oauth_provider"].(string)
+	expires := stdInt(sess["oauth_expires"], 0)
+	// The state is single use, whatever the outcome
+	for _, k := range []string{"oauth_provider", "oauth_state", "oauth_verifier", "oauth_nonce", "oauth_expires"} {
+		delete(sess, k)
+	}
+
+	if e := r.oauthInput("error"); e != "" {
+		return nil, fmt.Errorf("el proveedor rechazó el acceso: %s", e)
+	}
+	got := r.oauthInput("state")
+	if state == "" || started != strings.ToLower(name) || subtle.ConstantTimeCompare([]byte(state), []byte(got)) != 1 {
+		return nil, errors.New("el parámetro state no coincide (sesión expirada o posible CSRF)")
+	}
+	if Now().Unix() > int64(expires) {
+		return nil, errors.New("el inicio de sesión expiró, inténtalo de nuevo")
+	}
+	code := r.oauthInput("code")
+	if code == "" {
+		return nil, errors.New("falta el código de autorización")
+	}
+
+	p, err := r.oauthProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := p.exchange(code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := p.fetchProfile(tokens, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.GetDB() == nil {
+		return nil, errors.New("no hay conexión a la base de datos")
+	}
+	prefix := r.tablePrefix()
+	usersTable, rolesTable := prefix+"users", prefix+"roles"
+	r.ensureAuthTables(usersTable, rolesTable, prefix)
+
+	current := r.oauthCurrentUser()
+	userID, created, err := r.oauthLinkAccount(prefix, p.name, profile, current)
+	if err != nil {
+		return nil, err
+	}
+	profile["user_id"] = userID
+	profile["created"] = created
+	profile["two_factor"] = false
+
+	// Linking from a logged-in session keeps that session as is
+	if current == 0 {
+		u, ok := r.loadTwoFactorUser(usersTable, rolesTable, userID)
+		if !ok {
+			return nil, errors.New("el usuario vinculado ya no existe")
+		}
+		// Same gate as Auth::attempt: lockout, verified account and 2FA
+		result, err := r.authenticatedLogin(prefix, usersTable, u.id, u.email, u.username, u.userToken, u.role, u.verified, u.confirmed)
+		if err != nil {
+			return nil, err
+		}
+		LogInfo("[OAuth] Login con %s para '%s' (ID: %d)", p.name, u.email, u.id)
+		profile["two_factor"] = isTwoFactorPending(result)
+	}
+	return profile, nil
+}
+
+// oauthLinkAccount finds or creates the user of a provider account
+func (r *Runtime) oauthLinkAccount(prefix, provider string, profile map[string]interface{}, current int) (int, bool, error) {
+	accounts := prefix + "oauth_accounts"
+	providerID := fmt.Sprintf("%v", profile["id"])
+	email, _ := profile["email"].(string)
+	verified, _ := profile["email_verified"].(bool)
+
+	var linked int
+	err := r.Conn().QueryRow(fmt.Sprintf("SELECT user_id FROM %s WHERE provider = ? AND provider_user_id = ?", accounts), provider, providerID).Scan(&linked)
+	if err == nil {
+		if current != 0 && current != linked {
+			return 0, false, fmt.Errorf("esta cuenta de %s ya está vinculada a otro usuario", provider)
+		}
+		return linked, false, nil
+	}
+
+	userID, created := current, false
+	if userID == 0 {
+		var existing int
+		if email != "" && r.Conn().QueryRow(fmt.Sprintf("SELECT id FROM %susers WHERE email = ?", prefix), email).Scan(&existing) == nil {
+			// An unverified email could belong to someone else
+			if !verified {
+				return 0, false, fmt.Errorf("ya existe una cuenta con %s; inicia sesión y vincula %s desde tu perfil", email, provider)
+			}
+			userID = existing
+		} else {
+			if r.Env["OAUTH_REGISTER"] == "false" {
+				return 0, false, fmt.Errorf("no hay una cuenta registrada para esta cuenta de %s", provider)
+			}
+			if email == "" {
+				return 0, false, fmt.Errorf("%s no compartió un email", provider)
+			}
+			id, err := r.oauthRegisterUser(prefix, profile)
+			if err != nil {
+				return 0, false, err
+			}
+			userID, created = id, true
+		}
+	}
+
+	_, err = r.Conn().Exec(fmt.Sprintf("INSERT INTO %s (user_id, provider, provider_user_id, email) VALUES (?, ?, ?, ?)", accounts), userID, provider, providerID, email)
+	if err != nil {
+		return 0, false, fmt.Errorf("no se pudo vincular la cuenta: %v", err)
+	}
+	r.auditAuthEvent(prefix, "oauth_link", email, "", provider+" "+providerID)
+	return userID, created, nil
+}
+
+// oauthRegisterUser creates the user of a new provider account. Its random
+// password can be replaced with Auth::forgotPassword.
+func (r *Runtime) oauthRegisterUser(prefix string, profile map[string]interface{}) (int, error) {
+	email, _ := profile["email"].(string)
+	verified, _ := profile["email_verified"].(bool)
+	first, _ := profile["first_name"].(string)
+	last, _ := profile["last_name"].(string)
+	if name, _ := profile["name"].(string); first == "" && name != "" {
+		first, last, _ = strings.Cut(name, " ")
+	}
+	username, _ := profile["username"].(string)
+	if username == "" {
+		username, _, _ = strings.Cut(email, "@")
+	}
+	if len(username) > 50 {
+		username = username[:50]
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(randomURLToken(32)), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+	verificado := 0
+	if verified {
+		verificado = 1
+	}
+	// Every profile value is bound: insertFromMap would send some strings
+	// ("NULL", "NOW()") as raw SQL
+	_, err = r.Conn().Exec(fmt.Sprintf(`INSERT INTO %susers (user_token, username, first_name, last_name, email, phone, password, role_id, token_expires_at, verificado, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`, prefix),
+		uuid.New().String(), username, first, last, email, "", string(hashed), 2,
+		Now().Add(24*time.Hour).Format("2006-01-02 15:04:05"), verificado)
+	if err != nil {
+		return 0, fmt.Errorf("no se pudo registrar el usuario: %v", err)
+	}
+
+	var id int
+	if err := r.Conn().QueryRow(fmt.Sprintf("SELECT id FROM %susers WHERE email = ?", prefix), email).Scan(&id); err != nil {
+		return 0, fmt.Errorf("no se pudo registrar el usuario: %v", err)
+	}
+	fmt.Printf("[OAuth] Usuario '%s' registrado con %s\n", email, profile["provider"])
+	return id, nil
+}
+
+// ensureOAuthTables creates the table of linked provider accounts
+func (r *Runtime) ensureOAuthTables(prefix string) {
+	accounts := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %soauth_accounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider VARCHAR(50) NOT NULL,
+		provider_user_id VARCHAR(191) NOT NULL,
+		email VARCHAR(100),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (provider, provider_user_id)
+	);`, prefix)
+	if r.DBDriver() == "postgres" {
+		accounts = postgresDDL(accounts)
+	} else if val, ok := r.Env["DB"]; ok && val == "mysql" {
+		accounts = strings.Replace(accounts, "id INTEGER PRIMARY KEY AUTOINCREMENT", "id INT AUTO_INCREMENT PRIMARY KEY", 1)
+	}
+	r.GetDB().Exec(accounts)
+}
@@ -0,0 +1,445 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OAuth2 / OpenID Connect client behind the OAuth module.
+//
+// Providers are configured in env.joss as OAUTH_<NAME>_CLIENT_ID and
+// OAUTH_<NAME>_CLIENT_SECRET, plus optional _REDIRECT_URI and _SCOPES.
+// google, microsoft (OAUTH_MICROSOFT_TENANT, default "common") and github
+// have presets; any other name needs OAUTH_<NAME>_ISSUER for OIDC discovery,
+// or explicit _AUTHORIZE_URL, _TOKEN_URL and _USERINFO_URL endpoints.
+//
+// The flow is authorization code with PKCE (S256). The id_token of OIDC
+// providers is checked against the JWKS of the issuer: RS256 signature,
+// issuer, audience, expiry and the nonce sent with the redirect.
+
+type oauthProvider struct {
+	name         string
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	scopes       []string
+	issuer       string
+	authorizeURL string
+	tokenURL     string
+	userinfoURL  string
+	jwksURI      string
+	github       bool
+}
+
+var oauthPresets = map[string]oauthProvider{
+	"google":    {issuer: "https://accounts.google.com"},
+	"microsoft": {issuer: "https://login.microsoftonline.com/{tenant}/v2.0"},
+	"github": {
+		authorizeURL: "https://github.com/login/oauth/authorize",
+		tokenURL:     "https://github.com/login/oauth/access_token",
+		userinfoURL:  "https://api.github.com/user",
+		scopes:       []string{"read:user", "user:email"},
+		github:       true,
+	},
+}
+
+var oauthHTTP = &http.Client{Timeout: 10 * time.Second}
+
+// oidcDocument is the part of /.well-known/openid-configuration we use
+type oidcDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+var (
+	oidcDocuments sync.Map // issuer -> *oidcDocument
+	oidcKeys      sync.Map // jwks uri -> *jwksCache
+)
+
+// oauthProvider resolves the configuration of a provider by name
+func (r *Runtime) oauthProvider(name string) (*oauthProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	key := "OAUTH_" + strings.ToUpper(name) + "_"
+	env := func(k string) string { return strings.TrimSpace(r.Env[key+k]) }
+
+	p := oauthPresets[name]
+	p.name = name
+	if p.clientID = env("CLIENT_ID"); name == "" || p.clientID == "" {
+		return nil, fmt.Errorf("el proveedor '%s' no está configurado (falta %sCLIENT_ID)", name, key)
+	}
+	p.clientSecret = env("CLIENT_SECRET")
+	p.redirectURI = env("REDIRECT_URI")
+	if p.redirectURI == "" {
+		// Never derived from the Host header, which the client controls
+		base := strings.TrimSuffix(strings.TrimSpace(r.Env["APP_URL"]), "/")
+		if base == "" {
+			return nil, fmt.Errorf("falta APP_URL (o %sREDIRECT_URI) para construir la URL de retorno", key)
+		}
+		p.redirectURI = base + "/auth/" + name + "/callback"
+	}
+	if v := env("ISSUER"); v != "" {
+		p.issuer = strings.TrimSuffix(v, "/")
+	}
+	if v := env("AUTHORIZE_URL"); v != "" {
+		p.authorizeURL = v
+	}
+	if v := env("TOKEN_URL"); v != "" {
+		p.tokenURL = v
+	}
+	if v := env("USERINFO_URL"); v != "" {
+		p.userinfoURL = v
+	}
+	if v := env("SCOPES"); v != "" {
+		p.scopes = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	}
+
+	if p.issuer != "" {
+		tenant := env("TENANT")
+		if tenant == "" {
+			tenant = "common"
+		}
+		p.issuer = strings.ReplaceAll(p.issuer, "{tenant}", tenant)
+		doc, err := oidcDiscover(p.issuer)
+		if err != nil {
+			return nil, err
+		}
+		// Multi-tenant issuers come back as a template ({tenantid})
+		if doc.Issuer != "" {
+			p.issuer = doc.Issuer
+		}
+		if p.authorizeURL == "" {
+			p.authorizeURL = doc.AuthorizationEndpoint
+		}
+		if p.tokenURL == "" {
+			p.tokenURL = doc.TokenEndpoint
+		}
+		if p.userinfoURL == "" {
+			p.userinfoURL = doc.UserinfoEndpoint
+		}
+		p.jwksURI = doc.JwksURI
+		if len(p.scopes) == 0 {
+			p.scopes = []string{"openid", "email", "profile"}
+		}
+	}
+	if p.authorizeURL == "" || p.tokenURL == "" {
+		return nil, fmt.Errorf("el proveedor '%s' necesita %sISSUER, o %sAUTHORIZE_URL y %sTOKEN_URL", name, key, key, key)
+	}
+	return &p, nil
+}
+
+func oidcDiscover(issuer string) (*oidcDocument, error) {
+	if doc, ok := oidcDocuments.Load(issuer); ok {
+		return doc.(*oidcDocument), nil
+	}
+	var doc oidcDocument
+	if err := oauthGetJSON(issuer+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, fmt.Errorf("no se pudo leer la configuración OIDC de %s: %v", issuer, err)
+	}
+	oidcDocuments.Store(issuer, &doc)
+	return &doc, nil
+}
+
+// jwksCache holds the keys of one JWKS endpoint
+type jwksCache struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+// jwksRefetchInterval is the minimum time between two downloads of a JWKS,
+// so id_tokens with made-up kids cannot make us hammer the provider
+const jwksRefetchInterval = time.Minute
+
+// oidcKey returns the RSA key kid of a JWKS, fetching it again when the
+// provider rotated its keys. An unknown kid is answered from the cache
+// until jwksRefetchInterval has passed since the last download.
+func oidcKey(jwksURI, kid string) (*rsa.PublicKey, error) {
+	lookup := func(keys map[string]*rsa.PublicKey) *rsa.PublicKey {
+		if key, ok := keys[kid]; ok {
+			return key
+		}
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key
+			}
+		}
+		return nil
+	}
+	v, _ := oidcKeys.LoadOrStore(jwksURI, &jwksCache{})
+	c := v.(*jwksCache)
+	// One download at a time per endpoint; waiting requests see its keys
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key := lookup(c.keys); key != nil {
+		return key, nil
+	}
+	if !c.fetched.IsZero() && Now().Sub(c.fetched) < jwksRefetchInterval {
+		return nil, fmt.Errorf("clave '%s' no encontrada en %s", kid, jwksURI)
+	}
+
+	// Failed downloads count too, or a down provider would be hit per login
+	c.fetched = Now()
+	keys, err := fetchJWKS(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	if key := lookup(keys); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("clave '%s' no encontrada en %s", kid, jwksURI)
+}
+
+func fetchJWKS(jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := oauthGetJSON(jwksURI, "", &set); err != nil {
+		return nil, fmt.Errorf("no se pudieron leer las claves del proveedor: %v", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+func oauthGetJSON(endpoint, bearer string, out interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	// GitHub's API rejects requests without a User-Agent
+	req.Header.Set("User-Agent", "JosSecurity")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := oauthHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s respondió %d: %s", endpoint, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// randomURLToken returns n random bytes, base64url encoded
+func randomURLToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// pkceChallenge is the S256 code challenge of a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *oauthProvider) oidc() bool {
+	return p.jwksURI != ""
+}
+
+// authURL builds the authorization request; extra adds provider specific
+// parameters (prompt, login_hint, hd...)
+func (p *oauthProvider) authURL(state, verifier, nonce string, extra map[string]interface{}) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", p.redirectURI)
+	q.Set("scope", strings.Join(p.scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	if p.oidc() {
+		q.Set("nonce", nonce)
+	}
+	for k, v := range extra {
+		if v != nil {
+			q.Set(k, fmt.Sprintf("%v", v))
+		}
+	}
+	sep := "?"
+	if strings.Contains(p.authorizeURL, "?") {
+		sep = "&"
+	}
+	return p.authorizeURL + sep + q.Encode()
+}
+
+// exchange trades the authorization code for the provider tokens
+func (p *oauthProvider) exchange(code, verifier string) (map[string]interface{}, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURI)
+	form.Set("client_id", p.clientID)
+	form.Set("code_verifier", verifier)
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+	req, err := http.NewRequest("POST", p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauthHTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo contactar al proveedor: %v", err)
+	}
+	defer resp.Body.Close()
+
+	tokens := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("respuesta inválida del proveedor (%d)", resp.StatusCode)
+	}
+	if e, ok := tokens["error"]; ok {
+		return nil, fmt.Errorf("el proveedor rechazó el código: %v %v", e, tokens["error_description"])
+	}
+	if _, ok := tokens["access_token"].(string); !ok || resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("el proveedor no entregó un access_token (%d)", resp.StatusCode)
+	}
+	return tokens, nil
+}
+
+// verifyIDToken validates an id_token and returns its claims
+func (p *oauthProvider) verifyIDToken(raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return oidcKey(p.jwksURI, kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(p.clientID), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("id_token inválido: %v", err)
+	}
+	issuer := strings.ReplaceAll(p.issuer, "{tenantid}", fmt.Sprintf("%v", claims["tid"]))
+	if claims["iss"] != issuer {
+		return nil, fmt.Errorf("id_token de otro emisor: %v", claims["iss"])
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("el nonce del id_token no coincide")
+	}
+	return claims, nil
+}
+
+// fetchProfile reads the user of the tokens and normalizes it to
+// {"provider", "id", "email", "email_verified", "name", "first_name",
+// "last_name", "username", "avatar"}
+func (p *oauthProvider) fetchProfile(tokens map[string]interface{}, nonce string) (map[string]interface{}, error) {
+	accessToken, _ := tokens["access_token"].(string)
+	claims := map[string]interface{}{}
+
+	if p.oidc() {
+		raw, ok := tokens["id_token"].(string)
+		if !ok {
+			return nil, fmt.Errorf("el proveedor no entregó un id_token")
+		}
+		idClaims, err := p.verifyIDToken(raw, nonce)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range idClaims {
+			claims[k] = v
+		}
+	}
+	if p.userinfoURL != "" {
+		info := map[string]interface{}{}
+		if err := oauthGetJSON(p.userinfoURL, accessToken, &info); err != nil {
+			return nil, fmt.Errorf("no se pudo leer el perfil: %v", err)
+		}
+		// The id_token subject wins over a mismatching userinfo response
+		if sub, ok := claims["sub"]; ok && info["sub"] != nil && info["sub"] != sub {
+			return nil, fmt.Errorf("el perfil no corresponde al id_token")
+		}
+		for k, v := range info {
+			if k != "sub" || claims["sub"] == nil {
+				claims[k] = v
+			}
+		}
+	}
+
+	str := func(key string) string {
+		if v, ok := claims[key]; ok && v != nil {
+			return strings.TrimSpace(fmt.Sprintf("%v", v))
+		}
+		return ""
+	}
+	profile := map[string]interface{}{"provider": p.name}
+
+	if p.github {
+		// GitHub ids are numbers; keep them as plain digits
+		if id, ok := claims["id"].(float64); ok {
+			profile["id"] = fmt.Sprintf("%.0f", id)
+		}
+		profile["username"] = str("login")
+		profile["name"] = str("name")
+		profile["avatar"] = str("avatar_url")
+		email, verified := p.githubEmail(accessToken)
+		profile["email"], profile["email_verified"] = email, verified
+	} else {
+		profile["id"] = str("sub")
+		profile["email"] = str("email")
+		profile["email_verified"] = claims["email_verified"] == true || claims["email_verified"] == "true"
+		profile["name"] = str("name")
+		profile["first_name"] = str("given_name")
+		profile["last_name"] = str("family_name")
+		profile["username"] = str("preferred_username")
+		profile["avatar"] = str("picture")
+	}
+	if profile["id"] == nil || profile["id"] == "" {
+		return nil, fmt.Errorf("el proveedor no entregó un identificador de usuario")
+	}
+	return profile, nil
+}
+
+// githubEmail returns the primary email of a GitHub account
+func (p *oauthProvider) githubEmail(accessToken string) (string, bool) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	endpoint := strings.TrimSuffix(p.userinfoURL, "/user") + "/user/emails"
+	if err := oauthGetJSON(endpoint, accessToken, &emails); err != nil {
+		return "", false
+	}
+	for _, e := range emails {
+		if e.Primary {
+			return e.Email, e.Verified
+		}
+	}
+	return "", false
+}
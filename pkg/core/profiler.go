@@ -0,0 +1,439 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jossecurity/joss/pkg/parser"
+)
+
+// Profiler samples the Joss call stack of every busy runtime at a fixed rate
+// and attributes wall time and heap allocations to Joss functions (Class::method)
+// and the file:line being executed. Go's pprof only sees interpreter internals.
+type Profiler struct {
+	mu       sync.Mutex
+	interval time.Duration
+	started  time.Time
+	stopped  time.Time
+	output   string // base path: <output>.pb.gz and <output>.folded
+	stacks   map[*profileStack]struct{}
+	samples  map[string]*profileSample
+	done     chan struct{}
+
+	lastBytes   uint64
+	lastObjects uint64
+}
+
+type profileFrame struct {
+	Name      string
+	File      string
+	StartLine int // line where the function is declared
+	Line      int // line currently executing
+}
+
+// profileStack is the Joss call stack of one runtime
+type profileStack struct {
+	mu     sync.Mutex
+	frames []profileFrame
+}
+
+type profileSample struct {
+	Frames  []profileFrame // root first
+	Count   int64
+	Nanos   int64
+	Bytes   int64
+	Objects int64
+}
+
+var (
+	activeProfiler atomic.Pointer[Profiler]
+	profilerStart  sync.Once
+	profilerFlush  sync.Mutex
+)
+
+// StartProfiler starts sampling at hz samples per second. The profile is written
+// to output (.pb.gz + .folded) by FlushProfiler, which the server calls on
+// shutdown. Only the first call starts a profiler; later calls return it.
+func StartProfiler(output string, hz int) *Profiler {
+	profilerStart.Do(func() {
+		if hz <= 0 {
+			hz = 100
+		}
+		p := &Profiler{
+			interval: time.Second / time.Duration(hz),
+			started:  time.Now(),
+			output:   output,
+			stacks:   make(map[*profileStack]struct{}),
+			samples:  make(map[string]*profileSample),
+			done:     make(chan struct{}),
+		}
+		p.lastBytes, p.lastObjects = heapAllocs()
+		activeProfiler.Store(p)
+		go p.loop()
+		fmt.Printf("[Profiler] Muestreando a %d Hz -> %s.pb.gz\n", hz, output)
+	})
+	return activeProfiler.Load()
+}
+
+// ActiveProfiler returns the running profiler or nil
+func ActiveProfiler() *Profiler {
+	return activeProfiler.Load()
+}
+
+// FlushProfiler stops the active profiler, writes its files and prints a summary
+func FlushProfiler() {
+	profilerFlush.Lock()
+	defer profilerFlush.Unlock()
+
+	p := activeProfiler.Swap(nil)
+	if p == nil {
+		return
+	}
+	p.Stop()
+	files, err := p.WriteFiles(p.output)
+	if err != nil {
+		LogError("[Profiler] No se pudo escribir el perfil: %v", err)
+		return
+	}
+	fmt.Print(p.Summary(10))
+	for _, f := range files {
+		fmt.Printf("[Profiler] Escrito %s\n", f)
+	}
+}
+
+// ProfileOutput resolves JOSS_PROFILE (process env first, then env.joss).
+// "1"/"true" selects a timestamped default; "" or "0"/"false" disables profiling.
+func ProfileOutput(env map[string]string) string {
+	val := os.Getenv("JOSS_PROFILE")
+	if val == "" && env != nil {
+		val = env["JOSS_PROFILE"]
+	}
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "", "0", "false", "off":
+		return ""
+	case "1", "true", "on":
+		return DefaultProfileOutput()
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(val, ".gz"), ".pb")
+}
+
+// ProfileRate resolves JOSS_PROFILE_HZ (default 100)
+func ProfileRate(env map[string]string) int {
+	val := os.Getenv("JOSS_PROFILE_HZ")
+	if val == "" && env != nil {
+		val = env["JOSS_PROFILE_HZ"]
+	}
+	if hz, err := strconv.Atoi(val); err == nil && hz > 0 {
+		return hz
+	}
+	return 100
+}
+
+// DefaultProfileOutput returns storage/profiles/joss-<timestamp>
+func DefaultProfileOutput() string {
+	return filepath.Join("storage", "profiles", "joss-"+time.Now().Format("20060102-150405"))
+}
+
+// Stop ends sampling; collected samples are kept
+func (p *Profiler) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped.IsZero() {
+		p.stopped = time.Now()
+		close(p.done)
+	}
+}
+
+func (p *Profiler) loop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.sample()
+		}
+	}
+}
+
+// heapAllocs returns cumulative heap allocations (bytes, objects)
+func heapAllocs() (uint64, uint64) {
+	s := []metrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/gc/heap/allocs:objects"},
+	}
+	metrics.Read(s)
+	var bytes, objects uint64
+	if s[0].Value.Kind() == metrics.KindUint64 {
+		bytes = s[0].Value.Uint64()
+	}
+	if s[1].Value.Kind() == metrics.KindUint64 {
+		objects = s[1].Value.Uint64()
+	}
+	return bytes, objects
+}
+
+func (p *Profiler) sample() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bytes, objects := heapAllocs()
+	dBytes, dObjects := bytes-p.lastBytes, objects-p.lastObjects
+	p.lastBytes, p.lastObjects = bytes, objects
+
+	var snapshots [][]profileFrame
+	for s := range p.stacks {
+		s.mu.Lock()
+		if len(s.frames) > 0 {
+			snap := make([]profileFrame, len(s.frames))
+			copy(snap, s.frames)
+			snapshots = append(snapshots, snap)
+		}
+		s.mu.Unlock()
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+
+	// Allocations are process-wide; split them evenly between the busy stacks
+	share := int64(len(snapshots))
+	for _, frames := range snapshots {
+		key := foldedKey(frames)
+		smp, ok := p.samples[key]
+		if !ok {
+			smp = &profileSample{Frames: frames}
+			p.samples[key] = smp
+		}
+		smp.Count++
+		smp.Nanos += int64(p.interval)
+		smp.Bytes += int64(dBytes) / share
+		smp.Objects += int64(dObjects) / share
+	}
+}
+
+func (f profileFrame) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("%s:%d", f.Name, f.Line)
+	}
+	return fmt.Sprintf("%s (%s:%d)", f.Name, f.File, f.Line)
+}
+
+func foldedKey(frames []profileFrame) string {
+	parts := make([]string, len(frames))
+	for i, f := range frames {
+		parts[i] = strings.ReplaceAll(f.String(), ";", ",")
+	}
+	return strings.Join(parts, ";")
+}
+
+// sortedSamples returns samples ordered by stack for deterministic output
+func (p *Profiler) sortedSamples() []*profileSample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0, len(p.samples))
+	for k := range p.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*profileSample, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, p.samples[k])
+	}
+	return out
+}
+
+// WriteFolded writes "frame;frame;frame count" lines (flamegraph.pl, speedscope, inferno)
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range p.sortedSamples() {
+		fmt.Fprintf(bw, "%s %d\n", foldedKey(s.Frames), s.Count)
+	}
+	return bw.Flush()
+}
+
+// WriteFiles writes <base>.pb.gz (go tool pprof) and <base>.folded
+func (p *Profiler) WriteFiles(base string) ([]string, error) {
+	if dir := filepath.Dir(base); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	pprofPath := base + ".pb.gz"
+	foldedPath := base + ".folded"
+
+	f, err := os.Create(pprofPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.WritePprof(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.Close()
+
+	f, err = os.Create(foldedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := p.WriteFolded(f); err != nil {
+		return nil, err
+	}
+	return []string{pprofPath, foldedPath}, nil
+}
+
+// Summary renders the top functions by self (flat) and cumulative samples
+func (p *Profiler) Summary(n int) string {
+	samples := p.sortedSamples()
+	flat := make(map[string]int64)
+	cum := make(map[string]int64)
+	var total int64
+	for _, s := range samples {
+		total += s.Count
+		leaf := s.Frames[len(s.Frames)-1]
+		flat[leaf.Name] += s.Count
+		seen := make(map[string]bool)
+		for _, f := range s.Frames {
+			if !seen[f.Name] {
+				cum[f.Name] += s.Count
+				seen[f.Name] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Profiler] %d muestras (%s)\n", total, (time.Duration(total) * p.interval).Round(time.Millisecond))
+	if total == 0 {
+		return sb.String()
+	}
+	names := make([]string, 0, len(cum))
+	for name := range cum {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if flat[names[i]] != flat[names[j]] {
+			return flat[names[i]] > flat[names[j]]
+		}
+		if cum[names[i]] != cum[names[j]] {
+			return cum[names[i]] > cum[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	fmt.Fprintf(&sb, "  %6s %6s  %s\n", "flat%", "cum%", "función")
+	for _, name := range names {
+		fmt.Fprintf(&sb, "  %5.1f%% %5.1f%%  %s\n",
+			100*float64(flat[name])/float64(total),
+			100*float64(cum[name])/float64(total), name)
+	}
+	return sb.String()
+}
+
+// --- Runtime integration ---
+
+// profileFrameFor names a user function as Class::method with its source file
+func (r *Runtime) profileFrameFor(method *parser.MethodStatement, instance *Instance) profileFrame {
+	frame := profileFrame{StartLine: method.Token.Line, Line: method.Token.Line}
+	name := "{closure}"
+	if method.Name != nil && method.Name.Value != "anonymous" {
+		name = method.Name.Value
+	}
+	if info, ok := lookupSource(method); ok {
+		frame.File = info.File
+		if info.Class != "" {
+			name = info.Class + "::" + name
+		}
+	} else {
+		if instance != nil && instance.Class != nil && instance.Class.Name != nil {
+			name = instance.Class.Name.Value + "::" + name
+		}
+		// Closures report the file that declares them, or inherit the file
+		// of the code that calls them
+		if info, ok := lookupBlockSource(method.Body); ok {
+			frame.File = info.File
+		} else if r.profile != nil {
+			r.profile.mu.Lock()
+			if n := len(r.profile.frames); n > 0 {
+				frame.File = r.profile.frames[n-1].File
+			}
+			r.profile.mu.Unlock()
+		}
+	}
+	frame.Name = name
+	return frame
+}
+
+// profileEnter pushes a frame; the stack is registered with the profiler while
+// non-empty. p is nil when only the query log needs the stack.
+func (r *Runtime) profileEnter(p *Profiler, frame profileFrame) {
+	if r.profile == nil {
+		r.profile = &profileStack{}
+	}
+	s := r.profile
+	s.mu.Lock()
+	s.frames = append(s.frames, frame)
+	first := len(s.frames) == 1
+	s.mu.Unlock()
+
+	if first && p != nil {
+		p.mu.Lock()
+		p.stacks[s] = struct{}{}
+		p.mu.Unlock()
+	}
+}
+
+func (r *Runtime) profileLeave(p *Profiler) {
+	s := r.profile
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if len(s.frames) > 0 {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+	empty := len(s.frames) == 0
+	s.mu.Unlock()
+
+	if empty && p != nil {
+		p.mu.Lock()
+		delete(p.stacks, s)
+		p.mu.Unlock()
+	}
+}
+
+// profileLine records the line being executed by the innermost frame
+func (r *Runtime) profileLine(stmt parser.Statement) {
+	line := statementLine(stmt)
+	if line == 0 {
+		return
+	}
+	s := r.profile
+	s.mu.Lock()
+	if n := len(s.frames); n > 0 {
+		s.frames[n-1].Line = line
+	}
+	s.mu.Unlock()
+}
+
+// ProfileScript pushes the top-level "main" frame for a script; call the returned func when done
+func (r *Runtime) ProfileScript(filename string) func() {
+	p := activeProfiler.Load()
+	if p == nil {
+		return func() {}
+	}
+	r.profileEnter(p, profileFrame{Name: "main", File: filename, StartLine: 1, Line: 1})
+	return func() { r.profileLeave(p) }
+}
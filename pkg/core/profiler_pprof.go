@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Minimal encoder for the pprof protobuf format (profile.proto), enough for
+// `go tool pprof` and speedscope to read Joss profiles without extra deps.
+
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+func (b *protoBuffer) uintField(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *protoBuffer) intField(field int, v int64) {
+	b.uintField(field, uint64(v))
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protoBuffer) packedField(field int, vals []uint64) {
+	var inner protoBuffer
+	for _, v := range vals {
+		inner.varint(v)
+	}
+	b.bytesField(field, inner.Bytes())
+}
+
+// WritePprof writes the profile as gzipped profile.proto
+func (p *Profiler) WritePprof(w io.Writer) error {
+	samples := p.sortedSamples()
+
+	strs := []string{""}
+	strIndex := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if i, ok := strIndex[s]; ok {
+			return i
+		}
+		strIndex[s] = int64(len(strs))
+		strs = append(strs, s)
+		return strIndex[s]
+	}
+
+	type funcKey struct {
+		name, file string
+	}
+	type locKey struct {
+		fn   uint64
+		line int
+	}
+	funcs := map[funcKey]uint64{}
+	locs := map[locKey]uint64{}
+	var out protoBuffer
+
+	valueType := func(typ, unit string) []byte {
+		var vt protoBuffer
+		vt.intField(1, str(typ))
+		vt.intField(2, str(unit))
+		return vt.Bytes()
+	}
+
+	// sample_type
+	out.bytesField(1, valueType("samples", "count"))
+	out.bytesField(1, valueType("wall", "nanoseconds"))
+	out.bytesField(1, valueType("alloc_space", "bytes"))
+	out.bytesField(1, valueType("alloc_objects", "count"))
+
+	var functions, locations protoBuffer
+	for _, s := range samples {
+		ids := make([]uint64, 0, len(s.Frames))
+		// pprof stacks are leaf first
+		for i := len(s.Frames) - 1; i >= 0; i-- {
+			f := s.Frames[i]
+			fk := funcKey{f.Name, f.File}
+			fnID, ok := funcs[fk]
+			if !ok {
+				fnID = uint64(len(funcs) + 1)
+				funcs[fk] = fnID
+				var fn protoBuffer
+				fn.uintField(1, fnID)
+				fn.intField(2, str(f.Name))
+				fn.intField(3, str(f.Name))
+				fn.intField(4, str(f.File))
+				fn.intField(5, int64(f.StartLine))
+				functions.bytesField(5, fn.Bytes())
+			}
+			lk := locKey{fnID, f.Line}
+			locID, ok := locs[lk]
+			if !ok {
+				locID = uint64(len(locs) + 1)
+				locs[lk] = locID
+				var line protoBuffer
+				line.uintField(1, fnID)
+				line.intField(2, int64(f.Line))
+				var loc protoBuffer
+				loc.uintField(1, locID)
+				loc.bytesField(4, line.Bytes())
+				locations.bytesField(4, loc.Bytes())
+			}
+			ids = append(ids, locID)
+		}
+		var smp protoBuffer
+		smp.packedField(1, ids)
+		smp.packedField(2, []uint64{uint64(s.Count), uint64(s.Nanos), uint64(s.Bytes), uint64(s.Objects)})
+		out.bytesField(2, smp.Bytes())
+	}
+	out.Write(locations.Bytes())
+	out.Write(functions.Bytes())
+
+	stopped := p.stopped
+	if stopped.IsZero() {
+		stopped = p.started
+	}
+	// Register remaining strings before the string table is emitted
+	periodType := valueType("wall", "nanoseconds")
+	for _, s := range strs {
+		out.bytesField(6, []byte(s))
+	}
+	out.intField(9, p.started.UnixNano())
+	out.intField(10, int64(stopped.Sub(p.started)))
+	out.bytesField(11, periodType)
+	out.intField(12, int64(p.interval))
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(out.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
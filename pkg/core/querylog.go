@@ -0,0 +1,333 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query log: the SQL run by a runtime (one HTTP request), with bindings,
+// duration and the Joss file:line that triggered it. Configured in env.joss:
+//
+//	DB_QUERY_LOG=true     print the queries of every request
+//	DB_SLOW_QUERY_MS=200  LogError for queries slower than 200ms
+//	DB_N1_THRESHOLD=5     warn when the same query runs 5+ times in a request
+//	DB_LOG_BINDINGS=true  write binding values to the console and log.txt
+//	DEBUG_TOOLBAR=true    query toolbar in HTML responses (ignored in production)
+//
+// Every query goes through Conn()/ReadConn(), so builder, model, Auth, Cron,
+// Schema and GranDB::query() statements are all recorded.
+
+// QueryEntry is one statement of the query log
+type QueryEntry struct {
+	SQL      string
+	Bindings []interface{}
+	Duration time.Duration
+	File     string // Joss file that ran the query ("" if unknown)
+	Line     int
+	Error    string
+}
+
+// queryLog collects the entries of a runtime while logging is on
+type queryLog struct {
+	mu      sync.Mutex
+	entries []QueryEntry
+}
+
+// NPlusOne is a query shape repeated in one request
+type NPlusOne struct {
+	SQL   string
+	Count int
+	File  string
+	Line  int
+}
+
+func envFlag(env map[string]string, key string) bool {
+	switch strings.ToLower(strings.TrimSpace(env[key])) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+	return false
+}
+
+// slowQueryThreshold returns DB_SLOW_QUERY_MS as a duration (0 = disabled)
+func slowQueryThreshold(env map[string]string) time.Duration {
+	ms, err := strconv.Atoi(strings.TrimSpace(env["DB_SLOW_QUERY_MS"]))
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// nPlusOneThreshold returns DB_N1_THRESHOLD (0 = disabled)
+func nPlusOneThreshold(env map[string]string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(env["DB_N1_THRESHOLD"]))
+	if err != nil || n < 2 {
+		return 0
+	}
+	return n
+}
+
+// DebugToolbarEnabled reports whether DEBUG_TOOLBAR is on outside production
+func DebugToolbarEnabled(env map[string]string) bool {
+	return envFlag(env, "DEBUG_TOOLBAR") && !strings.EqualFold(env["APP_ENV"], "production")
+}
+
+// StartQueryLog turns the query log on for a request when the query log,
+// slow-query threshold, N+1 detector or toolbar are configured
+func (r *Runtime) StartQueryLog() bool {
+	if envFlag(r.Env, "DB_QUERY_LOG") || slowQueryThreshold(r.Env) > 0 ||
+		nPlusOneThreshold(r.Env) > 0 || DebugToolbarEnabled(r.Env) {
+		r.EnableQueryLog()
+		return true
+	}
+	return false
+}
+
+// EnableQueryLog starts recording queries (GranDB::enableQueryLog())
+func (r *Runtime) EnableQueryLog() {
+	if r.queries == nil {
+		r.queries = &queryLog{}
+	}
+}
+
+// DisableQueryLog stops recording and drops the entries
+func (r *Runtime) DisableQueryLog() {
+	r.queries = nil
+}
+
+// QueryLog returns the recorded queries
+func (r *Runtime) QueryLog() []QueryEntry {
+	if r.queries == nil {
+		return nil
+	}
+	r.queries.mu.Lock()
+	defer r.queries.mu.Unlock()
+	return append([]QueryEntry(nil), r.queries.entries...)
+}
+
+// FinishQueryLog ends the log of a request: prints it (DB_QUERY_LOG), warns
+// about N+1 patterns and returns the entries
+func (r *Runtime) FinishQueryLog(label string) []QueryEntry {
+	entries := r.QueryLog()
+	r.DisableQueryLog()
+
+	if envFlag(r.Env, "DB_QUERY_LOG") && len(entries) > 0 {
+		fmt.Print(FormatQueryLog(label, entries, envFlag(r.Env, "DB_LOG_BINDINGS")))
+	}
+	if n := nPlusOneThreshold(r.Env); n > 0 {
+		for _, w := range DetectNPlusOne(entries, n) {
+			LogWarning("[GranDB] Posible N+1 en %s: la misma consulta se ejecutó %d veces (%s): %s",
+				label, w.Count, queryLocation(w.File, w.Line), w.SQL)
+		}
+	}
+	return entries
+}
+
+// formatBindings renders the bindings of a statement. They carry passwords,
+// tokens and personal data, so only their count is shown unless show is set
+func formatBindings(bindings []interface{}, show bool) string {
+	if show {
+		return fmt.Sprintf("%v", bindings)
+	}
+	return fmt.Sprintf("[%d valor(es) ocultos]", len(bindings))
+}
+
+// FormatQueryLog renders entries as a console report; binding values are
+// masked unless showBindings is set
+func FormatQueryLog(label string, entries []QueryEntry, showBindings bool) string {
+	var sb strings.Builder
+	var total time.Duration
+	for _, e := range entries {
+		total += e.Duration
+	}
+	fmt.Fprintf(&sb, "[QueryLog] %s: %d consultas, %s\n", label, len(entries), formatDuration(total))
+	for i, e := range entries {
+		fmt.Fprintf(&sb, "  %3d. %8s  %s  %s", i+1, formatDuration(e.Duration), queryLocation(e.File, e.Line), e.SQL)
+		if len(e.Bindings) > 0 {
+			fmt.Fprintf(&sb, "  %s", formatBindings(e.Bindings, showBindings))
+		}
+		if e.Error != "" {
+			fmt.Fprintf(&sb, "  ERROR: %s", e.Error)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+var (
+	shapeStrings = regexp.MustCompile(`'(?:[^']|'')*'`)
+	shapeNumbers = regexp.MustCompile(`\b\d+(\.\d+)?\b`)
+	shapeLists   = regexp.MustCompile(`\(\s*\?(\s*,\s*\?)*\s*\)`)
+	shapeSpaces  = regexp.MustCompile(`\s+`)
+)
+
+// queryShape normalizes a statement so the same query with other values
+// (inline literals or a different number of IN items) compares equal
+func queryShape(query string) string {
+	shape := shapeStrings.ReplaceAllString(query, "?")
+	shape = shapeNumbers.ReplaceAllString(shape, "?")
+	shape = shapeLists.ReplaceAllString(shape, "(?)")
+	return strings.TrimSpace(shapeSpaces.ReplaceAllString(shape, " "))
+}
+
+// DetectNPlusOne returns the SELECT shapes that ran at least threshold times,
+// most repeated first
+func DetectNPlusOne(entries []QueryEntry, threshold int) []NPlusOne {
+	counts := make(map[string]*NPlusOne)
+	var order []string
+	for _, e := range entries {
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(e.SQL)), "SELECT") {
+			continue
+		}
+		shape := queryShape(e.SQL)
+		w, ok := counts[shape]
+		if !ok {
+			w = &NPlusOne{SQL: shape, File: e.File, Line: e.Line}
+			counts[shape] = w
+			order = append(order, shape)
+		}
+		w.Count++
+	}
+	var result []NPlusOne
+	for _, shape := range order {
+		if w := counts[shape]; w.Count >= threshold {
+			result = append(result, *w)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Count > result[j].Count })
+	return result
+}
+
+func queryLocation(file string, line int) string {
+	if file == "" {
+		return "(origen desconocido)"
+	}
+	if line <= 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d.Microseconds())/1000)
+}
+
+// queryCaller returns the Joss file:line being executed. Views are compiled
+// to a script, so their queries report only the view file.
+func (r *Runtime) queryCaller() (string, int) {
+	s := r.profile
+	if s == nil {
+		return "", 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		if f := s.frames[i]; f.File != "" {
+			if strings.HasSuffix(f.File, ".html") {
+				return f.File, 0
+			}
+			return f.File, f.Line
+		}
+	}
+	return "", 0
+}
+
+// QueryFrame pushes a frame for a script or test method, so queries logged
+// after GranDB::enableQueryLog() in its body report file:line; call the
+// returned func when done. With the profiler on the frames already exist.
+func (r *Runtime) QueryFrame(name, file string) func() {
+	if activeProfiler.Load() != nil {
+		return func() {}
+	}
+	r.profileEnter(nil, profileFrame{Name: name, File: file})
+	return func() { r.profileLeave(nil) }
+}
+
+// recordQuery adds a statement to the log and reports it if it was slow
+func (r *Runtime) recordQuery(query string, args []interface{}, start time.Time, err error) {
+	elapsed := time.Since(start)
+	slow := slowQueryThreshold(r.Env)
+	if r.queries == nil && (slow == 0 || elapsed < slow) {
+		return
+	}
+
+	file, line := r.queryCaller()
+	entry := QueryEntry{SQL: strings.TrimSpace(query), Bindings: args, Duration: elapsed, File: file, Line: line}
+	if err != nil && err != sql.ErrNoRows {
+		entry.Error = err.Error()
+	}
+	if q := r.queries; q != nil {
+		q.mu.Lock()
+		q.entries = append(q.entries, entry)
+		q.mu.Unlock()
+	}
+	if slow > 0 && elapsed >= slow {
+		msg := fmt.Sprintf("[GranDB] Consulta lenta (%s) en %s: %s", formatDuration(elapsed), queryLocation(file, line), entry.SQL)
+		if len(args) > 0 {
+			msg += " " + formatBindings(args, envFlag(r.Env, "DB_LOG_BINDINGS"))
+		}
+		LogError("%s", msg)
+	}
+}
+
+// loggedConn times the statements of a connection for the query log
+type loggedConn struct {
+	r    *Runtime
+	conn dbExecutor
+}
+
+func (c *loggedConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := c.conn.Exec(query, args...)
+	c.r.recordQuery(query, args, start, err)
+	return res, err
+}
+
+func (c *loggedConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := c.conn.Query(query, args...)
+	c.r.recordQuery(query, args, start, err)
+	return rows, err
+}
+
+func (c *loggedConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := c.conn.QueryRow(query, args...)
+	c.r.recordQuery(query, args, start, row.Err())
+	return row
+}
+
+// observe wraps conn when the query log or the slow-query threshold is on
+func (r *Runtime) observe(conn dbExecutor) dbExecutor {
+	if r.queries == nil && slowQueryThreshold(r.Env) == 0 {
+		return conn
+	}
+	return &loggedConn{r: r, conn: conn}
+}
+
+// queryLogMaps converts entries for GranDB::getQueryLog()
+func queryLogMaps(entries []QueryEntry) []interface{} {
+	list := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		bindings := make([]interface{}, len(e.Bindings))
+		copy(bindings, e.Bindings)
+		item := map[string]interface{}{
+			"sql":      e.SQL,
+			"bindings": bindings,
+			"time":     float64(e.Duration.Microseconds()) / 1000,
+			"file":     e.File,
+			"line":     int64(e.Line),
+		}
+		if e.Error != "" {
+			item["error"] = e.Error
+		}
+		list = append(list, item)
+	}
+	return list
+}
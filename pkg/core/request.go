@@ -53,7 +53,7 @@ func (r *Runtime) executeRequestMethod(instance *Instance, method string, args [
 				result := make(map[string]interface{})
 				for k, v := range reqInstance.Fields {
 					// exclude internal fields starting with _
-					if k != "_headers" && k != "_host" && k != "_scheme" && k != "_files" && k != "_cookies" && k != "_method" && k != "_referer" && k != "_token" {
+					if k != "_headers" && k != "_host" && k != "_scheme" && k != "_files" && k != "_cookies" && k != "_method" && k != "_referer" && k != "_token" && k != "_path" && k != "_query" && k != "_ip" {
 						result[k] = v
 					}
 				}
@@ -76,7 +76,7 @@ func (r *Runtime) executeRequestMethod(instance *Instance, method string, args [
 					result := make(map[string]interface{})
 					for k, v := range reqInstance.Fields {
 						// exclude internal fields
-						if !excludeMap[k] && k != "_headers" && k != "_host" && k != "_scheme" && k != "_files" && k != "_cookies" && k != "_method" && k != "_referer" && k != "_token" {
+						if !excludeMap[k] && k != "_headers" && k != "_host" && k != "_scheme" && k != "_files" && k != "_cookies" && k != "_method" && k != "_referer" && k != "_token" && k != "_path" && k != "_query" && k != "_ip" {
 							result[k] = v
 						}
 					}
@@ -2,12 +2,12 @@ package core
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
-	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jossecurity/joss/pkg/crypto"
@@ -89,6 +89,16 @@ func (r *Runtime) Free() {
 	// We should also clear CurrentMiddleware
 	r.CurrentMiddleware = r.CurrentMiddleware[:0]
 
+	// Never leak an unfinished transaction into the next request
+	r.closeConnections()
+	if r.tx != nil {
+		fmt.Println("[GranDB] Transacción sin cerrar al terminar la petición: rollback")
+		r.tx.tx.Rollback()
+		r.tx = nil
+	}
+	r.queries = nil
+	r.wrotePrimary = nil
+
 	runtimePool.Put(r)
 }
 
@@ -103,6 +113,7 @@ func (r *Runtime) Fork() *Runtime {
 		CurrentMiddleware: make([]string, 0),
 		CustomMiddlewares: make(map[string]interface{}),
 		DB:                r.DB, // Share DB Connection (Thread-Safe)
+		ReadDBs:           r.ReadDBs,
 		Variables:         make(map[string]interface{}),
 		VarTypes:          make(map[string]string),
 		NativeHandlers:    r.NativeHandlers, // Share Dispatch Table
@@ -283,6 +294,8 @@ func (r *Runtime) LoadEnv(fs http.FileSystem) {
 			r.Env[k] = v
 		}
 	}
+
+	configureDates(r.Env)
 }
 
 // GetDB ensures the database connection is initialized and returns it.
@@ -293,10 +306,8 @@ func (r *Runtime) GetDB() *sql.DB {
 	}
 
 	// Connect to DB lazily
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := r.DBDriver()
+	sqlDriver := dbDriver
 
 	var dsn string
 
@@ -308,17 +319,29 @@ func (r *Runtime) GetDB() *sql.DB {
 		dsn = dbPath
 		fmt.Printf("[Security] Conectando a SQLite: %s\n", dbPath)
 	} else {
-		// Default to MySQL
-		if host, ok := r.Env["DB_HOST"]; ok {
-			dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", r.Env["DB_USER"], r.Env["DB_PASS"], host, r.Env["DB_NAME"])
-			fmt.Printf("[Security] Conectando a MySQL: %s\n", host)
-		} else {
+		// MySQL (default) or PostgreSQL
+		host, hasHost := r.Env["DB_HOST"]
+		socket, hasSocket := r.Env["DB_SOCKET"]
+		if !hasHost && !(hasSocket && dbDriver == "mysql") {
 			// No DB config found
 			return nil
 		}
+		var err error
+		sqlDriver, dsn, err = driverDSN(dbDriver, r.Env)
+		if err != nil {
+			fmt.Printf("[Security] Error en configuración de base de datos: %v\n", err)
+			return nil
+		}
+		if dbDriver == "postgres" {
+			fmt.Printf("[Security] Conectando a PostgreSQL: %s\n", host)
+		} else if hasSocket && socket != "" {
+			fmt.Printf("[Security] Conectando a MySQL: %s\n", socket)
+		} else {
+			fmt.Printf("[Security] Conectando a MySQL: %s\n", host)
+		}
 	}
 
-	db, err := sql.Open(dbDriver, dsn)
+	db, err := sql.Open(sqlDriver, dsn)
 	if err == nil {
 		r.DB = db
 
@@ -334,14 +357,19 @@ func (r *Runtime) GetDB() *sql.DB {
 			}
 		}
 
-		r.EnsureCronTable()
-		r.EnsureMigrationTable()
-		r.EnsureAuthTables()
+		// A simulated migration (--pretend) must not write, not even these
+		if !r.Pretending() {
+			r.EnsureCronTable()
+			r.EnsureMigrationTable()
+			r.EnsureAuthTables()
+		}
 
 		// Connection Pooling Settings
-		db.SetMaxOpenConns(25)
-		db.SetMaxIdleConns(25)
-		db.SetConnMaxLifetime(5 * time.Minute)
+		configurePool(db, r.Env)
+
+		if dbDriver != "sqlite" {
+			r.openReplicas(dbDriver)
+		}
 	} else {
 		fmt.Printf("[Security] Error fatal de conexión SQL: %v\n", err)
 	}
@@ -373,3 +401,28 @@ func (i *Instance) Clone() *Instance {
 	}
 	return newI
 }
+
+// String prints dates as "Y-m-d H:i:s" ("Y-m-d" for DATE columns); other
+// instances keep Go's default format
+func (i *Instance) String() string {
+	if _, ok := dateValue(i); ok {
+		return instanceDateString(i)
+	}
+	return fmt.Sprintf("&%v", *i)
+}
+
+// MarshalJSON encodes dates with dateJSON and models as their attributes
+// (minus hidden) and loaded relations
+func (i *Instance) MarshalJSON() ([]byte, error) {
+	if t, ok := dateValue(i); ok {
+		if isDateOnly(i) {
+			return json.Marshal(t.Format("2006-01-02"))
+		}
+		return dateJSON(t)
+	}
+	if isModel(i) {
+		return json.Marshal(modelArray(i, false))
+	}
+	type plainInstance Instance
+	return json.Marshal((*plainInstance)(i))
+}
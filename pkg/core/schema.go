@@ -13,10 +13,7 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 		return nil
 	}
 
-	dbDriver := "mysql"
-	if val, ok := r.Env["DB"]; ok {
-		dbDriver = val
-	}
+	dbDriver := r.DBDriver()
 
 	switch method {
 	case "create":
@@ -32,7 +29,7 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 				tableName = prefix + tableName
 			}
 
-			var definitions []string
+			var definitions, after []string
 
 			// Check if second argument is a function (closure-based approach)
 			if fnLit, ok := args[1].(*parser.FunctionLiteral); ok {
@@ -67,6 +64,11 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 						definitions = append(definitions, def)
 					}
 				}
+
+				// Foreign keys and indexes
+				constraints, indexes := r.tableConstraints(tableName, blueprint, dbDriver)
+				definitions = append(definitions, constraints...)
+				after = indexes
 			} else {
 				// Map-based approach (legacy)
 				colsMap, ok := args[1].(map[string]interface{})
@@ -84,10 +86,12 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 
 			query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", tableName, strings.Join(definitions, ", "))
 
-			fmt.Printf("[Schema] Ejecutando: %s\n", query)
-			_, err := r.GetDB().Exec(query)
-			if err != nil {
+			if err := r.schemaExec(query); err != nil {
 				fmt.Printf("[Schema] Error creando tabla %s: %v\n", tableName, err)
+				return nil
+			}
+			for _, query := range after {
+				r.schemaExec(query)
 			}
 		}
 
@@ -117,17 +121,8 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 				}
 				r.executeBlock(fnLit.Body)
 
-				// Handle adding columns
-				if cols, ok := blueprint.Fields["_columns"].([]map[string]string); ok {
-					for _, col := range cols {
-						def := r.buildColumnDefinition(col["name"], col["type"], dbDriver)
-						query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", tableName, def)
-						fmt.Printf("[Schema] Ejecutando: %s\n", query)
-						r.GetDB().Exec(query)
-					}
-				}
-
-				// Handle other commands (dropColumn, renameColumn) - To be implemented if needed
+				// Columns, indexes, foreign keys, drops and renames
+				r.alterTable(tableName, blueprint, dbDriver)
 			}
 		}
 
@@ -150,7 +145,7 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 			if dbDriver == "mysql" {
 				query = fmt.Sprintf("RENAME TABLE %s TO %s", from, to)
 			}
-			r.GetDB().Exec(query)
+			r.schemaExec(query)
 		}
 
 	case "drop", "dropIfExists":
@@ -164,7 +159,7 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 				tableName = prefix + tableName
 			}
 			query := fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName)
-			r.GetDB().Exec(query)
+			r.schemaExec(query)
 		}
 
 	case "hasTable":
@@ -181,10 +176,13 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 			var exists bool
 			if dbDriver == "sqlite" {
 				query := "SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?"
-				r.GetDB().QueryRow(query, tableName).Scan(&exists)
+				r.Conn().QueryRow(query, tableName).Scan(&exists)
+			} else if dbDriver == "postgres" {
+				query := "SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+				r.Conn().QueryRow(query, tableName).Scan(&exists)
 			} else {
 				query := "SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
-				r.GetDB().QueryRow(query, tableName).Scan(&exists)
+				r.Conn().QueryRow(query, tableName).Scan(&exists)
 			}
 			return exists
 		}
@@ -203,7 +201,7 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 
 			if dbDriver == "sqlite" {
 				// SQLite doesn't have a simple exists check for columns, need to parse PRAGMA
-				rows, err := r.GetDB().Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+				rows, err := r.Conn().Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
 				if err == nil {
 					defer rows.Close()
 					for rows.Next() {
@@ -223,7 +221,10 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 			} else {
 				var count int
 				query := "SELECT count(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
-				r.GetDB().QueryRow(query, tableName, columnName).Scan(&count)
+				if dbDriver == "postgres" {
+					query = "SELECT count(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?"
+				}
+				r.Conn().QueryRow(query, tableName, columnName).Scan(&count)
 				return count > 0
 			}
 		}
@@ -233,97 +234,9 @@ func (r *Runtime) executeSchemaMethod(instance *Instance, method string, args []
 
 func (r *Runtime) buildColumnDefinition(name, typeStr, driver string) string {
 	parts := strings.Split(typeStr, "|")
-	baseType := parts[0]
 	modifiers := parts[1:]
-
-	var sqlDef string
-
-	// Parse base type (handle arguments like char(100))
-	typeName := baseType
-	typeArgs := ""
-	if strings.Contains(baseType, "(") {
-		start := strings.Index(baseType, "(")
-		end := strings.LastIndex(baseType, ")")
-		typeName = baseType[:start]
-		typeArgs = baseType[start+1 : end]
-	}
-
-	switch typeName {
-	case "increments":
-		if driver == "sqlite" {
-			sqlDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
-		} else {
-			sqlDef = "INT AUTO_INCREMENT PRIMARY KEY"
-		}
-	case "bigIncrements":
-		if driver == "sqlite" {
-			sqlDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
-		} else {
-			sqlDef = "BIGINT AUTO_INCREMENT PRIMARY KEY"
-		}
-	case "tinyInteger":
-		sqlDef = "TINYINT"
-	case "smallInteger":
-		sqlDef = "SMALLINT"
-	case "mediumInteger":
-		sqlDef = "MEDIUMINT"
-	case "integer":
-		sqlDef = "INT"
-	case "bigInteger":
-		sqlDef = "BIGINT"
-	case "float":
-		sqlDef = "FLOAT"
-	case "double":
-		sqlDef = "DOUBLE"
-	case "decimal":
-		sqlDef = fmt.Sprintf("DECIMAL(%s)", typeArgs)
-	case "char":
-		sqlDef = fmt.Sprintf("CHAR(%s)", typeArgs)
-	case "string":
-		sqlDef = fmt.Sprintf("VARCHAR(%s)", typeArgs)
-	case "text":
-		sqlDef = "TEXT"
-	case "mediumText":
-		if driver == "sqlite" {
-			sqlDef = "TEXT"
-		} else {
-			sqlDef = "MEDIUMTEXT"
-		}
-	case "longText":
-		if driver == "sqlite" {
-			sqlDef = "TEXT"
-		} else {
-			sqlDef = "LONGTEXT"
-		}
-	case "date":
-		sqlDef = "DATE"
-	case "dateTime":
-		sqlDef = "DATETIME"
-	case "time":
-		sqlDef = "TIME"
-	case "timestamp":
-		sqlDef = "TIMESTAMP"
-	case "boolean":
-		if driver == "sqlite" {
-			sqlDef = "BOOLEAN"
-		} else {
-			sqlDef = "TINYINT(1)"
-		}
-	case "json":
-		if driver == "sqlite" {
-			sqlDef = "TEXT"
-		} else {
-			sqlDef = "JSON"
-		}
-	case "enum":
-		if driver == "sqlite" {
-			sqlDef = "TEXT" // SQLite doesn't support ENUM natively
-		} else {
-			sqlDef = fmt.Sprintf("ENUM(%s)", typeArgs)
-		}
-	default:
-		sqlDef = "VARCHAR(255)"
-	}
+	typeName, typeArgs := splitColumnType(parts[0])
+	sqlDef := columnSQLType(name, typeName, typeArgs, driver)
 
 	def := fmt.Sprintf("%s %s", name, sqlDef)
 
@@ -340,7 +253,7 @@ func (r *Runtime) buildColumnDefinition(name, typeStr, driver string) string {
 	}
 
 	// Apply Unsigned (MySQL only mostly)
-	if isUnsigned && driver != "sqlite" {
+	if isUnsigned && driver == "mysql" {
 		// Insert UNSIGNED after type
 		// Simple hack: append to def if it's an int type
 		if strings.Contains(strings.ToLower(sqlDef), "int") || strings.Contains(strings.ToLower(sqlDef), "double") || strings.Contains(strings.ToLower(sqlDef), "float") || strings.Contains(strings.ToLower(sqlDef), "decimal") {
@@ -356,15 +269,8 @@ func (r *Runtime) buildColumnDefinition(name, typeStr, driver string) string {
 	}
 
 	// Apply Default
-	for _, mod := range modifiers {
-		if strings.HasPrefix(mod, "default") {
-			start := strings.Index(mod, "(")
-			end := strings.LastIndex(mod, ")")
-			if start != -1 && end != -1 {
-				val := mod[start+1 : end]
-				def += fmt.Sprintf(" DEFAULT %s", val)
-			}
-		}
+	if val, ok := columnDefault(modifiers, typeName, driver); ok {
+		def += fmt.Sprintf(" DEFAULT %s", val)
 	}
 
 	// Apply Unique
@@ -375,7 +281,7 @@ func (r *Runtime) buildColumnDefinition(name, typeStr, driver string) string {
 	}
 
 	// Apply Comment (MySQL only)
-	if driver != "sqlite" {
+	if driver == "mysql" {
 		for _, mod := range modifiers {
 			if strings.HasPrefix(mod, "comment") {
 				start := strings.Index(mod, "(")
@@ -402,6 +308,12 @@ func (r *Runtime) executeBlueprintMethod(instance *Instance, method string, args
 		cols = append(cols, map[string]string{"name": name, "type": typeStr})
 	}
 
+	// Index, foreign key and alter commands, compiled by Schema
+	cmds, _ := instance.Fields["_commands"].([]map[string]string)
+	addCmd := func(cmd map[string]string) {
+		cmds = append(cmds, cmd)
+	}
+
 	// Helper to modify last column
 	modCol := func(modifier string) {
 		if len(cols) > 0 {
@@ -418,6 +330,10 @@ func (r *Runtime) executeBlueprintMethod(instance *Instance, method string, args
 		if len(args) > 0 {
 			addCol(args[0].(string), "increments")
 		}
+	case "bigIncrements", "mediumIncrements", "smallIncrements":
+		if len(args) > 0 {
+			addCol(args[0].(string), method)
+		}
 	case "integer":
 		if len(args) > 0 {
 			addCol(args[0].(string), "integer")
@@ -549,7 +465,12 @@ func (r *Runtime) executeBlueprintMethod(instance *Instance, method string, args
 	case "unsigned":
 		modCol("unsigned")
 	case "unique":
-		modCol("unique")
+		if len(args) > 0 {
+			// unique("email") / unique(["tenant_id", "email"]): unique index
+			addCmd(map[string]string{"type": "unique", "columns": strings.Join(blueprintColumns(args[0]), ","), "name": blueprintIndexName(args)})
+		} else {
+			modCol("unique")
+		}
 	case "default":
 		if len(args) > 0 {
 			val := args[0]
@@ -563,8 +484,219 @@ func (r *Runtime) executeBlueprintMethod(instance *Instance, method string, args
 		if len(args) > 0 {
 			modCol(fmt.Sprintf("comment('%s')", args[0].(string)))
 		}
+	case "change":
+		// Schema::table: modify the column instead of adding it
+		if len(cols) > 0 {
+			cols[len(cols)-1]["change"] = "1"
+		}
+
+	// Indexes and foreign keys
+	case "index", "foreign":
+		var columns []string
+		if len(args) > 0 {
+			columns = blueprintColumns(args[0])
+		}
+		if len(columns) == 0 && len(cols) > 0 {
+			// $table->string("email")->index()
+			columns = []string{cols[len(cols)-1]["name"]}
+		}
+		addCmd(map[string]string{"type": method, "columns": strings.Join(columns, ","), "name": blueprintIndexName(args)})
+	case "references", "on", "onDelete", "onUpdate":
+		// foreign("user_id")->references("id")->on("users")->onDelete("cascade")
+		if len(args) > 0 && len(cmds) > 0 && cmds[len(cmds)-1]["type"] == "foreign" {
+			cmds[len(cmds)-1][method] = fmt.Sprintf("%v", args[0])
+		}
+	case "dropIndex", "dropUnique", "dropForeign":
+		// By name, or by columns: dropForeign(["user_id"])
+		if len(args) > 0 {
+			cmd := map[string]string{"type": method}
+			if name, ok := args[0].(string); ok {
+				cmd["name"] = name
+			} else {
+				cmd["columns"] = strings.Join(blueprintColumns(args[0]), ",")
+			}
+			addCmd(cmd)
+		}
+
+	// Column changes
+	case "dropColumn":
+		// dropColumn("a"), dropColumn("a", "b") or dropColumn(["a", "b"])
+		for _, arg := range args {
+			for _, col := range blueprintColumns(arg) {
+				addCmd(map[string]string{"type": "dropColumn", "column": col})
+			}
+		}
+	case "renameColumn":
+		if len(args) >= 2 {
+			addCmd(map[string]string{"type": "renameColumn", "from": args[0].(string), "to": args[1].(string)})
+		}
 	}
 
 	instance.Fields["_columns"] = cols
+	instance.Fields["_commands"] = cmds
 	return instance // Return blueprint to allow chaining
 }
+
+// columnDefault returns the SQL of a default(...) modifier, if any
+func columnDefault(modifiers []string, typeName, driver string) (string, bool) {
+	for _, mod := range modifiers {
+		if strings.HasPrefix(mod, "default") {
+			start := strings.Index(mod, "(")
+			end := strings.LastIndex(mod, ")")
+			if start != -1 && end != -1 {
+				val := mod[start+1 : end]
+				if driver == "postgres" && typeName == "boolean" {
+					// PostgreSQL BOOLEAN rejects integer defaults
+					if val == "0" {
+						val = "FALSE"
+					} else if val == "1" {
+						val = "TRUE"
+					}
+				}
+				return val, true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitColumnType separates a Blueprint type like "decimal(10,2)" into its
+// name and arguments
+func splitColumnType(baseType string) (typeName, typeArgs string) {
+	typeName = baseType
+	if strings.Contains(baseType, "(") {
+		start := strings.Index(baseType, "(")
+		end := strings.LastIndex(baseType, ")")
+		typeName = baseType[:start]
+		typeArgs = baseType[start+1 : end]
+	}
+	return typeName, typeArgs
+}
+
+// columnSQLType maps a Blueprint type to the SQL type of the driver
+func columnSQLType(name, typeName, typeArgs, driver string) string {
+	var sqlDef string
+
+	switch typeName {
+	case "increments":
+		if driver == "sqlite" {
+			sqlDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
+		} else if driver == "postgres" {
+			sqlDef = "SERIAL PRIMARY KEY"
+		} else {
+			sqlDef = "INT AUTO_INCREMENT PRIMARY KEY"
+		}
+	case "bigIncrements":
+		if driver == "sqlite" {
+			sqlDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
+		} else if driver == "postgres" {
+			sqlDef = "BIGSERIAL PRIMARY KEY"
+		} else {
+			sqlDef = "BIGINT AUTO_INCREMENT PRIMARY KEY"
+		}
+	case "mediumIncrements":
+		if driver == "sqlite" {
+			sqlDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
+		} else if driver == "postgres" {
+			sqlDef = "SERIAL PRIMARY KEY"
+		} else {
+			sqlDef = "MEDIUMINT AUTO_INCREMENT PRIMARY KEY"
+		}
+	case "smallIncrements":
+		if driver == "sqlite" {
+			sqlDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
+		} else if driver == "postgres" {
+			sqlDef = "SMALLSERIAL PRIMARY KEY"
+		} else {
+			sqlDef = "SMALLINT AUTO_INCREMENT PRIMARY KEY"
+		}
+	case "tinyInteger":
+		if driver == "postgres" {
+			sqlDef = "SMALLINT"
+		} else {
+			sqlDef = "TINYINT"
+		}
+	case "smallInteger":
+		sqlDef = "SMALLINT"
+	case "mediumInteger":
+		if driver == "postgres" {
+			sqlDef = "INTEGER"
+		} else {
+			sqlDef = "MEDIUMINT"
+		}
+	case "integer":
+		sqlDef = "INT"
+	case "bigInteger":
+		sqlDef = "BIGINT"
+	case "float":
+		if driver == "postgres" {
+			sqlDef = "REAL"
+		} else {
+			sqlDef = "FLOAT"
+		}
+	case "double":
+		if driver == "postgres" {
+			sqlDef = "DOUBLE PRECISION"
+		} else {
+			sqlDef = "DOUBLE"
+		}
+	case "decimal":
+		sqlDef = fmt.Sprintf("DECIMAL(%s)", typeArgs)
+	case "char":
+		sqlDef = fmt.Sprintf("CHAR(%s)", typeArgs)
+	case "string":
+		sqlDef = fmt.Sprintf("VARCHAR(%s)", typeArgs)
+	case "text":
+		sqlDef = "TEXT"
+	case "mediumText":
+		if driver == "sqlite" || driver == "postgres" {
+			sqlDef = "TEXT"
+		} else {
+			sqlDef = "MEDIUMTEXT"
+		}
+	case "longText":
+		if driver == "sqlite" || driver == "postgres" {
+			sqlDef = "TEXT"
+		} else {
+			sqlDef = "LONGTEXT"
+		}
+	case "date":
+		sqlDef = "DATE"
+	case "dateTime":
+		if driver == "postgres" {
+			sqlDef = "TIMESTAMP"
+		} else {
+			sqlDef = "DATETIME"
+		}
+	case "time":
+		sqlDef = "TIME"
+	case "timestamp":
+		sqlDef = "TIMESTAMP"
+	case "boolean":
+		if driver == "sqlite" || driver == "postgres" {
+			sqlDef = "BOOLEAN"
+		} else {
+			sqlDef = "TINYINT(1)"
+		}
+	case "json":
+		if driver == "sqlite" {
+			sqlDef = "TEXT"
+		} else if driver == "postgres" {
+			sqlDef = "JSONB"
+		} else {
+			sqlDef = "JSON"
+		}
+	case "enum":
+		if driver == "sqlite" {
+			sqlDef = "TEXT" // SQLite doesn't support ENUM natively
+		} else if driver == "postgres" {
+			sqlDef = fmt.Sprintf("VARCHAR(255) CHECK (%s IN (%s))", name, typeArgs)
+		} else {
+			sqlDef = fmt.Sprintf("ENUM(%s)", typeArgs)
+		}
+	default:
+		sqlDef = "VARCHAR(255)"
+	}
+
+	return sqlDef
+}
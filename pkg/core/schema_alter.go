@@ -0,0 +1,407 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Blueprint commands (index, unique, foreign, dropColumn, renameColumn, ...)
+// are collected in "_commands" and compiled here. SQLite cannot ALTER a
+// column or a foreign key, so those changes rebuild the table: create a copy
+// with the new definition, move the rows, drop the old one and rename.
+
+// blueprintColumns reads a column argument: "col" or ["a", "b"]
+func blueprintColumns(arg interface{}) []string {
+	switch v := arg.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		cols := make([]string, 0, len(v))
+		for _, c := range v {
+			cols = append(cols, fmt.Sprintf("%v", c))
+		}
+		return cols
+	}
+	return nil
+}
+
+// blueprintIndexName returns the explicit name of index(cols, name)
+func blueprintIndexName(args []interface{}) string {
+	if len(args) >= 2 {
+		if name, ok := args[1].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// schemaTable adds the table prefix (PREFIX in env.joss) when missing
+func (r *Runtime) schemaTable(name string) string {
+	prefix := "js_"
+	if val, ok := r.Env["PREFIX"]; ok {
+		prefix = val
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return prefix + name
+	}
+	return name
+}
+
+// indexName is the explicit name of a command or the conventional
+// table_columns_suffix one (js_posts_user_id_foreign)
+func indexName(table string, cmd map[string]string, suffix string) string {
+	if cmd["name"] != "" {
+		return cmd["name"]
+	}
+	return strings.ToLower(table + "_" + strings.ReplaceAll(cmd["columns"], ",", "_") + "_" + suffix)
+}
+
+func sqlColumnList(columns string) string {
+	return strings.ReplaceAll(columns, ",", ", ")
+}
+
+// foreignKeySQL compiles foreign(...)->references(...)->on(...) as a table constraint
+func (r *Runtime) foreignKeySQL(table string, cmd map[string]string) string {
+	references := cmd["references"]
+	if references == "" {
+		references = "id"
+	}
+	if cmd["on"] == "" {
+		panic(fmt.Sprintf("Schema Error: foreign('%s') necesita ->on(\"tabla\")", cmd["columns"]))
+	}
+	clause := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		indexName(table, cmd, "foreign"), sqlColumnList(cmd["columns"]), r.schemaTable(cmd["on"]), sqlColumnList(references))
+	if action := cmd["onDelete"]; action != "" {
+		clause += " ON DELETE " + strings.ToUpper(action)
+	}
+	if action := cmd["onUpdate"]; action != "" {
+		clause += " ON UPDATE " + strings.ToUpper(action)
+	}
+	return clause
+}
+
+// createIndexSQL compiles index(...) / unique([...])
+func createIndexSQL(table string, cmd map[string]string, driver string) string {
+	kind, suffix := "INDEX", "index"
+	if cmd["type"] == "unique" {
+		kind, suffix = "UNIQUE INDEX", "unique"
+	}
+	ifNotExists := " IF NOT EXISTS"
+	if driver == "mysql" {
+		ifNotExists = ""
+	}
+	return fmt.Sprintf("CREATE %s%s %s ON %s (%s)", kind, ifNotExists, indexName(table, cmd, suffix), table, sqlColumnList(cmd["columns"]))
+}
+
+func dropIndexSQL(table, name, driver string) string {
+	if driver == "mysql" {
+		return fmt.Sprintf("DROP INDEX %s ON %s", name, table)
+	}
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s", name)
+}
+
+// tableConstraints returns the foreign keys and (MySQL) indexes declared in
+// Schema::create, plus the CREATE INDEX statements to run after the table
+func (r *Runtime) tableConstraints(table string, blueprint *Instance, driver string) (definitions, after []string) {
+	cmds, _ := blueprint.Fields["_commands"].([]map[string]string)
+	for _, cmd := range cmds {
+		switch cmd["type"] {
+		case "foreign":
+			definitions = append(definitions, r.foreignKeySQL(table, cmd))
+		case "index", "unique":
+			if driver == "mysql" {
+				kind, suffix := "INDEX", "index"
+				if cmd["type"] == "unique" {
+					kind, suffix = "UNIQUE KEY", "unique"
+				}
+				definitions = append(definitions, fmt.Sprintf("%s %s (%s)", kind, indexName(table, cmd, suffix), sqlColumnList(cmd["columns"])))
+			} else {
+				after = append(after, createIndexSQL(table, cmd, driver))
+			}
+		}
+	}
+	return definitions, after
+}
+
+// alterTable applies a Schema::table blueprint
+func (r *Runtime) alterTable(table string, blueprint *Instance, driver string) {
+	cols, _ := blueprint.Fields["_columns"].([]map[string]string)
+	cmds, _ := blueprint.Fields["_commands"].([]map[string]string)
+	rebuild := &sqliteRebuild{changed: map[string]string{}, dropped: map[string]bool{}, dropForeign: map[string]bool{}}
+
+	for _, col := range cols {
+		def := r.buildColumnDefinition(col["name"], col["type"], driver)
+		if col["change"] == "" {
+			r.schemaExec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, def))
+			continue
+		}
+		switch driver {
+		case "sqlite":
+			rebuild.changed[col["name"]] = def
+		case "postgres":
+			r.schemaExec(postgresChangeColumn(table, col))
+		default:
+			r.schemaExec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", table, def))
+		}
+	}
+
+	for _, cmd := range cmds {
+		switch cmd["type"] {
+		case "renameColumn":
+			r.schemaExec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, cmd["from"], cmd["to"]))
+		case "dropColumn":
+			if driver == "sqlite" {
+				rebuild.dropped[cmd["column"]] = true
+			} else {
+				r.schemaExec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, cmd["column"]))
+			}
+		case "index", "unique":
+			r.schemaExec(createIndexSQL(table, cmd, driver))
+		case "dropIndex", "dropUnique":
+			suffix := "index"
+			if cmd["type"] == "dropUnique" {
+				suffix = "unique"
+			}
+			r.schemaExec(dropIndexSQL(table, indexName(table, cmd, suffix), driver))
+		case "foreign":
+			if driver == "sqlite" {
+				rebuild.foreign = append(rebuild.foreign, r.foreignKeySQL(table, cmd))
+			} else {
+				r.schemaExec(fmt.Sprintf("ALTER TABLE %s ADD %s", table, r.foreignKeySQL(table, cmd)))
+			}
+		case "dropForeign":
+			name := indexName(table, cmd, "foreign")
+			switch driver {
+			case "sqlite":
+				rebuild.dropForeign[name] = true
+			case "postgres":
+				r.schemaExec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, name))
+			default:
+				r.schemaExec(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, name))
+			}
+		}
+	}
+
+	if driver == "sqlite" && rebuild.needed() {
+		r.rebuildSQLiteTable(table, rebuild)
+	}
+}
+
+// postgresChangeColumn compiles ->change(): type, nullability and default
+// are separate ALTER COLUMN actions in PostgreSQL
+func postgresChangeColumn(table string, col map[string]string) string {
+	name := col["name"]
+	parts := strings.Split(col["type"], "|")
+	modifiers := parts[1:]
+	typeName, typeArgs := splitColumnType(parts[0])
+
+	actions := []string{fmt.Sprintf("ALTER COLUMN %s TYPE %s", name, columnSQLType(name, typeName, typeArgs, "postgres"))}
+
+	nullable := false
+	for _, mod := range modifiers {
+		if mod == "nullable" {
+			nullable = true
+		}
+	}
+	if nullable {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", name))
+	} else {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", name))
+	}
+	if val, ok := columnDefault(modifiers, typeName, "postgres"); ok {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", name, val))
+	} else {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", name))
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s", table, strings.Join(actions, ", "))
+}
+
+// sqliteRebuild collects the changes SQLite can only apply by rebuilding
+type sqliteRebuild struct {
+	changed     map[string]string // column -> new definition
+	dropped     map[string]bool   // columns to drop
+	foreign     []string          // foreign key constraints to add
+	dropForeign map[string]bool   // foreign keys to drop (table_cols_foreign)
+}
+
+func (p *sqliteRebuild) needed() bool {
+	return len(p.changed) > 0 || len(p.dropped) > 0 || len(p.foreign) > 0 || len(p.dropForeign) > 0
+}
+
+type sqliteColumn struct {
+	name    string
+	typ     string
+	notNull bool
+	dflt    sql.NullString
+	pk      int
+}
+
+// rebuildSQLiteTable recreates a table with the changes of plan, keeping its
+// rows, primary key, unique constraints, foreign keys and indexes
+func (r *Runtime) rebuildSQLiteTable(table string, plan *sqliteRebuild) {
+	conn := r.Conn()
+
+	var createSQL string
+	conn.QueryRow("SELECT sql FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&createSQL)
+	if createSQL == "" {
+		panic(fmt.Sprintf("Schema Error: la tabla %s no existe", table))
+	}
+
+	var columns []sqliteColumn
+	rows, err := conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		panic(fmt.Sprintf("Schema Error: %v", err))
+	}
+	for rows.Next() {
+		var cid int
+		var col sqliteColumn
+		rows.Scan(&cid, &col.name, &col.typ, &col.notNull, &col.dflt, &col.pk)
+		columns = append(columns, col)
+	}
+	rows.Close()
+
+	var pks []string
+	for _, col := range columns {
+		if col.pk > 0 && !plan.dropped[col.name] {
+			pks = append(pks, col.name)
+		}
+	}
+
+	// Columns
+	var definitions, kept []string
+	for _, col := range columns {
+		if plan.dropped[col.name] {
+			continue
+		}
+		kept = append(kept, col.name)
+		if def, ok := plan.changed[col.name]; ok {
+			definitions = append(definitions, def)
+			continue
+		}
+		def := strings.TrimSpace(col.name + " " + col.typ)
+		if col.pk > 0 && len(pks) == 1 {
+			def += " PRIMARY KEY"
+			if strings.Contains(strings.ToUpper(createSQL), "AUTOINCREMENT") {
+				def += " AUTOINCREMENT"
+			}
+		}
+		if col.notNull {
+			def += " NOT NULL"
+		}
+		if col.dflt.Valid {
+			def += " DEFAULT " + col.dflt.String
+		}
+		definitions = append(definitions, def)
+	}
+	if len(pks) > 1 {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pks, ", ")))
+	}
+
+	touchesDropped := func(cols []string) bool {
+		for _, c := range cols {
+			if plan.dropped[c] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Unique constraints and CREATE INDEX statements
+	var indexes []string
+	type sqliteIndex struct {
+		name, origin string
+		unique       bool
+	}
+	var indexList []sqliteIndex
+	rows, err = conn.Query(fmt.Sprintf("PRAGMA index_list(%s)", table))
+	if err == nil {
+		for rows.Next() {
+			var seq, partial int
+			var idx sqliteIndex
+			rows.Scan(&seq, &idx.name, &idx.unique, &idx.origin, &partial)
+			indexList = append(indexList, idx)
+		}
+		rows.Close()
+	}
+	for _, idx := range indexList {
+		if idx.origin == "pk" {
+			continue
+		}
+		var cols []string
+		if rows, err := conn.Query(fmt.Sprintf("PRAGMA index_info(%s)", idx.name)); err == nil {
+			for rows.Next() {
+				var seqno, cid int
+				var name string
+				rows.Scan(&seqno, &cid, &name)
+				cols = append(cols, name)
+			}
+			rows.Close()
+		}
+		if touchesDropped(cols) {
+			continue
+		}
+		if idx.origin == "u" {
+			definitions = append(definitions, fmt.Sprintf("UNIQUE (%s)", strings.Join(cols, ", ")))
+			continue
+		}
+		var indexSQL sql.NullString
+		conn.QueryRow("SELECT sql FROM sqlite_master WHERE type='index' AND name=?", idx.name).Scan(&indexSQL)
+		if indexSQL.Valid {
+			indexes = append(indexes, indexSQL.String)
+		}
+	}
+
+	// Foreign keys, grouped by constraint id
+	type sqliteForeign struct {
+		from, to           []string
+		table              string
+		onUpdate, onDelete string
+	}
+	var foreignIDs []int
+	foreigns := map[int]*sqliteForeign{}
+	rows, err = conn.Query(fmt.Sprintf("PRAGMA foreign_key_list(%s)", table))
+	if err == nil {
+		for rows.Next() {
+			var id, seq int
+			var refTable, from, onUpdate, onDelete, match string
+			var to sql.NullString
+			rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match)
+			fk, ok := foreigns[id]
+			if !ok {
+				fk = &sqliteForeign{table: refTable, onUpdate: onUpdate, onDelete: onDelete}
+				foreigns[id] = fk
+				foreignIDs = append(foreignIDs, id)
+			}
+			fk.from = append(fk.from, from)
+			fk.to = append(fk.to, to.String)
+		}
+		rows.Close()
+	}
+	for _, id := range foreignIDs {
+		fk := foreigns[id]
+		name := indexName(table, map[string]string{"columns": strings.Join(fk.from, ",")}, "foreign")
+		if plan.dropForeign[name] || touchesDropped(fk.from) {
+			continue
+		}
+		clause := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", name, strings.Join(fk.from, ", "), fk.table, strings.Join(fk.to, ", "))
+		if fk.onDelete != "" && fk.onDelete != "NO ACTION" {
+			clause += " ON DELETE " + fk.onDelete
+		}
+		if fk.onUpdate != "" && fk.onUpdate != "NO ACTION" {
+			clause += " ON UPDATE " + fk.onUpdate
+		}
+		definitions = append(definitions, clause)
+	}
+	definitions = append(definitions, plan.foreign...)
+
+	tmp := "__tmp_" + table
+	keptList := strings.Join(kept, ", ")
+	r.schemaExec(fmt.Sprintf("CREATE TABLE %s (%s)", tmp, strings.Join(definitions, ", ")))
+	r.schemaExec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", tmp, keptList, keptList, table))
+	r.schemaExec(fmt.Sprintf("DROP TABLE %s", table))
+	r.schemaExec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmp, table))
+	for _, indexSQL := range indexes {
+		r.schemaExec(indexSQL)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Seeders fill the database with initial or fake data:
+//
+//	class DatabaseSeeder extends Seeder {
+//	    func run() {
+//	        $this->call(["RoleSeeder", "UserSeeder"])
+//	    }
+//	}
+//
+// `joss db:seed` runs DatabaseSeeder (or --class=Name). Tests can seed with
+// Seeder::call("UserSeeder").
+
+const seedersDir = "app/database/seeders"
+
+func (r *Runtime) executeSeederMethod(instance *Instance, method string, args []interface{}) interface{} {
+	switch method {
+	case "call":
+		// call("UserSeeder") / call(["RoleSeeder", "UserSeeder"])
+		for _, arg := range args {
+			for _, name := range stringList(arg) {
+				r.RunSeeder(name)
+			}
+		}
+	}
+	return nil
+}
+
+// RunSeeder runs the run() method of a seeder class. The models, factories
+// and seeders must already be loaded (see LoadClassDirs).
+func (r *Runtime) RunSeeder(name string) {
+	class, ok := r.Classes[name]
+	if !ok {
+		panic(fmt.Sprintf("Seeder Error: no se encontró el seeder '%s' en %s", name, seedersDir))
+	}
+	method := r.findClassMethod(class, "run")
+	if method == nil {
+		panic(fmt.Sprintf("Seeder Error: %s no define run()", name))
+	}
+
+	fmt.Printf("[Seeder] Ejecutando %s...\n", name)
+	start := time.Now()
+	r.CallMethodEvaluated(method, r.NewInstance(name), nil)
+	fmt.Printf("[Seeder] %s completado (%s)\n", name, time.Since(start).Round(time.Millisecond))
+}
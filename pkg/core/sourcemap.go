@@ -0,0 +1,158 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/jossecurity/joss/pkg/parser"
+)
+
+// sourceInfo records where a function or method was declared
+type sourceInfo struct {
+	File  string
+	Class string
+}
+
+// sourceMethods maps *parser.MethodStatement -> sourceInfo
+var sourceMethods sync.Map
+
+// sourceBlocks maps the body (*parser.BlockStatement) of each closure -> sourceInfo
+var sourceBlocks sync.Map
+
+// sourceKeys lists the entries registered per file, so reloading a file
+// replaces them instead of piling up old ASTs
+var sourceKeys = struct {
+	sync.Mutex
+	byFile map[string][]interface{}
+}{byFile: map[string][]interface{}{}}
+
+// RegisterSource remembers the file that declared every function and method in
+// the program, so tooling (profiler, coverage) can report Joss file:line.
+func RegisterSource(program *parser.Program, filename string) {
+	if program == nil {
+		return
+	}
+	if c := activeCoverage.Load(); c != nil {
+		c.register(program, filename)
+	}
+
+	sourceKeys.Lock()
+	defer sourceKeys.Unlock()
+	for _, key := range sourceKeys.byFile[filename] {
+		sourceMethods.Delete(key)
+		sourceBlocks.Delete(key)
+	}
+	var keys []interface{}
+
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.MethodStatement:
+			sourceMethods.Store(s, sourceInfo{File: filename})
+			keys = append(keys, s)
+		case *parser.ClassStatement:
+			if s.Body == nil || s.Name == nil {
+				continue
+			}
+			for _, inner := range s.Body.Statements {
+				if m, ok := inner.(*parser.MethodStatement); ok {
+					sourceMethods.Store(m, sourceInfo{File: filename, Class: s.Name.Value})
+					keys = append(keys, m)
+				}
+			}
+		}
+	}
+	walkFunctionLiterals(reflect.ValueOf(program), func(fn *parser.FunctionLiteral) {
+		if fn.Body != nil {
+			sourceBlocks.Store(fn.Body, sourceInfo{File: filename})
+			keys = append(keys, fn.Body)
+		}
+	})
+	sourceKeys.byFile[filename] = keys
+}
+
+var functionLiteralType = reflect.TypeOf((*parser.FunctionLiteral)(nil))
+
+// walkFunctionLiterals calls fn for every closure in the AST below v
+func walkFunctionLiterals(v reflect.Value, fn func(*parser.FunctionLiteral)) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if v.Type() == functionLiteralType {
+			fn(v.Interface().(*parser.FunctionLiteral))
+		}
+		walkFunctionLiterals(v.Elem(), fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			walkFunctionLiterals(v.Field(i), fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkFunctionLiterals(v.Index(i), fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkFunctionLiterals(iter.Value(), fn)
+		}
+	}
+}
+
+// lookupSource returns the declaring file/class of a method, if registered
+func lookupSource(method *parser.MethodStatement) (sourceInfo, bool) {
+	if v, ok := sourceMethods.Load(method); ok {
+		return v.(sourceInfo), true
+	}
+	return sourceInfo{}, false
+}
+
+// lookupBlockSource returns the declaring file of a closure body, if registered
+func lookupBlockSource(body *parser.BlockStatement) (sourceInfo, bool) {
+	if body == nil {
+		return sourceInfo{}, false
+	}
+	if v, ok := sourceBlocks.Load(body); ok {
+		return v.(sourceInfo), true
+	}
+	return sourceInfo{}, false
+}
+
+// statementLine returns the source line where a statement starts
+func statementLine(stmt parser.Statement) int {
+	switch s := stmt.(type) {
+	case *parser.LetStatement:
+		return s.Token.Line
+	case *parser.MultiLetStatement:
+		return s.TypeToken.Line
+	case *parser.ExpressionStatement:
+		return s.Token.Line
+	case *parser.EchoStatement:
+		return s.Token.Line
+	case *parser.ForeachStatement:
+		return s.Token.Line
+	case *parser.ImportStatement:
+		return s.Token.Line
+	case *parser.WhileStatement:
+		return s.Token.Line
+	case *parser.DoWhileStatement:
+		return s.Token.Line
+	case *parser.TryCatchStatement:
+		return s.Token.Line
+	case *parser.ThrowStatement:
+		return s.Token.Line
+	case *parser.ReturnStatement:
+		return s.Token.Line
+	case *parser.BreakStatement:
+		return s.Token.Line
+	case *parser.ContinueStatement:
+		return s.Token.Line
+	case *parser.MethodStatement:
+		return s.Token.Line
+	case *parser.ClassStatement:
+		return s.Token.Line
+	case *parser.BlockStatement:
+		return s.Token.Line
+	}
+	return 0
+}
@@ -0,0 +1,471 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Standard library: string and array helpers available as builtins (so they
+// compose with |>, e.g. `$title |> trim |> slug`) and as Str::method().
+// The subject is always the first argument.
+
+// strMethods are the Str:: methods served by callStdlib
+var strMethods = []string{
+	"replace", "split", "join", "trim", "ltrim", "rtrim", "upper", "lower", "ucfirst",
+	"contains", "endsWith", "padLeft", "padRight", "slug", "match", "matchAll", "replaceRegex",
+}
+
+var (
+	regexCache   = make(map[string]*regexp.Regexp)
+	regexCacheMu sync.Mutex
+)
+
+// compileRegex caches patterns; invalid patterns panic like other runtime errors
+func compileRegex(pattern string) *regexp.Regexp {
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if re, ok := regexCache[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("Regex Error: patrón inválido '%s': %v", pattern, err))
+	}
+	regexCache[pattern] = re
+	return re
+}
+
+func stdString(val interface{}) string {
+	if val == nil {
+		return ""
+	}
+	if s, ok := val.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+func stdInt(val interface{}, def int) int {
+	switch v := val.(type) {
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+func stdList(val interface{}) ([]interface{}, bool) {
+	list, ok := val.([]interface{})
+	return list, ok
+}
+
+func toStringList(parts []string) []interface{} {
+	out := make([]interface{}, len(parts))
+	for i, p := range parts {
+		out[i] = p
+	}
+	return out
+}
+
+// accentFolds maps accented Latin letters to ASCII for slugs
+var accentFolds = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c", "ß", "ss",
+)
+
+// slugify lowercases, strips accents (á -> a, ñ -> n) and joins words with sep
+func slugify(s, sep string) string {
+	folded := accentFolds.Replace(strings.ToLower(s))
+	var sb strings.Builder
+	pendingSep := false
+	for _, r := range folded {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingSep && sb.Len() > 0 {
+				sb.WriteString(sep)
+			}
+			pendingSep = false
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			pendingSep = true
+		}
+	}
+	return sb.String()
+}
+
+func padString(s string, length int, pad string, left bool) string {
+	if pad == "" {
+		pad = " "
+	}
+	missing := length - len([]rune(s))
+	if missing <= 0 {
+		return s
+	}
+	fill := []rune(strings.Repeat(pad, missing/len([]rune(pad))+1))[:missing]
+	if left {
+		return string(fill) + s
+	}
+	return s + string(fill)
+}
+
+// fieldOf reads a key from a map or an instance (for sortBy/groupBy)
+func fieldOf(item interface{}, key string) interface{} {
+	switch v := item.(type) {
+	case map[string]interface{}:
+		return v[key]
+	case *Instance:
+		return v.Fields[key]
+	}
+	return nil
+}
+
+// compareValues orders numbers numerically and everything else as strings
+func compareValues(a, b interface{}) int {
+	toF := func(v interface{}) (float64, bool) {
+		switch n := v.(type) {
+		case int64:
+			return float64(n), true
+		case int:
+			return float64(n), true
+		case float64:
+			return n, true
+		}
+		return 0, false
+	}
+	fa, okA := toF(a)
+	fb, okB := toF(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(stdString(a), stdString(b))
+}
+
+// looseEqual is the equality of contains(): maps and lists compare by
+// content (== would panic on them), scalars like compareValues ("1" == 1)
+func looseEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a.(type) {
+	case map[string]interface{}, []interface{}:
+		return reflect.DeepEqual(a, b)
+	}
+	switch b.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return compareValues(a, b) == 0
+}
+
+// keyFunc builds an extractor from a field name or a callback
+func (r *Runtime) keyFunc(selector interface{}) func(item interface{}, idx int) interface{} {
+	if key, ok := selector.(string); ok {
+		return func(item interface{}, _ int) interface{} { return fieldOf(item, key) }
+	}
+	return func(item interface{}, idx int) interface{} {
+		return r.applyFunction(selector, []interface{}{item, int64(idx)})
+	}
+}
+
+// callStdlib runs a standard library function; ok is false if name is unknown
+func (r *Runtime) callStdlib(name string, args []interface{}) (interface{}, bool) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+
+	switch name {
+	// --- Strings ---
+	case "replace":
+		// replace($s, $search, $replace) ; $search may be a list
+		s := stdString(arg(0))
+		if list, ok := stdList(arg(1)); ok {
+			for _, search := range list {
+				s = strings.ReplaceAll(s, stdString(search), stdString(arg(2)))
+			}
+			return s, true
+		}
+		return strings.ReplaceAll(s, stdString(arg(1)), stdString(arg(2))), true
+	case "split":
+		// split($s, $sep = ",", $limit = -1)
+		sep := ","
+		if len(args) > 1 {
+			sep = stdString(args[1])
+		}
+		return toStringList(strings.SplitN(stdString(arg(0)), sep, stdInt(arg(2), -1))), true
+	case "join":
+		list, _ := stdList(arg(0))
+		parts := make([]string, len(list))
+		for i, v := range list {
+			parts[i] = stdString(v)
+		}
+		return strings.Join(parts, stdString(arg(1))), true
+	case "trim", "ltrim", "rtrim":
+		s := stdString(arg(0))
+		cutset := " \t\n\r\x00\x0B"
+		if len(args) > 1 {
+			cutset = stdString(args[1])
+		}
+		switch name {
+		case "ltrim":
+			return strings.TrimLeft(s, cutset), true
+		case "rtrim":
+			return strings.TrimRight(s, cutset), true
+		}
+		return strings.Trim(s, cutset), true
+	case "upper":
+		return strings.ToUpper(stdString(arg(0))), true
+	case "lower":
+		return strings.ToLower(stdString(arg(0))), true
+	case "ucfirst":
+		runes := []rune(stdString(arg(0)))
+		if len(runes) > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		return string(runes), true
+	case "contains":
+		// contains($s, $needle) or contains($list, $value)
+		if list, ok := stdList(arg(0)); ok {
+			for _, v := range list {
+				if looseEqual(v, arg(1)) {
+					return true, true
+				}
+			}
+			return false, true
+		}
+		if m, ok := arg(0).(map[string]interface{}); ok {
+			_, exists := m[stdString(arg(1))]
+			return exists, true
+		}
+		return strings.Contains(stdString(arg(0)), stdString(arg(1))), true
+	case "startsWith":
+		return strings.HasPrefix(stdString(arg(0)), stdString(arg(1))), true
+	case "endsWith":
+		return strings.HasSuffix(stdString(arg(0)), stdString(arg(1))), true
+	case "padLeft", "padRight":
+		pad := " "
+		if len(args) > 2 {
+			pad = stdString(args[2])
+		}
+		return padString(stdString(arg(0)), stdInt(arg(1), 0), pad, name == "padLeft"), true
+	case "slug":
+		sep := "-"
+		if len(args) > 1 {
+			sep = stdString(args[1])
+		}
+		return slugify(stdString(arg(0)), sep), true
+	case "match", "matchRegex":
+		// match($s, $pattern) -> [full, group1, ...] or null
+		m := compileRegex(stdString(arg(1))).FindStringSubmatch(stdString(arg(0)))
+		if m == nil {
+			return nil, true
+		}
+		return toStringList(m), true
+	case "matchAll":
+		all := compileRegex(stdString(arg(1))).FindAllStringSubmatch(stdString(arg(0)), -1)
+		out := make([]interface{}, len(all))
+		for i, m := range all {
+			out[i] = toStringList(m)
+		}
+		return out, true
+	case "replaceRegex":
+		// replaceRegex($s, $pattern, $replacement) ; $1 / ${name} refer to groups
+		return compileRegex(stdString(arg(1))).ReplaceAllString(stdString(arg(0)), stdString(arg(2))), true
+
+	// --- Arrays ---
+	case "map":
+		// map($list, func($item, $index)) ; maps keep their keys: func($value, $key)
+		if m, ok := arg(0).(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				out[k] = r.applyFunction(arg(1), []interface{}{v, k})
+			}
+			return out, true
+		}
+		list, _ := stdList(arg(0))
+		out := make([]interface{}, len(list))
+		for i, v := range list {
+			out[i] = r.applyFunction(arg(1), []interface{}{v, int64(i)})
+		}
+		return out, true
+	case "filter":
+		// filter($list, func($item, $index)) ; without callback drops falsy values
+		keep := func(v interface{}, idx interface{}) bool {
+			if arg(1) == nil {
+				return isTruthy(v)
+			}
+			return isTruthy(r.applyFunction(arg(1), []interface{}{v, idx}))
+		}
+		if m, ok := arg(0).(map[string]interface{}); ok {
+			out := make(map[string]interface{})
+			for k, v := range m {
+				if keep(v, k) {
+					out[k] = v
+				}
+			}
+			return out, true
+		}
+		list, _ := stdList(arg(0))
+		out := []interface{}{}
+		for i, v := range list {
+			if keep(v, int64(i)) {
+				out = append(out, v)
+			}
+		}
+		return out, true
+	case "reduce":
+		// reduce($list, func($carry, $item), $initial)
+		list, _ := stdList(arg(0))
+		carry := arg(2)
+		for i, v := range list {
+			carry = r.applyFunction(arg(1), []interface{}{carry, v, int64(i)})
+		}
+		return carry, true
+	case "find":
+		list, _ := stdList(arg(0))
+		for i, v := range list {
+			if isTruthy(r.applyFunction(arg(1), []interface{}{v, int64(i)})) {
+				return v, true
+			}
+		}
+		return nil, true
+	case "sort":
+		// sort($list) natural order ; sort($list, func($a, $b)) returns <0/0/>0 or bool (a before b)
+		list, _ := stdList(arg(0))
+		out := append([]interface{}{}, list...)
+		if arg(1) == nil {
+			sort.SliceStable(out, func(i, j int) bool { return compareValues(out[i], out[j]) < 0 })
+			return out, true
+		}
+		sort.SliceStable(out, func(i, j int) bool {
+			res := r.applyFunction(arg(1), []interface{}{out[i], out[j]})
+			if b, ok := res.(bool); ok {
+				return b
+			}
+			return stdInt(res, 0) < 0
+		})
+		return out, true
+	case "sortBy":
+		// sortBy($list, "field" | func($item), "desc"?)
+		list, _ := stdList(arg(0))
+		key := r.keyFunc(arg(1))
+		desc := strings.EqualFold(stdString(arg(2)), "desc")
+		type keyed struct {
+			item interface{}
+			key  interface{}
+		}
+		items := make([]keyed, len(list))
+		for i, v := range list {
+			items[i] = keyed{v, key(v, i)}
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			c := compareValues(items[i].key, items[j].key)
+			if desc {
+				return c > 0
+			}
+			return c < 0
+		})
+		out := make([]interface{}, len(items))
+		for i, k := range items {
+			out[i] = k.item
+		}
+		return out, true
+	case "unique":
+		list, _ := stdList(arg(0))
+		seen := make(map[string]bool)
+		out := []interface{}{}
+		for _, v := range list {
+			k := fmt.Sprintf("%T:%v", v, v)
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, v)
+			}
+		}
+		return out, true
+	case "slice":
+		// slice($list|$string, $start, $length?) ; negative start counts from the end
+		if s, ok := arg(0).(string); ok {
+			runes := []rune(s)
+			start, end := sliceBounds(len(runes), stdInt(arg(1), 0), arg(2))
+			return string(runes[start:end]), true
+		}
+		list, _ := stdList(arg(0))
+		start, end := sliceBounds(len(list), stdInt(arg(1), 0), arg(2))
+		return append([]interface{}{}, list[start:end]...), true
+	case "chunk":
+		list, _ := stdList(arg(0))
+		size := stdInt(arg(1), 1)
+		if size < 1 {
+			size = 1
+		}
+		out := []interface{}{}
+		for i := 0; i < len(list); i += size {
+			end := i + size
+			if end > len(list) {
+				end = len(list)
+			}
+			out = append(out, append([]interface{}{}, list[i:end]...))
+		}
+		return out, true
+	case "groupBy":
+		// groupBy($list, "field" | func($item)) -> { "key": [items...] }
+		list, _ := stdList(arg(0))
+		key := r.keyFunc(arg(1))
+		out := make(map[string]interface{})
+		for i, v := range list {
+			k := stdString(key(v, i))
+			group, _ := out[k].([]interface{})
+			out[k] = append(group, v)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// sliceBounds resolves start/length the way PHP's array_slice does
+func sliceBounds(n, start int, length interface{}) (int, int) {
+	if start < 0 {
+		start = n + start
+		if start < 0 {
+			start = 0
+		}
+	}
+	if start > n {
+		start = n
+	}
+	end := n
+	if length != nil {
+		l := stdInt(length, n)
+		if l < 0 {
+			end = n + l
+		} else {
+			end = start + l
+		}
+	}
+	if end > n {
+		end = n
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
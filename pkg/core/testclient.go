@@ -0,0 +1,499 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Hooks registered by pkg/server to avoid an import cycle.
+var (
+	// TestHandler is the HTTP handler driven by TestClient (server.MainHandler)
+	TestHandler http.Handler
+	// TestBootCallback loads the application routes/controllers without opening a socket
+	TestBootCallback func()
+	// SessionSeedCallback writes values into the server session store
+	SessionSeedCallback func(sessionID string, data map[string]interface{})
+	// SessionReadCallback returns a copy of a server session
+	SessionReadCallback func(sessionID string) map[string]interface{}
+)
+
+// viewCapture records the last view rendered while a TestClient request is in flight
+var viewCapture = struct {
+	mu      sync.Mutex
+	enabled bool
+	name    string
+	data    map[string]interface{}
+}{}
+
+// recordRenderedView is called by View::render so tests can assert on view name and data
+func recordRenderedView(name string, data map[string]interface{}) {
+	viewCapture.mu.Lock()
+	defer viewCapture.mu.Unlock()
+	if !viewCapture.enabled {
+		return
+	}
+	viewCapture.name = name
+	viewCapture.data = make(map[string]interface{})
+	for k, v := range data {
+		viewCapture.data[k] = v
+	}
+}
+
+// TestClient drives the HTTP handler in-process (via httptest) keeping cookies between calls
+type TestClient struct {
+	Handler         http.Handler
+	Cookies         map[string]string
+	Headers         map[string]string
+	FollowRedirects bool
+	MaxRedirects    int
+}
+
+// TestResponse is the result of a TestClient request
+type TestResponse struct {
+	Status   int
+	Headers  http.Header
+	Body     string
+	Location string
+	View     string
+	ViewData map[string]interface{}
+}
+
+// NewTestClient creates a client for the given handler (defaults to TestHandler)
+func NewTestClient(handler http.Handler) *TestClient {
+	if handler == nil {
+		if TestBootCallback != nil {
+			TestBootCallback()
+		}
+		handler = TestHandler
+	}
+	return &TestClient{
+		Handler:      handler,
+		Cookies:      make(map[string]string),
+		Headers:      make(map[string]string),
+		MaxRedirects: 10,
+	}
+}
+
+// SessionID returns the client session cookie, creating one if needed
+func (c *TestClient) SessionID() string {
+	if id, ok := c.Cookies["joss_session"]; ok && id != "" {
+		return id
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	c.Cookies["joss_session"] = id
+	return id
+}
+
+// WithSession merges values into the server-side session of this client
+func (c *TestClient) WithSession(data map[string]interface{}) *TestClient {
+	if SessionSeedCallback == nil {
+		fmt.Println("[TestClient] Advertencia: almacén de sesiones no registrado")
+		return c
+	}
+	SessionSeedCallback(c.SessionID(), data)
+	return c
+}
+
+// Session returns a copy of the current server-side session
+func (c *TestClient) Session() map[string]interface{} {
+	if SessionReadCallback == nil {
+		return map[string]interface{}{}
+	}
+	return SessionReadCallback(c.SessionID())
+}
+
+// CSRFToken returns the session CSRF token, seeding one if the session has none yet
+func (c *TestClient) CSRFToken() string {
+	if tok, ok := c.Session()["csrf_token"].(string); ok && tok != "" {
+		return tok
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	tok := hex.EncodeToString(b)
+	c.WithSession(map[string]interface{}{"csrf_token": tok})
+	return tok
+}
+
+// Get performs a GET request
+func (c *TestClient) Get(path string) *TestResponse {
+	return c.Do("GET", path, nil, "")
+}
+
+// Post sends form fields as application/x-www-form-urlencoded
+func (c *TestClient) Post(path string, form map[string]interface{}) *TestResponse {
+	return c.Form("POST", path, form)
+}
+
+// Form sends form fields with the given method
+func (c *TestClient) Form(method, path string, form map[string]interface{}) *TestResponse {
+	values := url.Values{}
+	for k, v := range form {
+		values.Set(k, fmt.Sprintf("%v", v))
+	}
+	return c.Do(method, path, strings.NewReader(values.Encode()), "application/x-www-form-urlencoded")
+}
+
+// JSON sends data encoded as an application/json body
+func (c *TestClient) JSON(method, path string, data interface{}) *TestResponse {
+	body, err := json.Marshal(data)
+	if err != nil {
+		panic(fmt.Sprintf("TestClient Error: no se pudo codificar JSON: %v", err))
+	}
+	return c.Do(method, path, bytes.NewReader(body), "application/json")
+}
+
+// Upload sends a multipart request with a single file plus optional form fields
+func (c *TestClient) Upload(path, field, filename string, content []byte, form map[string]interface{}) *TestResponse {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range form {
+		mw.WriteField(k, fmt.Sprintf("%v", v))
+	}
+	fw, err := mw.CreateFormFile(field, filename)
+	if err == nil {
+		fw.Write(content)
+	}
+	mw.Close()
+	return c.Do("POST", path, &buf, mw.FormDataContentType())
+}
+
+// Do executes a request against the handler, following redirects when enabled
+func (c *TestClient) Do(method, path string, body io.Reader, contentType string) *TestResponse {
+	if c.Handler == nil {
+		panic("TestClient Error: no hay handler HTTP registrado (importe pkg/server)")
+	}
+	method = strings.ToUpper(method)
+
+	res := c.do(method, path, body, contentType)
+	for i := 0; c.FollowRedirects && i < c.MaxRedirects; i++ {
+		if res.Status < 300 || res.Status >= 400 || res.Location == "" {
+			break
+		}
+		res = c.do("GET", res.Location, nil, "")
+	}
+	return res
+}
+
+func (c *TestClient) do(method, path string, body io.Reader, contentType string) *TestResponse {
+	req := httptest.NewRequest(method, path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	// Attach CSRF token automatically for state-changing web requests
+	if method != "GET" && method != "HEAD" && method != "OPTIONS" && !strings.HasPrefix(req.URL.Path, "/api/") {
+		if req.Header.Get("X-CSRF-TOKEN") == "" {
+			req.Header.Set("X-CSRF-TOKEN", c.CSRFToken())
+		}
+	}
+
+	c.SessionID()
+	for name, value := range c.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	viewCapture.mu.Lock()
+	viewCapture.enabled = true
+	viewCapture.name = ""
+	viewCapture.data = nil
+	viewCapture.mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	c.Handler.ServeHTTP(rec, req)
+
+	viewCapture.mu.Lock()
+	viewCapture.enabled = false
+	viewName, viewData := viewCapture.name, viewCapture.data
+	viewCapture.mu.Unlock()
+
+	result := rec.Result()
+	for _, ck := range result.Cookies() {
+		if ck.MaxAge < 0 || ck.Value == "" {
+			delete(c.Cookies, ck.Name)
+		} else {
+			c.Cookies[ck.Name] = ck.Value
+		}
+	}
+
+	return &TestResponse{
+		Status:   rec.Code,
+		Headers:  rec.Header(),
+		Body:     rec.Body.String(),
+		Location: rec.Header().Get("Location"),
+		View:     viewName,
+		ViewData: viewData,
+	}
+}
+
+// JSON decodes the response body
+func (res *TestResponse) JSON() interface{} {
+	return JsonDecode(res.Body)
+}
+
+// JSONPath returns the value at a dot path of the JSON body ("data.0.id");
+// an empty path is the whole body
+func (res *TestResponse) JSONPath(path string) (interface{}, error) {
+	current := res.JSON()
+	if path == "" {
+		return current, nil
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			val, ok := node[part]
+			if !ok {
+				return nil, fmt.Errorf("la clave JSON '%s' no existe", path)
+			}
+			current = val
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("índice JSON '%s' inválido en '%s'", part, path)
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("la clave JSON '%s' no existe", path)
+		}
+	}
+	return current, nil
+}
+
+// AssertStatus checks the HTTP status code
+func (res *TestResponse) AssertStatus(code int) error {
+	if res.Status != code {
+		return fmt.Errorf("se esperaba estado %d, se obtuvo %d", code, res.Status)
+	}
+	return nil
+}
+
+// AssertOk checks for a 2xx status
+func (res *TestResponse) AssertOk() error {
+	if res.Status < 200 || res.Status >= 300 {
+		return fmt.Errorf("se esperaba estado 2xx, se obtuvo %d", res.Status)
+	}
+	return nil
+}
+
+// AssertSee checks that the body contains text
+func (res *TestResponse) AssertSee(text string) error {
+	if !strings.Contains(res.Body, text) {
+		return fmt.Errorf("no se encontró '%s' en la respuesta", text)
+	}
+	return nil
+}
+
+// AssertDontSee checks that the body does not contain text
+func (res *TestResponse) AssertDontSee(text string) error {
+	if strings.Contains(res.Body, text) {
+		return fmt.Errorf("se encontró '%s' en la respuesta", text)
+	}
+	return nil
+}
+
+// AssertRedirect checks for a 3xx response, optionally to a specific location
+func (res *TestResponse) AssertRedirect(location string) error {
+	if res.Status < 300 || res.Status >= 400 {
+		return fmt.Errorf("se esperaba una redirección, se obtuvo estado %d", res.Status)
+	}
+	if location != "" && res.Location != location {
+		return fmt.Errorf("se esperaba redirección a '%s', se obtuvo '%s'", location, res.Location)
+	}
+	return nil
+}
+
+// AssertJSON checks a value in the decoded JSON body using a dot path (e.g. "data.user.id")
+func (res *TestResponse) AssertJSON(path string, expected interface{}) error {
+	current, err := res.JSONPath(path)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprintf("%v", current) != fmt.Sprintf("%v", expected) {
+		return fmt.Errorf("JSON '%s': se esperaba %v, se obtuvo %v", path, expected, current)
+	}
+	return nil
+}
+
+// AssertViewIs checks which view was rendered
+func (res *TestResponse) AssertViewIs(name string) error {
+	if res.View != name {
+		return fmt.Errorf("se esperaba la vista '%s', se renderizó '%s'", name, res.View)
+	}
+	return nil
+}
+
+// AssertViewHas checks that the rendered view received a variable
+func (res *TestResponse) AssertViewHas(key string) error {
+	if _, ok := res.ViewData[key]; !ok {
+		return fmt.Errorf("la vista '%s' no recibió la variable '%s'", res.View, key)
+	}
+	return nil
+}
+
+// TestClient Native Class
+func (r *Runtime) executeTestClientMethod(instance *Instance, method string, args []interface{}) interface{} {
+	if instance.Fields == nil {
+		instance.Fields = make(map[string]interface{})
+	}
+	client, ok := instance.Fields["_client"].(*TestClient)
+	if !ok {
+		client = NewTestClient(nil)
+		instance.Fields["_client"] = client
+	}
+
+	argMap := func(i int) map[string]interface{} {
+		if len(args) > i {
+			if m, ok := args[i].(map[string]interface{}); ok {
+				return m
+			}
+		}
+		return map[string]interface{}{}
+	}
+
+	switch method {
+	case "get":
+		if len(args) > 0 {
+			return r.newTestResponseInstance(client.Get(fmt.Sprintf("%v", args[0])))
+		}
+	case "post", "put", "patch", "delete":
+		if len(args) > 0 {
+			return r.newTestResponseInstance(client.Form(method, fmt.Sprintf("%v", args[0]), argMap(1)))
+		}
+	case "json":
+		// $client.json("POST", "/api/items", {...})
+		if len(args) >= 2 {
+			var data interface{} = map[string]interface{}{}
+			if len(args) > 2 {
+				data = args[2]
+			}
+			return r.newTestResponseInstance(client.JSON(fmt.Sprintf("%v", args[0]), fmt.Sprintf("%v", args[1]), data))
+		}
+	case "upload":
+		// $client->upload("/avatar", "file", "me.png", $content, {...})
+		if len(args) >= 4 {
+			return r.newTestResponseInstance(client.Upload(
+				fmt.Sprintf("%v", args[0]),
+				fmt.Sprintf("%v", args[1]),
+				fmt.Sprintf("%v", args[2]),
+				[]byte(fmt.Sprintf("%v", args[3])),
+				argMap(4),
+			))
+		}
+	case "withSession":
+		client.WithSession(argMap(0))
+		return instance
+	case "withHeader":
+		if len(args) >= 2 {
+			client.Headers[fmt.Sprintf("%v", args[0])] = fmt.Sprintf("%v", args[1])
+		}
+		return instance
+	case "withCookie":
+		if len(args) >= 2 {
+			client.Cookies[fmt.Sprintf("%v", args[0])] = fmt.Sprintf("%v", args[1])
+		}
+		return instance
+	case "followRedirects":
+		client.FollowRedirects = len(args) == 0 || isTruthy(args[0])
+		return instance
+	case "session":
+		return client.Session()
+	case "csrfToken":
+		return client.CSRFToken()
+	}
+	return nil
+}
+
+func (r *Runtime) newTestResponseInstance(res *TestResponse) *Instance {
+	return &Instance{
+		Class:  r.Classes["TestResponse"],
+		Fields: map[string]interface{}{"_response": res},
+	}
+}
+
+// TestResponse Native Class
+func (r *Runtime) executeTestResponseMethod(instance *Instance, method string, args []interface{}) interface{} {
+	res, ok := instance.Fields["_response"].(*TestResponse)
+	if !ok {
+		return nil
+	}
+
+	strArg := func(i int) string {
+		if len(args) > i && args[i] != nil {
+			return fmt.Sprintf("%v", args[i])
+		}
+		return ""
+	}
+
+	// Assertions throw so they surface like any other Joss error
+	check := func(err error) interface{} {
+		if err != nil {
+			panic("Assertion Error: " + err.Error())
+		}
+		return instance
+	}
+
+	switch method {
+	case "status":
+		return int64(res.Status)
+	case "body":
+		return res.Body
+	case "header":
+		return res.Headers.Get(strArg(0))
+	case "json":
+		// $res->json("data.0.id"); a missing path returns null
+		if len(args) > 0 && args[0] != nil {
+			val, err := res.JSONPath(fmt.Sprintf("%v", args[0]))
+			if err != nil {
+				return nil
+			}
+			return val
+		}
+		return res.JSON()
+	case "view":
+		return res.View
+	case "viewData":
+		if len(args) > 0 && args[0] != nil {
+			return res.ViewData[fmt.Sprintf("%v", args[0])]
+		}
+		if res.ViewData == nil {
+			return map[string]interface{}{}
+		}
+		return res.ViewData
+	case "assertStatus":
+		if len(args) > 0 {
+			return check(res.AssertStatus(toInt(args[0])))
+		}
+	case "assertOk":
+		return check(res.AssertOk())
+	case "assertSee":
+		return check(res.AssertSee(strArg(0)))
+	case "assertDontSee":
+		return check(res.AssertDontSee(strArg(0)))
+	case "assertRedirect":
+		return check(res.AssertRedirect(strArg(0)))
+	case "assertJson":
+		if len(args) >= 2 {
+			return check(res.AssertJSON(strArg(0), args[1]))
+		}
+	case "assertViewIs":
+		return check(res.AssertViewIs(strArg(0)))
+	case "assertViewHas":
+		return check(res.AssertViewHas(strArg(0)))
+	}
+	return nil
+}
@@ -36,6 +36,7 @@ type Runtime struct {
 	Classes           map[string]*parser.ClassStatement
 	Functions         map[string]*parser.MethodStatement
 	DB                *sql.DB
+	ReadDBs           []*sql.DB // Read replicas (DB_READ_HOST) used by builder SELECTs
 	Routes            map[string]map[string]interface{} // HTTP Method -> Path -> Handler
 	CurrentMiddleware []string
 	CustomMiddlewares map[string]interface{} // Name -> Closure/Handler
@@ -45,6 +46,28 @@ type Runtime struct {
 	SEO            *SEOData
 	SitemapEntries []SitemapEntry
 	CurrentSource  string // "routes", "api", "app", etc.
+
+	// Joss call stack sampled by the profiler (nil unless profiling)
+	profile *profileStack
+
+	// Open GranDB::transaction of this runtime (nil outside transactions)
+	tx *dbTransaction
+
+	// Set while `joss migrate*` runs a migration (nil otherwise)
+	migration *migrationMode
+
+	// Queries of the current request (nil unless the query log is on)
+	queries *queryLog
+
+	// Primaries this request has written to; their reads skip the replicas
+	wrotePrimary map[*sql.DB]bool
+
+	// Named connection this runtime is bound to (nil = default, see
+	// ConnectionRuntime), the default connection when bound, and the open
+	// transactions of the other connections
+	connection  *dbConnection
+	defaultConn *dbConnection
+	connTx      map[string]*dbTransaction
 }
 
 // Instance represents an instance of a class
@@ -71,6 +71,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 				}
 			}
 			fmt.Printf("[View] Rendering %s with data: %v\n", viewName, data)
+			recordRenderedView(viewName, data)
 
 			// Inject Global Auth Variables
 			data["auth_check"] = false
@@ -127,6 +128,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 
 			var content []byte
 			var err error
+			var viewFile string
 
 			if GlobalFileSystem != nil {
 				// VFS Mode
@@ -151,6 +153,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 						return fmt.Sprintf("Error: Vista '%s' no encontrada (VFS)", viewName)
 					}
 				}
+				viewFile = pathStr
 			} else {
 				// Disk Mode
 				path := filepath.Join("app", "views", viewPath+".joss.html")
@@ -162,15 +165,16 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 						return fmt.Sprintf("Error: Vista '%s' no encontrada", viewName)
 					}
 				}
+				viewFile = path
 			}
 
-			viewContent := string(content)
+			viewContent := markViewSource(string(content), viewFile)
 
 			// 2. Handle Inheritance (@extends)
 			var layoutContent string
 			sections := make(map[string]string)
 
-			if strings.HasPrefix(strings.TrimSpace(viewContent), "@extends") {
+			if strings.HasPrefix(strings.TrimSpace(stripViewMarkers(viewContent)), "@extends") {
 				// Extract layout name
 				// Support both ' and " quotes
 				reExtends := regexp.MustCompile(`@extends\s*\(\s*['"]([^'"]+)['"]\s*\)`)
@@ -188,7 +192,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 							lContent := make([]byte, stat.Size())
 							f.Read(lContent)
 							f.Close()
-							layoutContent = string(lContent)
+							layoutContent = markViewSource(string(lContent), lPath)
 						} else {
 							// Try .html
 							lPath = path.Join("app", "views", layoutPath+".html")
@@ -198,7 +202,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 								lContent := make([]byte, stat.Size())
 								f.Read(lContent)
 								f.Close()
-								layoutContent = string(lContent)
+								layoutContent = markViewSource(string(lContent), lPath)
 							} else {
 								return fmt.Sprintf("Error: Layout '%s' no encontrado (VFS)", layoutName)
 							}
@@ -208,13 +212,13 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 						lPath := filepath.Join("app", "views", layoutPath+".joss.html")
 						lContent, err := os.ReadFile(lPath)
 						if err == nil {
-							layoutContent = string(lContent)
+							layoutContent = markViewSource(string(lContent), lPath)
 						} else {
 							// Try .html
 							lPath = filepath.Join("app", "views", layoutPath+".html")
 							lContent, err = os.ReadFile(lPath)
 							if err == nil {
-								layoutContent = string(lContent)
+								layoutContent = markViewSource(string(lContent), lPath)
 							} else {
 								return fmt.Sprintf("Error: Layout '%s' no encontrado", layoutName)
 							}
@@ -272,7 +276,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 						c := make([]byte, stat.Size())
 						f.Read(c)
 						f.Close()
-						includeContent = c
+						includeContent = []byte(markViewSource(string(c), iPath))
 					} else {
 						// Try .html
 						iPath = path.Join("app", "views", includePath+".html")
@@ -282,7 +286,7 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 							c := make([]byte, stat.Size())
 							f.Read(c)
 							f.Close()
-							includeContent = c
+							includeContent = []byte(markViewSource(string(c), iPath))
 						} else {
 							includeContent = []byte(fmt.Sprintf("<!-- Error: Include '%s' not found -->", includeName))
 						}
@@ -292,12 +296,12 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 					iPath := filepath.Join("app", "views", includePath+".joss.html")
 					c, err := os.ReadFile(iPath)
 					if err == nil {
-						includeContent = c
+						includeContent = []byte(markViewSource(string(c), iPath))
 					} else {
 						iPath = filepath.Join("app", "views", includePath+".html")
 						c, err := os.ReadFile(iPath)
 						if err == nil {
-							includeContent = c
+							includeContent = []byte(markViewSource(string(c), iPath))
 						} else {
 							includeContent = []byte(fmt.Sprintf("<!-- Error: Include '%s' not found -->", includeName))
 						}
@@ -307,6 +311,10 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 				finalHtml = strings.Replace(finalHtml, fullMatch, string(includeContent), 1)
 			}
 
+			// @pagination($items) renders the links of a paginate() result
+			rePagination := regexp.MustCompile(`@pagination\s*\(\s*([^)]+?)\s*\)`)
+			finalHtml = rePagination.ReplaceAllString(finalHtml, `{{! pagination_links($1) }}`)
+
 			// Pre-process csrf_field() to be raw output
 			reCsrfPre := regexp.MustCompile(`\{\{\s*csrf_field\(\)\s*\}\}`)
 			finalHtml = reCsrfPre.ReplaceAllString(finalHtml, `{{! csrf_field() }}`)
@@ -331,6 +339,13 @@ func (r *Runtime) executeViewMethod(instance *Instance, method string, args []in
 				r.Variables[k] = v
 			}
 
+			// Queries run by the view are reported against the view file
+			if r.queries != nil {
+				p := activeProfiler.Load()
+				r.profileEnter(p, profileFrame{Name: "view " + viewName, File: viewFile})
+				defer r.profileLeave(p)
+			}
+
 			var result interface{}
 			func() {
 				defer func() {
@@ -400,7 +415,24 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 	reExprRaw := regexp.MustCompile(`^\{\{!(.*?)\}\}`)
 	reExprEscaped := regexp.MustCompile(`^\{\{(.*?)\}\}`)
 
+	// Coverage: directives emit a hit for the view line they came from
+	cov := activeCoverage.Load()
+	// coverHit returns the "file:line" it counted, skipping a line already counted by the caller
+	coverHit := func(code *strings.Builder, str string, i int, skip string) string {
+		if cov == nil {
+			return ""
+		}
+		file, line, ok := viewMarkerAt(str, i)
+		if !ok || fmt.Sprintf("%s:%d", file, line) == skip {
+			return skip
+		}
+		cov.DeclareLine(file, line)
+		code.WriteString(fmt.Sprintf("__coverage_hit(\"%s\", %d);\n", escapeJossString(file), line))
+		return fmt.Sprintf("%s:%d", file, line)
+	}
+
 	translateExpr := func(expr string) string {
+		expr = stripViewMarkers(expr)
 		reDot := regexp.MustCompile(`\$([a-zA-Z0-9_]+)\.([a-zA-Z0-9_]+)`)
 		for reDot.MatchString(expr) {
 			expr = reDot.ReplaceAllString(expr, "$$$1->$2")
@@ -418,7 +450,7 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 			if start >= end {
 				return
 			}
-			txt := str[start:end]
+			txt := stripViewMarkers(str[start:end])
 			code.WriteString(fmt.Sprintf("$__output = $__output . \"%s\";\n", escapeJossString(txt)))
 		}
 
@@ -455,6 +487,7 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 					
 					if endIdx != -1 {
 						body := str[i+fullMatchLen : endIdx]
+						coverHit(&code, str, i, "")
 						code.WriteString(fmt.Sprintf("foreach ($%s as $%s) {\n", listVar, itemVar))
 						code.WriteString(compileRange(body))
 						code.WriteString("}\n")
@@ -466,6 +499,57 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 				}
 			}
 
+			// 1b. Check @can('perm') ... @else ... @endcan (and @cannot ... @endcannot)
+			if strings.HasPrefix(str[i:], "@can(") || strings.HasPrefix(str[i:], "@cannot(") {
+				directive := "can"
+				if strings.HasPrefix(str[i:], "@cannot(") {
+					directive = "cannot"
+				}
+				argsEnd := findMatchingPair(str, i+len(directive)+1, '(', ')')
+				if argsEnd != -1 {
+					depth := 1
+					elseIdx, endIdx, endLen := -1, -1, 0
+					for j := argsEnd + 1; j < n && endIdx == -1; j++ {
+						rest := str[j:]
+						switch {
+						case strings.HasPrefix(rest, "@can(") || strings.HasPrefix(rest, "@cannot("):
+							depth++
+						case strings.HasPrefix(rest, "@endcannot") || strings.HasPrefix(rest, "@endcan"):
+							depth--
+							if depth == 0 {
+								endIdx = j
+								endLen = len("@endcan")
+								if strings.HasPrefix(rest, "@endcannot") {
+									endLen = len("@endcannot")
+								}
+							}
+						case depth == 1 && elseIdx == -1 && strings.HasPrefix(rest, "@else"):
+							elseIdx = j
+						}
+					}
+
+					if endIdx != -1 {
+						flushText(lastIdx, i)
+						trueBody := str[argsEnd+1 : endIdx]
+						falseBody := ""
+						if elseIdx != -1 {
+							trueBody = str[argsEnd+1 : elseIdx]
+							falseBody = str[elseIdx+len("@else") : endIdx]
+						}
+						coverHit(&code, str, i, "")
+						code.WriteString(fmt.Sprintf("(Auth::%s(%s)) ? {\n", directive, translateExpr(str[i+len(directive)+2:argsEnd])))
+						code.WriteString(compileRange(trueBody))
+						code.WriteString("} : {\n")
+						code.WriteString(compileRange(falseBody))
+						code.WriteString("};\n")
+
+						i = endIdx + endLen
+						lastIdx = i
+						continue
+					}
+				}
+			}
+
 			// 2. Check Block Ternary
 			if i+4 < n && str[i] == '{' && str[i+1] == '{' {
 				k := i + 2
@@ -511,9 +595,12 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 													trueBody := str[tbStart+1 : tbEnd]
 													falseBody := str[fbStart+1 : fbEnd]
 													
+													ternaryLine := coverHit(&code, str, i, "")
 													code.WriteString(fmt.Sprintf("(%s) ? {\n", translateExpr(condExpr)))
+													coverHit(&code, str, tbStart+1, ternaryLine)
 													code.WriteString(compileRange(trueBody))
 													code.WriteString("} : {\n")
+													coverHit(&code, str, fbStart+1, ternaryLine)
 													code.WriteString(compileRange(falseBody))
 													code.WriteString("};\n")
 													
@@ -539,6 +626,7 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 					expr := strings.TrimSpace(m[1])
 					fullMatchLen := len(m[0])
 					
+					coverHit(&code, str, i, "")
 					code.WriteString(fmt.Sprintf("$__output = $__output . (%s);\n", translateExpr(expr)))
 					
 					i += fullMatchLen
@@ -555,6 +643,7 @@ func compileViewToJOSS(htmlStr string) (string, error) {
 					expr := strings.TrimSpace(m[1])
 					fullMatchLen := len(m[0])
 					
+					coverHit(&code, str, i, "")
 					code.WriteString(fmt.Sprintf("$__output = $__output . html_escape(%s);\n", translateExpr(expr)))
 					
 					i += fullMatchLen
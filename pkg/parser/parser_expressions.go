@@ -365,7 +365,7 @@ func isBlueprintMethod(name string) bool {
 	case "id", "string", "text", "integer", "tinyInteger", "smallInteger", "mediumInteger", "bigInteger",
 		"unsignedInteger", "unsignedBigInteger", "float", "double", "decimal", "char", "mediumText",
 		"longText", "date", "dateTime", "time", "timestamp", "timestamps", "softDeletes", "boolean",
-		"json", "enum", "increments", "bigIncrements", "unique", "nullable", "unsigned", "default",
+		"json", "enum", "increments", "bigIncrements", "mediumIncrements", "smallIncrements", "unique", "nullable", "unsigned", "default",
 		"comment", "foreign", "references", "on", "onDelete", "onUpdate", "dropColumn":
 		return true
 	}
@@ -531,7 +531,10 @@ func (p *Parser) parseNewExpression() Expression {
 func (p *Parser) parseMemberExpression(left Expression) Expression {
 	exp := &MemberExpression{Token: p.curToken, Left: left}
 
-	if !p.expectPeek(IDENT) {
+	// Keywords are valid member names (Router::match, Str::match)
+	if _, isKeyword := keywords[p.peekToken.Literal]; isKeyword {
+		p.nextToken()
+	} else if !p.expectPeek(IDENT) {
 		return nil
 	}
 	exp.Property = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
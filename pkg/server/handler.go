@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -94,32 +95,29 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. Rate Limiting (60 req/min)
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip == "" {
-		ip = strings.Split(r.RemoteAddr, ":")[0]
-	} else {
-		// XFF can be "client, proxy1, proxy2"
-		ip = strings.TrimSpace(strings.Split(ip, ",")[0])
-	}
-
-	rateLimitMu.Lock()
-	entry, exists := rateLimitStore[ip]
-	if !exists {
-		entry = &rateLimitEntry{count: 0, lastTime: time.Now()}
-		rateLimitStore[ip] = entry
-	}
-	if time.Since(entry.lastTime) > time.Minute {
-		entry.count = 0
-		entry.lastTime = time.Now()
-	}
-	entry.count++
-	if entry.count > 60 {
+	ip := clientIP(r, rt.Env["TRUSTED_PROXIES"])
+
+	// In-process test clients share one synthetic address, so they skip the limiter
+	if !testMode {
+		rateLimitMu.Lock()
+		entry, exists := rateLimitStore[ip]
+		if !exists {
+			entry = &rateLimitEntry{count: 0, lastTime: time.Now()}
+			rateLimitStore[ip] = entry
+		}
+		if time.Since(entry.lastTime) > time.Minute {
+			entry.count = 0
+			entry.lastTime = time.Now()
+		}
+		entry.count++
+		if entry.count > 60 {
+			rateLimitMu.Unlock()
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, "<h1>429 Too Many Requests</h1>")
+			return
+		}
 		rateLimitMu.Unlock()
-		w.WriteHeader(http.StatusTooManyRequests)
-		fmt.Fprintf(w, "<h1>429 Too Many Requests</h1>")
-		return
 	}
-	rateLimitMu.Unlock()
 
 	// Panic Recovery
 	defer func() {
@@ -345,6 +343,9 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 
 	reqData["_host"] = host
 	reqData["_scheme"] = scheme
+	reqData["_path"] = r.URL.Path
+	reqData["_query"] = r.URL.RawQuery
+	reqData["_ip"] = ip
 
 	// 4. Session Management
 	sessionID := ""
@@ -467,7 +468,13 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 7. Dispatch
 	// fmt.Printf("[DEBUG] Dispatching %s %s\n", r.Method, r.URL.Path)
+	// Query log, slow queries, N+1 warnings and debug toolbar (DB_QUERY_LOG, DB_SLOW_QUERY_MS, DB_N1_THRESHOLD, DEBUG_TOOLBAR)
+	queryLog := rt.StartQueryLog()
 	result, err := rt.Dispatch(r.Method, r.URL.Path, reqData, sessData)
+	var queries []core.QueryEntry
+	if queryLog {
+		queries = rt.FinishQueryLog(requestID)
+	}
 
 	// 8. Save Session
 	if rt.Env["SESSION_DRIVER"] == "redis" {
@@ -720,6 +727,10 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			}
 
+			if queryLog && core.DebugToolbarEnabled(rt.Env) && strings.Contains(w.Header().Get("Content-Type"), "text/html") {
+				str = core.InjectToolbar(str, rt.DebugToolbar(requestID, queries, time.Since(requestStartTime)))
+			}
+
 			w.Write([]byte(str))
 
 			// Hot Reload Script (ONLY for HTML)
@@ -780,6 +791,69 @@ func generateSessionID() string {
 	return hex.EncodeToString(b)
 }
 
+// clientIP is the address of the client. X-Forwarded-For is only honored
+// when the connection comes from a proxy listed in trusted (comma-separated
+// IPs or CIDRs); the chain is then read right to left up to the first
+// address that is not a trusted proxy.
+func clientIP(r *http.Request, trusted string) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	proxies := parseTrustedProxies(trusted)
+	if len(proxies) == 0 || !isTrustedProxy(ip, proxies) {
+		return ip
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop, proxies) {
+			break
+		}
+	}
+	return ip
+}
+
+func parseTrustedProxies(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+		} else {
+			core.LogWarning("[Security] TRUSTED_PROXIES: entrada inválida '%s'", entry)
+		}
+	}
+	return nets
+}
+
+func isTrustedProxy(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
 // resolveRedirectStatus returns the HTTP status code from a WebResponse instance,
 // falling back to 302 (Found) if not explicitly set.
 func resolveRedirectStatus(inst *core.Instance) int {
@@ -247,6 +247,7 @@ func reloadApp(changedFile string) {
 					fmt.Printf("\t%s\n", msg)
 				}
 			}
+			core.RegisterSource(program, path)
 			currentRuntime.Execute(program)
 		} else {
 			fmt.Printf("[DEBUG] Error reading %s: %v\n", path, err)
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/jossecurity/joss/pkg/core"
@@ -20,6 +23,10 @@ var (
 
 func init() {
 	core.ServerStartCallback = Start
+	core.TestHandler = http.HandlerFunc(MainHandler)
+	core.TestBootCallback = BootForTests
+	core.SessionSeedCallback = seedSession
+	core.SessionReadCallback = readSession
 }
 
 // Start initializes and starts the Joss HTTP server with Hot Reload
@@ -31,6 +38,11 @@ func Start(fileSystem http.FileSystem) {
 	// Initial Load
 	reloadApp("")
 
+	// Joss-level profiler (JOSS_PROFILE=1 or a base path); written on shutdown
+	if output := core.ProfileOutput(currentRuntime.Env); output != "" && core.ActiveProfiler() == nil {
+		core.StartProfiler(output, core.ProfileRate(currentRuntime.Env))
+	}
+
 	// Start File Watcher
 	go watchChanges()
 
@@ -110,8 +122,21 @@ func Start(fileSystem http.FileSystem) {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Graceful shutdown: finish in-flight requests, then write the profile
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		fmt.Println("\nDeteniendo servidor...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
 	fmt.Printf("Iniciando servidor JosSecurity en http://localhost:%s\n", port)
-	if err := srv.ListenAndServe(); err != nil {
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		fmt.Printf("Error iniciando servidor: %v\n", err)
 	}
+	signal.Stop(stop)
+	core.FlushProfiler()
 }
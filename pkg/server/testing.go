@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jossecurity/joss/pkg/core"
+)
+
+// testMode is enabled by the in-process test client (disables rate limiting)
+var testMode bool
+
+// NewTestClient boots the application and returns a client bound to MainHandler.
+// Usage (Go): res := server.NewTestClient().Get("/"); if err := res.AssertOk(); err != nil { t.Fatal(err) }
+func NewTestClient() *core.TestClient {
+	BootForTests()
+	return core.NewTestClient(http.HandlerFunc(MainHandler))
+}
+
+// BootForTests loads app/, routes.joss and api.joss without starting the listener or file watcher
+func BootForTests() {
+	testMode = true
+
+	mutex.RLock()
+	loaded := currentRuntime != nil
+	mutex.RUnlock()
+
+	if !loaded {
+		reloadApp("")
+	}
+}
+
+// UseRuntime installs a prepared runtime as the one forked by MainHandler on each request
+func UseRuntime(rt *core.Runtime) {
+	testMode = true
+	mutex.Lock()
+	currentRuntime = rt
+	mutex.Unlock()
+}
+
+func usesRedisSessions() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return currentRuntime != nil && currentRuntime.Env["SESSION_DRIVER"] == "redis" && core.GlobalRedis != nil
+}
+
+// seedSession merges data into a stored session (used by TestClient.WithSession)
+func seedSession(sessionID string, data map[string]interface{}) {
+	if usesRedisSessions() {
+		sess := readSession(sessionID)
+		for k, v := range data {
+			sess[k] = v
+		}
+		encoded, _ := json.Marshal(sess)
+		core.GlobalRedis.Set(core.Ctx, "session:"+sessionID, encoded, 24*time.Hour)
+		return
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if _, ok := sessionStore[sessionID]; !ok {
+		sessionStore[sessionID] = make(map[string]interface{})
+	}
+	for k, v := range data {
+		sessionStore[sessionID][k] = v
+	}
+}
+
+// readSession returns a copy of a stored session
+func readSession(sessionID string) map[string]interface{} {
+	sess := make(map[string]interface{})
+	if usesRedisSessions() {
+		val, err := core.GlobalRedis.Get(core.Ctx, "session:"+sessionID).Result()
+		if err == nil {
+			json.Unmarshal([]byte(val), &sess)
+		}
+		return sess
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	for k, v := range sessionStore[sessionID] {
+		sess[k] = v
+	}
+	return sess
+}